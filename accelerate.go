@@ -0,0 +1,43 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// checkAccelerate checks that transfer acceleration is enabled on the buckets
+// of the s3 urls, before transferring through their accelerate endpoints
+// with --accelerate, which would otherwise fail key by key.
+func checkAccelerate(ctx context.Context, conn S3API, urls []string) error {
+	checked := map[string]bool{}
+	for _, url := range urls {
+		if !isS3Url(url) {
+			continue
+		}
+		bucket, _ := extractBucketPath(url)
+		if checked[bucket] {
+			continue
+		}
+		checked[bucket] = true
+		output, err := conn.GetBucketAccelerateConfiguration(ctx, &s3.GetBucketAccelerateConfigurationInput{
+			Bucket: aws.String(bucket),
+		}, withoutAccelerate)
+		if err != nil {
+			return fmt.Errorf("--accelerate: can't check transfer acceleration of bucket %s: %s", bucket, err)
+		}
+		if output.Status != types.BucketAccelerateStatusEnabled {
+			return fmt.Errorf("--accelerate: transfer acceleration isn't enabled on bucket %s, enable it with: aws s3api put-bucket-accelerate-configuration --bucket %s --accelerate-configuration Status=Enabled", bucket, bucket)
+		}
+	}
+	return nil
+}
+
+// withoutAccelerate sends a request to the bucket's usual endpoint, even from
+// a client using its accelerate endpoint.
+func withoutAccelerate(o *s3.Options) {
+	o.UseAccelerate = false
+}
@@ -0,0 +1,109 @@
+package s3
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	adaptiveMaxParallel = 256
+	adaptiveInterval    = time.Second
+)
+
+// adaptiveLimiter bounds the number of concurrent operations, raising the
+// limit while throughput keeps improving and halving it when S3 asks us to
+// slow down.
+type adaptiveLimiter struct {
+	sync.Mutex
+	cond      *sync.Cond
+	limit     int
+	max       int
+	active    int
+	completed int // operations completed in the current interval
+	lastRate  float64
+	throttled bool
+}
+
+func newAdaptiveLimiter(initial, max int) *adaptiveLimiter {
+	if initial < 1 {
+		initial = 1
+	}
+	if initial > max {
+		initial = max
+	}
+	l := &adaptiveLimiter{limit: initial, max: max}
+	l.cond = sync.NewCond(&l.Mutex)
+	return l
+}
+
+func (l *adaptiveLimiter) acquire() {
+	l.Lock()
+	defer l.Unlock()
+	for l.active >= l.limit {
+		l.cond.Wait()
+	}
+	l.active += 1
+}
+
+func (l *adaptiveLimiter) release(err error) {
+	l.Lock()
+	defer l.Unlock()
+	l.active -= 1
+	l.completed += 1
+	if isErrorThrottle(err) && !l.throttled {
+		// back off immediately rather than waiting for the next interval
+		l.throttled = true
+		l.limit = maxInt(1, l.limit/2)
+	}
+	l.cond.Broadcast()
+}
+
+// adjust tunes the limit from the throughput observed over elapsed.
+func (l *adaptiveLimiter) adjust(elapsed time.Duration) {
+	l.Lock()
+	defer l.Unlock()
+	rate := float64(l.completed) / elapsed.Seconds()
+	switch {
+	case l.throttled:
+		// already halved, hold for one interval
+	case rate < l.lastRate*0.9:
+		// got worse, ease off
+		l.limit -= maxInt(1, l.limit/4)
+	case l.active >= l.limit:
+		// saturated and not getting worse, try more
+		l.limit += maxInt(1, l.limit/4)
+	}
+	if l.limit < 1 {
+		l.limit = 1
+	}
+	if l.limit > l.max {
+		l.limit = l.max
+	}
+	l.lastRate = rate
+	l.completed = 0
+	l.throttled = false
+	l.cond.Broadcast()
+}
+
+// run adjusts the limit periodically until stop is closed.
+func (l *adaptiveLimiter) run(stop <-chan struct{}) {
+	ticker := time.NewTicker(adaptiveInterval)
+	defer ticker.Stop()
+	last := time.Now()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			l.adjust(now.Sub(last))
+			last = now
+		}
+	}
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
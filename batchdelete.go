@@ -0,0 +1,86 @@
+package s3
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// deleteBatchSize is the most keys DeleteObjects removes in one request.
+const deleteBatchSize = 1000
+
+// batchDeleter removes keys with DeleteObjects, buffering them into requests
+// of up to deleteBatchSize keys of one bucket, in place of a DeleteObject
+// request per key.
+type batchDeleter struct {
+	ctx    context.Context
+	conn   S3API
+	bucket string
+	keys   []types.ObjectIdentifier
+	files  map[string]File // by key, of those buffered
+	// called with each file S3 fails to delete, returning an error to stop
+	failed func(file File, err error) error
+	// delete versions under governance mode retention
+	bypassGovernance bool
+}
+
+func newBatchDeleter(ctx context.Context, conn S3API, failed func(file File, err error) error) *batchDeleter {
+	return &batchDeleter{ctx: ctx, conn: conn, files: map[string]File{}, failed: failed}
+}
+
+// add buffers file, the key in bucket, for deletion, sending the buffered
+// keys once a batch is full or the bucket changes.
+func (bd *batchDeleter) add(bucket, key string, file File) error {
+	if bucket != bd.bucket {
+		if err := bd.flush(); err != nil {
+			return err
+		}
+		bd.bucket = bucket
+	}
+	bd.keys = append(bd.keys, types.ObjectIdentifier{Key: aws.String(key)})
+	bd.files[key] = file
+	if len(bd.keys) == deleteBatchSize {
+		return bd.flush()
+	}
+	return nil
+}
+
+// flush deletes the buffered keys, passing those S3 reports it couldn't
+// delete to failed.
+func (bd *batchDeleter) flush() error {
+	if len(bd.keys) == 0 {
+		return nil
+	}
+	files := bd.files
+	input := s3.DeleteObjectsInput{
+		Bucket: aws.String(bd.bucket),
+		Delete: &types.Delete{
+			Objects: bd.keys,
+			// only the keys that failed are listed
+			Quiet: aws.Bool(true),
+		},
+	}
+	if bd.bypassGovernance {
+		input.BypassGovernanceRetention = aws.Bool(true)
+	}
+	output, err := bd.conn.DeleteObjects(bd.ctx, &input)
+	bd.keys = nil
+	bd.files = map[string]File{}
+	if err != nil {
+		return err
+	}
+	for _, e := range output.Errors {
+		file, ok := files[aws.ToString(e.Key)]
+		if !ok {
+			continue
+		}
+		err := bd.failed(file, &smithy.GenericAPIError{Code: aws.ToString(e.Code), Message: aws.ToString(e.Message)})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// bucketName accepts either a bare bucket name or an s3://bucket/ url.
+func bucketName(arg string) string {
+	if isS3Url(arg) {
+		bucket, _ := extractBucketPath(arg)
+		return bucket
+	}
+	return strings.TrimSuffix(arg, "/")
+}
+
+// isAWSErrorCode reports whether err is an aws error with the given code.
+func isAWSErrorCode(err error, code string) bool {
+	var aerr smithy.APIError
+	return errors.As(err, &aerr) && aerr.ErrorCode() == code
+}
+
+// BucketEncryptionOptions configure RunSetBucketEncryption.
+type BucketEncryptionOptions struct {
+	Algorithm string // AES256 or aws:kms
+	KMSKeyID  string // kms key for aws:kms, defaults to the aws managed key
+	BucketKey bool   // use an s3 bucket key to reduce kms requests
+}
+
+// RunGetBucketEncryption prints the default encryption of each bucket.
+func RunGetBucketEncryption(ctx context.Context, conn S3API, buckets []string) error {
+	for _, arg := range buckets {
+		bucket := bucketName(arg)
+		output, err := conn.GetBucketEncryption(ctx, &s3.GetBucketEncryptionInput{
+			Bucket: aws.String(bucket),
+		})
+		if isAWSErrorCode(err, "ServerSideEncryptionConfigurationNotFoundError") {
+			fmt.Fprintf(outOf(ctx), "s3://%s/: none\n", bucket)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for _, rule := range output.ServerSideEncryptionConfiguration.Rules {
+			sse := rule.ApplyServerSideEncryptionByDefault
+			if sse == nil {
+				continue
+			}
+			line := fmt.Sprintf("s3://%s/: %s", bucket, sse.SSEAlgorithm)
+			if sse.KMSMasterKeyID != nil {
+				line += " key " + *sse.KMSMasterKeyID
+			}
+			if aws.ToBool(rule.BucketKeyEnabled) {
+				line += " (bucket key)"
+			}
+			fmt.Fprintln(outOf(ctx), line)
+		}
+	}
+	return nil
+}
+
+// RunSetBucketEncryption sets the default encryption of each bucket.
+func RunSetBucketEncryption(ctx context.Context, conn S3API, buckets []string, opts BucketEncryptionOptions) error {
+	rule, err := opts.rule()
+	if err != nil {
+		return err
+	}
+	for _, arg := range buckets {
+		_, err := conn.PutBucketEncryption(ctx, &s3.PutBucketEncryptionInput{
+			Bucket: aws.String(bucketName(arg)),
+			ServerSideEncryptionConfiguration: &types.ServerSideEncryptionConfiguration{
+				Rules: []types.ServerSideEncryptionRule{*rule},
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sseAlgorithm normalises the spelling of an encryption algorithm.
+// rule returns the encryption rule opts configure.
+func (opts BucketEncryptionOptions) rule() (*types.ServerSideEncryptionRule, error) {
+	algorithm, err := sseAlgorithm(opts.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	sse := &types.ServerSideEncryptionByDefault{SSEAlgorithm: types.ServerSideEncryption(algorithm)}
+	if opts.KMSKeyID != "" {
+		if algorithm != string(types.ServerSideEncryptionAwsKms) {
+			return nil, fmt.Errorf("a kms key id requires aws:kms encryption")
+		}
+		sse.KMSMasterKeyID = aws.String(opts.KMSKeyID)
+	}
+	rule := &types.ServerSideEncryptionRule{ApplyServerSideEncryptionByDefault: sse}
+	if opts.BucketKey {
+		rule.BucketKeyEnabled = aws.Bool(true)
+	}
+	return rule, nil
+}
+
+func sseAlgorithm(name string) (string, error) {
+	switch strings.ToLower(name) {
+	case "aes256", "sse-s3":
+		return string(types.ServerSideEncryptionAes256), nil
+	case "aws:kms", "kms", "sse-kms":
+		return string(types.ServerSideEncryptionAwsKms), nil
+	}
+	return "", fmt.Errorf("unknown encryption %q: use aes256 or aws:kms", name)
+}
+
+// PublicAccessBlockOptions configure RunSetPublicAccessBlock.
+type PublicAccessBlockOptions struct {
+	BlockPublicAcls       bool
+	IgnorePublicAcls      bool
+	BlockPublicPolicy     bool
+	RestrictPublicBuckets bool
+}
+
+// RunGetPublicAccessBlock prints the public access block of each bucket.
+func RunGetPublicAccessBlock(ctx context.Context, conn S3API, buckets []string) error {
+	for _, arg := range buckets {
+		bucket := bucketName(arg)
+		output, err := conn.GetPublicAccessBlock(ctx, &s3.GetPublicAccessBlockInput{
+			Bucket: aws.String(bucket),
+		})
+		if isAWSErrorCode(err, "NoSuchPublicAccessBlockConfiguration") {
+			fmt.Fprintf(outOf(ctx), "s3://%s/: none\n", bucket)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		config := output.PublicAccessBlockConfiguration
+		fmt.Fprintf(outOf(ctx), "s3://%s/: block-public-acls=%t ignore-public-acls=%t block-public-policy=%t restrict-public-buckets=%t\n",
+			bucket,
+			aws.ToBool(config.BlockPublicAcls),
+			aws.ToBool(config.IgnorePublicAcls),
+			aws.ToBool(config.BlockPublicPolicy),
+			aws.ToBool(config.RestrictPublicBuckets))
+	}
+	return nil
+}
+
+// RunSetPublicAccessBlock sets the public access block of each bucket.
+func RunSetPublicAccessBlock(ctx context.Context, conn S3API, buckets []string, opts PublicAccessBlockOptions) error {
+	for _, arg := range buckets {
+		_, err := conn.PutPublicAccessBlock(ctx, &s3.PutPublicAccessBlockInput{
+			Bucket: aws.String(bucketName(arg)),
+			PublicAccessBlockConfiguration: &types.PublicAccessBlockConfiguration{
+				BlockPublicAcls:       aws.Bool(opts.BlockPublicAcls),
+				IgnorePublicAcls:      aws.Bool(opts.IgnorePublicAcls),
+				BlockPublicPolicy:     aws.Bool(opts.BlockPublicPolicy),
+				RestrictPublicBuckets: aws.Bool(opts.RestrictPublicBuckets),
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseTags parses key=value tags.
+func ParseTags(values []string) ([]types.Tag, error) {
+	var tags []types.Tag
+	for _, value := range values {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid tag %q: expected key=value", value)
+		}
+		tags = append(tags, types.Tag{Key: aws.String(parts[0]), Value: aws.String(parts[1])})
+	}
+	return tags, nil
+}
+
+// ParseTagging parses comma separated key=value object tags, returning them
+// url encoded as uploads take them.
+func ParseTagging(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	tags, err := ParseTags(strings.Split(value, ","))
+	if err != nil {
+		return "", err
+	}
+	pairs := make([]string, len(tags))
+	for i, tag := range tags {
+		pairs[i] = url.QueryEscape(aws.ToString(tag.Key)) + "=" + url.QueryEscape(aws.ToString(tag.Value))
+	}
+	return strings.Join(pairs, "&"), nil
+}
+
+// formatTags returns tags as key=value pairs, sorted by key.
+func formatTags(tags []types.Tag) string {
+	pairs := make([]string, len(tags))
+	for i, tag := range tags {
+		pairs[i] = aws.ToString(tag.Key) + "=" + aws.ToString(tag.Value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, " ")
+}
+
+// RunGetBucketTagging prints the tags of each bucket.
+func RunGetBucketTagging(ctx context.Context, conn S3API, buckets []string) error {
+	for _, arg := range buckets {
+		bucket := bucketName(arg)
+		output, err := conn.GetBucketTagging(ctx, &s3.GetBucketTaggingInput{
+			Bucket: aws.String(bucket),
+		})
+		if isAWSErrorCode(err, "NoSuchTagSet") {
+			fmt.Fprintf(outOf(ctx), "s3://%s/: none\n", bucket)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(outOf(ctx), "s3://%s/: %s\n", bucket, formatTags(output.TagSet))
+	}
+	return nil
+}
+
+// RunSetBucketTagging replaces the tags of each bucket, such as with cost
+// allocation tags.
+func RunSetBucketTagging(ctx context.Context, conn S3API, buckets []string, tags []types.Tag) error {
+	if len(tags) == 0 {
+		return fmt.Errorf("at least one --tag is required")
+	}
+	for _, arg := range buckets {
+		_, err := conn.PutBucketTagging(ctx, &s3.PutBucketTaggingInput{
+			Bucket:  aws.String(bucketName(arg)),
+			Tagging: &types.Tagging{TagSet: tags},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
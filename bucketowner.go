@@ -0,0 +1,60 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/smithy-go/middleware"
+)
+
+var accountIDPattern = regexp.MustCompile(`^\d{12}$`)
+
+// ParseExpectedBucketOwner checks id is an aws account id, if given.
+func ParseExpectedBucketOwner(id string) (string, error) {
+	if id != "" && !accountIDPattern.MatchString(id) {
+		return "", fmt.Errorf("--expected-bucket-owner must be a 12 digit account id, not %q", id)
+	}
+	return id, nil
+}
+
+// writeOperations prefix the names of operations that write or delete, and
+// so are refused when the bucket has an unexpected owner.
+var writeOperations = []string{"Put", "Delete", "Copy", "Create", "UploadPart", "Complete", "Abort", "Restore"}
+
+// expectedOwner is the account that must own the buckets written to, so a
+// mistyped bucket name belonging to someone else fails rather than being
+// written to.
+type expectedOwner string
+
+// install adds the middleware setting ExpectedBucketOwner on write and
+// delete requests made through a client.
+func (o expectedOwner) install(stack *middleware.Stack) error {
+	owner := middleware.InitializeMiddlewareFunc("s3.ExpectedBucketOwner", func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+		for _, prefix := range writeOperations {
+			if strings.HasPrefix(middleware.GetOperationName(ctx), prefix) {
+				setExpectedBucketOwner(in.Parameters, string(o))
+				break
+			}
+		}
+		return next.HandleInitialize(ctx, in)
+	})
+	// first, so the owner is set before the input is validated
+	return stack.Initialize.Add(owner, middleware.Before)
+}
+
+// setExpectedBucketOwner sets the ExpectedBucketOwner field of an
+// operation's input, where it has one and it isn't already set.
+func setExpectedBucketOwner(params interface{}, owner string) {
+	v := reflect.ValueOf(params)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return
+	}
+	field := v.Elem().FieldByName("ExpectedBucketOwner")
+	if field.IsValid() && field.IsNil() {
+		field.Set(reflect.ValueOf(aws.String(owner)))
+	}
+}
@@ -0,0 +1,122 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+var reByteRange = regexp.MustCompile(`^(?:bytes=)?(\d*)-(\d*)$`)
+
+// ByteRange selects the bytes of an object read, as an http Range does.
+type ByteRange struct {
+	Start int64 // first byte, unless a suffix
+	End   int64 // last byte, inclusive, or -1 for the end of the object
+	// the last this many bytes, in place of Start and End, if set
+	Suffix int64
+}
+
+// ParseByteRange parses a --range such as bytes=0-1023, 1024- or -100 (the
+// last 100 bytes), or failing that an --offset and --length, the length
+// zero for the rest of the object. It returns nil when neither is given.
+func ParseByteRange(value string, offset, length int64) (*ByteRange, error) {
+	if value != "" {
+		if offset != 0 || length != 0 {
+			return nil, errors.New("--range can't be given with --offset or --length")
+		}
+		m := reByteRange.FindStringSubmatch(value)
+		if m == nil || (m[1] == "" && m[2] == "") {
+			return nil, fmt.Errorf("invalid --range %q: expected bytes=start-end, start- or -suffix", value)
+		}
+		// -1 where blank, for an open ended range
+		bounds := [2]int64{-1, -1}
+		for i, s := range m[1:] {
+			if s == "" {
+				continue
+			}
+			n, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid --range %q: %s", value, err)
+			}
+			bounds[i] = n
+		}
+		switch {
+		case bounds[0] < 0 && bounds[1] == 0:
+			return nil, fmt.Errorf("invalid --range %q: empty", value)
+		case bounds[0] < 0:
+			return &ByteRange{Suffix: bounds[1]}, nil
+		case bounds[1] >= 0 && bounds[1] < bounds[0]:
+			return nil, fmt.Errorf("invalid --range %q: ends before it starts", value)
+		}
+		return &ByteRange{Start: bounds[0], End: bounds[1]}, nil
+	}
+	if offset < 0 || length < 0 {
+		return nil, errors.New("--offset and --length can't be negative")
+	}
+	if offset == 0 && length == 0 {
+		return nil, nil
+	}
+	r := &ByteRange{Start: offset, End: -1}
+	if length > 0 {
+		r.End = offset + length - 1
+	}
+	return r, nil
+}
+
+// header returns the range as an http Range header.
+func (r *ByteRange) header() string {
+	switch {
+	case r.Suffix > 0:
+		return fmt.Sprintf("bytes=-%d", r.Suffix)
+	case r.End < 0:
+		return fmt.Sprintf("bytes=%d-", r.Start)
+	}
+	return fmt.Sprintf("bytes=%d-%d", r.Start, r.End)
+}
+
+// rangeReader returns a reader of the bytes of file in r. Only those bytes
+// of a key are fetched.
+func rangeReader(ctx context.Context, file File, r *ByteRange) (io.ReadCloser, error) {
+	if s3f, ok := file.(*S3File); ok {
+		input := s3.GetObjectInput{
+			Bucket: aws.String(s3f.bucket),
+			Key:    s3f.object.Key,
+			Range:  aws.String(r.header()),
+
+			SSECustomerAlgorithm: s3f.encryption.customerAlgorithm(),
+			SSECustomerKey:       s3f.encryption.customerKey(),
+			SSECustomerKeyMD5:    s3f.encryption.customerKeyMD5(),
+		}
+		output, err := s3f.mys3.GetObject(ctx, &input)
+		if err != nil {
+			return nil, err
+		}
+		return output.Body, nil
+	}
+	reader, err := file.Reader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	start, end := r.Start, r.End
+	if r.Suffix > 0 {
+		start, end = file.Size()-r.Suffix, -1
+		if start < 0 {
+			start = 0
+		}
+	}
+	if _, err := io.CopyN(ioutil.Discard, reader, start); err != nil && err != io.EOF {
+		reader.Close()
+		return nil, err
+	}
+	if end < 0 {
+		return reader, nil
+	}
+	return readCloser{io.LimitReader(reader, end-start+1), reader}, nil
+}
@@ -0,0 +1,102 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// CanceledError is returned by a run stopped through its context, recording
+// what it completed first. It unwraps to the context's error, so
+// errors.Is(err, context.Canceled) holds.
+type CanceledError struct {
+	Err   error // context.Canceled or context.DeadlineExceeded
+	Files int   // files transferred before the run stopped
+	Bytes int64 // bytes of those files
+}
+
+func (e *CanceledError) Error() string {
+	return fmt.Sprintf("%s after %d files (%d bytes)", e.Err, e.Files, e.Bytes)
+}
+
+func (e *CanceledError) Unwrap() error {
+	return e.Err
+}
+
+// tally counts the files a run has transferred, for a CanceledError.
+type tally struct {
+	mu    sync.Mutex
+	files int
+	bytes int64
+}
+
+func (t *tally) add(file File) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.files += 1
+	t.bytes += file.Size()
+}
+
+// canceled returns err as a CanceledError if ctx is done, as whatever failed
+// then most likely did so for that reason.
+func (t *tally) canceled(ctx context.Context, err error) error {
+	if err == nil || ctx.Err() == nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return &CanceledError{Err: ctx.Err(), Files: t.files, Bytes: t.bytes}
+}
+
+// contextReader fails reads once its context is done, stopping transfers
+// and hashing part way.
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (cr *contextReader) Read(b []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.reader.Read(b)
+}
+
+// readContext returns r, stopped by ctx.
+func readContext(ctx context.Context, r io.Reader) io.Reader {
+	return &contextReader{ctx, r}
+}
+
+// contextWriter fails writes once its context is done.
+type contextWriter struct {
+	ctx    context.Context
+	writer io.Writer
+}
+
+func (cw *contextWriter) Write(b []byte) (int, error) {
+	if err := cw.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cw.writer.Write(b)
+}
+
+// writeContext returns w, stopped by ctx.
+func writeContext(ctx context.Context, w io.Writer) io.Writer {
+	return &contextWriter{ctx, w}
+}
+
+// done reports whether ctx is done.
+func done(ctx context.Context) bool {
+	return ctx.Err() != nil
+}
+
+// send passes file down ch, unless ctx is done first.
+func send(ctx context.Context, ch chan<- File, file File) error {
+	select {
+	case ch <- file:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
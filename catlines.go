@@ -0,0 +1,107 @@
+package s3
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+)
+
+// tailChunk is how many trailing bytes cat --tail first fetches, doubled
+// until they hold enough lines.
+const tailChunk = 64 << 10
+
+// catHead writes the first n lines of file to w, closing the body as soon as they
+// are read.
+func catHead(ctx context.Context, w io.Writer, file File, n int, mode DecompressMode) error {
+	reader, err := file.Reader(ctx)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	reader, err = decompressReader(ctx, reader, file, mode)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	br := bufio.NewReader(reader)
+	for i := 0; i < n; i++ {
+		line, err := br.ReadBytes('\n')
+		buf.Write(line)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	// a key's lines are written together
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// catTail writes the last n lines of file to w. Only the trailing bytes holding
+// them are fetched, except of keys to be decompressed, which are read in full.
+func catTail(ctx context.Context, w io.Writer, file File, n int, mode DecompressMode) error {
+	if mode.applies(ctx, file) {
+		reader, err := file.Reader(ctx)
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		reader, err = decompressReader(ctx, reader, file, mode)
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(lastLines(data, n))
+		return err
+	}
+	size := file.Size()
+	if size == 0 {
+		return nil
+	}
+	for fetch := int64(tailChunk); ; fetch *= 2 {
+		whole := fetch >= size
+		r := &ByteRange{Suffix: fetch}
+		if whole {
+			r = &ByteRange{End: -1}
+		}
+		reader, err := rangeReader(ctx, file, r)
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			return err
+		}
+		lines := lastLines(data, n)
+		// the first line fetched may be partial, so only counts when it
+		// starts the object
+		if whole || len(lines) < len(data) {
+			_, err = w.Write(lines)
+			return err
+		}
+	}
+}
+
+// lastLines returns the last n lines of data, a final line lacking a
+// newline counting as one.
+func lastLines(data []byte, n int) []byte {
+	end := len(data)
+	if end > 0 && data[end-1] == '\n' {
+		end--
+	}
+	for i := 0; i < n; i++ {
+		end = bytes.LastIndexByte(data[:end], '\n')
+		if end == -1 {
+			return data
+		}
+	}
+	return data[end+1:]
+}
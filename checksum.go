@@ -0,0 +1,131 @@
+package s3
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// Checksum algorithms, beyond the md5 always recorded. The checksum is
+// recorded in metadata, as the md5 of multipart uploads is, and also sent in
+// S3's checksum headers for single request uploads.
+const (
+	ChecksumSHA256 = "SHA256"
+	ChecksumCRC32C = "CRC32C"
+)
+
+// ParseChecksumAlgorithm checks name is sha256 or crc32c, ignoring case.
+func ParseChecksumAlgorithm(name string) (string, error) {
+	switch algorithm := strings.ToUpper(name); algorithm {
+	case "", ChecksumSHA256, ChecksumCRC32C:
+		return algorithm, nil
+	}
+	return "", fmt.Errorf("unknown checksum algorithm %q, must be sha256 or crc32c", name)
+}
+
+// newChecksumHash returns a hash computing the checksum in algorithm.
+func newChecksumHash(algorithm string) hash.Hash {
+	if algorithm == ChecksumCRC32C {
+		return crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	}
+	return sha256.New()
+}
+
+// checksumMetadataKey is the metadata recording the checksum in algorithm.
+func checksumMetadataKey(algorithm string) string {
+	return strings.ToLower(algorithm) + "_checksum"
+}
+
+// checksumOf returns the checksum of data, base64 encoded as S3 reports it.
+func checksumOf(algorithm string, data []byte) string {
+	h := newChecksumHash(algorithm)
+	h.Write(data)
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// fileChecksum returns the checksum of the contents of file.
+func fileChecksum(ctx context.Context, file File, algorithm string) (string, error) {
+	reader, err := file.Reader(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	h := newChecksumHash(algorithm)
+	_, err = io.Copy(h, reader)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// checksumHeader sends a checksum with PutObject requests, for S3 to reject
+// the upload if it doesn't match and otherwise keep as the object's own.
+func checksumHeader(algorithm, value string) func(*s3.Options) {
+	header := middleware.BuildMiddlewareFunc("ChecksumHeader", func(ctx context.Context, in middleware.BuildInput, next middleware.BuildHandler) (middleware.BuildOutput, middleware.Metadata, error) {
+		if req, ok := in.Request.(*smithyhttp.Request); ok && middleware.GetOperationName(ctx) == "PutObject" {
+			req.Header.Set("X-Amz-Sdk-Checksum-Algorithm", algorithm)
+			req.Header.Set("X-Amz-Checksum-"+strings.ToLower(algorithm), value)
+		}
+		return next.HandleBuild(ctx, in)
+	})
+	return func(o *s3.Options) {
+		o.APIOptions = append(o.APIOptions, func(stack *middleware.Stack) error {
+			return stack.Build.Add(header, middleware.After)
+		})
+	}
+}
+
+// recordedChecksum checks a download against the checksum recorded at
+// upload. A nil recordedChecksum checks nothing.
+type recordedChecksum struct {
+	algorithm string
+	expected  string
+	hash      hash.Hash
+}
+
+// newRecordedChecksum returns a check of file against its checksum in
+// algorithm, or nil without an algorithm or a recorded checksum.
+func newRecordedChecksum(ctx context.Context, file File, algorithm string) (*recordedChecksum, error) {
+	s3f, ok := file.(*S3File)
+	if algorithm == "" || !ok {
+		return nil, nil
+	}
+	metadata, err := s3f.Metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	expected := metadataValue(metadata, checksumMetadataKey(algorithm))
+	if expected == "" {
+		return nil, nil
+	}
+	return &recordedChecksum{algorithm, expected, newChecksumHash(algorithm)}, nil
+}
+
+// Write hashes downloaded content.
+func (rc *recordedChecksum) Write(b []byte) (int, error) {
+	if rc == nil {
+		return len(b), nil
+	}
+	return rc.hash.Write(b)
+}
+
+// check compares the checksum of the content written with that recorded.
+func (rc *recordedChecksum) check(file File) error {
+	if rc == nil {
+		return nil
+	}
+	sum := base64.StdEncoding.EncodeToString(rc.hash.Sum(nil))
+	if sum == rc.expected {
+		return nil
+	}
+	return fmt.Errorf("%s: download failed checksum verification (%s %s, expected %s)", file, strings.ToLower(rc.algorithm), sum, rc.expected)
+}
@@ -0,0 +1,97 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/barnybug/s3/pkg/mys3"
+)
+
+// Result is what a sync, put, get or remove did.
+type Result struct {
+	Added     int // files uploaded or downloaded that weren't there
+	Deleted   int
+	Updated   int // files replaced as their contents differed
+	Unchanged int // files left as they were, or kept by the overwrite policy
+	Bytes     int64
+	// files and bytes not transferred, once the transfer limits were reached
+	OverLimitFiles int
+	OverLimitBytes int64
+	Failures       []FailedEntry // of failed transfers and deletes, with IgnoreErrors
+	Took           time.Duration
+
+	quota *transferQuota // reported by the command line
+}
+
+// newResult returns the result of a run that transferred done.
+func newResult(quota *transferQuota, done *tally, took time.Duration, added, deleted, updated, unchanged int) *Result {
+	quota.mu.Lock()
+	defer quota.mu.Unlock()
+	return &Result{
+		Added:          added,
+		Deleted:        deleted,
+		Updated:        updated,
+		Unchanged:      unchanged,
+		Bytes:          done.bytes,
+		OverLimitFiles: quota.remainingFiles,
+		OverLimitBytes: quota.remainingBytes,
+		Took:           took,
+		quota:          quota,
+	}
+}
+
+// Client runs the commands for Go programs that embed them. Each method is
+// the command of the same name, taking its options and returning what it did
+// rather than writing it out: the Quiet option is taken as set, and failures
+// ignored with IgnoreErrors are returned in the result. A Client is safe to
+// use from several goroutines.
+type Client struct {
+	conn S3API
+	mys3 mys3.Mys3
+}
+
+// NewClient returns a client making requests with conn.
+func NewClient(conn S3API) *Client {
+	return &Client{conn: conn, mys3: mys3.NewFromAPI(conn)}
+}
+
+// Sync synchronises src to dest, either of which may be local or s3.
+func (c *Client) Sync(ctx context.Context, src, dest string, opts SyncOptions) (*Result, error) {
+	opts.Quiet, opts.silent = true, true
+	return syncFiles(ctx, c.conn, c.mys3, src, dest, opts)
+}
+
+// Put uploads the local sources to the s3 destination.
+func (c *Client) Put(ctx context.Context, sources []string, destination string, opts PutOptions) (*Result, error) {
+	opts.Quiet, opts.silent = true, true
+	return putFiles(ctx, c.conn, c.mys3, sources, destination, opts)
+}
+
+// Get downloads the keys under each url to files.
+func (c *Client) Get(ctx context.Context, urls []string, opts GetOptions) (*Result, error) {
+	if opts.Stdout || opts.OnlyShow {
+		return nil, errors.New("a client can't get keys to the output, only to files")
+	}
+	if err := checkGet(ctx, c.conn, urls, opts); err != nil {
+		return nil, err
+	}
+	opts.Quiet, opts.silent = true, true
+	return getKeys(ctx, c.conn, c.mys3, urls, opts)
+}
+
+// List returns the keys or files under each url, as records of type key, or
+// dir and upload as opts asks, followed by a summary record of the totals.
+func (c *Client) List(ctx context.Context, urls []string, opts ListOptions) ([]Record, error) {
+	records := newRecordCollector()
+	opts.Records, opts.Summarize = records, true
+	opts.Quiet, opts.silent = true, true
+	err := RunList(ctx, c.conn, c.mys3, urls, opts)
+	return records.collected, err
+}
+
+// Remove removes the keys under each url.
+func (c *Client) Remove(ctx context.Context, urls []string, opts RmOptions) (*Result, error) {
+	opts.Quiet, opts.silent = true, true
+	return removeKeys(ctx, c.conn, c.mys3, urls, opts)
+}
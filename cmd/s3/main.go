@@ -9,6 +9,6 @@ import (
 
 func main() {
 	runtime.GOMAXPROCS(2)
-	exitCode := s3.Main(nil, os.Args, os.Stdout)
+	exitCode := s3.MainStreams(nil, os.Args, s3.Streams{Out: os.Stdout, Err: os.Stderr})
 	os.Exit(exitCode)
 }
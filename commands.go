@@ -8,54 +8,247 @@
 package s3
 
 import (
-	"bytes"
-	"compress/gzip"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/barnybug/s3/pkg/mys3"
 )
 
 var reBucketPath = regexp.MustCompile("^(?:s3://)?([^/]+)/?(.*)$")
-var out io.Writer = os.Stdout
+
+// runOutput is where a run of a command writes: its results to out, and its
+// errors, warnings, logs and prompts to errOut, logging as much as level in
+// format. Each run has its own, carried by its context, so that runs at once
+// don't write to each other's.
+type runOutput struct {
+	out    io.Writer
+	errOut io.Writer
+	level  LogLevel
+	format LogFormat
+	logMu  sync.Mutex // keeps records logged in parallel from interleaving
+}
+
+// defaultOutput is the output of operations run without one, such as those
+// of a Client: stdout and stderr, logging only errors and warnings.
+var defaultOutput = &runOutput{out: os.Stdout, errOut: os.Stderr, level: LogErrors, format: LogText}
+
+// runOutputKey carries the runOutput of a run in its context.
+type runOutputKey struct{}
+
+// withOutput returns ctx carrying the output of a run.
+func withOutput(ctx context.Context, o *runOutput) context.Context {
+	return context.WithValue(ctx, runOutputKey{}, o)
+}
+
+// outputOf returns the output of the run of ctx, or defaultOutput.
+func outputOf(ctx context.Context) *runOutput {
+	if o, ok := ctx.Value(runOutputKey{}).(*runOutput); ok {
+		return o
+	}
+	return defaultOutput
+}
+
+// outOf returns where the run of ctx writes its results.
+func outOf(ctx context.Context) io.Writer {
+	return outputOf(ctx).out
+}
+
+// errOutOf returns where the run of ctx writes its errors, warnings, logs
+// and prompts.
+func errOutOf(ctx context.Context) io.Writer {
+	return outputOf(ctx).errOut
+}
 
 var (
 	ErrNotFound = errors.New("no files found")
+	// stops a listing limited by --max once enough keys are listed
+	errListed = errors.New("listed enough keys")
 )
 
+// CommonOptions are shared by all commands.
+type CommonOptions struct {
+	Parallel     int      // number of parallel operations to run
+	DryRun       bool     // report actions without taking them
+	Quiet        bool     // suppress per-file output
+	IgnoreErrors bool     // carry on past failed transfers
+	Metrics      *Metrics // record transfers on, if set
+
+	silent bool // write nothing, not even failures, for a Client
+}
+
+// ListOptions configure RunList.
+type ListOptions struct {
+	CommonOptions
+	FilesystemOptions
+	Dirs      bool          // list one level, showing the prefixes beneath as directories
+	Summarize bool          // end with the totals even when quiet or writing records
+	Records   *RecordWriter // write json records in place of text, if set
+	Sort      ListSort      // order the keys, rather than as listed
+	Reverse   bool          // reverse the order
+	Max       int           // list only the first keys in order, 0 for all
+	Uploads   bool          // list incomplete multipart uploads after the keys
+}
+
+// GetOptions configure RunGet.
+type GetOptions struct {
+	CommonOptions
+	FilesystemOptions
+	Directory  string          // download directory, defaults to the working directory
+	OnlyShow   bool            // print object details rather than downloading
+	Recursive  bool            // treat each url as a directory, downloading every key beneath it
+	Resume     bool            // take existing shorter local files to be partial downloads
+	Ranges     RangeOptions    // fetch large objects in concurrent ranges
+	Stdout     bool            // write the contents to the output rather than to files
+	Decompress DecompressMode  // gunzip compressed keys, dropping the .gz from their names
+	NoVerify   bool            // skip checking downloads against the key's md5
+	Overwrite  OverwritePolicy // whether existing local files are replaced
+	Template   *OutputTemplate // lay out downloads by this template, if set
+}
+
+// CatOptions configure RunCat.
+type CatOptions struct {
+	CommonOptions
+	FilesystemOptions
+	Decompress DecompressMode // gunzip compressed keys
+	Range      *ByteRange     // write only these bytes, as stored, if set
+	Head       int            // write only the first this many lines, if set
+	Tail       int            // write only the last this many lines, if set
+}
+
+// GrepOptions configure RunGrep.
+type GrepOptions struct {
+	CommonOptions
+	FilesystemOptions
+	NoKeysPrefix    bool           // don't prefix matching lines with the key name
+	KeysWithMatches bool           // only print the names of matching keys
+	Invert          bool           // select the lines not containing the string
+	Count           bool           // only print the number of lines selected in each key
+	LineNumbers     bool           // prefix lines with their line number
+	ByteOffsets     bool           // prefix lines with the offset of their first byte
+	Before          int            // lines of context before each selected line
+	After           int            // lines of context after each selected line
+	Select          bool           // search csv and json keys with S3 Select
+	Names           *NameFilter    // select the keys searched by name, if set
+	Text            bool           // search binary keys too
+	MaxMatches      int64          // stop after this many lines are selected, if set
+	Decompress      DecompressMode // gunzip compressed keys
+	Records         *RecordWriter  // write json records in place of text, if set
+}
+
+// PutOptions configure RunPut.
+type PutOptions struct {
+	CommonOptions
+	FilesystemOptions
+	Multipart bool           // upload using explicit multipart requests
+	Limits    TransferLimits // stop uploading once these are reached
+	Stdin     io.Reader      // read for a "-" source
+	// upload files at least this large as Multipart does, if set
+	MultipartThreshold int64
+}
+
+// DefaultMultipartThreshold is the size from which put uploads files in
+// explicit parts.
+const DefaultMultipartThreshold = 100 * mib
+
+// RmOptions configure RunRm.
+type RmOptions struct {
+	CommonOptions
+	FilesystemOptions
+	Protect []string     // patterns of keys never removed, with those in the bucket's .s3keep
+	Confirm Confirmation // ask before removing keys
+	// remove this version of a single key, or delete marker, rather than
+	// the key
+	VersionID string
+	// remove versions under governance mode object lock retention
+	BypassGovernance bool
+	// device authorizing version deletes in buckets with MFA delete, if any
+	MFA *MFA
+}
+
+// SyncOptions configure RunSync.
+type SyncOptions struct {
+	CommonOptions
+	FilesystemOptions
+	Delete       bool            // delete extraneous files from the destination
+	Adaptive     bool            // tune parallelism from throughput, starting at Parallel
+	Manifest     string          // write a manifest of transferred files here
+	FromManifest string          // only transfer the keys listed in this manifest
+	FailuresFile string          // with IgnoreErrors, write failed keys here
+	RetryFile    string          // only transfer the keys listed in this failures file
+	Limits       TransferLimits  // stop transferring once these are reached
+	Protect      []string        // patterns of destination paths never deleted, with those in its .s3keep
+	Overwrite    OverwritePolicy // whether existing local files are replaced
+	Confirm      Confirmation    // with Delete, ask before deleting files
+}
+
+// RemoveBucketOptions configure RunRemoveBuckets.
+type RemoveBucketOptions struct {
+	Confirm Confirmation // ask before removing the buckets
+}
+
+// MakeBucketOptions configure RunMakeBucket.
+type MakeBucketOptions struct {
+	ACL    string
+	Tags   []types.Tag // tag the new buckets, such as for cost allocation
+	Region string      // create the buckets in this region
+	Wait   bool        // wait until the buckets exist before returning
+	// configure the new buckets
+	Versioning bool
+	ObjectLock bool                     // enable object lock, which enables versioning
+	Encryption *BucketEncryptionOptions // default encryption, nil to leave S3's default
+}
+
 func extractBucketPath(url string) (string, string) {
 	parts := reBucketPath.FindStringSubmatch(url)
 	return parts[1], parts[2]
 }
 
-func listBuckets(conn s3iface.S3API) error {
-	output, err := conn.ListBuckets(nil)
+// RunListBuckets lists all buckets, as json records if records is set.
+func RunListBuckets(ctx context.Context, conn S3API, records *RecordWriter) error {
+	output, err := conn.ListBuckets(ctx, &s3.ListBucketsInput{})
 	if err != nil {
 		return err
 	}
 	for _, b := range output.Buckets {
-		fmt.Fprintf(out, "s3://%s/\n", *b.Name)
+		url := fmt.Sprintf("s3://%s/", *b.Name)
+		if records != nil {
+			record := Record{Type: "bucket", URL: url}
+			if b.CreationDate != nil {
+				record.LastModified = b.CreationDate.UTC().Format(time.RFC3339)
+			}
+			if err := records.Write(record); err != nil {
+				return err
+			}
+			continue
+		}
+		fmt.Fprintln(outOf(ctx), url)
 	}
 	return nil
 }
 
-func iterateKeys(conn s3iface.S3API, urls []string, callback func(file File) error, mys3Conn mys3.Mys3) error {
+func iterateKeys(ctx context.Context, conn S3API, urls []string, opts FilesystemOptions, callback func(file File) error, mys3Conn mys3.Mys3) error {
 	found := false
 	for _, url := range urls {
-		fs := getFilesystem(conn, url, mys3Conn)
-		ch := fs.Files()
+		fs := getKeysFilesystem(conn, url, opts, mys3Conn)
+		ch := opts.Filter.files(ctx, fs.Files(ctx))
 		for file := range ch {
-
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 			found = true
 			err := callback(file)
 			if err != nil {
@@ -72,7 +265,7 @@ func iterateKeys(conn s3iface.S3API, urls []string, callback func(file File) err
 	return nil
 }
 
-func iterateKeysParallel(conn s3iface.S3API, urls []string, callback func(file File) error, mys3Conn mys3.Mys3) error {
+func iterateKeysParallel(ctx context.Context, conn S3API, urls []string, parallel int, opts FilesystemOptions, callback func(file File) error, mys3Conn mys3.Mys3) error {
 	// create pool for processing
 	var err error
 	wg := sync.WaitGroup{}
@@ -82,6 +275,10 @@ func iterateKeysParallel(conn s3iface.S3API, urls []string, callback func(file F
 		go func() {
 			defer wg.Done()
 			for key := range q {
+				if ctx.Err() != nil {
+					// drain the queue, the run is stopping
+					continue
+				}
 				e := callback(key)
 				if e != nil {
 					err = e
@@ -91,258 +288,535 @@ func iterateKeysParallel(conn s3iface.S3API, urls []string, callback func(file F
 		}()
 	}
 
-	e := iterateKeys(conn, urls, func(file File) error {
-		q <- file
-		return nil
+	e := iterateKeys(ctx, conn, urls, opts, func(file File) error {
+		return send(ctx, q, file)
 	}, mys3Conn)
+	close(q)
+	wg.Wait()
 	if e != nil {
 		return e
 	}
-
-	close(q)
-	wg.Wait()
 	return err
 }
 
-func listKeys(conn s3iface.S3API, urls []string, mys3Conn mys3.Mys3) error {
-	var count, totalSize int64
-	err := iterateKeys(conn, urls, func(file File) error {
-		if quiet {
-			fmt.Fprintln(out, file)
-		} else {
-			fmt.Fprintf(out, "%s\t%db\n", file, file.Size())
+// RunList lists the keys or files under each url.
+func RunList(ctx context.Context, conn S3API, mys3Conn mys3.Mys3, urls []string, opts ListOptions) error {
+	if opts.Dirs {
+		if opts.Sort != SortNone || opts.Reverse || opts.Max > 0 {
+			return errors.New("directory listings can't be sorted or limited")
 		}
+		return listDirs(ctx, conn, urls, opts)
+	}
+	// stops listing once enough keys are listed
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var count, totalSize int64
+	show := func(file File) error {
 		count += 1
 		totalSize += file.Size()
+		if opts.Records != nil {
+			return opts.Records.Write(fileRecord(file))
+		}
+		if opts.Quiet {
+			fmt.Fprintln(outOf(ctx), file)
+		} else {
+			fmt.Fprintf(outOf(ctx), "%s\t%db\n", file, file.Size())
+		}
 		return nil
+	}
+	// sorted keys are collected, and shown once all are listed
+	var sorted *sortedFiles
+	if opts.Sort != SortNone || opts.Reverse {
+		sorted = newSortedFiles(opts.Sort, opts.Reverse, opts.Max)
+	}
+	err := iterateKeys(ctx, conn, urls, opts.FilesystemOptions, func(file File) error {
+		if sorted != nil {
+			sorted.add(file)
+			return nil
+		}
+		if opts.Max > 0 && count == int64(opts.Max) {
+			return errListed
+		}
+		return show(file)
 	}, mys3Conn)
-	if err != nil && err != ErrNotFound {
+	if err != nil && err != ErrNotFound && err != errListed {
 		return err
 	}
-	if !quiet {
-		fmt.Fprintf(out, "\n%d files, %d bytes\n", count, totalSize)
+	if sorted != nil {
+		for _, file := range sorted.sorted() {
+			if err := show(file); err != nil {
+				return err
+			}
+		}
+	}
+	summary := fmt.Sprintf("%d files, %d bytes", count, totalSize)
+	if opts.Uploads {
+		uploads, err := listUploads(ctx, conn, urls, opts)
+		if err != nil {
+			return err
+		}
+		summary += fmt.Sprintf(", %d incomplete uploads", uploads)
+	}
+	return listSummary(ctx, opts, summary, count, totalSize)
+}
+
+// listSummary ends a listing with the summary of its totals, unless quiet or
+// writing records. Given --summarize, it's always printed, or written as a
+// summary record.
+func listSummary(ctx context.Context, opts ListOptions, summary string, count, totalSize int64) error {
+	if opts.Records != nil {
+		if !opts.Summarize {
+			return nil
+		}
+		return opts.Records.Write(Record{Type: "summary", Count: aws.Int64(count), Size: aws.Int64(totalSize)})
+	}
+	if !opts.Quiet || opts.Summarize {
+		fmt.Fprintf(outOf(ctx), "\n%s\n", summary)
 	}
 	return nil
 }
 
-func getKeys(conn s3iface.S3API, urls []string, mys3Conn mys3.Mys3, directory string) error {
+// listDirs lists the keys directly beneath each url, as for a directory. The
+// deeper keys are listed by S3 as the prefixes containing them, delimited by
+// "/", so a level of even a huge bucket lists in a request or two.
+func listDirs(ctx context.Context, conn S3API, urls []string, opts ListOptions) error {
+	var dirs, count, totalSize int64
 	for _, url := range urls {
 		if !isS3Url(url) {
 			return errors.New("s3:// url required")
 		}
-	}
-
-	err := iterateKeysParallel(conn, urls, func(file File) error {
-		reader, err := file.Reader()
-		if err != nil {
-			return err
-		}
-		defer reader.Close()
-		if onlyShow {
-			return nil
+		bucket, prefix := extractBucketPath(url)
+		if strings.ContainsAny(prefix, globChars) {
+			return fmt.Errorf("glob patterns can't be listed by directory: %s", url)
 		}
-		fpath := file.Relative()
-		if directory != "" {
-			fpath = directory + "/" + fpath
+		input := s3.ListObjectsV2Input{
+			Bucket:    aws.String(bucket),
+			Prefix:    aws.String(prefix),
+			Delimiter: aws.String("/"),
 		}
-		dirpath := path.Dir(fpath)
-		if dirpath != "." {
-			err = os.MkdirAll(dirpath, 0777)
+		pages := s3.NewListObjectsV2Paginator(conn, &input)
+		for pages.HasMorePages() {
+			if done(ctx) {
+				return ctx.Err()
+			}
+			output, err := pages.NextPage(ctx)
 			if err != nil {
 				return err
 			}
+			for _, p := range output.CommonPrefixes {
+				dir := fmt.Sprintf("s3://%s/%s", bucket, aws.ToString(p.Prefix))
+				if opts.Records != nil {
+					if err := opts.Records.Write(Record{Type: "dir", URL: dir}); err != nil {
+						return err
+					}
+				} else if opts.Quiet {
+					fmt.Fprintln(outOf(ctx), dir)
+				} else {
+					fmt.Fprintf(outOf(ctx), "%s\tDIR\n", dir)
+				}
+				dirs += 1
+			}
+			for _, object := range output.Contents {
+				if !opts.Filter.selects(&S3File{bucket: bucket, object: &object}) {
+					continue
+				}
+				key := fmt.Sprintf("s3://%s/%s", bucket, aws.ToString(object.Key))
+				size := aws.ToInt64(object.Size)
+				if opts.Records != nil {
+					if err := opts.Records.Write(objectRecord(bucket, &object)); err != nil {
+						return err
+					}
+				} else if opts.Quiet {
+					fmt.Fprintln(outOf(ctx), key)
+				} else {
+					fmt.Fprintf(outOf(ctx), "%s\t%db\n", key, size)
+				}
+				count += 1
+				totalSize += size
+			}
 		}
-
-		writer, err := os.Create(fpath)
-		if err != nil {
-			return err
-		}
-		nbytes, err := io.Copy(writer, reader)
+	}
+	summary := fmt.Sprintf("%d directories, %d files, %d bytes", dirs, count, totalSize)
+	if opts.Uploads {
+		uploads, err := listUploads(ctx, conn, urls, opts)
 		if err != nil {
 			return err
 		}
-		if !quiet {
-			fmt.Fprintf(out, "%s -> %s (%d bytes)\n", file, fpath, nbytes)
-		}
-		return nil
-	}, mys3Conn)
+		summary += fmt.Sprintf(", %d incomplete uploads", uploads)
+	}
+	return listSummary(ctx, opts, summary, count, totalSize)
+}
+
+// RunGet downloads the keys under each url.
+func RunGet(ctx context.Context, conn S3API, mys3Conn mys3.Mys3, urls []string, opts GetOptions) error {
+	if err := checkGet(ctx, conn, urls, opts); err != nil {
+		return err
+	}
+	if opts.Stdout {
+		return getStream(ctx, conn, mys3Conn, urls, opts)
+	}
+	_, err := getKeys(ctx, conn, mys3Conn, urls, opts)
 	return err
 }
 
-func catKeys(conn s3iface.S3API, urls []string, mys3Conn mys3.Mys3) error {
-	return iterateKeysParallel(conn, urls, func(file File) error {
-		reader, err := file.Reader()
-		if err != nil {
-			return err
+// checkGet checks the urls of a get, and that they can be got as opts asks.
+func checkGet(ctx context.Context, conn S3API, urls []string, opts GetOptions) error {
+	for _, url := range urls {
+		if !isS3Url(url) {
+			return errors.New("s3:// url required")
 		}
-		defer reader.Close()
+	}
+	if opts.Accelerate {
+		return checkAccelerate(ctx, conn, urls)
+	}
+	return nil
+}
 
-		if strings.HasSuffix(file.String(), ".gz") {
-			reader, err = gzip.NewReader(reader)
+// getKeys downloads the keys under each url to files, returning what it did.
+func getKeys(ctx context.Context, conn S3API, mys3Conn mys3.Mys3, urls []string, opts GetOptions) (*Result, error) {
+	start := time.Now()
+	if opts.Recursive {
+		// download the keys beneath each prefix relative to it, so
+		// prefix/a/b lands at a/b
+		dirs := make([]string, len(urls))
+		for i, url := range urls {
+			if !strings.HasSuffix(url, "/") {
+				url += "/"
+			}
+			dirs[i] = url
+		}
+		urls = dirs
+	}
+
+	var done, skipped tally
+	err := iterateKeysParallel(ctx, conn, urls, opts.Parallel, opts.FilesystemOptions, func(file File) error {
+		if opts.OnlyShow {
+			return showObject(ctx, file)
+		}
+		fpath := file.Relative()
+		if opts.Template != nil {
+			if file.IsDirectory() {
+				return nil
+			}
+			var err error
+			fpath, err = opts.Template.Expand(file)
+			if err != nil {
+				return err
+			}
+		}
+		if opts.Directory != "" && !path.IsAbs(fpath) {
+			fpath = opts.Directory + "/" + fpath
+		}
+		if file.IsDirectory() || file.Relative() == "" {
+			// directory marker
+			return os.MkdirAll(fpath, 0777)
+		}
+		dirpath := path.Dir(fpath)
+		if dirpath != "." {
+			err := os.MkdirAll(dirpath, 0777)
 			if err != nil {
 				return err
 			}
 		}
 
-		_, err = io.Copy(out, reader)
+		decompress := opts.Decompress.applies(ctx, file)
+		if decompress {
+			fpath = strings.TrimSuffix(fpath, gzipExt)
+			logDecision(ctx, "decompress", file, file.String(), "gzipped, to "+fpath)
+		}
+		if !opts.Overwrite.replacesPath(file, fpath) {
+			logDecision(ctx, "skip", file, file.String(), fpath+" exists, and is kept by the overwrite policy")
+			skipped.add(file)
+			if !opts.Quiet {
+				fmt.Fprintf(outOf(ctx), "%s -> %s (skipped, exists)\n", file, fpath)
+			}
+			return nil
+		}
+
+		opts.Progress.Start(file)
+		opts.Metrics.start()
+		started := time.Now()
+		var nbytes int64
+		var err error
+		if decompress {
+			nbytes, err = downloadDecompressed(ctx, file, fpath, opts)
+		} else {
+			nbytes, err = downloadFile(ctx, file, fpath, opts)
+		}
+		if err == nil {
+			err = restoreModTime(fpath, file)
+		}
+		opts.Progress.track(file, err)
+		opts.Metrics.done("get", nbytes, time.Since(started), err)
 		if err != nil {
 			return err
 		}
+		done.add(file)
+		logTransfer(ctx, "get", file, file.String(), nbytes, time.Since(started))
+		if !opts.Quiet {
+			fmt.Fprintf(outOf(ctx), "%s -> %s (%d bytes)\n", file, fpath, nbytes)
+		}
 		return nil
 	}, mys3Conn)
+	if err != nil {
+		return nil, done.canceled(ctx, err)
+	}
+	return &Result{Added: done.files, Unchanged: skipped.files, Bytes: done.bytes, Took: time.Since(start)}, nil
 }
 
-func outputMatches(buf []byte, needle []byte, prefix string) {
-	p := 0
-	for {
-		i := bytes.Index(buf[p:], needle)
-		if i == -1 {
-			break
-		}
-		i += p
-		lineStart := bytes.LastIndexByte(buf[:i], byte('\n'))
-		if lineStart == -1 {
-			lineStart = 0
-		} else {
-			lineStart += 1
-		}
-		lineEnd := bytes.IndexByte(buf[i:], byte('\n'))
-		if lineEnd == -1 {
-			lineEnd = len(buf)
-		} else {
-			lineEnd += i
-		}
-		line := string(buf[lineStart:lineEnd])
-
-		fmt.Fprintf(out, "%s%s\n", prefix, line)
-
-		p = lineEnd + 1
-		if p > len(buf)-len(needle) {
-			break
-		}
+// showObject prints the response details of fetching an object.
+func showObject(ctx context.Context, file File) error {
+	s3f, ok := file.(*S3File)
+	if !ok {
+		return errors.New("s3:// url required")
+	}
+	output, err := s3f.getObject(ctx)
+	if err != nil {
+		return err
 	}
+	defer output.Body.Close()
+	details, err := json.MarshalIndent(output, "", "\t")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(outOf(ctx), string(details))
+	return nil
 }
 
-func grepKeys(conn s3iface.S3API, find string, urls []string, noKeysPrefix bool, keysWithMatches bool, mys3Conn mys3.Mys3) error {
-	needle := []byte(find)
+// RunCat writes the contents of the keys under each url to the output.
+func RunCat(ctx context.Context, conn S3API, mys3Conn mys3.Mys3, urls []string, opts CatOptions) error {
+	return iterateKeysOrdered(ctx, conn, urls, opts.Parallel, opts.FilesystemOptions, func(w io.Writer, file File) error {
+		return catFile(ctx, w, file, opts)
+	}, mys3Conn)
+}
 
-	return iterateKeysParallel(conn, urls, func(file File) error {
-		reader, err := file.Reader()
+// catFile writes the contents of file, or the part of it selected by opts, to
+// w.
+func catFile(ctx context.Context, w io.Writer, file File, opts CatOptions) error {
+	if opts.Head > 0 {
+		return catHead(ctx, w, file, opts.Head, opts.Decompress)
+	}
+	if opts.Tail > 0 {
+		return catTail(ctx, w, file, opts.Tail, opts.Decompress)
+	}
+	if opts.Range != nil {
+		// part of a compressed key can't be gunzipped
+		reader, err := rangeReader(ctx, file, opts.Range)
 		if err != nil {
 			return err
 		}
 		defer reader.Close()
+		_, err = io.Copy(w, reader)
+		return err
+	}
+	reader, err := file.Reader(ctx)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
 
-		if strings.HasSuffix(file.String(), ".gz") {
-			reader, err = gzip.NewReader(reader)
-			if err != nil {
-				return err
-			}
-		}
+	reader, err = decompressReader(ctx, reader, file, opts.Decompress)
+	if err != nil {
+		return err
+	}
 
-		prefix := ""
-		if !noKeysPrefix {
-			prefix = file.String() + ":"
-		}
+	_, err = io.Copy(w, reader)
+	return err
+}
 
-		buf := make([]byte, 4096)
-		offset := 0
-		for n, err := reader.Read(buf[offset:]); n > 0 && err == nil; n, err = reader.Read(buf[offset:]) {
-			if bytes.Contains(buf[:n+offset], needle) {
-				if keysWithMatches {
-					// only filename required, bail early
-					fmt.Fprintln(out, file.String())
-					break
-				} else {
-					outputMatches(buf[:n+offset], needle, prefix)
-				}
-			}
-			// handle overlapping matches - copy last N-1 bytes to start of next
-			offset = len(needle) - 1
-			if offset > n {
-				offset = n
-			} else {
-				copy(buf, buf[n-offset:])
-			}
-		}
-		if err != nil && err != io.EOF {
-			return err
-		}
-		return nil
+// RunGrep searches the keys under each url for lines containing find.
+func RunGrep(ctx context.Context, conn S3API, mys3Conn mys3.Mys3, find string, urls []string, opts GrepOptions) error {
+	if opts.Select && (opts.LineNumbers || opts.ByteOffsets || opts.Before > 0 || opts.After > 0) {
+		return errors.New("--select can't be given with line numbers, byte offsets or context")
+	}
+	needle := []byte(find)
+	var limit *matchLimit
+	if opts.MaxMatches > 0 {
+		limit = &matchLimit{max: opts.MaxMatches}
+	}
+	err := iterateKeysOrdered(ctx, conn, urls, opts.Parallel, opts.FilesystemOptions, func(w io.Writer, file File) error {
+		return grepKey(ctx, w, file, needle, limit, opts)
 	}, mys3Conn)
+	if err == errMaxMatches {
+		return nil
+	}
+	return err
 }
 
-func deleteBatch(conn s3iface.S3API, bucket string, batch []*s3.ObjectIdentifier, mys3Conn mys3.Mys3) error {
-	if !dryRun {
-		deleteRequest := s3.Delete{
-			Objects: batch,
-		}
-		input := s3.DeleteObjectsInput{
-			Bucket: aws.String(bucket),
-			Delete: &deleteRequest,
-		}
-		_, err := conn.DeleteObjects(&input)
+// RunRm removes the keys under each url.
+func RunRm(ctx context.Context, conn S3API, mys3Conn mys3.Mys3, urls []string, opts RmOptions) error {
+	result, err := removeKeys(ctx, conn, mys3Conn, urls, opts)
+	if err != nil || opts.VersionID != "" {
 		return err
 	}
+	summary(ctx, 0, result.Deleted, 0, 0, result.Took, opts.DryRun)
 	return nil
 }
 
-func rmKeys(conn s3iface.S3API, urls []string, mys3Conn mys3.Mys3) error {
+// removeKeys removes the keys under each url, returning what it did.
+func removeKeys(ctx context.Context, conn S3API, mys3Conn mys3.Mys3, urls []string, opts RmOptions) (*Result, error) {
 	for _, url := range urls {
 		if !isS3Url(url) {
-			return errors.New("cowardly refusing to remove local files ,use rm")
+			return nil, errors.New("cowardly refusing to remove local files ,use rm")
 		}
 	}
-	batch := make([]*s3.ObjectIdentifier, 0, 1000)
-	var bucket string
+	if opts.VersionID != "" {
+		return removeVersion(ctx, conn, urls, opts)
+	}
 	start := time.Now()
 	var deleted int
-	err := iterateKeys(conn, urls, func(file File) error {
+	failures := &failureRecorder{}
+	deletes := newBatchDeleter(ctx, conn, func(file File, err error) error {
+		deleted -= 1
+		if opts.IgnoreErrors {
+			if !opts.silent {
+				fmt.Fprintf(errOutOf(ctx), "E %s: %s\n", file, err)
+			}
+			failures.record(Action{"delete", file}, err)
+			return nil
+		}
+		return fmt.Errorf("%s: %s", file, err)
+	})
+	deletes.bypassGovernance = opts.BypassGovernance
+	keep := map[string]*ignoreRules{}
+	// protected reports whether file is kept by its bucket's .s3keep or
+	// --protect
+	protected := func(file File) (bool, error) {
+		t, ok := file.(*S3File)
+		if !ok {
+			return false, nil
+		}
+		rules, ok := keep[t.bucket]
+		if !ok {
+			var err error
+			rules, err = loadKeepRules(ctx, conn, "s3://"+t.bucket, opts.Protect)
+			if err != nil {
+				return false, err
+			}
+			keep[t.bucket] = rules
+		}
+		return rules.protected(*t.object.Key), nil
+	}
+	if opts.Confirm.enabled() && !opts.DryRun {
+		// count the keys to remove, to ask before removing any
+		count := 0
+		err := iterateKeys(ctx, conn, urls, opts.FilesystemOptions, func(file File) error {
+			kept, err := protected(file)
+			if err == nil && !kept {
+				count += 1
+			}
+			return err
+		}, mys3Conn)
+		if err != nil {
+			return nil, err
+		}
+		err = opts.Confirm.confirm(ctx, count, fmt.Sprintf("remove %d keys under %s", count, strings.Join(urls, " ")))
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := iterateKeys(ctx, conn, urls, opts.FilesystemOptions, func(file File) error {
+		kept, err := protected(file)
+		if err != nil {
+			return err
+		}
+		if kept {
+			if !opts.Quiet {
+				fmt.Fprintf(outOf(ctx), "K %s\n", file)
+			}
+			return nil
+		}
 		deleted += 1
-		if !quiet {
-			fmt.Fprintf(out, "D %s\n", file)
+		if !opts.Quiet {
+			fmt.Fprintf(outOf(ctx), "D %s\n", file)
+		}
+		if opts.DryRun {
+			return nil
 		}
 		switch t := file.(type) {
 		case *S3File:
 			// optimize as a batch delete
-			if t.bucket != bucket && len(batch) > 0 {
-				deleteBatch(conn, bucket, batch, mys3Conn)
-				batch = batch[:0]
-			}
-			bucket = t.bucket
-			obj := s3.ObjectIdentifier{Key: t.object.Key}
-			batch = append(batch, &obj)
-			if len(batch) == 1000 {
-				deleteBatch(conn, bucket, batch, mys3Conn)
-				batch = batch[:0]
-			}
-
+			return deletes.add(t.bucket, *t.object.Key, file)
 		default:
-			if !dryRun {
-				file.Delete()
-			}
+			file.Delete(ctx)
 		}
 		return nil
 	}, mys3Conn)
+	if err == nil {
+		// final batch
+		err = deletes.flush()
+	}
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return &Result{Deleted: deleted, Failures: failures.sorted(), Took: time.Since(start)}, nil
+}
 
-	// final batch
-	if len(batch) > 0 {
-		deleteBatch(conn, bucket, batch, mys3Conn)
+// removeVersion removes a version of a single key. Removing its latest
+// version, or the delete marker left when it was removed, makes the version
+// before current again, undeleting the key.
+func removeVersion(ctx context.Context, conn S3API, urls []string, opts RmOptions) (*Result, error) {
+	if len(urls) != 1 {
+		return nil, errors.New("--version-id removes a version of a single key")
 	}
-	end := time.Now()
-	took := end.Sub(start)
-	summary(0, deleted, 0, 0, took)
-	return nil
+	bucket, key := extractBucketPath(urls[0])
+	if key == "" || strings.ContainsAny(key, globChars) {
+		return nil, errors.New("--version-id removes a version of a single key")
+	}
+	rules, err := loadKeepRules(ctx, conn, "s3://"+bucket, opts.Protect)
+	if err != nil {
+		return nil, err
+	}
+	if rules.protected(key) {
+		if !opts.Quiet {
+			fmt.Fprintf(outOf(ctx), "K %s\n", urls[0])
+		}
+		return &Result{}, nil
+	}
+	if !opts.DryRun {
+		err = opts.Confirm.confirm(ctx, 1, fmt.Sprintf("remove version %s of %s", opts.VersionID, urls[0]))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !opts.Quiet {
+		fmt.Fprintf(outOf(ctx), "D %s (version %s)\n", urls[0], opts.VersionID)
+	}
+	if opts.DryRun {
+		return &Result{Deleted: 1}, nil
+	}
+	input := s3.DeleteObjectInput{
+		Bucket:    aws.String(bucket),
+		Key:       aws.String(key),
+		VersionId: aws.String(opts.VersionID),
+	}
+	if opts.BypassGovernance {
+		input.BypassGovernanceRetention = aws.Bool(true)
+	}
+	if opts.MFA != nil {
+		header, err := opts.MFA.header()
+		if err != nil {
+			return nil, err
+		}
+		input.MFA = aws.String(header)
+	}
+	_, err = conn.DeleteObject(ctx, &input)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{Deleted: 1}, nil
 }
 
-func rmBuckets(conn s3iface.S3API, buckets []string, mys3Conn mys3.Mys3) error {
+// RunRemoveBuckets removes each (empty) bucket.
+func RunRemoveBuckets(ctx context.Context, conn S3API, buckets []string, opts RemoveBucketOptions) error {
+	err := opts.Confirm.confirm(ctx, len(buckets), "remove buckets "+strings.Join(buckets, " "))
+	if err != nil {
+		return err
+	}
 	for _, name := range buckets {
 		bucket, _ := extractBucketPath(name)
 		input := s3.DeleteBucketInput{Bucket: aws.String(bucket)}
-		_, err := conn.DeleteBucket(&input)
+		_, err := conn.DeleteBucket(ctx, &input)
 		if err != nil {
 			return err
 		}
@@ -350,116 +824,213 @@ func rmBuckets(conn s3iface.S3API, buckets []string, mys3Conn mys3.Mys3) error {
 	return nil
 }
 
-func summary(added, deleted, updated, unchanged int, took time.Duration) {
+func summary(ctx context.Context, added, deleted, updated, unchanged int, took time.Duration, dryRun bool) {
 	rate := float64(added+deleted+updated) / took.Seconds()
 
 	if dryRun {
-		fmt.Fprintln(out, "-- summary (dry-run) --")
+		fmt.Fprintln(outOf(ctx), "-- summary (dry-run) --")
 	} else {
-		fmt.Fprintln(out, "-- summary --")
+		fmt.Fprintln(outOf(ctx), "-- summary --")
 	}
-	fmt.Fprintf(out, `%d added %d deleted %d updated %d unchanged
+	fmt.Fprintf(outOf(ctx), `%d added %d deleted %d updated %d unchanged
 took: %s (%.1f ops/s)
 
 `, added, deleted, updated, unchanged, took, rate)
 }
 
-func putBuckets(conn s3iface.S3API, buckets []string, mys3Conn mys3.Mys3) error {
+// bucketExistsWait is how long mb --wait waits for a new bucket to be seen.
+const bucketExistsWait = 100 * time.Second
+
+// RunMakeBucket creates each bucket.
+func RunMakeBucket(ctx context.Context, conn S3API, buckets []string, opts MakeBucketOptions) error {
+	if opts.Encryption != nil {
+		// fail before creating buckets that can't be configured
+		if _, err := opts.Encryption.rule(); err != nil {
+			return err
+		}
+	}
 	for _, bucket := range buckets {
 		input := s3.CreateBucketInput{
-			ACL:    aws.String(acl),
+			ACL:    types.BucketCannedACL(opts.ACL),
 			Bucket: aws.String(bucket),
 		}
-		_, err := conn.CreateBucket(&input)
+		if opts.ObjectLock {
+			input.ObjectLockEnabledForBucket = aws.Bool(true)
+		}
+		// buckets are created in us-east-1 unless given another region,
+		// which S3 rejects naming us-east-1 itself
+		if opts.Region != "" && opts.Region != "us-east-1" {
+			input.CreateBucketConfiguration = &types.CreateBucketConfiguration{
+				LocationConstraint: types.BucketLocationConstraint(opts.Region),
+			}
+		}
+		_, err := conn.CreateBucket(ctx, &input)
 		if err != nil {
 			return err
 		}
+		if opts.Wait {
+			err = s3.NewBucketExistsWaiter(conn).Wait(ctx, &s3.HeadBucketInput{Bucket: aws.String(bucket)}, bucketExistsWait)
+			if err != nil {
+				return err
+			}
+		}
+		if opts.Versioning && !opts.ObjectLock {
+			_, err = conn.PutBucketVersioning(ctx, &s3.PutBucketVersioningInput{
+				Bucket:                  aws.String(bucket),
+				VersioningConfiguration: &types.VersioningConfiguration{Status: types.BucketVersioningStatusEnabled},
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if opts.Encryption != nil {
+			err = RunSetBucketEncryption(ctx, conn, []string{bucket}, *opts.Encryption)
+			if err != nil {
+				return err
+			}
+		}
+		if len(opts.Tags) > 0 {
+			err = RunSetBucketTagging(ctx, conn, []string{bucket}, opts.Tags)
+			if err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
 
-func putKeys(conn s3iface.S3API, sources []string, destination string, mys3Conn mys3.Mys3) error {
+// RunPut uploads the local sources to the s3 destination.
+func RunPut(ctx context.Context, conn S3API, mys3Conn mys3.Mys3, sources []string, destination string, opts PutOptions) error {
+	result, err := putFiles(ctx, conn, mys3Conn, sources, destination, opts)
+	if err != nil || result.quota == nil {
+		// standard input is put without a summary
+		return err
+	}
+	if opts.Progress == nil {
+		result.quota.report(ctx)
+		summary(ctx, result.Added, 0, 0, 0, result.Took, opts.DryRun)
+	}
+	return nil
+}
+
+// putFiles uploads the local sources to the s3 destination, returning what it
+// did.
+func putFiles(ctx context.Context, conn S3API, mys3Conn mys3.Mys3, sources []string, destination string, opts PutOptions) (*Result, error) {
+	if opts.Accelerate {
+		if err := checkAccelerate(ctx, conn, []string{destination}); err != nil {
+			return nil, err
+		}
+	}
+	err := checkBucketACL(ctx, conn, destination, &opts.FilesystemOptions)
+	if err != nil {
+		return nil, err
+	}
 	start := time.Now()
+	for _, source := range sources {
+		if source == streamArg {
+			if len(sources) > 1 {
+				return nil, errors.New("standard input must be the only source")
+			}
+			err := putStream(ctx, mys3Conn, opts.Stdin, destination, opts)
+			if err != nil {
+				return nil, err
+			}
+			return &Result{Added: 1, Took: time.Since(start)}, nil
+		}
+	}
+	destination = putPrefix(sources, destination)
 	if !isS3Url(destination) {
-		return errors.New("s3:// url required for destination")
+		return nil, errors.New("s3:// url required for destination")
 	}
-	dfs := getFilesystem(conn, destination, mys3Conn)
-	var added int
-	err := iterateKeysParallel(conn, sources, func(file File) error {
-		reader, err := file.Reader()
+	opts.PartParallel = opts.Parallel
+	dfs := getFilesystem(conn, destination, opts.FilesystemOptions, mys3Conn)
+	quota := newTransferQuota(opts.Limits)
+	var added int64 // by the workers at once
+	var done tally
+	err = iterateKeysParallel(ctx, conn, sources, opts.Parallel, opts.FilesystemOptions, func(file File) error {
+		if !quota.allow(file) {
+			return nil
+		}
+		reader, err := file.Reader(ctx)
 		if err != nil {
 			return err
 		}
 		defer reader.Close()
 
-		if !quiet {
-			fmt.Fprintf(out, "A %s\n", file)
+		if !opts.Quiet {
+			fmt.Fprintf(outOf(ctx), "A %s\n", file)
 		}
-		err = dfs.Create(file)
+		opts.Progress.Start(file)
+		opts.Metrics.start()
+		started := time.Now()
+		if opts.Multipart || (opts.MultipartThreshold > 0 && file.Size() >= opts.MultipartThreshold) {
+			err = dfs.CreateMultiPart(ctx, file)
+		} else {
+			err = dfs.Create(ctx, file)
+		}
+		opts.Progress.track(file, err)
+		opts.Metrics.done("put", file.Size(), time.Since(started), err)
 		if err != nil {
-
 			return err
 		}
 
-		added += 1
+		done.add(file)
+		logTransfer(ctx, "put", file, file.String(), file.Size(), time.Since(started))
+		atomic.AddInt64(&added, 1)
 		return nil
 	}, mys3Conn)
 	if err != nil {
-		return err
+		return nil, done.canceled(ctx, err)
 	}
-	end := time.Now()
-	took := end.Sub(start)
-	summary(added, 0, 0, 0, took)
-
-	return nil
+	return newResult(quota, &done, time.Since(start), int(added), 0, 0, 0), nil
 }
 
-func multiPartPutKeys(conn s3iface.S3API, sources []string, destination string, mys3Conn mys3.Mys3) error {
-	start := time.Now()
+// putPrefix returns the destination of a put, taken to be a prefix when
+// uploading several files or a directory tree, even without a trailing /.
+func putPrefix(sources []string, destination string) string {
 	if !isS3Url(destination) {
-		return errors.New("s3:// url required for destination")
+		return destination
 	}
-	dfs := getFilesystem(conn, destination, mys3Conn)
-	var added int
-	err := iterateKeysParallel(conn, sources, func(file File) error {
-		reader, err := file.Reader()
-		if err != nil {
-			return err
-		}
-		defer reader.Close()
-		buffer := make([]byte, file.Size())
-		reader.Read(buffer)
-		if !quiet {
-			fmt.Fprintf(out, "A %s\n", file)
-		}
-		err = dfs.CreateMultiPart(file, buffer)
-		if err != nil {
-			return err
-		}
-		added += 1
-		return nil
-	}, mys3Conn)
-	if err != nil {
-		return err
+	_, key := extractBucketPath(destination)
+	if key == "" || strings.HasSuffix(key, "/") {
+		return destination
 	}
-	end := time.Now()
-	took := end.Sub(start)
-	summary(added, 0, 0, 0, took)
-
-	return nil
+	if len(sources) > 1 {
+		return destination + "/"
+	}
+	if info, err := os.Stat(sources[0]); err == nil && info.IsDir() {
+		return destination + "/"
+	}
+	return destination
 }
 
 func isS3Url(url string) bool {
 	return strings.HasPrefix(url, "s3:")
 }
 
-func getFilesystem(conn s3iface.S3API, url string, mys3Conn mys3.Mys3) Filesystem {
+func getFilesystem(conn S3API, url string, opts FilesystemOptions, mys3Conn mys3.Mys3) Filesystem {
 	if isS3Url(url) {
 		bucket, prefix := extractBucketPath(url)
-		return &S3Filesystem{conn: conn, bucket: bucket, path: prefix, mys3: mys3Conn}
+		return &S3Filesystem{conn: conn, bucket: bucket, path: prefix, mys3: mys3Conn, opts: opts}
 	} else {
-		return &LocalFilesystem{path: url}
+		return &LocalFilesystem{path: url, opts: opts}
+	}
+}
+
+// globChars are the characters that make a key argument a glob pattern.
+const globChars = "*?["
+
+// getKeysFilesystem is getFilesystem for key arguments, which may be glob
+// patterns such as s3://bucket/logs/2024-06-*.gz. These are expanded by
+// listing the prefix before the first wildcard and matching the keys.
+func getKeysFilesystem(conn S3API, url string, opts FilesystemOptions, mys3Conn mys3.Mys3) Filesystem {
+	if isS3Url(url) {
+		bucket, prefix := extractBucketPath(url)
+		if i := strings.IndexAny(prefix, globChars); i != -1 {
+			return &S3Filesystem{conn: conn, bucket: bucket, path: prefix[:i], mys3: mys3Conn, opts: opts, pattern: prefix}
+		}
 	}
+	return getFilesystem(conn, url, opts, mys3Conn)
 }
 
 type Action struct {
@@ -467,75 +1038,212 @@ type Action struct {
 	File   File
 }
 
-func processAction(action Action, fs2 Filesystem) error {
+func processAction(ctx context.Context, action Action, fs2 Filesystem, opts SyncOptions, manifest *manifestRecorder, failures *failureRecorder, done *tally) error {
+	var code string
 	switch action.Action {
 	case "create":
-		if !quiet {
-			fmt.Fprintf(out, "A %s\n", action.File.Relative())
-		}
-		if dryRun {
+		code = "A"
+	case "delete":
+		code = "D"
+	case "update":
+		code = "U"
+	default:
+		return nil
+	}
+	if action.Action != "delete" {
+		opts.Metrics.dequeue()
+	}
+	if !opts.Quiet {
+		fmt.Fprintf(outOf(ctx), "%s %s\n", code, action.File.Relative())
+	}
+	if opts.DryRun {
+		return nil
+	}
+	var err error
+	started := time.Now()
+	if action.Action == "delete" {
+		err = fs2.Delete(ctx, action.File.Relative())
+	} else {
+		opts.Progress.Start(action.File)
+		opts.Metrics.start()
+		err = fs2.Create(ctx, action.File)
+		opts.Progress.track(action.File, err)
+		opts.Metrics.done(action.Action, action.File.Size(), time.Since(started), err)
+	}
+	if err != nil {
+		if opts.IgnoreErrors {
+			if opts.Progress == nil && !opts.silent {
+				fmt.Fprintf(errOutOf(ctx), "E %s: %s\n", action.File.Relative(), err)
+			}
+			failures.record(action, err)
 			return nil
 		}
-		err := fs2.Create(action.File)
+		return err
+	}
+	if action.Action != "delete" {
+		done.add(action.File)
+		logTransfer(ctx, action.Action, action.File, action.File.Relative(), action.File.Size(), time.Since(started))
+	}
+	if manifest != nil && action.Action != "delete" {
+		manifest.record(ctx, action.File, fs2)
+	}
+	return nil
+}
+
+// RunSync synchronises src to dest, either of which may be local or s3.
+func RunSync(ctx context.Context, conn S3API, mys3Conn mys3.Mys3, src, dest string, opts SyncOptions) error {
+	result, err := syncFiles(ctx, conn, mys3Conn, src, dest, opts)
+	if err != nil || opts.Progress != nil {
+		return err
+	}
+	if n := len(result.Failures); n > 0 {
+		fmt.Fprintf(outOf(ctx), "%d failed\n", n)
+	}
+	result.quota.report(ctx)
+	summary(ctx, result.Added, result.Deleted, result.Updated, result.Unchanged, result.Took, opts.DryRun)
+	return nil
+}
+
+// syncFiles synchronises src to dest, returning what it did.
+func syncFiles(ctx context.Context, conn S3API, mys3Conn mys3.Mys3, src, dest string, opts SyncOptions) (*Result, error) {
+	start := time.Now()
+	// stops the run at the first failed action, without --ignore-errors
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	err := checkBucketACL(ctx, conn, dest, &opts.FilesystemOptions)
+	if err != nil {
+		return nil, err
+	}
+	fs1 := getFilesystem(conn, src, opts.FilesystemOptions, mys3Conn)
+	fs2 := getFilesystem(conn, dest, opts.FilesystemOptions, mys3Conn)
+	ch1 := fs1.Files(ctx)
+	ch2 := fs2.Files(ctx)
+	if opts.FromManifest != "" {
+		entries, err := ReadManifest(opts.FromManifest)
 		if err != nil {
-			if ignoreErrors {
-				fmt.Fprintf(out, "E %s: %s\n", action.File.Relative(), err)
-			} else {
-				return err
-			}
-		}
-	case "delete":
-		if !quiet {
-			fmt.Fprintf(out, "D %s\n", action.File.Relative())
+			return nil, err
 		}
-		if dryRun {
-			return nil
+		keys := map[string]bool{}
+		for _, entry := range entries {
+			keys[entry.Key] = true
 		}
-		err := fs2.Delete(action.File.Relative())
+		ch1 = filterFiles(ch1, keys)
+		ch2 = filterFiles(ch2, keys)
+	}
+	if opts.RetryFile != "" {
+		entries, err := ReadFailures(opts.RetryFile)
 		if err != nil {
-			return err
+			return nil, err
 		}
-	case "update":
-		if !quiet {
-			fmt.Fprintf(out, "U %s\n", action.File.Relative())
+		keys := map[string]bool{}
+		for _, entry := range entries {
+			keys[entry.Key] = true
 		}
-		if dryRun {
-			return nil
-		}
-		err := fs2.Create(action.File)
+		ch1 = filterFiles(ch1, keys)
+		ch2 = filterFiles(ch2, keys)
+	}
+	var manifest *manifestRecorder
+	if opts.Manifest != "" {
+		manifest = &manifestRecorder{}
+	}
+	failures := &failureRecorder{}
+	quota := newTransferQuota(opts.Limits)
+	var keep *ignoreRules
+	if opts.Delete {
+		keep, err = loadKeepRules(ctx, conn, dest, opts.Protect)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
-	return nil
-}
-
-func syncFiles(conn s3iface.S3API, src, dest string, mys3Conn mys3.Mys3) error {
-	start := time.Now()
-	fs1 := getFilesystem(conn, src, mys3Conn)
-	fs2 := getFilesystem(conn, dest, mys3Conn)
-	ch1 := fs1.Files()
+	var done tally
+	// deletes from s3 are sent in batches, rather than by the workers
+	var deletes *batchDeleter
+	s3fs, ok := fs2.(*S3Filesystem)
+	if ok && opts.Delete && !opts.DryRun {
+		deletes = newBatchDeleter(ctx, conn, func(file File, err error) error {
+			if opts.IgnoreErrors {
+				if opts.Progress == nil && !opts.silent {
+					fmt.Fprintf(errOutOf(ctx), "E %s: %s\n", file.Relative(), err)
+				}
+				failures.record(Action{"delete", file}, err)
+				return nil
+			}
+			return fmt.Errorf("%s: %s", file.Relative(), err)
+		})
+	}
 	f1 := <-ch1
-
-	ch2 := fs2.Files()
 	f2 := <-ch2
 
+	// the first action to fail, recorded for --failures-file
+	var failed error
+	var failedMu sync.Mutex
+	fail := func(action Action, err error) {
+		failedMu.Lock()
+		defer failedMu.Unlock()
+		if failed == nil {
+			failures.record(action, err)
+			failed = fmt.Errorf("%s: %s", action.File.Relative(), err)
+			cancel()
+		}
+	}
+
 	// create pool for processing
 	wg := sync.WaitGroup{}
 	q := make(chan Action, 1000)
-	for i := 0; i < parallel; i += 1 {
+	workers := opts.Parallel
+	var limiter *adaptiveLimiter
+	if opts.Adaptive {
+		limiter = newAdaptiveLimiter(opts.Parallel, adaptiveMaxParallel)
+		workers = adaptiveMaxParallel
+		stop := make(chan struct{})
+		defer close(stop)
+		go limiter.run(stop)
+	}
+	for i := 0; i < workers; i += 1 {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
 			for action := range q {
-				processAction(action, fs2)
+				if ctx.Err() != nil {
+					// drain the queue, the run is stopping
+					continue
+				}
+				if limiter != nil {
+					limiter.acquire()
+				}
+				err := processAction(ctx, action, fs2, opts, manifest, failures, &done)
+				if limiter != nil {
+					limiter.release(err)
+				}
+				if err != nil {
+					fail(action, err)
+				}
 			}
 		}()
 	}
 
+	// remove deletes file from the destination, in batches from s3
+	remove := func(file File) error {
+		if deletes == nil {
+			q <- Action{"delete", file}
+			return nil
+		}
+		if !opts.Quiet {
+			fmt.Fprintf(outOf(ctx), "D %s\n", file.Relative())
+		}
+		return deletes.add(s3fs.bucket, s3fs.keyOf(file.Relative()), file)
+	}
+	// with confirmation, deletes are counted before any is made
+	confirming := opts.Delete && opts.Confirm.enabled() && !opts.DryRun
+	var pending []File
+
 	var added, deleted, updated, unchanged int
-	var err error
 	for {
+		err = ctx.Err()
+		if err != nil {
+			break
+		}
 		err = fs1.Error()
 		if err != nil {
 			break
@@ -549,38 +1257,116 @@ func syncFiles(conn s3iface.S3API, src, dest string, mys3Conn mys3.Mys3) error {
 		// if f1 is nil or f1 < f2, create f1
 		// if f2 is nil or f1 > f2, delete f2
 		// if f1 = f2, check size, md5
+		// files the filter leaves out of fs1 are left alone in fs2, and only
+		// those it selects are deleted from fs2
 		if f1 == nil && f2 == nil {
 			break
 		} else if f2 == nil || (f1 != nil && f1.Relative() < f2.Relative()) {
-			q <- Action{"create", f1}
-			added += 1
+			if !opts.Filter.selects(f1) {
+				logDecision(ctx, "skip", f1, f1.Relative(), "left out by the filter")
+			} else if !quota.allow(f1) {
+				logDecision(ctx, "skip", f1, f1.Relative(), "over the transfer limits")
+			} else {
+				logDecision(ctx, "add", f1, f1.Relative(), "not in the destination")
+				opts.Progress.Queued(f1)
+				opts.Metrics.queue()
+				q <- Action{"create", f1}
+				added += 1
+			}
 			f1 = <-ch1
 		} else if f1 == nil || (f2 != nil && f1.Relative() > f2.Relative()) {
-			if deleteExtra {
-				q <- Action{"delete", f2}
+			deleting := opts.Delete && opts.Filter.selects(f2)
+			if !deleting {
+				logDecision(ctx, "leave", f2, f2.Relative(), "not in the source, without --delete or left out by the filter")
+			}
+			if deleting && keep.protected(filepath.ToSlash(f2.Relative())) {
+				logDecision(ctx, "keep", f2, f2.Relative(), "not in the source, but protected by the keep rules")
+				if !opts.Quiet {
+					fmt.Fprintf(outOf(ctx), "K %s\n", f2.Relative())
+				}
+			} else if deleting {
+				logDecision(ctx, "delete", f2, f2.Relative(), "not in the source")
+				if confirming {
+					// held until confirmed
+					pending = append(pending, f2)
+				} else if err = remove(f2); err != nil {
+					break
+				}
 				deleted += 1
 			}
 			f2 = <-ch2
-		} else if f1.Size() != f2.Size() || !bytes.Equal(f1.MD5(), f2.MD5()) {
-			q <- Action{"update", f1}
-			updated += 1
+		} else if !opts.Filter.selects(f1) {
+			logDecision(ctx, "skip", f1, f1.Relative(), "left out by the filter")
+			f1 = <-ch1
+			f2 = <-ch2
+		} else if !sameContents(ctx, f1, f2) {
+			differs := "contents differ"
+			if f1.Size() != f2.Size() {
+				differs = fmt.Sprintf("size %d differs from %d", f1.Size(), f2.Size())
+			}
+			if lf, ok := f2.(*LocalFile); ok && !opts.Overwrite.replaces(f1, lf.info) {
+				// the local file is kept
+				logDecision(ctx, "skip", f2, f2.Relative(), differs+", but the local file is kept by the overwrite policy")
+				if !opts.Quiet {
+					fmt.Fprintf(outOf(ctx), "S %s\n", f2.Relative())
+				}
+				unchanged += 1
+			} else if quota.allow(f1) {
+				logDecision(ctx, "update", f1, f1.Relative(), differs)
+				opts.Progress.Queued(f1)
+				opts.Metrics.queue()
+				q <- Action{"update", f1}
+				updated += 1
+			} else {
+				logDecision(ctx, "skip", f1, f1.Relative(), differs+", but over the transfer limits")
+			}
 			f1 = <-ch1
 			f2 = <-ch2
 		} else {
+			logDecision(ctx, "unchanged", f1, f1.Relative(), "same size and md5")
 			unchanged += 1
 			f1 = <-ch1
 			f2 = <-ch2
 		}
 	}
 
+	if err == nil && len(pending) > 0 {
+		err = opts.Confirm.confirm(ctx, len(pending), fmt.Sprintf("delete %d files from %s", len(pending), dest))
+		for i := 0; err == nil && i < len(pending); i++ {
+			err = remove(pending[i])
+		}
+	}
+	if err == nil && deletes != nil {
+		// final batch
+		err = deletes.flush()
+	}
 	close(q)
 	wg.Wait()
+	if failed != nil {
+		// rather than the cancellation it caused
+		err = failed
+		if opts.FailuresFile != "" {
+			if e := failures.write(opts.FailuresFile); e != nil {
+				return nil, e
+			}
+		}
+	}
 	if err != nil {
-		return err
+		return nil, done.canceled(parent, err)
 	}
-
-	end := time.Now()
-	took := end.Sub(start)
-	summary(added, deleted, updated, unchanged, took)
-	return nil
+	if manifest != nil {
+		err = manifest.write(opts.Manifest)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if opts.FailuresFile != "" {
+		err = failures.write(opts.FailuresFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	result := newResult(quota, &done, time.Since(start), added, deleted, updated, unchanged)
+	result.Failures = failures.sorted()
+	return result, nil
 }
@@ -0,0 +1,177 @@
+package s3
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Target is a named endpoint of the config file, chosen with --target. Its
+// settings are the defaults of the flags of the same names.
+type Target struct {
+	Endpoint    string
+	Region      string
+	Profile     string // of the shared aws config, whose credentials are used
+	PathStyle   *bool  // address buckets by path, or by host name if false
+	ACL         string // of uploads and buckets made
+	ConfirmOver int    // keys removed before asking, 0 never asks
+}
+
+// configFile returns the path of the config file,
+// ~/.config/s3/config.yaml unless set by S3_CONFIG_FILE.
+func configFile() string {
+	if path := os.Getenv("S3_CONFIG_FILE"); path != "" {
+		return path
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".config", "s3", "config.yaml")
+}
+
+// LoadTarget returns the target name of the config file at path, which is
+// yaml of the form:
+//
+//	targets:
+//	  minio-prod:
+//	    endpoint: https://minio.example.com:9000
+//	    region: eu-west-1
+//	    profile: minio
+//	    path-style: true
+//	    acl: private
+//	    confirm-over: 100
+func LoadTarget(path, name string) (*Target, error) {
+	targets, err := readConfig(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("--target %s: no config file %s", name, path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	settings, ok := targets[name]
+	if !ok {
+		return nil, fmt.Errorf("--target %s: not found in %s", name, path)
+	}
+	target := &Target{}
+	for key, value := range settings {
+		switch key {
+		case "endpoint":
+			target.Endpoint = value
+		case "region":
+			target.Region = value
+		case "profile":
+			target.Profile = value
+		case "path-style":
+			pathStyle, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: path-style of target %s must be true or false, not %q", path, name, value)
+			}
+			target.PathStyle = &pathStyle
+		case "acl":
+			if !ValidACLs[value] {
+				return nil, fmt.Errorf("%s: acl of target %s isn't valid: %q", path, name, value)
+			}
+			target.ACL = value
+		case "confirm-over":
+			over, err := strconv.Atoi(value)
+			if err != nil || over < 0 {
+				return nil, fmt.Errorf("%s: confirm-over of target %s must be a number of keys, not %q", path, name, value)
+			}
+			target.ConfirmOver = over
+		default:
+			return nil, fmt.Errorf("%s: unknown setting %q of target %s", path, key, name)
+		}
+	}
+	return target, nil
+}
+
+// readConfig returns the settings of each target of the config file at path.
+// It reads the yaml of the targets mapping only: keys and plain or quoted
+// scalar values, nested by indentation, and comments.
+func readConfig(path string) (map[string]map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	targets := map[string]map[string]string{}
+	var settings map[string]string // of the target being read
+	inTargets := false
+	targetIndent, settingIndent := -1, -1
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("%s:%d: indented with a tab", path, n)
+		}
+		indent := len(line) - len(trimmed)
+		i := strings.Index(trimmed, ":")
+		if i <= 0 || (i+1 < len(trimmed) && trimmed[i+1] != ' ') {
+			return nil, fmt.Errorf("%s:%d: expected key: value", path, n)
+		}
+		key := unquoteYAML(trimmed[:i])
+		value := unquoteYAML(stripYAMLComment(strings.TrimSpace(trimmed[i+1:])))
+		switch {
+		case indent == 0:
+			// only targets are read, other top level keys are left alone
+			inTargets = key == "targets"
+			targetIndent, settingIndent = -1, -1
+		case !inTargets:
+		case targetIndent < 0 || indent == targetIndent:
+			if value != "" {
+				return nil, fmt.Errorf("%s:%d: target %s has a value rather than settings", path, n, key)
+			}
+			targetIndent, settingIndent = indent, -1
+			settings = map[string]string{}
+			targets[key] = settings
+		case indent > targetIndent && (settingIndent < 0 || indent == settingIndent):
+			settingIndent = indent
+			settings[key] = value
+		default:
+			return nil, fmt.Errorf("%s:%d: unexpected indentation", path, n)
+		}
+	}
+	return targets, scanner.Err()
+}
+
+// stripYAMLComment returns value without any comment after it.
+func stripYAMLComment(value string) string {
+	if value != "" && (value[0] == '"' || value[0] == '\'') {
+		// up to the closing quote
+		for i := 1; i < len(value); i++ {
+			switch {
+			case value[0] == '"' && value[i] == '\\':
+				i++
+			case value[i] == value[0]:
+				if value[0] == '\'' && i+1 < len(value) && value[i+1] == '\'' {
+					i++
+					continue
+				}
+				return value[:i+1]
+			}
+		}
+		return value
+	}
+	if i := strings.Index(value, " #"); i >= 0 {
+		return strings.TrimSpace(value[:i])
+	}
+	return value
+}
+
+// unquoteYAML returns a scalar without its quotes, if quoted.
+func unquoteYAML(s string) string {
+	if len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'")
+	}
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		if unquoted, err := strconv.Unquote(s); err == nil {
+			return unquoted
+		}
+	}
+	return s
+}
@@ -0,0 +1,43 @@
+package s3
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrNotConfirmed is returned when a removal isn't confirmed.
+var ErrNotConfirmed = errors.New("not confirmed, nothing removed")
+
+// Confirmation governs asking before destructive commands remove keys.
+type Confirmation struct {
+	Interactive bool      // ask before removing anything
+	Over        int       // ask before removing more than this many keys, 0 never
+	Force       bool      // never ask
+	In          io.Reader // answers, normally stdin
+}
+
+// enabled reports whether removals might need confirming, so are counted
+// before any is made.
+func (c Confirmation) enabled() bool {
+	return !c.Force && (c.Interactive || c.Over > 0)
+}
+
+// confirm asks whether to go ahead with the prompt, removing count keys,
+// when there are enough to call for it, failing with ErrNotConfirmed unless
+// answered yes.
+func (c Confirmation) confirm(ctx context.Context, count int, prompt string) error {
+	if !c.enabled() || count == 0 || (!c.Interactive && count <= c.Over) {
+		return nil
+	}
+	fmt.Fprintf(errOutOf(ctx), "%s? [y/N] ", prompt)
+	answer, _ := bufio.NewReader(c.In).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+	return ErrNotConfirmed
+}
@@ -0,0 +1,207 @@
+package s3
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	dashboardRefresh = 500 * time.Millisecond
+	dashboardRows    = 20 // transfers shown, the longest running first
+	dashboardErrors  = 5  // most recent errors shown
+)
+
+// Dashboard redraws a full screen summary of the transfers in progress, fed
+// by progress events: each active transfer with its throughput, the most
+// recent errors, and overall progress with an ETA.
+type Dashboard struct {
+	mu      sync.Mutex
+	w       io.Writer
+	workers int
+	started time.Time
+	active  map[string]*activeTransfer
+	planned map[string]bool // files queued ahead of their transfer
+
+	plannedFiles, plannedBytes int64
+	doneFiles, doneBytes       int64
+	failed                     int
+	errors                     []string
+
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+type activeTransfer struct {
+	key     string
+	bytes   int64
+	total   int64
+	started time.Time
+}
+
+// NewDashboard returns a dashboard drawing to w, for transfers run by the
+// given number of workers.
+func NewDashboard(w io.Writer, workers int) *Dashboard {
+	return &Dashboard{
+		w:       w,
+		workers: workers,
+		started: time.Now(),
+		active:  map[string]*activeTransfer{},
+		planned: map[string]bool{},
+	}
+}
+
+// Start redraws the dashboard periodically until Stop.
+func (d *Dashboard) Start() {
+	d.stop = make(chan struct{})
+	d.stopped = make(chan struct{})
+	go func() {
+		defer close(d.stopped)
+		ticker := time.NewTicker(dashboardRefresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				d.render()
+			case <-d.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops redrawing, leaving the final state on screen.
+func (d *Dashboard) Stop() {
+	if d.stop != nil {
+		close(d.stop)
+		<-d.stopped
+		d.stop = nil
+	}
+	d.render()
+}
+
+// queue counts file towards the total to transfer.
+func (d *Dashboard) queue(key string, size int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.plan(key, size)
+}
+
+// plan counts a file towards the total, once. The caller must hold the lock.
+func (d *Dashboard) plan(key string, size int64) {
+	if d.planned[key] {
+		return
+	}
+	d.planned[key] = true
+	d.plannedFiles += 1
+	d.plannedBytes += size
+}
+
+func (d *Dashboard) handle(event ProgressEvent) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	switch event.Event {
+	case "start":
+		d.plan(event.Key, event.Total)
+		d.active[event.Key] = &activeTransfer{key: event.Key, total: event.Total, started: time.Now()}
+	case "chunk":
+		if t, ok := d.active[event.Key]; ok {
+			t.bytes = event.Bytes
+		}
+	case "done":
+		delete(d.active, event.Key)
+		delete(d.planned, event.Key)
+		d.doneFiles += 1
+		d.doneBytes += event.Total
+	case "error":
+		delete(d.active, event.Key)
+		delete(d.planned, event.Key)
+		d.failed += 1
+		d.plannedFiles -= 1
+		d.plannedBytes -= event.Total
+		d.errors = append(d.errors, fmt.Sprintf("%s: %s", event.Key, event.Error))
+		if len(d.errors) > dashboardErrors {
+			d.errors = d.errors[len(d.errors)-dashboardErrors:]
+		}
+	}
+}
+
+func (d *Dashboard) render() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	elapsed := now.Sub(d.started)
+
+	transfers := make([]*activeTransfer, 0, len(d.active))
+	transferred := d.doneBytes
+	for _, t := range d.active {
+		transfers = append(transfers, t)
+		transferred += t.bytes
+	}
+	sort.Slice(transfers, func(i, j int) bool {
+		if !transfers[i].started.Equal(transfers[j].started) {
+			return transfers[i].started.Before(transfers[j].started)
+		}
+		return transfers[i].key < transfers[j].key
+	})
+
+	var b strings.Builder
+	// home the cursor and clear the screen
+	b.WriteString("\x1b[H\x1b[2J")
+	speed := rate(transferred, elapsed)
+	eta := "-"
+	if speed > 0 {
+		remaining := d.plannedBytes - transferred
+		if remaining < 0 {
+			remaining = 0
+		}
+		eta = time.Duration(float64(remaining) / speed * float64(time.Second)).Round(time.Second).String()
+	}
+	fmt.Fprintf(&b, "%d/%d files  %s/%s  %s/s  elapsed %s  eta %s\n",
+		d.doneFiles, d.plannedFiles, formatBytes(transferred), formatBytes(d.plannedBytes),
+		formatBytes(int64(speed)), elapsed.Round(time.Second), eta)
+	fmt.Fprintf(&b, "workers: %d/%d active  %d failed\n\n", len(transfers), d.workers, d.failed)
+	for i, t := range transfers {
+		if i == dashboardRows {
+			fmt.Fprintf(&b, "  ... and %d more\n", len(transfers)-dashboardRows)
+			break
+		}
+		percent := 100
+		if t.total > 0 {
+			percent = int(t.bytes * 100 / t.total)
+		}
+		fmt.Fprintf(&b, "  %10s/s %3d%%  %s\n", formatBytes(int64(rate(t.bytes, now.Sub(t.started)))), percent, t.key)
+	}
+	if len(d.errors) > 0 {
+		b.WriteString("\nerrors:\n")
+		for _, e := range d.errors {
+			fmt.Fprintf(&b, "  %s\n", e)
+		}
+	}
+	io.WriteString(d.w, b.String())
+}
+
+// rate returns bytes per second.
+func rate(bytes int64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(bytes) / elapsed.Seconds()
+}
+
+// formatBytes returns n in binary units, e.g. 1.5MiB.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
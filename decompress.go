@@ -0,0 +1,138 @@
+package s3
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// DecompressMode selects which fetched objects are gunzipped.
+type DecompressMode int
+
+const (
+	DecompressNever  DecompressMode = iota
+	DecompressAuto                  // .gz keys and those stored with Content-Encoding gzip
+	DecompressAlways                // every key
+)
+
+// ParseDecompressMode parses a --decompress value: never, auto or always.
+func ParseDecompressMode(value string) (DecompressMode, error) {
+	switch value {
+	case "never", "":
+		return DecompressNever, nil
+	case "auto":
+		return DecompressAuto, nil
+	case "always":
+		return DecompressAlways, nil
+	}
+	return DecompressNever, fmt.Errorf("invalid --decompress %q: expected never, auto or always", value)
+}
+
+// gzipExt is the extension of gzipped keys, dropped from their names when
+// downloaded decompressed
+const gzipExt = ".gz"
+
+// applies reports whether file should be decompressed. For auto, an S3 key
+// without the extension is checked for its Content-Encoding, fetching it if
+// the object hasn't been read yet.
+func (mode DecompressMode) applies(ctx context.Context, file File) bool {
+	switch mode {
+	case DecompressAlways:
+		return true
+	case DecompressAuto:
+		if strings.HasSuffix(file.String(), gzipExt) {
+			return true
+		}
+		if s3f, ok := file.(*S3File); ok {
+			return strings.EqualFold(s3f.ContentEncoding(ctx), "gzip")
+		}
+	}
+	return false
+}
+
+// decompressReader returns reader gunzipping the contents of file, if mode
+// applies to it. In auto mode content that isn't gzipped after all, such as
+// when the http client has already decoded it, is passed through as is.
+func decompressReader(ctx context.Context, reader io.ReadCloser, file File, mode DecompressMode) (io.ReadCloser, error) {
+	if !mode.applies(ctx, file) {
+		return reader, nil
+	}
+	buffered := bufio.NewReader(reader)
+	if mode == DecompressAuto {
+		magic, _ := buffered.Peek(2)
+		if len(magic) < 2 || magic[0] != 0x1f || magic[1] != 0x8b {
+			return readCloser{buffered, reader}, nil
+		}
+	}
+	gz, err := gzip.NewReader(buffered)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+	return readCloser{gz, reader}, nil
+}
+
+// readCloser reads from one reader, closing another underlying it.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// downloadDecompressed downloads file gunzipped to fpath, via a partial file
+// as downloadFile does. Decompressed downloads are not resumed.
+func downloadDecompressed(ctx context.Context, file File, fpath string, opts GetOptions) (int64, error) {
+	raw, err := file.Reader(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer raw.Close()
+	// check the stored bytes, as they are read for decompression
+	hash := md5.New()
+	checksum, err := newRecordedChecksum(ctx, file, opts.ChecksumAlgorithm)
+	if err != nil {
+		return 0, err
+	}
+	tee := readCloser{io.TeeReader(raw, io.MultiWriter(hash, checksum)), raw}
+	reader, err := decompressReader(ctx, tee, file, opts.Decompress)
+	if err != nil {
+		return 0, err
+	}
+	partial := fpath + partialSuffix
+	writer, err := os.Create(partial)
+	if err != nil {
+		return 0, err
+	}
+	defer writer.Close()
+	nbytes, err := io.Copy(writeContext(ctx, writer), opts.Progress.wrap(file, reader))
+	if err != nil {
+		if done(ctx) {
+			// not resumed, so of no use
+			writer.Close()
+			os.Remove(partial)
+		}
+		return nbytes, err
+	}
+	err = writer.Close()
+	if err != nil {
+		return nbytes, err
+	}
+	if !opts.NoVerify {
+		_, err = io.Copy(ioutil.Discard, tee)
+		if err == nil {
+			err = checkMD5(ctx, file, hash.Sum(nil))
+		}
+		if err == nil {
+			err = checksum.check(file)
+		}
+		if err != nil {
+			os.Remove(partial)
+			return nbytes, err
+		}
+	}
+	return nbytes, os.Rename(partial, fpath)
+}
@@ -0,0 +1,191 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// partialSuffix marks a download in progress. A failed download leaves the
+// partial file behind, and the next get resumes from where it stopped. One
+// interrupted through its context is removed, unless resuming.
+const partialSuffix = ".s3part"
+
+// downloadFile downloads file to fpath via a partial file, resuming from the
+// end of any partial file left by an earlier attempt. With Resume, an
+// existing shorter file at fpath is also taken to be a partial download.
+// Returns the number of bytes fetched.
+func downloadFile(ctx context.Context, file File, fpath string, opts GetOptions) (int64, error) {
+	partial := fpath + partialSuffix
+	if _, err := os.Stat(partial); os.IsNotExist(err) && opts.Resume {
+		if info, err := os.Stat(fpath); err == nil && info.Mode().IsRegular() {
+			err = os.Rename(fpath, partial)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+	var offset int64
+	if info, err := os.Stat(partial); err == nil {
+		offset = info.Size()
+	}
+	s3f, ok := file.(*S3File)
+	if !ok || offset > file.Size() {
+		// can't resume, start over
+		offset = 0
+	}
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if offset > 0 {
+		flags = os.O_WRONLY | os.O_APPEND
+	}
+	writer, err := os.OpenFile(partial, flags, 0666)
+	if err != nil {
+		return 0, err
+	}
+	defer writer.Close()
+
+	var nbytes int64
+	w := writeContext(ctx, opts.Progress.wrapWriter(file, writer))
+	hash := md5.New()
+	checksum, err := newRecordedChecksum(ctx, file, opts.ChecksumAlgorithm)
+	if err != nil {
+		return 0, err
+	}
+	if offset == 0 {
+		nbytes, err = download(ctx, file, io.MultiWriter(w, hash, checksum), opts.Ranges)
+	} else if offset < file.Size() {
+		nbytes, err = s3f.downloadFrom(ctx, offset, w, opts.Ranges)
+		if isAWSErrorCode(err, "PreconditionFailed") {
+			// the object changed, so the partial file may be of another
+			// version: start over with the one there now
+			offset = 0
+			err = s3f.reload(ctx)
+			if err == nil {
+				err = writer.Truncate(0)
+			}
+			if err == nil {
+				checksum, err = newRecordedChecksum(ctx, file, opts.ChecksumAlgorithm)
+			}
+			if err == nil {
+				nbytes, err = download(ctx, file, io.MultiWriter(w, hash, checksum), opts.Ranges)
+			}
+		}
+	}
+	if err != nil {
+		if done(ctx) && !opts.Resume || isAWSErrorCode(err, "PreconditionFailed") {
+			// nothing to resume from, or ranges of a version since replaced
+			writer.Close()
+			os.Remove(partial)
+		}
+		return nbytes, err
+	}
+	err = writer.Close()
+	if err != nil {
+		return nbytes, err
+	}
+	if !opts.NoVerify {
+		if offset > 0 {
+			err = verifyDownload(ctx, file, partial, checksum)
+		} else {
+			err = checkMD5(ctx, file, hash.Sum(nil))
+			if err == nil {
+				err = checksum.check(file)
+			}
+		}
+		if err != nil {
+			// the partial file can't be trusted, so don't resume from it
+			os.Remove(partial)
+			return nbytes, err
+		}
+	}
+	return nbytes, os.Rename(partial, fpath)
+}
+
+// download writes the contents of file to w, verifying each part of
+// multipart uploads that recorded part checksums, and fetching large objects
+// in concurrent ranges.
+func download(ctx context.Context, file File, w io.Writer, ranges RangeOptions) (int64, error) {
+	if s3f, ok := file.(*S3File); ok && multipartParts(aws.ToString(s3f.object.ETag)) > 0 {
+		metadata, err := s3f.Metadata(ctx)
+		if err != nil {
+			return 0, err
+		}
+		if partSize, sums, ok := partChecksums(metadata); ok {
+			err = s3f.copyVerified(ctx, w, partSize, sums, ranges.Concurrency)
+			if err != nil {
+				return 0, err
+			}
+			return s3f.Size(), nil
+		}
+	}
+	if s3f, ok := file.(*S3File); ok && ranges.applies(s3f.Size()) {
+		return s3f.downloadFrom(ctx, 0, w, ranges)
+	}
+	reader, err := file.Reader(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+	return io.Copy(w, reader)
+}
+
+// streamFrom writes the object from offset onwards to w, failing with
+// PreconditionFailed if it's no longer the version listed.
+func (s3f *S3File) streamFrom(ctx context.Context, offset int64, w io.Writer) (int64, error) {
+	input := s3.GetObjectInput{
+		Bucket:  aws.String(s3f.bucket),
+		Key:     s3f.object.Key,
+		Range:   aws.String(fmt.Sprintf("bytes=%d-", offset)),
+		IfMatch: s3f.object.ETag,
+
+		SSECustomerAlgorithm: s3f.encryption.customerAlgorithm(),
+		SSECustomerKey:       s3f.encryption.customerKey(),
+		SSECustomerKeyMD5:    s3f.encryption.customerKeyMD5(),
+	}
+	output, err := s3f.mys3.GetObject(ctx, &input)
+	if err != nil {
+		return 0, err
+	}
+	defer output.Body.Close()
+	return io.Copy(w, output.Body)
+}
+
+// verifyDownload checks a resumed download against the md5 of file, where
+// known, and its recorded checksum.
+func verifyDownload(ctx context.Context, file File, fpath string, checksum *recordedChecksum) error {
+	expected := file.MD5(ctx)
+	if expected == nil && checksum == nil {
+		return nil
+	}
+	f, err := os.Open(fpath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	hash := md5.New()
+	_, err = io.Copy(io.MultiWriter(hash, checksum), f)
+	if err != nil {
+		return err
+	}
+	if expected != nil && !bytes.Equal(hash.Sum(nil), expected) {
+		return fmt.Errorf("%s: resumed download failed checksum verification", file)
+	}
+	return checksum.check(file)
+}
+
+// checkMD5 compares the md5 of downloaded content with that of file: the
+// ETag of simple uploads, or the md5 recorded in metadata of our multipart
+// uploads. Passes when the md5 is unknown.
+func checkMD5(ctx context.Context, file File, sum []byte) error {
+	expected := file.MD5(ctx)
+	if expected == nil || bytes.Equal(sum, expected) {
+		return nil
+	}
+	return fmt.Errorf("%s: download failed checksum verification (md5 %x, expected %x)", file, sum, expected)
+}
@@ -0,0 +1,116 @@
+package s3
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Encryption is the server-side encryption requested for uploaded keys.
+type Encryption struct {
+	Algorithm string // AES256 or aws:kms, or empty for the bucket default
+	KMSKeyID  string // key for aws:kms, or empty for the aws managed key
+	// raw 256 bit key for SSE-C, which must then be given to read the keys
+	// back
+	CustomerKey string
+}
+
+// customerKeySize is the size of an SSE-C key in bytes.
+const customerKeySize = 32
+
+// ParseEncryption checks the --sse, --sse-kms-key-id and --sse-c-key flags.
+func ParseEncryption(algorithm, kmsKeyID, customerKey string) (Encryption, error) {
+	if customerKey != "" {
+		if algorithm != "" || kmsKeyID != "" {
+			return Encryption{}, errors.New("--sse-c-key and --sse are mutually exclusive")
+		}
+		key, err := ParseCustomerKey(customerKey)
+		if err != nil {
+			return Encryption{}, err
+		}
+		return Encryption{CustomerKey: key}, nil
+	}
+	if algorithm == "" {
+		if kmsKeyID != "" {
+			return Encryption{}, errors.New("--sse-kms-key-id requires --sse aws:kms")
+		}
+		return Encryption{}, nil
+	}
+	name, err := sseAlgorithm(algorithm)
+	if err != nil {
+		return Encryption{}, err
+	}
+	if kmsKeyID != "" && name != string(types.ServerSideEncryptionAwsKms) {
+		return Encryption{}, errors.New("--sse-kms-key-id requires --sse aws:kms")
+	}
+	return Encryption{Algorithm: name, KMSKeyID: kmsKeyID}, nil
+}
+
+// ParseCustomerKey reads an SSE-C key, given as base64 or as the name of a
+// file holding it, raw or base64 encoded.
+func ParseCustomerKey(value string) (string, error) {
+	data := []byte(value)
+	if content, err := ioutil.ReadFile(value); err == nil {
+		if len(content) == customerKeySize {
+			return string(content), nil
+		}
+		data = content
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != customerKeySize {
+		return "", errors.New("--sse-c-key must be a 256 bit key, base64 encoded or in a file")
+	}
+	return string(key), nil
+}
+
+// algorithm returns the ServerSideEncryption of a request, empty if unset.
+func (e Encryption) algorithm() types.ServerSideEncryption {
+	return types.ServerSideEncryption(e.Algorithm)
+}
+
+// keyID returns the SSEKMSKeyId of a request, nil if unset.
+func (e Encryption) keyID() *string {
+	if e.KMSKeyID == "" {
+		return nil
+	}
+	return aws.String(e.KMSKeyID)
+}
+
+// customerAlgorithm returns the SSECustomerAlgorithm of a request, nil
+// without a customer key.
+func (e Encryption) customerAlgorithm() *string {
+	if e.CustomerKey == "" {
+		return nil
+	}
+	return aws.String(string(types.ServerSideEncryptionAes256))
+}
+
+// md5ETags reports whether S3 gives uploads encrypted this way ETags derived
+// from the md5 of their content, which SSE-KMS and SSE-C encryption don't.
+func (e Encryption) md5ETags() bool {
+	return e.Algorithm != string(types.ServerSideEncryptionAwsKms) && e.CustomerKey == ""
+}
+
+// customerKey returns the SSECustomerKey of a request, base64 encoded, nil
+// if unset.
+func (e Encryption) customerKey() *string {
+	if e.CustomerKey == "" {
+		return nil
+	}
+	return aws.String(base64.StdEncoding.EncodeToString([]byte(e.CustomerKey)))
+}
+
+// customerKeyMD5 returns the SSECustomerKeyMD5 of a request, nil if unset,
+// which the sdk doesn't add itself.
+func (e Encryption) customerKeyMD5() *string {
+	if e.CustomerKey == "" {
+		return nil
+	}
+	sum := md5.Sum([]byte(e.CustomerKey))
+	return aws.String(base64.StdEncoding.EncodeToString(sum[:]))
+}
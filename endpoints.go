@@ -0,0 +1,188 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/barnybug/s3/pkg/mys3"
+)
+
+// endpointCooldown is how long an endpoint that failed to connect is passed
+// over before requests try it again
+const endpointCooldown = 30 * time.Second
+
+// parseEndpoints splits a comma separated --endpoint value into its addresses
+func parseEndpoints(value string) []string {
+	var endpoints []string
+	for _, e := range strings.Split(value, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			endpoints = append(endpoints, e)
+		}
+	}
+	return endpoints
+}
+
+// fipsRegions are those with FIPS 140-2 validated s3 endpoints
+var fipsRegions = map[string]bool{
+	"us-east-1": true, "us-east-2": true, "us-west-1": true, "us-west-2": true,
+	"ca-central-1": true, "us-gov-east-1": true, "us-gov-west-1": true,
+}
+
+// awsEndpoint returns the s3 endpoint of region for --use-fips and
+// --use-dualstack, which is reached over IPv6 as well as IPv4, or "" for the
+// sdk's own without either
+func awsEndpoint(region string, fips, dualStack bool) (string, error) {
+	if !fips && !dualStack {
+		return "", nil
+	}
+	if fips && !fipsRegions[region] {
+		return "", fmt.Errorf("--use-fips: s3 has no FIPS endpoint in region %q", region)
+	}
+	suffix := "amazonaws.com"
+	if strings.HasPrefix(region, "cn-") {
+		suffix = "amazonaws.com.cn"
+	}
+	host := "s3"
+	if fips {
+		host = "s3-fips"
+	}
+	if dualStack {
+		host += ".dualstack"
+	}
+	return fmt.Sprintf("https://%s.%s.%s", host, region, suffix), nil
+}
+
+// endpointPool spreads requests over equivalent endpoints, such as the nodes
+// of a minio cluster, moving on to the next endpoint when one cannot be
+// reached.
+type endpointPool struct {
+	mu        sync.Mutex
+	endpoints []*url.URL
+	downUntil []time.Time
+	current   int
+	now       func() time.Time
+}
+
+func newEndpointPool(endpoints []string) (*endpointPool, error) {
+	pool := &endpointPool{now: time.Now}
+	for _, e := range endpoints {
+		u, err := mys3.ParseEndpoint(e)
+		if err != nil {
+			return nil, err
+		}
+		pool.endpoints = append(pool.endpoints, u)
+	}
+	pool.downUntil = make([]time.Time, len(pool.endpoints))
+	return pool, nil
+}
+
+// pick returns the index of the endpoint to send the next request to: the
+// current one while it is healthy, else the next healthy one, else the one
+// that has been down longest.
+func (p *endpointPool) pick() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	best := p.current
+	for i := range p.endpoints {
+		n := (p.current + i) % len(p.endpoints)
+		if !now.Before(p.downUntil[n]) {
+			p.current = n
+			return n
+		}
+		if p.downUntil[n].Before(p.downUntil[best]) {
+			best = n
+		}
+	}
+	return best
+}
+
+// markDown takes an endpoint out of rotation for the cooldown, returning
+// whether another endpoint is available to retry on
+func (p *endpointPool) markDown(n int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	p.downUntil[n] = now.Add(endpointCooldown)
+	for i := range p.endpoints {
+		if !now.Before(p.downUntil[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// rewrite points the request at endpoint n, keeping any bucket subdomain
+func (p *endpointPool) rewrite(u *url.URL, n int) {
+	target := p.endpoints[n]
+	host := u.Host
+	for _, e := range p.endpoints {
+		if host == e.Host {
+			host = ""
+			break
+		}
+		if strings.HasSuffix(host, "."+e.Host) {
+			host = strings.TrimSuffix(host, e.Host)
+			break
+		}
+	}
+	u.Scheme = target.Scheme
+	u.Host = host + target.Host
+}
+
+// install adds the failover middleware to a client. The endpoint is chosen
+// for each attempt before signing, as the signature covers the host.
+func (p *endpointPool) install(stack *middleware.Stack) error {
+	failover := middleware.FinalizeMiddlewareFunc("s3.EndpointFailover", func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+		req, ok := in.Request.(*smithyhttp.Request)
+		if !ok {
+			return next.HandleFinalize(ctx, in)
+		}
+		n := p.pick()
+		p.rewrite(req.URL, n)
+		req.Host = ""
+		out, metadata, err := next.HandleFinalize(ctx, in)
+		if isConnectionError(err) && p.markDown(n) {
+			err = &failoverError{err}
+		}
+		return out, metadata, err
+	})
+	return stack.Finalize.Insert(failover, "Signing", middleware.Before)
+}
+
+// failoverError is a connection error retried on another endpoint.
+type failoverError struct {
+	err error
+}
+
+func (e *failoverError) Error() string {
+	return e.err.Error()
+}
+
+func (e *failoverError) Unwrap() error {
+	return e.err
+}
+
+// RetryableError marks the error retryable for the sdk's retryer.
+func (e *failoverError) RetryableError() bool {
+	return true
+}
+
+// isConnectionError reports whether a request failed without reaching the
+// endpoint
+func isConnectionError(err error) bool {
+	var uerr *url.Error
+	if !errors.As(err, &uerr) {
+		return false
+	}
+	var nerr net.Error
+	return errors.As(uerr.Err, &nerr)
+}
@@ -0,0 +1,123 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const mib = 1024 * 1024
+
+// part sizes commonly used by uploaders, tried in turn when matching a
+// multipart ETag: ours, s3manager's, the aws cli's and the S3 minimum.
+var candidatePartSizes = []int64{PART_SIZE, 10 * mib, 8 * mib, 16 * mib, 5 * mib}
+
+// multipartParts returns the part count of a multipart upload ETag
+// ("<md5>-<parts>"), or 0 if etag is a plain md5.
+func multipartParts(etag string) int {
+	etag = strings.Trim(etag, `"`)
+	i := strings.LastIndexByte(etag, '-')
+	if i == -1 {
+		return 0
+	}
+	parts, err := strconv.Atoi(etag[i+1:])
+	if err != nil {
+		return 0
+	}
+	return parts
+}
+
+// multipartETag computes the ETag S3 assigns to content uploaded in parts of
+// partSize: the md5 of the concatenated part md5s, suffixed by the part count.
+func multipartETag(r io.Reader, partSize int64) (string, error) {
+	var sums bytes.Buffer
+	parts := 0
+	for {
+		h := md5.New()
+		n, err := io.CopyN(h, r, partSize)
+		if n > 0 {
+			sums.Write(h.Sum(nil))
+			parts += 1
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	sum := md5.Sum(sums.Bytes())
+	return fmt.Sprintf("%s-%d", hex.EncodeToString(sum[:]), parts), nil
+}
+
+// compositeETag returns the ETag S3 assigns to an upload of parts with the
+// given hex md5s.
+func compositeETag(partMD5s []string) (string, error) {
+	var sums []byte
+	for _, s := range partMD5s {
+		sum, err := hex.DecodeString(s)
+		if err != nil {
+			return "", err
+		}
+		sums = append(sums, sum...)
+	}
+	sum := md5.Sum(sums)
+	return fmt.Sprintf("%s-%d", hex.EncodeToString(sum[:]), len(partMD5s)), nil
+}
+
+// matchesMultipartETag reports whether file's contents would produce etag
+// when uploaded in parts, trying the likely part sizes.
+func matchesMultipartETag(ctx context.Context, file File, etag string) bool {
+	parts := int64(multipartParts(etag))
+	if parts == 0 {
+		return false
+	}
+	etag = strings.Trim(etag, `"`)
+	size := file.Size()
+	sizes := candidatePartSizes
+	// also try the smallest whole MiB part size giving this many parts
+	if perPart := (size + parts - 1) / parts; perPart > 0 {
+		sizes = append(sizes, (perPart+mib-1)/mib*mib)
+	}
+	tried := map[int64]bool{}
+	for _, partSize := range sizes {
+		if tried[partSize] || (size+partSize-1)/partSize != parts {
+			continue
+		}
+		tried[partSize] = true
+		reader, err := file.Reader(ctx)
+		if err != nil {
+			return false
+		}
+		computed, err := multipartETag(reader, partSize)
+		reader.Close()
+		if err == nil && computed == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// sameContents compares two files by size and md5, falling back to part-wise
+// ETag computation when one side is a multipart upload without a recorded md5.
+func sameContents(ctx context.Context, f1, f2 File) bool {
+	if f1.Size() != f2.Size() {
+		return false
+	}
+	md5a, md5b := f1.MD5(ctx), f2.MD5(ctx)
+	if md5a != nil && md5b != nil {
+		return bytes.Equal(md5a, md5b)
+	}
+	if s3f, ok := f2.(*S3File); ok && md5b == nil {
+		return matchesMultipartETag(ctx, f1, *s3f.object.ETag)
+	}
+	if s3f, ok := f1.(*S3File); ok && md5a == nil {
+		return matchesMultipartETag(ctx, f2, *s3f.object.ETag)
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package s3
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+	"sync"
+)
+
+// FailedEntry records a sync action that failed.
+type FailedEntry struct {
+	Key    string `json:"key"`
+	Action string `json:"action"`
+	Error  string `json:"error"`
+}
+
+// failureRecorder collects failed actions from concurrent sync workers.
+type failureRecorder struct {
+	sync.Mutex
+	entries []FailedEntry
+}
+
+func (f *failureRecorder) record(action Action, err error) {
+	f.Lock()
+	defer f.Unlock()
+	f.entries = append(f.entries, FailedEntry{
+		Key:    action.File.Relative(),
+		Action: action.Action,
+		Error:  err.Error(),
+	})
+}
+
+func (f *failureRecorder) count() int {
+	f.Lock()
+	defer f.Unlock()
+	return len(f.entries)
+}
+
+// sorted returns the failures in order of key.
+func (f *failureRecorder) sorted() []FailedEntry {
+	f.Lock()
+	defer f.Unlock()
+	sort.Slice(f.entries, func(i, j int) bool {
+		return f.entries[i].Key < f.entries[j].Key
+	})
+	return append([]FailedEntry(nil), f.entries...)
+}
+
+func (f *failureRecorder) write(filename string) error {
+	entries := f.sorted()
+	if entries == nil {
+		entries = []FailedEntry{}
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, append(data, '\n'), 0666)
+}
+
+// ReadFailures loads the entries of a retry file written by sync
+// --failures-file.
+func ReadFailures(filename string) ([]FailedEntry, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var entries []FailedEntry
+	err = json.Unmarshal(data, &entries)
+	return entries, err
+}
@@ -0,0 +1,832 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/protocol/eventstream"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// FakeServerOptions configure RunFakeServer.
+type FakeServerOptions struct {
+	Addr string // address to listen on, such as :9000
+	Dir  string // directory the buckets are kept in, or in memory if empty
+}
+
+// RunFakeServer serves a minimal S3 API until ctx is done, for testing
+// scripts offline. Requests aren't authenticated.
+func RunFakeServer(ctx context.Context, opts FakeServerOptions) error {
+	ms := NewMockS3()
+	if opts.Dir != "" {
+		var err error
+		ms, err = LoadMockS3(opts.Dir)
+		if err != nil {
+			return err
+		}
+	}
+	listener, err := net.Listen("tcp", opts.Addr)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Handler: NewFakeServer(ms, opts.Dir)}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	fmt.Fprintf(outOf(ctx), "Serving s3 on http://%s\n", listener.Addr())
+	err = server.Serve(listener)
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// FakeServer answers S3 requests from a MockS3: listing, getting, putting,
+// copying and deleting keys, selecting lines of them as grep --select does,
+// and creating, tagging and removing buckets.
+// Buckets are addressed by path, or by host under localhost, such as
+// bucket.localhost:9000. Unsupported requests fail with NotImplemented.
+type FakeServer struct {
+	ms  *MockS3
+	dir string // saved to after each change, if set
+	mu  sync.Mutex
+}
+
+// NewFakeServer returns a server for ms, saving it to dir after each change
+// when dir is set.
+func NewFakeServer(ms *MockS3, dir string) *FakeServer {
+	return &FakeServer{ms: ms, dir: dir}
+}
+
+const fakeXMLNS = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+// fakeTimeFormat is the format of times in S3 responses.
+const fakeTimeFormat = "2006-01-02T15:04:05.000Z"
+
+func (fs *FakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if query := r.URL.Query(); query.Has("x-id") {
+		// the sdk names some operations in the query, which says nothing
+		// the method and the rest of the request don't
+		query.Del("x-id")
+		r.URL.RawQuery = query.Encode()
+	}
+	bucket, key := fakeBucketKey(r)
+	var err error
+	switch owner := r.Header.Get("X-Amz-Expected-Bucket-Owner"); {
+	case owner != "" && owner != FakeAccountID:
+		err = errFakeAccessDenied
+	case bucket == "":
+		if r.Method != http.MethodGet {
+			err = errFakeNotImplemented
+			break
+		}
+		err = fs.listBuckets(w, r)
+	case key == "":
+		err = fs.serveBucket(w, r, bucket)
+	default:
+		err = fs.serveObject(w, r, bucket, key)
+	}
+	if err != nil {
+		writeFakeError(w, r, err)
+		return
+	}
+	if fs.dir != "" && r.Method != http.MethodGet && r.Method != http.MethodHead {
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		err = fs.ms.Save(fs.dir)
+		if err != nil {
+			// the response has been sent, so the client can't be told
+			log.Printf("saving %s: %s", fs.dir, err)
+		}
+	}
+}
+
+// fakeBucketKey returns the bucket and key a request addresses.
+func fakeBucketKey(r *http.Request) (string, string) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	if strings.HasSuffix(host, ".localhost") {
+		return strings.TrimSuffix(host, ".localhost"), path
+	}
+	parts := strings.SplitN(path, "/", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+var errFakeNotImplemented = &smithy.GenericAPIError{Code: "NotImplemented", Message: "A header or query you provided implies functionality that is not implemented."}
+
+// FakeAccountID is the account owning every bucket on the fake server.
+const FakeAccountID = "123456789012"
+
+var errFakeAccessDenied = &smithy.GenericAPIError{Code: "AccessDenied", Message: "Access Denied"}
+
+type fakeError struct {
+	XMLName  xml.Name `xml:"Error"`
+	Code     string
+	Message  string
+	Resource string
+}
+
+// writeFakeError writes err as an S3 error response.
+func writeFakeError(w http.ResponseWriter, r *http.Request, err error) {
+	code, message := "InternalError", err.Error()
+	switch {
+	case err == ErrBucketExists:
+		code = "BucketAlreadyOwnedByYou"
+	case err == ErrBucketHasKeys:
+		code = "BucketNotEmpty"
+	case err.Error() == "missing key":
+		code = "NoSuchKey"
+	default:
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) {
+			code, message = apiErr.ErrorCode(), apiErr.ErrorMessage()
+		} else if i := strings.Index(message, ": "); i != -1 && !strings.Contains(message[:i], " ") {
+			// mock errors read "Code: message"
+			code, message = message[:i], message[i+2:]
+		}
+	}
+	status := http.StatusBadRequest
+	switch code {
+	case "NoSuchBucket", "NoSuchKey", "NoSuchTagSet", "NoSuchUpload":
+		status = http.StatusNotFound
+	case "AccessDenied":
+		status = http.StatusForbidden
+	case "BucketAlreadyOwnedByYou", "BucketNotEmpty":
+		status = http.StatusConflict
+	case "InvalidRange":
+		status = http.StatusRequestedRangeNotSatisfiable
+	case "PreconditionFailed":
+		status = http.StatusPreconditionFailed
+	case "NotImplemented":
+		status = http.StatusNotImplemented
+	case "InternalError":
+		status = http.StatusInternalServerError
+	}
+	writeFakeXML(w, status, fakeError{Code: code, Message: message, Resource: r.URL.Path}, r.Method == http.MethodHead)
+}
+
+// writeFakeXML writes v as the response, without the body for head
+// requests.
+func writeFakeXML(w http.ResponseWriter, status int, v interface{}, head bool) {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	if !head {
+		w.Write([]byte(xml.Header))
+		w.Write(data)
+	}
+}
+
+type fakeListBucketsResult struct {
+	XMLName xml.Name     `xml:"ListAllMyBucketsResult"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Buckets []fakeBucket `xml:"Buckets>Bucket"`
+}
+
+type fakeBucket struct {
+	Name         string
+	CreationDate string
+}
+
+func (fs *FakeServer) listBuckets(w http.ResponseWriter, r *http.Request) error {
+	output, err := fs.ms.ListBuckets(r.Context(), &s3.ListBucketsInput{})
+	if err != nil {
+		return err
+	}
+	result := fakeListBucketsResult{XMLNS: fakeXMLNS}
+	for _, b := range output.Buckets {
+		result.Buckets = append(result.Buckets, fakeBucket{Name: *b.Name, CreationDate: time.Now().UTC().Format(fakeTimeFormat)})
+	}
+	sort.Slice(result.Buckets, func(i, j int) bool {
+		return result.Buckets[i].Name < result.Buckets[j].Name
+	})
+	writeFakeXML(w, http.StatusOK, result, false)
+	return nil
+}
+
+// bucketExists reports whether the mock has bucket.
+func (fs *FakeServer) bucketExists(bucket string) bool {
+	fs.ms.RLock()
+	defer fs.ms.RUnlock()
+	_, ok := fs.ms.data[bucket]
+	return ok
+}
+
+func (fs *FakeServer) serveBucket(w http.ResponseWriter, r *http.Request, bucket string) error {
+	query := r.URL.Query()
+	_, tagging := query["tagging"]
+	_, location := query["location"]
+	_, deletes := query["delete"]
+	switch {
+	case tagging:
+		return fs.serveBucketTagging(w, r, bucket)
+	case location && r.Method == http.MethodGet:
+		if !fs.bucketExists(bucket) {
+			return ErrNoSuchBucket
+		}
+		writeFakeXML(w, http.StatusOK, struct {
+			XMLName xml.Name `xml:"LocationConstraint"`
+			XMLNS   string   `xml:"xmlns,attr"`
+		}{XMLNS: fakeXMLNS}, false)
+		return nil
+	case deletes && r.Method == http.MethodPost:
+		return fs.deleteObjects(w, r, bucket)
+	}
+	for name := range query {
+		if r.Method != http.MethodGet || !fakeListParams[name] {
+			// versioning, acls, policies and the like
+			return errFakeNotImplemented
+		}
+	}
+	switch r.Method {
+	case http.MethodHead:
+		if !fs.bucketExists(bucket) {
+			return ErrNoSuchBucket
+		}
+		return nil
+	case http.MethodGet:
+		return fs.listObjects(w, r, bucket)
+	case http.MethodPut:
+		if bucket == "." || bucket == ".." {
+			return &smithy.GenericAPIError{Code: "InvalidBucketName", Message: "The specified bucket is not valid."}
+		}
+		_, err := fs.ms.CreateBucket(r.Context(), &s3.CreateBucketInput{Bucket: aws.String(bucket)})
+		if err != nil {
+			return err
+		}
+		w.Header().Set("Location", "/"+bucket)
+		return nil
+	case http.MethodDelete:
+		_, err := fs.ms.DeleteBucket(r.Context(), &s3.DeleteBucketInput{Bucket: aws.String(bucket)})
+		if err != nil {
+			return err
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	return errFakeNotImplemented
+}
+
+type fakeTagging struct {
+	XMLName xml.Name  `xml:"Tagging"`
+	XMLNS   string    `xml:"xmlns,attr,omitempty"`
+	Tags    []fakeTag `xml:"TagSet>Tag"`
+}
+
+type fakeTag struct {
+	Key   string
+	Value string
+}
+
+func (fs *FakeServer) getObjectTagging(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	output, err := fs.ms.GetObjectTagging(r.Context(), &s3.GetObjectTaggingInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return err
+	}
+	result := fakeTagging{XMLNS: fakeXMLNS}
+	for _, tag := range output.TagSet {
+		result.Tags = append(result.Tags, fakeTag{Key: aws.ToString(tag.Key), Value: aws.ToString(tag.Value)})
+	}
+	writeFakeXML(w, http.StatusOK, result, false)
+	return nil
+}
+
+func (fs *FakeServer) serveBucketTagging(w http.ResponseWriter, r *http.Request, bucket string) error {
+	switch r.Method {
+	case http.MethodGet:
+		output, err := fs.ms.GetBucketTagging(r.Context(), &s3.GetBucketTaggingInput{Bucket: aws.String(bucket)})
+		if err != nil {
+			return err
+		}
+		result := fakeTagging{XMLNS: fakeXMLNS}
+		for _, tag := range output.TagSet {
+			result.Tags = append(result.Tags, fakeTag{Key: aws.ToString(tag.Key), Value: aws.ToString(tag.Value)})
+		}
+		writeFakeXML(w, http.StatusOK, result, false)
+		return nil
+	case http.MethodPut:
+		var tagging fakeTagging
+		err := xml.NewDecoder(r.Body).Decode(&tagging)
+		if err != nil {
+			return &smithy.GenericAPIError{Code: "MalformedXML", Message: err.Error()}
+		}
+		tags := []types.Tag{}
+		for _, tag := range tagging.Tags {
+			tags = append(tags, types.Tag{Key: aws.String(tag.Key), Value: aws.String(tag.Value)})
+		}
+		_, err = fs.ms.PutBucketTagging(r.Context(), &s3.PutBucketTaggingInput{
+			Bucket:  aws.String(bucket),
+			Tagging: &types.Tagging{TagSet: tags},
+		})
+		return err
+	case http.MethodDelete:
+		_, err := fs.ms.DeleteBucketTagging(r.Context(), &s3.DeleteBucketTaggingInput{Bucket: aws.String(bucket)})
+		if err != nil {
+			return err
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	return errFakeNotImplemented
+}
+
+// fakeListParams are the query parameters of ListObjects and ListObjectsV2.
+var fakeListParams = map[string]bool{
+	"prefix": true, "marker": true, "delimiter": true, "max-keys": true, "encoding-type": true, "list-type": true,
+	"continuation-token": true, "start-after": true, "fetch-owner": true,
+}
+
+type fakeListBucketResult struct {
+	XMLName      xml.Name `xml:"ListBucketResult"`
+	XMLNS        string   `xml:"xmlns,attr"`
+	Name         string   `xml:"Name"`
+	Prefix       string   `xml:"Prefix"`
+	Marker       *string  `xml:"Marker"` // of the original listing only
+	NextMarker   string   `xml:"NextMarker,omitempty"`
+	Delimiter    string   `xml:"Delimiter,omitempty"`
+	EncodingType string   `xml:"EncodingType,omitempty"`
+	MaxKeys      int      `xml:"MaxKeys"`
+	IsTruncated  bool     `xml:"IsTruncated"`
+	// of ListObjectsV2 only
+	KeyCount              *int   `xml:"KeyCount"`
+	ContinuationToken     string `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string `xml:"NextContinuationToken,omitempty"`
+	StartAfter            string `xml:"StartAfter,omitempty"`
+
+	Contents       []fakeObject     `xml:"Contents"`
+	CommonPrefixes []fakeCommonPath `xml:"CommonPrefixes"`
+}
+
+type fakeObject struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         int64
+	StorageClass string
+}
+
+type fakeCommonPath struct {
+	Prefix string
+}
+
+// listObjects answers ListObjects and ListObjectsV2, paging and grouping by
+// delimiter the keys the mock lists. The continuation tokens of
+// ListObjectsV2 are the last key or common prefix listed.
+func (fs *FakeServer) listObjects(w http.ResponseWriter, r *http.Request, bucket string) error {
+	query := r.URL.Query()
+	v2 := false
+	switch query.Get("list-type") {
+	case "":
+	case "2":
+		v2 = true
+	default:
+		return errFakeNotImplemented
+	}
+	prefix, marker, delimiter := query.Get("prefix"), query.Get("marker"), query.Get("delimiter")
+	token, startAfter := query.Get("continuation-token"), query.Get("start-after")
+	if v2 {
+		marker = startAfter
+		if token > marker {
+			marker = token
+		}
+	}
+	maxKeys := 1000
+	if value := query.Get("max-keys"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return &smithy.GenericAPIError{Code: "InvalidArgument", Message: "Invalid max-keys"}
+		}
+		maxKeys = n
+	}
+	// all the keys, to be grouped by delimiter before paging
+	output, err := fs.ms.ListObjects(r.Context(), &s3.ListObjectsInput{Bucket: aws.String(bucket), Prefix: aws.String(prefix), MaxKeys: aws.Int32(math.MaxInt32)})
+	if err != nil {
+		return err
+	}
+	result := fakeListBucketResult{
+		XMLNS:     fakeXMLNS,
+		Name:      bucket,
+		Prefix:    prefix,
+		Delimiter: delimiter,
+		MaxKeys:   maxKeys,
+	}
+	var last string
+	for _, object := range output.Contents {
+		key := *object.Key
+		if key <= marker {
+			continue
+		}
+		commonPrefix := ""
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i != -1 {
+				commonPrefix = key[:len(prefix)+i+len(delimiter)]
+				if commonPrefix <= marker || commonPrefix == last {
+					continue
+				}
+			}
+		}
+		if len(result.Contents)+len(result.CommonPrefixes) == maxKeys {
+			result.IsTruncated = true
+			break
+		}
+		if commonPrefix != "" {
+			result.CommonPrefixes = append(result.CommonPrefixes, fakeCommonPath{commonPrefix})
+			last = commonPrefix
+			continue
+		}
+		result.Contents = append(result.Contents, fakeObject{
+			Key:          key,
+			LastModified: object.LastModified.UTC().Format(fakeTimeFormat),
+			ETag:         aws.ToString(object.ETag),
+			Size:         aws.ToInt64(object.Size),
+			StorageClass: string(object.StorageClass),
+		})
+		last = key
+	}
+	if v2 {
+		keyCount := len(result.Contents) + len(result.CommonPrefixes)
+		result.KeyCount = &keyCount
+		result.ContinuationToken, result.StartAfter = token, startAfter
+		if result.IsTruncated {
+			result.NextContinuationToken = last
+		}
+	} else {
+		result.Marker = &marker
+		if result.IsTruncated && delimiter != "" {
+			result.NextMarker = last
+		}
+	}
+	if query.Get("encoding-type") == "url" {
+		result.encodeKeys()
+	}
+	writeFakeXML(w, http.StatusOK, result, false)
+	return nil
+}
+
+// encodeKeys url encodes the keys listed, for clients asking for them so.
+func (result *fakeListBucketResult) encodeKeys() {
+	result.EncodingType = "url"
+	result.Prefix = url.QueryEscape(result.Prefix)
+	if result.Marker != nil {
+		marker := url.QueryEscape(*result.Marker)
+		result.Marker = &marker
+	}
+	result.NextMarker = url.QueryEscape(result.NextMarker)
+	result.StartAfter = url.QueryEscape(result.StartAfter)
+	result.Delimiter = url.QueryEscape(result.Delimiter)
+	for i := range result.Contents {
+		result.Contents[i].Key = url.QueryEscape(result.Contents[i].Key)
+	}
+	for i := range result.CommonPrefixes {
+		result.CommonPrefixes[i].Prefix = url.QueryEscape(result.CommonPrefixes[i].Prefix)
+	}
+}
+
+type fakeDelete struct {
+	Objects []struct {
+		Key string
+	} `xml:"Object"`
+	Quiet bool
+}
+
+type fakeDeleteResult struct {
+	XMLName xml.Name          `xml:"DeleteResult"`
+	XMLNS   string            `xml:"xmlns,attr"`
+	Deleted []fakeDeletedKey  `xml:"Deleted"`
+	Errors  []fakeDeleteError `xml:"Error"`
+}
+
+type fakeDeletedKey struct {
+	Key string
+}
+
+type fakeDeleteError struct {
+	Key     string
+	Code    string
+	Message string
+}
+
+func (fs *FakeServer) deleteObjects(w http.ResponseWriter, r *http.Request, bucket string) error {
+	var request fakeDelete
+	err := xml.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		return &smithy.GenericAPIError{Code: "MalformedXML", Message: err.Error()}
+	}
+	if !fs.bucketExists(bucket) {
+		return ErrNoSuchBucket
+	}
+	input := s3.DeleteObjectsInput{Bucket: aws.String(bucket), Delete: &types.Delete{Quiet: aws.Bool(request.Quiet)}}
+	for _, object := range request.Objects {
+		input.Delete.Objects = append(input.Delete.Objects, types.ObjectIdentifier{Key: aws.String(object.Key)})
+	}
+	output, err := fs.ms.DeleteObjects(r.Context(), &input)
+	if err != nil {
+		return err
+	}
+	result := fakeDeleteResult{XMLNS: fakeXMLNS}
+	for _, deleted := range output.Deleted {
+		result.Deleted = append(result.Deleted, fakeDeletedKey{aws.ToString(deleted.Key)})
+	}
+	for _, e := range output.Errors {
+		result.Errors = append(result.Errors, fakeDeleteError{aws.ToString(e.Key), aws.ToString(e.Code), aws.ToString(e.Message)})
+	}
+	writeFakeXML(w, http.StatusOK, result, false)
+	return nil
+}
+
+const fakeMetaPrefix = "X-Amz-Meta-"
+
+// fakeMetadata returns the user metadata headers of a request, by lower
+// case name as S3 stores them.
+func fakeMetadata(header http.Header) map[string]string {
+	metadata := map[string]string{}
+	for name := range header {
+		if strings.HasPrefix(name, fakeMetaPrefix) {
+			metadata[strings.ToLower(strings.TrimPrefix(name, fakeMetaPrefix))] = header.Get(name)
+		}
+	}
+	if len(metadata) == 0 {
+		return nil
+	}
+	return metadata
+}
+
+// optionalHeader returns the header, or nil if missing.
+func optionalHeader(header http.Header, name string) *string {
+	if value := header.Get(name); value != "" {
+		return aws.String(value)
+	}
+	return nil
+}
+
+// checkFakeChecksum fails if content doesn't match a checksum header sent
+// with it.
+func checkFakeChecksum(header http.Header, content []byte) error {
+	for _, algorithm := range []string{ChecksumSHA256, ChecksumCRC32C} {
+		value := header.Get("X-Amz-Checksum-" + strings.ToLower(algorithm))
+		if value != "" && value != checksumOf(algorithm, content) {
+			return &smithy.GenericAPIError{Code: "BadDigest", Message: "The " + strings.ToLower(algorithm) + " you specified did not match the calculated checksum."}
+		}
+	}
+	return nil
+}
+
+func (fs *FakeServer) serveObject(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	query := r.URL.Query()
+	if _, tagging := query["tagging"]; tagging && len(query) == 1 && r.Method == http.MethodGet {
+		return fs.getObjectTagging(w, r, bucket, key)
+	}
+	if _, selects := query["select"]; selects && query.Get("select-type") == "2" && r.Method == http.MethodPost {
+		return fs.selectObject(w, r, bucket, key)
+	}
+	if len(query) > 0 {
+		// multipart uploads, versions, acls and the like
+		return errFakeNotImplemented
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		return fs.getObject(w, r, bucket, key)
+	case http.MethodPut:
+		if source := r.Header.Get("X-Amz-Copy-Source"); source != "" {
+			return fs.copyObject(w, r, bucket, key, source)
+		}
+		content, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return err
+		}
+		err = checkFakeChecksum(r.Header, content)
+		if err != nil {
+			return err
+		}
+		input := s3.PutObjectInput{
+			Bucket:          aws.String(bucket),
+			Key:             aws.String(key),
+			Body:            bytes.NewReader(content),
+			ACL:             types.ObjectCannedACL(r.Header.Get("X-Amz-Acl")),
+			ContentType:     optionalHeader(r.Header, "Content-Type"),
+			ContentEncoding: optionalHeader(r.Header, "Content-Encoding"),
+			ContentMD5:      optionalHeader(r.Header, "Content-Md5"),
+			Tagging:         optionalHeader(r.Header, "X-Amz-Tagging"),
+			StorageClass:    types.StorageClass(r.Header.Get("X-Amz-Storage-Class")),
+			Metadata:        fakeMetadata(r.Header),
+
+			CacheControl:         optionalHeader(r.Header, "Cache-Control"),
+			ContentDisposition:   optionalHeader(r.Header, "Content-Disposition"),
+			ServerSideEncryption: types.ServerSideEncryption(r.Header.Get("X-Amz-Server-Side-Encryption")),
+			SSEKMSKeyId:          optionalHeader(r.Header, "X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"),
+
+			ObjectLockMode:            types.ObjectLockMode(r.Header.Get("X-Amz-Object-Lock-Mode")),
+			ObjectLockLegalHoldStatus: types.ObjectLockLegalHoldStatus(r.Header.Get("X-Amz-Object-Lock-Legal-Hold")),
+		}
+		if until := r.Header.Get("X-Amz-Object-Lock-Retain-Until-Date"); until != "" {
+			date, err := time.Parse(time.RFC3339, until)
+			if err != nil {
+				return err
+			}
+			input.ObjectLockRetainUntilDate = aws.Time(date)
+		}
+		_, err = fs.ms.PutObject(r.Context(), &input)
+		if err != nil {
+			return err
+		}
+		object, err := fs.ms.HeadObject(r.Context(), &s3.HeadObjectInput{Bucket: input.Bucket, Key: input.Key})
+		if err == nil {
+			w.Header().Set("ETag", aws.ToString(object.ETag))
+		}
+		return nil
+	case http.MethodDelete:
+		if !fs.bucketExists(bucket) {
+			return ErrNoSuchBucket
+		}
+		_, err := fs.ms.DeleteObject(r.Context(), &s3.DeleteObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+		if err != nil {
+			return err
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	return errFakeNotImplemented
+}
+
+func (fs *FakeServer) getObject(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	if !fs.bucketExists(bucket) {
+		return ErrNoSuchBucket
+	}
+	output, err := fs.ms.GetObject(r.Context(), &s3.GetObjectInput{
+		Bucket:  aws.String(bucket),
+		Key:     aws.String(key),
+		Range:   optionalHeader(r.Header, "Range"),
+		IfMatch: optionalHeader(r.Header, "If-Match"),
+	})
+	if err != nil {
+		return err
+	}
+	defer output.Body.Close()
+	header := w.Header()
+	contentType := aws.ToString(output.ContentType)
+	if contentType == "" {
+		contentType = "binary/octet-stream"
+	}
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Length", strconv.FormatInt(aws.ToInt64(output.ContentLength), 10))
+	header.Set("ETag", aws.ToString(output.ETag))
+	header.Set("Last-Modified", output.LastModified.UTC().Format(http.TimeFormat))
+	header.Set("Accept-Ranges", "bytes")
+	if output.ContentEncoding != nil {
+		header.Set("Content-Encoding", *output.ContentEncoding)
+	}
+	if output.CacheControl != nil {
+		header.Set("Cache-Control", *output.CacheControl)
+	}
+	if output.ContentDisposition != nil {
+		header.Set("Content-Disposition", *output.ContentDisposition)
+	}
+	if output.StorageClass != "" {
+		header.Set("X-Amz-Storage-Class", string(output.StorageClass))
+	}
+	if output.ServerSideEncryption != "" {
+		header.Set("X-Amz-Server-Side-Encryption", string(output.ServerSideEncryption))
+	}
+	if output.SSEKMSKeyId != nil {
+		header.Set("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id", *output.SSEKMSKeyId)
+	}
+	if output.ObjectLockMode != "" {
+		header.Set("X-Amz-Object-Lock-Mode", string(output.ObjectLockMode))
+		header.Set("X-Amz-Object-Lock-Retain-Until-Date", output.ObjectLockRetainUntilDate.UTC().Format(time.RFC3339))
+	}
+	if output.ObjectLockLegalHoldStatus != "" {
+		header.Set("X-Amz-Object-Lock-Legal-Hold", string(output.ObjectLockLegalHoldStatus))
+	}
+	for name, value := range output.Metadata {
+		header.Set(fakeMetaPrefix+name, value)
+	}
+	status := http.StatusOK
+	if output.ContentRange != nil {
+		header.Set("Content-Range", *output.ContentRange)
+		status = http.StatusPartialContent
+	}
+	w.WriteHeader(status)
+	if r.Method == http.MethodHead {
+		return nil
+	}
+	content, err := ioutil.ReadAll(output.Body)
+	if err != nil {
+		return err
+	}
+	w.Write(content)
+	return nil
+}
+
+type fakeCopyObjectResult struct {
+	XMLName      xml.Name `xml:"CopyObjectResult"`
+	XMLNS        string   `xml:"xmlns,attr"`
+	ETag         string
+	LastModified string
+}
+
+func (fs *FakeServer) copyObject(w http.ResponseWriter, r *http.Request, bucket, key, source string) error {
+	input := s3.CopyObjectInput{
+		Bucket:            aws.String(bucket),
+		Key:               aws.String(key),
+		CopySource:        aws.String(source),
+		MetadataDirective: types.MetadataDirective(r.Header.Get("X-Amz-Metadata-Directive")),
+		StorageClass:      types.StorageClass(r.Header.Get("X-Amz-Storage-Class")),
+		ContentType:       optionalHeader(r.Header, "Content-Type"),
+		ContentEncoding:   optionalHeader(r.Header, "Content-Encoding"),
+		Metadata:          fakeMetadata(r.Header),
+
+		CacheControl:         optionalHeader(r.Header, "Cache-Control"),
+		ContentDisposition:   optionalHeader(r.Header, "Content-Disposition"),
+		ServerSideEncryption: types.ServerSideEncryption(r.Header.Get("X-Amz-Server-Side-Encryption")),
+		SSEKMSKeyId:          optionalHeader(r.Header, "X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"),
+	}
+	_, err := fs.ms.CopyObject(r.Context(), &input)
+	if err != nil {
+		return err
+	}
+	object, err := fs.ms.HeadObject(r.Context(), &s3.HeadObjectInput{Bucket: input.Bucket, Key: input.Key})
+	if err != nil {
+		return err
+	}
+	writeFakeXML(w, http.StatusOK, fakeCopyObjectResult{
+		XMLNS:        fakeXMLNS,
+		ETag:         aws.ToString(object.ETag),
+		LastModified: object.LastModified.UTC().Format(fakeTimeFormat),
+	}, false)
+	return nil
+}
+
+// fakeSelectRequest is the body of SelectObjectContent, as far as the fake
+// server reads it.
+type fakeSelectRequest struct {
+	Expression         string
+	InputSerialization struct {
+		CompressionType string
+	}
+}
+
+// selectObject answers SelectObjectContent with the queries of grep
+// --select, which the mock runs, sending the lines selected as a Records
+// event followed by an End event.
+func (fs *FakeServer) selectObject(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	var request fakeSelectRequest
+	err := xml.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		return &smithy.GenericAPIError{Code: "MalformedXML", Message: err.Error()}
+	}
+	records, err := fs.ms.selectRecords(&s3.SelectObjectContentInput{
+		Bucket:     aws.String(bucket),
+		Key:        aws.String(key),
+		Expression: aws.String(request.Expression),
+		InputSerialization: &types.InputSerialization{
+			CompressionType: types.CompressionType(request.InputSerialization.CompressionType),
+		},
+		SSECustomerKey: optionalHeader(r.Header, "X-Amz-Server-Side-Encryption-Customer-Key"),
+	})
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	encoder := eventstream.NewEncoder()
+	for _, event := range []struct {
+		name    string
+		payload []byte
+	}{{"Records", records}, {"End", nil}} {
+		var headers eventstream.Headers
+		headers.Set(":message-type", eventstream.StringValue("event"))
+		headers.Set(":event-type", eventstream.StringValue(event.name))
+		err = encoder.Encode(w, eventstream.Message{Headers: headers, Payload: event.payload})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+package s3
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// binaryBlock is how much of the start of a key is checked for a NUL byte,
+// which marks it as binary.
+const binaryBlock = 8 << 10
+
+// errMaxMatches stops grep once --max-matches lines are found.
+var errMaxMatches = errors.New("max matches found")
+
+// matchLimit is the number of matches grep finds over all the keys, which
+// are taken in the order the keys are written.
+type matchLimit struct {
+	max   int64
+	taken int64
+}
+
+// take claims a match of the key written to w, once the keys before it are
+// written, reporting false if there are no more.
+func (ml *matchLimit) take(w io.Writer) bool {
+	if ml == nil {
+		return true
+	}
+	if oo, ok := w.(*orderedOutput); ok {
+		oo.waitLive()
+	}
+	return atomic.AddInt64(&ml.taken, 1) <= ml.max
+}
+
+// reached reports whether every match has been taken.
+func (ml *matchLimit) reached() bool {
+	return ml != nil && atomic.LoadInt64(&ml.taken) >= ml.max
+}
+
+// grepLine is a line of a key read by grep.
+type grepLine struct {
+	text   []byte
+	number int64 // from 1
+	offset int64 // of its first byte in the key
+}
+
+// grepKey searches file for the lines selected by opts, writing them, or
+// their count or the key's name, to w. It returns errMaxMatches once limit's
+// matches are taken.
+func grepKey(ctx context.Context, w io.Writer, file File, needle []byte, limit *matchLimit, opts GrepOptions) error {
+	if !opts.Names.selects(file) {
+		return nil
+	}
+	reader, err := grepReader(ctx, file, needle, opts)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	var records *RecordWriter
+	if opts.Records != nil {
+		// written in order with the key's other output
+		records = NewRecordWriter(w)
+	}
+	emit := func(line grepLine, sep string) error {
+		if records != nil {
+			record := Record{Type: "match", URL: file.String(), Line: string(line.text)}
+			if sep != ":" {
+				record.Type = "context"
+			}
+			if opts.LineNumbers {
+				record.LineNumber = line.number
+			}
+			if opts.ByteOffsets {
+				record.Offset = aws.Int64(line.offset)
+			}
+			return records.Write(record)
+		}
+		var buf bytes.Buffer
+		if !opts.NoKeysPrefix {
+			buf.WriteString(file.String() + sep)
+		}
+		if opts.LineNumbers {
+			buf.WriteString(strconv.FormatInt(line.number, 10) + sep)
+		}
+		if opts.ByteOffsets {
+			buf.WriteString(strconv.FormatInt(line.offset, 10) + sep)
+		}
+		buf.Write(line.text)
+		buf.WriteByte('\n')
+		_, err := w.Write(buf.Bytes())
+		return err
+	}
+
+	var count int64
+	var before []grepLine // held for --before-context
+	var after int         // lines of --after-context left to write
+	var last int64        // number of the last line written
+	var limited bool      // the last match was taken, by this key
+	var exhausted bool    // the matches were taken before this key's
+	br := bufio.NewReaderSize(reader, 64<<10)
+	if !opts.Text {
+		// binary keys are skipped, as grep -r -I does
+		block, err := br.Peek(binaryBlock)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if bytes.IndexByte(block, 0) != -1 {
+			return nil
+		}
+	}
+	var offset int64
+	for number := int64(1); ; number++ {
+		text, err := br.ReadBytes('\n')
+		if len(text) == 0 && err == io.EOF {
+			break
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+		line := grepLine{bytes.TrimSuffix(text, []byte("\n")), number, offset}
+		offset += int64(len(text))
+		if !limited && limit.reached() {
+			exhausted = true
+			break
+		}
+
+		if bytes.Contains(line.text, needle) != opts.Invert {
+			if limited {
+				// past the trailing context of the last match
+				break
+			}
+			if !limit.take(w) {
+				exhausted = true
+				break
+			}
+			count++
+			limited = limit.reached()
+			if opts.KeysWithMatches {
+				// only the name is wanted, stop reading
+				break
+			}
+			if opts.Count {
+				if limited {
+					break
+				}
+				continue
+			}
+			first := number - int64(len(before))
+			if (opts.Before > 0 || opts.After > 0) && last > 0 && first > last+1 && records == nil {
+				if _, err := io.WriteString(w, "--\n"); err != nil {
+					return err
+				}
+			}
+			for _, held := range before {
+				if err := emit(held, "-"); err != nil {
+					return err
+				}
+			}
+			before = before[:0]
+			if err := emit(line, ":"); err != nil {
+				return err
+			}
+			last, after = number, opts.After
+		} else if after > 0 {
+			if err := emit(line, "-"); err != nil {
+				return err
+			}
+			last = number
+			after--
+		} else if opts.Before > 0 {
+			if len(before) == opts.Before {
+				before = append(before[:0], before[1:]...)
+			}
+			before = append(before, line)
+		}
+		if err == io.EOF || (limited && after == 0) {
+			break
+		}
+	}
+	if exhausted && count == 0 {
+		return errMaxMatches
+	}
+
+	switch {
+	case opts.KeysWithMatches && count == 0:
+	case opts.KeysWithMatches && records != nil:
+		err = records.Write(fileRecord(file))
+	case opts.KeysWithMatches:
+		_, err = fmt.Fprintln(w, file.String())
+	case opts.Count && records != nil:
+		err = records.Write(Record{Type: "count", URL: file.String(), Count: aws.Int64(count)})
+	case opts.Count && opts.NoKeysPrefix:
+		_, err = fmt.Fprintln(w, count)
+	case opts.Count:
+		_, err = fmt.Fprintf(w, "%s:%d\n", file, count)
+	}
+	if err == nil && exhausted {
+		err = errMaxMatches
+	}
+	return err
+}
+
+// grepReader returns a reader of the lines of file to search: with --select,
+// of csv and json keys just those S3 Select finds, and otherwise all of them.
+func grepReader(ctx context.Context, file File, needle []byte, opts GrepOptions) (io.ReadCloser, error) {
+	if s3f, ok := selectable(file); ok && opts.Select {
+		return selectLines(ctx, s3f, string(needle), opts.Invert, opts.Decompress)
+	}
+	reader, err := file.Reader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	decompressed, err := decompressReader(ctx, reader, file, opts.Decompress)
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+	return decompressed, nil
+}
@@ -0,0 +1,51 @@
+package s3
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Headers are response headers stored with uploaded keys, and returned when
+// they are fetched, such as caching directives for web assets.
+type Headers struct {
+	CacheControl       string // such as max-age=31536000, public
+	ContentEncoding    string // such as gzip, for precompressed files
+	ContentDisposition string // such as attachment; filename="report.pdf"
+}
+
+// IsZero reports whether no headers are set.
+func (h Headers) IsZero() bool {
+	return h == Headers{}
+}
+
+// apply sets the request fields of the headers given, leaving the others.
+func (h Headers) apply(cacheControl, contentEncoding, contentDisposition **string) {
+	if h.CacheControl != "" {
+		*cacheControl = aws.String(h.CacheControl)
+	}
+	if h.ContentEncoding != "" {
+		*contentEncoding = aws.String(h.ContentEncoding)
+	}
+	if h.ContentDisposition != "" {
+		*contentDisposition = aws.String(h.ContentDisposition)
+	}
+}
+
+// ParseMetadataDirective checks the --metadata-directive flag of cp, which
+// must be REPLACE for headers to be set.
+func ParseMetadataDirective(directive string, headers Headers) (string, error) {
+	directive = strings.ToUpper(directive)
+	switch types.MetadataDirective(directive) {
+	case "", types.MetadataDirectiveCopy:
+		if !headers.IsZero() {
+			return "", errors.New("setting headers on a copy requires --metadata-directive REPLACE")
+		}
+		return string(types.MetadataDirectiveCopy), nil
+	case types.MetadataDirectiveReplace:
+		return directive, nil
+	}
+	return "", errors.New("--metadata-directive must be COPY or REPLACE")
+}
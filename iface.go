@@ -1,22 +1,113 @@
 package s3
 
-import "io"
+import (
+	"context"
+	"io"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/barnybug/s3/pkg/mys3"
+)
+
+// File is a key or local file. The methods taking a context stop reading,
+// and fail the requests they make, once it's done.
 type File interface {
 	Relative() string
 	Size() int64
-	MD5() []byte
-	Reader() (io.ReadCloser, error)
-	Delete() error
+	MD5(ctx context.Context) []byte
+	Reader(ctx context.Context) (io.ReadCloser, error)
+	Delete(ctx context.Context) error
 	String() string
 	IsDirectory() bool
-	CheckSum() (string, error)
+	CheckSum(ctx context.Context) (string, error)
 }
 
+// Filesystem is a bucket prefix or local directory. Files lists it until ctx
+// is done, failing with ctx's error, and the other methods taking a context
+// stop their transfers once it's done.
 type Filesystem interface {
-	Files() <-chan File
-	Create(src File) error
-	Delete(path string) error
+	Files(ctx context.Context) <-chan File
+	Create(ctx context.Context, src File) error
+	Delete(ctx context.Context, path string) error
 	Error() error
-	CreateMultiPart(src File, buffer []byte) error
+	CreateMultiPart(ctx context.Context, src File) error
+}
+
+// S3API is the s3 operations the commands make, as *s3.Client of the sdk
+// makes them. MockS3 implements it too, for the tests.
+type S3API interface {
+	AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error)
+	CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error)
+	CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error)
+	CreateBucket(ctx context.Context, params *s3.CreateBucketInput, optFns ...func(*s3.Options)) (*s3.CreateBucketOutput, error)
+	CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error)
+	DeleteBucket(ctx context.Context, params *s3.DeleteBucketInput, optFns ...func(*s3.Options)) (*s3.DeleteBucketOutput, error)
+	DeleteBucketTagging(ctx context.Context, params *s3.DeleteBucketTaggingInput, optFns ...func(*s3.Options)) (*s3.DeleteBucketTaggingOutput, error)
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+	DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error)
+	GetBucketAccelerateConfiguration(ctx context.Context, params *s3.GetBucketAccelerateConfigurationInput, optFns ...func(*s3.Options)) (*s3.GetBucketAccelerateConfigurationOutput, error)
+	GetBucketEncryption(ctx context.Context, params *s3.GetBucketEncryptionInput, optFns ...func(*s3.Options)) (*s3.GetBucketEncryptionOutput, error)
+	GetBucketLocation(ctx context.Context, params *s3.GetBucketLocationInput, optFns ...func(*s3.Options)) (*s3.GetBucketLocationOutput, error)
+	GetBucketOwnershipControls(ctx context.Context, params *s3.GetBucketOwnershipControlsInput, optFns ...func(*s3.Options)) (*s3.GetBucketOwnershipControlsOutput, error)
+	GetBucketTagging(ctx context.Context, params *s3.GetBucketTaggingInput, optFns ...func(*s3.Options)) (*s3.GetBucketTaggingOutput, error)
+	GetBucketVersioning(ctx context.Context, params *s3.GetBucketVersioningInput, optFns ...func(*s3.Options)) (*s3.GetBucketVersioningOutput, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	GetObjectLockConfiguration(ctx context.Context, params *s3.GetObjectLockConfigurationInput, optFns ...func(*s3.Options)) (*s3.GetObjectLockConfigurationOutput, error)
+	GetObjectTagging(ctx context.Context, params *s3.GetObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.GetObjectTaggingOutput, error)
+	GetPublicAccessBlock(ctx context.Context, params *s3.GetPublicAccessBlockInput, optFns ...func(*s3.Options)) (*s3.GetPublicAccessBlockOutput, error)
+	HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error)
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	ListBuckets(ctx context.Context, params *s3.ListBucketsInput, optFns ...func(*s3.Options)) (*s3.ListBucketsOutput, error)
+	ListMultipartUploads(ctx context.Context, params *s3.ListMultipartUploadsInput, optFns ...func(*s3.Options)) (*s3.ListMultipartUploadsOutput, error)
+	ListObjectVersions(ctx context.Context, params *s3.ListObjectVersionsInput, optFns ...func(*s3.Options)) (*s3.ListObjectVersionsOutput, error)
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	ListParts(ctx context.Context, params *s3.ListPartsInput, optFns ...func(*s3.Options)) (*s3.ListPartsOutput, error)
+	PutBucketAccelerateConfiguration(ctx context.Context, params *s3.PutBucketAccelerateConfigurationInput, optFns ...func(*s3.Options)) (*s3.PutBucketAccelerateConfigurationOutput, error)
+	PutBucketEncryption(ctx context.Context, params *s3.PutBucketEncryptionInput, optFns ...func(*s3.Options)) (*s3.PutBucketEncryptionOutput, error)
+	PutBucketOwnershipControls(ctx context.Context, params *s3.PutBucketOwnershipControlsInput, optFns ...func(*s3.Options)) (*s3.PutBucketOwnershipControlsOutput, error)
+	PutBucketTagging(ctx context.Context, params *s3.PutBucketTaggingInput, optFns ...func(*s3.Options)) (*s3.PutBucketTaggingOutput, error)
+	PutBucketVersioning(ctx context.Context, params *s3.PutBucketVersioningInput, optFns ...func(*s3.Options)) (*s3.PutBucketVersioningOutput, error)
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	PutPublicAccessBlock(ctx context.Context, params *s3.PutPublicAccessBlockInput, optFns ...func(*s3.Options)) (*s3.PutPublicAccessBlockOutput, error)
+	SelectObjectContent(ctx context.Context, params *s3.SelectObjectContentInput, optFns ...func(*s3.Options)) (*s3.SelectObjectContentOutput, error)
+	UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error)
+}
+
+// FilesystemOptions configure how a Filesystem reads and writes files.
+type FilesystemOptions struct {
+	ACL        string            // canned acl applied to uploaded keys
+	StrictACL  bool              // fail rather than drop an acl the bucket doesn't support
+	Symlinks   SymlinkMode       // treatment of local symlinks
+	Preserve   bool              // record and restore file mtime, mode and ownership
+	Progress   *ProgressReporter // report transfer progress events, if set
+	Visibility time.Duration     // wait up to this long for uploads to become visible, if set
+	Exclude    []string          // patterns of local paths left out, after those in .s3ignore
+	Include    []string          // patterns of local paths kept despite Exclude
+	Filter     *KeyFilter        // select the keys and files listed by age and size, if set
+	// storage class of uploaded keys, defaulting to that of an s3 source
+	// or else STANDARD
+	StorageClass string
+	Encryption   Encryption // server-side encryption of uploaded keys
+	Headers      Headers    // response headers of uploaded keys
+	ContentType  string     // of uploaded keys, instead of guessing it
+	Tagging      string     // url encoded key=value tags of uploaded keys
+	ObjectLock   ObjectLock // retention and legal hold of uploaded keys
+	// part size and concurrency of uploads in parts, by put-part and of
+	// files too large for a single request
+	Parts mys3.PartOptions
+	// parts of multipart uploads sent at once without Parts.Concurrency,
+	// the operations run in parallel
+	PartParallel int
+	// continue incomplete multipart uploads of the same content, and leave
+	// those that fail to be continued, rather than starting over
+	Resume bool
+	// checksum recorded with uploaded keys, and verified on download, if
+	// set: ChecksumSHA256 or ChecksumCRC32C
+	ChecksumAlgorithm string
+	// retries of parts of transfers stored or fetched corrupted, the
+	// default if nil
+	Retry *RetryPolicy
+	// the clients transfer through the buckets' accelerate endpoints,
+	// checked first to have transfer acceleration enabled
+	Accelerate bool
 }
@@ -0,0 +1,177 @@
+package s3
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ignoreFile names the file at the root of a local tree listing paths to
+// leave out of transfers, in gitignore syntax.
+const ignoreFile = ".s3ignore"
+
+type ignorePattern struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// ignoreRules matches paths beneath root against the patterns of its
+// .s3ignore. The last matching pattern wins, as with gitignore.
+type ignoreRules struct {
+	root     string
+	patterns []ignorePattern
+}
+
+// loadIgnoreRules reads root/.s3ignore, returning nil if there is none.
+func loadIgnoreRules(root string) (*ignoreRules, error) {
+	file, err := os.Open(filepath.Join(root, ignoreFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	rules := &ignoreRules{root: root}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		err = rules.add(scanner.Text())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rules, scanner.Err()
+}
+
+// filter adds the exclude patterns to rules, then the include patterns
+// keeping what they match. rules may be nil, for a tree without an .s3ignore.
+func (rules *ignoreRules) filter(root string, exclude, include []string) (*ignoreRules, error) {
+	if len(exclude) == 0 && len(include) == 0 {
+		return rules, nil
+	}
+	if rules == nil {
+		rules = &ignoreRules{root: root}
+	}
+	for _, pattern := range exclude {
+		err := rules.add(pattern)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, pattern := range include {
+		err := rules.add("!" + pattern)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+// add appends the pattern on a line of gitignore syntax, skipping blank
+// lines and comments.
+func (rules *ignoreRules) add(line string) error {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+	var pattern ignorePattern
+	if strings.HasPrefix(line, "!") {
+		pattern.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\`) {
+		// escaped leading ! or #
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		pattern.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	re, err := regexp.Compile(ignoreRegexp(line))
+	if err != nil {
+		return err
+	}
+	pattern.re = re
+	rules.patterns = append(rules.patterns, pattern)
+	return nil
+}
+
+// ignoreRegexp translates a gitignore pattern to a regexp matching slash
+// separated paths relative to the root.
+func ignoreRegexp(pattern string) string {
+	// a slash anywhere but the end anchors the pattern to the root,
+	// otherwise it matches at any depth
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	var re strings.Builder
+	re.WriteString("^")
+	if !anchored {
+		re.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			re.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			re.WriteString(".*")
+			i += 1
+		case c == '*':
+			re.WriteString("[^/]*")
+		case c == '?':
+			re.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				re.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			re.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			re.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString("$")
+	return re.String()
+}
+
+// ignored reports whether the file or directory at path should be skipped.
+func (rules *ignoreRules) ignored(path string, isDir bool) bool {
+	if rules == nil {
+		return false
+	}
+	rel, err := filepath.Rel(rules.root, path)
+	if err != nil {
+		return false
+	}
+	return rules.matches(filepath.ToSlash(rel), isDir)
+}
+
+// matches reports whether the slash separated path, relative to the root,
+// is matched by the patterns.
+func (rules *ignoreRules) matches(rel string, isDir bool) bool {
+	if rules == nil {
+		return false
+	}
+	matched := false
+	for _, pattern := range rules.patterns {
+		if pattern.dirOnly && !isDir {
+			continue
+		}
+		if pattern.re.MatchString(rel) {
+			matched = !pattern.negate
+		}
+	}
+	return matched
+}
@@ -0,0 +1,64 @@
+@bucket
+Feature: bucket command
+
+  Scenario: I can create a bucket
+    When I run "s3 bucket create s3.barnybug.github.com"
+    Then the bucket "s3.barnybug.github.com" exists
+
+  Scenario: I can list buckets
+    Given I have bucket "s3.barnybug.github.com"
+    When I run "s3 bucket list"
+    Then the output is "s3://s3.barnybug.github.com/\n"
+
+  Scenario: I can remove a bucket
+    Given I have bucket "s3.barnybug.github.com"
+    When I run "s3 bucket remove s3.barnybug.github.com"
+    Then the bucket "s3.barnybug.github.com" does not exist
+
+  Scenario: create needs a bucket name
+    When I run "s3 bucket create"
+    Then the exit code is 1
+
+  Scenario: I can set and show default bucket encryption
+    Given I have bucket "s3.barnybug.github.com"
+    When I run "s3 bucket encryption set --sse aws:kms --sse-kms-key-id alias/mykey --bucket-key s3.barnybug.github.com"
+    And I run "s3 bucket encryption get s3://s3.barnybug.github.com/"
+    Then the output is "s3://s3.barnybug.github.com/: aws:kms key alias/mykey (bucket key)\n"
+
+  Scenario: A bucket without default encryption shows none
+    Given I have bucket "s3.barnybug.github.com"
+    When I run "s3 bucket encryption get s3.barnybug.github.com"
+    Then the output is "s3://s3.barnybug.github.com/: none\n"
+
+  Scenario: An unknown encryption is an error
+    Given I have bucket "s3.barnybug.github.com"
+    When I run "s3 bucket encryption set --sse rot13 s3.barnybug.github.com"
+    Then the exit code is 1
+
+  Scenario: I can set and show bucket tags
+    Given I have bucket "s3.barnybug.github.com"
+    When I run "s3 bucket tag set --tag team=data --tag cost-centre=1234 s3.barnybug.github.com"
+    And I run "s3 bucket tag get s3://s3.barnybug.github.com/"
+    Then the output is "s3://s3.barnybug.github.com/: cost-centre=1234 team=data\n"
+
+  Scenario: A bucket without tags shows none
+    Given I have bucket "s3.barnybug.github.com"
+    When I run "s3 bucket tag get s3.barnybug.github.com"
+    Then the output is "s3://s3.barnybug.github.com/: none\n"
+
+  Scenario: I can tag a bucket when creating it
+    When I run "s3 bucket create --tag team=data s3.barnybug.github.com"
+    And I run "s3 bucket tag get s3.barnybug.github.com"
+    Then the output is "s3://s3.barnybug.github.com/: team=data\n"
+
+  Scenario: A tag without a value is an error
+    Given I have bucket "s3.barnybug.github.com"
+    When I run "s3 bucket tag set --tag team s3.barnybug.github.com"
+    Then the exit code is 1
+    And the output contains "invalid tag"
+
+  Scenario: I can block public access to a bucket
+    Given I have bucket "s3.barnybug.github.com"
+    When I run "s3 bucket public-access-block set --restrict-public-buckets=false s3.barnybug.github.com"
+    And I run "s3 bucket public-access-block get s3.barnybug.github.com"
+    Then the output is "s3://s3.barnybug.github.com/: block-public-acls=true ignore-public-acls=true block-public-policy=true restrict-public-buckets=false\n"
@@ -18,3 +18,135 @@ Feature: cat command
   	Given I have bucket "s3.barnybug.github.com"
     When I run "s3 cat s3://s3.barnybug.github.com/key"
     Then the exit code is 1
+
+  Scenario: cat decompresses .gz keys
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "app.log.gz" contains "LINE ONE" gzipped
+    When I run "s3 cat s3://s3.barnybug.github.com/app.log.gz"
+    Then the output is "LINE ONE"
+
+  Scenario: cat decompresses keys stored with gzip content encoding
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "app.log" contains "LINE ONE" gzipped with content encoding
+    When I run "s3 cat s3://s3.barnybug.github.com/app.log"
+    Then the output is "LINE ONE"
+
+  Scenario: cat --decompress never outputs the stored bytes
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "app.log.gz" contains "LINE ONE" gzipped
+    When I run "s3 cat --decompress never s3://s3.barnybug.github.com/app.log.gz"
+    Then the output is not "LINE ONE"
+
+  Scenario: cat passes through .gz keys that aren't gzipped
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "plain.gz" contains "PLAIN"
+    When I run "s3 cat s3://s3.barnybug.github.com/plain.gz"
+    Then the output is "PLAIN"
+
+  Scenario: cat --decompress rejects unknown modes
+    Given I have bucket "s3.barnybug.github.com"
+    When I run "s3 cat --decompress sometimes s3://s3.barnybug.github.com/app.log.gz"
+    Then the exit code is 1
+    And the output contains "invalid --decompress"
+
+  Scenario: cat reads keys encrypted with a customer key
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    When I run "s3 put --sse-c-key MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY= apple s3://s3.barnybug.github.com/"
+    And I run "s3 cat --sse-c-key MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY= s3://s3.barnybug.github.com/apple"
+    Then the output contains "APPLE"
+    And the exit code is 0
+
+  Scenario: cat without the customer key is an error
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    When I run "s3 put --sse-c-key MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY= apple s3://s3.barnybug.github.com/"
+    And I run "s3 cat s3://s3.barnybug.github.com/apple"
+    Then the output contains "The correct parameters must be provided to retrieve the object"
+    And the exit code is 1
+
+  Scenario: cat --range writes only those bytes
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "alphabet" contains "ABCDEFGHIJ"
+    When I run "s3 cat --range bytes=2-4 s3://s3.barnybug.github.com/alphabet"
+    Then the output is "CDE"
+
+  Scenario: cat --range with a suffix writes the last bytes
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "alphabet" contains "ABCDEFGHIJ"
+    When I run "s3 cat --range -3 s3://s3.barnybug.github.com/alphabet"
+    Then the output is "HIJ"
+
+  Scenario: cat --offset and --length write those bytes
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "alphabet" contains "ABCDEFGHIJ"
+    When I run "s3 cat --offset 6 --length 2 s3://s3.barnybug.github.com/alphabet"
+    And I run "s3 cat --offset 8 s3://s3.barnybug.github.com/alphabet"
+    Then the output is "GHIJ"
+
+  Scenario: cat --range of a local file
+    Given local file "alphabet" contains "ABCDEFGHIJ"
+    When I run "s3 cat --range 1-2 alphabet"
+    Then the output is "BC"
+
+  Scenario: an invalid cat --range is an error
+    When I run "s3 cat --range bytes=5-2 s3://s3.barnybug.github.com/alphabet"
+    Then the output contains "ends before it starts"
+    And the exit code is 1
+
+  Scenario: cat --head writes the first lines
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "app.log" contains 100 numbered lines
+    When I run "s3 cat --head 2 s3://s3.barnybug.github.com/app.log"
+    Then the output is "line 1\nline 2\n"
+
+  Scenario: cat --tail writes the last lines
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "app.log" contains 100 numbered lines
+    When I run "s3 cat --tail 2 s3://s3.barnybug.github.com/app.log"
+    Then the output is "line 99\nline 100\n"
+
+  Scenario: cat --tail fetches more of the end until it has the lines
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "app.log" contains 30000 numbered lines
+    When I run "s3 cat --tail 20000 s3://s3.barnybug.github.com/app.log"
+    Then the output contains "line 10001\n"
+    And the output does not contain "line 10000\n"
+    And the output contains "line 30000\n"
+
+  Scenario: cat --tail of a short key writes it all
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "app.log" contains "one\ntwo"
+    When I run "s3 cat --tail 5 s3://s3.barnybug.github.com/app.log"
+    Then the output is "one\ntwo"
+
+  Scenario: cat --head and --tail of gzipped keys
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "app.log.gz" contains "LINE ONE" gzipped
+    When I run "s3 cat --head 1 s3://s3.barnybug.github.com/app.log.gz"
+    And I run "s3 cat --tail 1 s3://s3.barnybug.github.com/app.log.gz"
+    Then the output is "LINE ONELINE ONE"
+
+  Scenario: cat --head and --tail can't be given together
+    When I run "s3 cat --head 1 --tail 1 s3://s3.barnybug.github.com/app.log"
+    Then the exit code is 1
+
+  Scenario: cat writes many keys in order while fetching them at once
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "log/00" contains "ZERO\n"
+    And bucket "s3.barnybug.github.com" key "log/01" contains "ONE\n"
+    And bucket "s3.barnybug.github.com" key "log/02" contains "TWO\n"
+    And bucket "s3.barnybug.github.com" key "log/03" contains "THREE\n"
+    And bucket "s3.barnybug.github.com" key "log/04" contains "FOUR\n"
+    And bucket "s3.barnybug.github.com" key "log/05" contains "FIVE\n"
+    When I run "s3 -p 4 cat s3://s3.barnybug.github.com/log/"
+    Then the output is "ZERO\nONE\nTWO\nTHREE\nFOUR\nFIVE\n"
+
+  Scenario: cat writes big keys whole and in order
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "log/00" contains 200000 numbered lines
+    And bucket "s3.barnybug.github.com" key "log/01" contains 200000 numbered lines
+    And bucket "s3.barnybug.github.com" key "log/02" contains 200000 numbered lines
+    When I run "s3 -p 3 cat s3://s3.barnybug.github.com/log/"
+    Then the output contains "line 199999\nline 200000\nline 1\nline 2\n"
+    And the output does not contain "line 200000\nline 200000\n"
@@ -0,0 +1,28 @@
+@changes
+Feature: changes command
+
+  Scenario: Without a previous listing every key is created
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "logs/apple" contains "APPLE"
+    When I run "s3 changes --save listing.csv s3://s3.barnybug.github.com/logs/"
+    Then the output is "A apple\n\n1 created, 0 modified, 0 deleted\n"
+    And local file "listing.csv" includes "key,size,etag,last_modified"
+    And local file "listing.csv" includes "apple,5,"
+
+  Scenario: I can list changes since a saved listing
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "logs/apple" contains "APPLE"
+    And bucket "s3.barnybug.github.com" key "logs/banana" contains "BANANA"
+    And bucket "s3.barnybug.github.com" key "logs/cherry" contains "CHERRY"
+    When I run "s3 changes --save listing.csv s3://s3.barnybug.github.com/logs/"
+    And bucket "s3.barnybug.github.com" key "logs/banana" contains "BANANAS"
+    And bucket "s3.barnybug.github.com" key "logs/date" contains "DATE"
+    And I run "s3 rm s3://s3.barnybug.github.com/logs/cherry"
+    And I run "s3 -q changes --since listing.csv s3://s3.barnybug.github.com/logs/"
+    Then the output contains "U banana\nD cherry\nA date\n"
+
+  Scenario: changes rejects a file that isn't a listing
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "listing.csv" contains "nonsense"
+    When I run "s3 changes --since listing.csv s3://s3.barnybug.github.com/logs/"
+    Then the exit code is 1
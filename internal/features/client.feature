@@ -0,0 +1,55 @@
+@client
+Feature: Client
+
+  Scenario: A client syncs, returning what it did
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "orange"
+    And bucket "s3.barnybug.github.com" key "cherry" contains "CHERRY"
+    And local file "apple" contains "APPLE"
+    And local file "banana" contains "BANANA"
+    And local file "cherry" contains "CHERRY"
+    When I sync "." to "s3://s3.barnybug.github.com/" with a client
+    Then the client's result is "1 added 0 deleted 1 updated 1 unchanged 11 bytes"
+    And bucket "s3.barnybug.github.com" has key "banana" with contents "BANANA"
+    And the output is ""
+
+  Scenario: A client puts files
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    When I put "apple" to "s3://s3.barnybug.github.com/" with a client
+    Then the client's result is "1 added 0 deleted 0 updated 0 unchanged 5 bytes"
+    And bucket "s3.barnybug.github.com" has key "apple" with contents "APPLE"
+
+  Scenario: A client gets keys
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "APPLE"
+    When I get "s3://s3.barnybug.github.com/apple" with a client
+    Then the client's result is "1 added 0 deleted 0 updated 0 unchanged 5 bytes"
+    And local file "apple" has contents "APPLE"
+
+  Scenario: A client lists keys
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "APPLE"
+    And bucket "s3.barnybug.github.com" key "banana" contains "BANANA"
+    When I list "s3://s3.barnybug.github.com/" with a client
+    Then the client listed "s3://s3.barnybug.github.com/apple s3://s3.barnybug.github.com/banana 2 files, 11 bytes"
+
+  Scenario: A client removes keys
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "APPLE"
+    And bucket "s3.barnybug.github.com" key "banana" contains "BANANA"
+    When I remove "s3://s3.barnybug.github.com/a" with a client
+    Then the client's result is "0 added 1 deleted 0 updated 0 unchanged 0 bytes"
+    And bucket "s3.barnybug.github.com" key "apple" does not exist
+    And bucket "s3.barnybug.github.com" has key "banana" with contents "BANANA"
+
+  Scenario: A client stops syncing once its context is canceled
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    When I sync "." to "s3://s3.barnybug.github.com/" with a client and a canceled context
+    Then the client failed with "canceled"
+    And bucket "s3.barnybug.github.com" key "apple" does not exist
+
+  Scenario: A client fails as the command does
+    When I get "s3://missing/apple" with a client
+    Then the client failed with "NoSuchBucket"
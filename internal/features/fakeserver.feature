@@ -0,0 +1,631 @@
+@fakeserver
+Feature: fake-server command
+
+  Scenario: I can list buckets on the fake server
+    Given I use a fake server
+    And I have bucket "s3.barnybug.github.com"
+    When I run "s3 ls"
+    Then the output is "s3://s3.barnybug.github.com/\n"
+
+  Scenario: I can put, list and cat keys on the fake server
+    Given I use a fake server
+    And I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    When I run "s3 put apple s3://s3.barnybug.github.com/fruit/apple"
+    And I run "s3 -q ls s3://s3.barnybug.github.com/fruit/"
+    And I run "s3 cat s3://s3.barnybug.github.com/fruit/apple"
+    Then the output contains "s3://s3.barnybug.github.com/fruit/apple\nAPPLE"
+    And the exit code is 0
+
+  Scenario: I can sync to and from the fake server
+    Given I use a fake server
+    And I have bucket "s3.barnybug.github.com"
+    And local file "dir/apple" contains "APPLE"
+    And local file "dir/banana" contains "BANANA"
+    When I run "s3 sync dir/ s3://s3.barnybug.github.com/fruit/"
+    And I run "s3 sync s3://s3.barnybug.github.com/fruit/ copy/"
+    Then local file "copy/apple" has contents "APPLE"
+    And local file "copy/banana" has contents "BANANA"
+    And the exit code is 0
+
+  Scenario: I can remove keys from the fake server
+    Given I use a fake server
+    And I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "APPLE"
+    When I run "s3 rm s3://s3.barnybug.github.com/apple"
+    Then bucket "s3.barnybug.github.com" key "apple" does not exist
+
+  Scenario: Keys on the fake server survive a restart
+    Given I use a fake server
+    And I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "APPLE"
+    When the fake server restarts
+    And I run "s3 cat s3://s3.barnybug.github.com/apple"
+    Then the output is "APPLE"
+
+  Scenario: The fake server reports missing buckets
+    Given I use a fake server
+    When I run "s3 ls s3://missing/"
+    Then the output contains "NoSuchBucket"
+    And the exit code is 1
+
+  Scenario: The fake server checks checksums sent with uploads
+    Given I use a fake server
+    And I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    When I run "s3 put --checksum-algorithm sha256 apple s3://s3.barnybug.github.com/"
+    And I run "s3 cat s3://s3.barnybug.github.com/apple"
+    Then the output contains "APPLE"
+    And the exit code is 0
+
+  Scenario: Writes to the fake server check the expected bucket owner
+    Given I use a fake server
+    And I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    And local file "banana" contains "BANANA"
+    When I run "s3 --expected-bucket-owner 123456789012 put apple s3://s3.barnybug.github.com/"
+    And I run "s3 --expected-bucket-owner 999999999999 put banana s3://s3.barnybug.github.com/"
+    Then the output contains "AccessDenied"
+    And the exit code is 1
+    And bucket "s3.barnybug.github.com" has key "apple" with contents "APPLE"
+    And bucket "s3.barnybug.github.com" key "banana" does not exist
+
+  Scenario: Reads ignore the expected bucket owner
+    Given I use a fake server
+    And I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "APPLE"
+    When I run "s3 --expected-bucket-owner 999999999999 cat s3://s3.barnybug.github.com/apple"
+    Then the output is "APPLE"
+    And the exit code is 0
+
+  Scenario: The expected bucket owner must be an account id
+    When I run "s3 --expected-bucket-owner me ls"
+    Then the output contains "--expected-bucket-owner must be a 12 digit account id"
+    And the exit code is 1
+
+  Scenario: The role to assume must be an arn
+    When I run "s3 --role-arn admin ls"
+    Then the output contains "--role-arn "admin" is not an arn"
+    And the exit code is 1
+
+  Scenario: An external id needs a role to assume
+    When I run "s3 --external-id secret ls"
+    Then the output contains "--external-id and --role-session-name need a --role-arn"
+    And the exit code is 1
+
+  Scenario: The profile must be in the shared aws files
+    Given local file "aws-config" contains "[profile dev]\nregion = eu-west-1\n"
+    And the environment variable "AWS_CONFIG_FILE" is "aws-config"
+    And the environment variable "AWS_SHARED_CREDENTIALS_FILE" is "aws-credentials"
+    When I run "s3 --profile prod ls"
+    Then the output contains "profile "prod" not found"
+    And the exit code is 1
+
+  Scenario: A profile of the shared aws config is accepted
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "aws-config" contains "[profile dev]\nregion = eu-west-1\n"
+    And the environment variable "AWS_CONFIG_FILE" is "aws-config"
+    And the environment variable "AWS_SHARED_CREDENTIALS_FILE" is "aws-credentials"
+    When I run "s3 --profile dev ls"
+    Then the output contains "s3://s3.barnybug.github.com"
+    And the exit code is 0
+
+  Scenario: --access-key and --secret-key sign requests in place of the default credentials
+    Given I use a fake server
+    And I have bucket "s3.barnybug.github.com"
+    When I run "s3 --debug --access-key AKIDSTATIC --secret-key secret --session-token TOKEN ls" against the fake server
+    Then the output contains "Credential=AKIDSTATIC/"
+    And the output contains "X-Amz-Security-Token: REDACTED"
+    And the output does not contain ": TOKEN"
+    And the output contains "s3://s3.barnybug.github.com"
+    And the exit code is 0
+
+  Scenario: The keys are read from the files of the -file flags
+    Given I use a fake server
+    And I have bucket "s3.barnybug.github.com"
+    And local file "access-key" contains "AKIDFILE\n"
+    And local file "secret-key" contains "secret\n"
+    When I run "s3 --debug --access-key-file access-key --secret-key-file secret-key ls" against the fake server
+    Then the output contains "Credential=AKIDFILE/"
+    And the output contains "s3://s3.barnybug.github.com"
+    And the exit code is 0
+
+  Scenario: --access-key needs a --secret-key
+    When I run "s3 --access-key AKIDSTATIC ls"
+    Then the output contains "--access-key and --secret-key must be given together"
+    And the exit code is 1
+
+  Scenario: A key is given by the flag or its file, not both
+    Given local file "secret-key" contains "secret\n"
+    When I run "s3 --access-key AKIDSTATIC --secret-key secret --secret-key-file secret-key ls"
+    Then the output contains "--secret-key and --secret-key-file can't be used together"
+    And the exit code is 1
+
+  Scenario: The file of a key must not be empty
+    Given local file "secret-key" contains "\n"
+    When I run "s3 --access-key AKIDSTATIC --secret-key-file secret-key ls"
+    Then the output contains "--secret-key-file "secret-key" is empty"
+    And the exit code is 1
+
+  Scenario: --access-key can't be used with --profile
+    When I run "s3 --access-key AKIDSTATIC --secret-key secret --profile dev ls"
+    Then the output contains "--access-key and --profile can't be used together"
+    And the exit code is 1
+
+  Scenario: A private CA is trusted with --ca-bundle
+    Given I use a fake server over https with its certificate in "ca.pem"
+    And I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    When I run "s3 --ca-bundle ca.pem put apple s3://s3.barnybug.github.com/" against the fake server
+    And I run "s3 --ca-bundle ca.pem cat s3://s3.barnybug.github.com/apple" against the fake server
+    Then the output contains "APPLE"
+    And the exit code is 0
+
+  Scenario: Certificates of a private CA are refused without --ca-bundle
+    Given I use a fake server over https with its certificate in "ca.pem"
+    And I have bucket "s3.barnybug.github.com"
+    When I run "s3 ls" against the fake server
+    Then the output contains "certificate"
+    And the exit code is 1
+
+  Scenario: Certificates aren't verified with --insecure-skip-verify
+    Given I use a fake server over https with its certificate in "ca.pem"
+    And I have bucket "s3.barnybug.github.com"
+    When I run "s3 --insecure-skip-verify ls" against the fake server
+    Then the output contains "s3://s3.barnybug.github.com"
+    And the exit code is 0
+
+  Scenario: The CA bundle must hold pem certificates
+    Given local file "ca.pem" contains "not a certificate"
+    When I run "s3 --ca-bundle ca.pem ls"
+    Then the output contains "--ca-bundle "ca.pem" has no pem certificates"
+    And the exit code is 1
+
+  Scenario: The CA bundle must exist
+    When I run "s3 --ca-bundle missing.pem ls"
+    Then the output contains "missing.pem: no such file or directory"
+    And the exit code is 1
+
+  Scenario: Requests to a hung endpoint give up after --timeout
+    Given I use a fake server
+    And I have bucket "s3.barnybug.github.com"
+    And the fake server takes "1m" to respond
+    When I run "s3 --timeout 100ms ls" against the fake server
+    Then the output contains "timeout awaiting response headers"
+    And the exit code is 1
+
+  Scenario: Requests answered within --timeout succeed
+    Given I use a fake server
+    And I have bucket "s3.barnybug.github.com"
+    And the fake server takes "50ms" to respond
+    When I run "s3 --timeout 5s ls" against the fake server
+    Then the output contains "s3://s3.barnybug.github.com"
+    And the exit code is 0
+
+  Scenario: --connect-timeout gives up connecting only, not awaiting a response
+    Given I use a fake server
+    And I have bucket "s3.barnybug.github.com"
+    And the fake server takes "500ms" to respond
+    When I run "s3 --connect-timeout 100ms ls" against the fake server
+    Then the output contains "s3://s3.barnybug.github.com"
+    And the exit code is 0
+
+  Scenario: Parallel transfers share the connections of a tuned transport
+    Given I use a fake server
+    And I have bucket "s3.barnybug.github.com"
+    And local file "a" contains "A"
+    And local file "b" contains "B"
+    And local file "c" contains "C"
+    When I run "s3 --max-idle-conns 8 --max-conns-per-host 2 --idle-conn-timeout 10s --keep-alive 10s -p 8 put a b c s3://s3.barnybug.github.com/" against the fake server
+    Then the exit code is 0
+    And bucket "s3.barnybug.github.com" key "a" matches local file "a"
+    And bucket "s3.barnybug.github.com" key "b" matches local file "b"
+    And bucket "s3.barnybug.github.com" key "c" matches local file "c"
+
+  Scenario: Throttled requests are retried
+    Given I use a fake server
+    And I have bucket "s3.barnybug.github.com"
+    And the fake server throttles the next 2 requests
+    When I run "s3 ls" against the fake server
+    Then the output contains "s3://s3.barnybug.github.com"
+    And the exit code is 0
+
+  Scenario: --max-retries limits the retries of a request
+    Given I use a fake server
+    And I have bucket "s3.barnybug.github.com"
+    And the fake server throttles the next 2 requests
+    When I run "s3 --max-retries 1 ls" against the fake server
+    Then the output contains "SlowDown"
+    And the exit code is 1
+
+  Scenario: --max-retries 0 doesn't retry
+    Given I use a fake server
+    And I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    And the fake server throttles the next 1 request
+    When I run "s3 --max-retries 0 put apple s3://s3.barnybug.github.com/" against the fake server
+    Then the output contains "SlowDown"
+    And the exit code is 1
+
+  Scenario: --retry-mode adaptive retries throttled requests
+    Given I use a fake server
+    And I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    And the fake server throttles the next 2 requests
+    When I run "s3 --retry-mode adaptive -p 4 put apple s3://s3.barnybug.github.com/" against the fake server
+    Then the exit code is 0
+    And bucket "s3.barnybug.github.com" key "apple" matches local file "apple"
+
+  Scenario: Requests timed out by S3 are retried
+    Given I use a fake server
+    And I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "APPLE"
+    And the fake server times out the next 2 requests
+    When I run "s3 get s3://s3.barnybug.github.com/apple" against the fake server
+    Then the exit code is 0
+    And local file "apple" has contents "APPLE"
+
+  Scenario: Requests whose connection is reset are retried
+    Given I use a fake server
+    And I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    And the fake server resets the connection of the next 2 requests
+    When I run "s3 put apple s3://s3.barnybug.github.com/" against the fake server
+    Then the exit code is 0
+    And bucket "s3.barnybug.github.com" key "apple" matches local file "apple"
+
+  Scenario: Deletes are retried as every other request is
+    Given I use a fake server
+    And I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "APPLE"
+    And the fake server throttles the next 2 requests
+    When I run "s3 rm s3://s3.barnybug.github.com/apple" against the fake server
+    Then the exit code is 0
+    And bucket "s3.barnybug.github.com" key "apple" does not exist
+
+  Scenario: --max-retries 0 fails on a reset connection
+    Given I use a fake server
+    And I have bucket "s3.barnybug.github.com"
+    And the fake server resets the connection of the next 1 request
+    When I run "s3 --max-retries 0 ls" against the fake server
+    Then the output contains "connection reset"
+    And the exit code is 1
+
+  Scenario: --rps limits the requests for keys a second
+    Given I use a fake server
+    And I have bucket "s3.barnybug.github.com"
+    And local file "a" contains "A"
+    And local file "b" contains "B"
+    And local file "c" contains "C"
+    And local file "d" contains "D"
+    And local file "e" contains "E"
+    And local file "f" contains "F"
+    When I run "s3 --rps 5 put a b c d e f s3://s3.barnybug.github.com/" against the fake server
+    Then the exit code is 0
+    And it took at least "1s"
+    And bucket "s3.barnybug.github.com" key "f" matches local file "f"
+
+  Scenario: --list-rps limits the list requests a second
+    Given I use a fake server
+    And I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" has 2001 keys under "logs/"
+    When I run "s3 --list-rps 2 ls s3://s3.barnybug.github.com/logs/" against the fake server
+    Then the exit code is 0
+    And it took at least "1s"
+
+  Scenario: List requests are limited apart from those for keys
+    Given I use a fake server
+    And I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" has 2001 keys under "logs/"
+    When I run "s3 --rps 0.5 --list-rps 100 ls s3://s3.barnybug.github.com/logs/" against the fake server
+    Then the exit code is 0
+    And it took less than "1s"
+
+  Scenario: --virtual-host-style addresses buckets by host name
+    Given I use a fake server
+    And I have bucket "barnybug"
+    When I run "s3 --max-retries 0 --virtual-host-style ls s3://barnybug/" against the fake server
+    Then the output contains "barnybug.localhost"
+    And the exit code is 1
+
+  Scenario: --virtual-host-style addresses buckets by host name for uploads too
+    Given I use a fake server
+    And I have bucket "barnybug"
+    And local file "apple" contains "APPLE"
+    When I run "s3 --max-retries 0 --virtual-host-style put apple s3://barnybug/" against the fake server
+    Then the output contains "barnybug.localhost"
+    And the exit code is 1
+
+  Scenario: --force-path-style addresses buckets by path
+    Given I use a fake server
+    And I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    When I run "s3 --force-path-style put apple s3://s3.barnybug.github.com/" against the fake server
+    Then the exit code is 0
+    And bucket "s3.barnybug.github.com" key "apple" matches local file "apple"
+
+  Scenario: SIGINT stops a command with a distinct exit code
+    Given I use a fake server
+    And I have bucket "s3.barnybug.github.com"
+    And the fake server takes "1m" to respond
+    When I run "s3 ls" against the fake server and interrupt it
+    Then the output is "Interrupted by SIGINT\n"
+    And the exit code is 130
+
+  Scenario: An interrupted get removes its partial file
+    Given I use a fake server
+    And I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "APPLE"
+    And the fake server takes "1m" to respond to gets of keys
+    When I run "s3 get s3://s3.barnybug.github.com/apple" against the fake server and interrupt it
+    Then the output contains "Interrupted by SIGINT"
+    And local file "apple.s3part" does not exist
+    And local file "apple" does not exist
+    And the exit code is 130
+
+  Scenario: An interrupted get --resume keeps its partial file to resume from
+    Given I use a fake server
+    And I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "APPLE"
+    And the fake server takes "1m" to respond to gets of keys
+    When I run "s3 get --resume s3://s3.barnybug.github.com/apple" against the fake server and interrupt it
+    Then local file "apple.s3part" is empty
+    And the exit code is 130
+
+  Scenario: The timeout can't be negative
+    When I run "s3 --timeout -1s ls"
+    Then the output contains "--timeout can't be negative"
+    And the exit code is 1
+
+  Scenario: The connections of the transport can't be negative
+    When I run "s3 --max-conns-per-host -1 ls"
+    Then the output contains "--max-idle-conns and --max-conns-per-host can't be negative"
+    And the exit code is 1
+
+  Scenario: The timeouts of the transport can't be negative
+    When I run "s3 --connect-timeout -1s ls"
+    Then the output contains "--idle-conn-timeout and --connect-timeout can't be negative"
+    And the exit code is 1
+
+  Scenario: The retries can't be negative
+    When I run "s3 --max-retries -1 ls"
+    Then the output contains "--max-retries can't be negative"
+    And the exit code is 1
+
+  Scenario: The retry mode must be known
+    When I run "s3 --retry-mode eager ls"
+    Then the output contains "--retry-mode must be standard or adaptive"
+    And the exit code is 1
+
+  Scenario: The request rates can't be negative
+    When I run "s3 --rps -1 ls"
+    Then the output contains "--rps and --list-rps can't be negative"
+    And the exit code is 1
+
+  Scenario: --use-dualstack uses the region's dual-stack endpoint
+    When I run "s3 --use-dualstack --region xx-nowhere-1 --max-retries 0 ls s3://s3.barnybug.github.com/" with a connection of its own
+    Then the output contains "s3.dualstack.xx-nowhere-1.amazonaws.com"
+    And the exit code is 1
+
+  Scenario: --use-fips needs a region with a FIPS endpoint
+    When I run "s3 --use-fips --region eu-west-1 ls"
+    Then the output contains "--use-fips: s3 has no FIPS endpoint in region"
+    And the exit code is 1
+
+  Scenario: --use-fips and --use-dualstack can't be used with --endpoint
+    When I run "s3 --use-fips --endpoint http://localhost:9000 ls"
+    Then the output contains "can't be used with --endpoint"
+    And the exit code is 1
+
+  Scenario: The scheme of an --endpoint must be http or https
+    When I run "s3 --endpoint htp://localhost:9000 ls"
+    Then the output contains "endpoint "htp://localhost:9000": scheme must be http or https, not "htp""
+    And the exit code is 1
+
+  Scenario: A malformed scheme of an --endpoint is reported
+    When I run "s3 --endpoint https:/localhost:9000 ls"
+    Then the output contains "endpoint "https:/localhost:9000": malformed scheme, expected https://"
+    And the exit code is 1
+
+  Scenario: The port of an --endpoint must be in range
+    When I run "s3 --endpoint http://localhost:99999 ls"
+    Then the output contains "endpoint "http://localhost:99999": port must be 1 to 65535, not 99999"
+    And the exit code is 1
+
+  Scenario: An --endpoint must have a host
+    When I run "s3 --endpoint http:// ls"
+    Then the output contains "endpoint "http://" has no host"
+    And the exit code is 1
+
+  Scenario: Every endpoint of a failover list is checked
+    When I run "s3 --endpoint http://node1:9000,node2:port ls"
+    Then the output contains "endpoint "node2:port": invalid port"
+    And the exit code is 1
+
+  Scenario: Requests fail over from an endpoint that can't be reached to the next
+    Given I use a fake server
+    And I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "APPLE"
+    When I run "s3 --debug --endpoint http://127.0.0.1:1,{fake-server} get s3://s3.barnybug.github.com/apple" against the fake server
+    Then local file "apple" contains "APPLE"
+    And the output contains "Host: 127.0.0.1:1" 1 time
+    And the output contains "Host: localhost:" 2 times
+    And the exit code is 0
+
+  Scenario: -vv logs a summary of each request
+    Given I use a fake server
+    And I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "APPLE"
+    When I run "s3 -vv ls s3://s3.barnybug.github.com/" against the fake server
+    Then the output contains "request: ListObjectsV2 GET http://localhost:"
+    And the output contains "/s3.barnybug.github.com/ 200 "
+    And the output contains "s3://s3.barnybug.github.com/apple"
+    And the exit code is 0
+
+  Scenario: -vv logs the errors of requests
+    Given I use a fake server
+    And I have bucket "s3.barnybug.github.com"
+    When I run "s3 -vv ls s3://missing/" against the fake server
+    Then the output contains "request: ListObjectsV2 GET http://localhost:"
+    And the output contains "/missing/ 404 "
+    And the output contains "error=NoSuchBucket"
+
+  Scenario: -vv logs the uploads of mys3
+    Given I use a fake server
+    And I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    When I run "s3 -vv put apple s3://s3.barnybug.github.com/" against the fake server
+    Then the output contains "uploaded bucket=s3.barnybug.github.com key=apple location="
+    And the exit code is 0
+
+  Scenario: -q silences the logs of mys3
+    Given I use a fake server
+    And I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    When I run "s3 -vv -q put apple s3://s3.barnybug.github.com/" against the fake server
+    Then the output does not contain "uploaded bucket="
+    And the output contains "request: PutObject"
+    And the exit code is 0
+
+  Scenario: --log-format json logs the uploads of mys3 as records
+    Given I use a fake server
+    And I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    When I run "s3 -vv --log-format json put apple s3://s3.barnybug.github.com/" against the fake server
+    Then the output contains ""level":"debug","msg":"uploaded location=http://localhost:"
+    And the output contains ""bucket":"s3.barnybug.github.com","key":"apple""
+    And the exit code is 0
+
+  Scenario: --debug logs the headers of requests and responses
+    Given I use a fake server
+    And I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "APPLE"
+    When I run "s3 --debug get s3://s3.barnybug.github.com/apple" against the fake server
+    Then the output contains "GET /s3.barnybug.github.com/apple?x-id=GetObject HTTP/1.1"
+    And the output contains "HTTP/1.1 200 OK"
+    And the output does not contain "APPLE"
+    And the exit code is 0
+
+  Scenario: --debug redacts sse-c keys
+    Given I use a fake server
+    And I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    When I run "s3 --debug put --sse-c-key MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY= apple s3://s3.barnybug.github.com/" against the fake server
+    Then the output contains "X-Amz-Server-Side-Encryption-Customer-Key: REDACTED"
+    And the output does not contain "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+    And the exit code is 0
+
+  Scenario: --log-format json logs a record of each request
+    Given I use a fake server
+    And I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "APPLE"
+    When I run "s3 -vv --log-format json -q get s3://s3.barnybug.github.com/apple" against the fake server
+    Then the output contains ""level":"debug""
+    And the output contains ""operation":"GetObject","bucket":"s3.barnybug.github.com","key":"apple","bytes":5,"
+    And the output contains ""status":200"
+    And the output contains ""operation":"get","bucket":"s3.barnybug.github.com","key":"apple","bytes":5"
+    And the output does not contain "request: "
+    And the exit code is 0
+
+  Scenario: --log-format json logs errors as records
+    Given I use a fake server
+    And I have bucket "s3.barnybug.github.com"
+    When I run "s3 -vv --log-format json ls s3://missing/" against the fake server
+    Then the output contains ""operation":"ListObjectsV2","bucket":"missing","
+    And the output contains ""status":404,"error":"NoSuchBucket""
+    And the output contains ""level":"error""
+    And the output does not contain "Error: "
+    And the exit code is 1
+
+  Scenario: --log-format must be text or json
+    When I run "s3 --log-format xml ls"
+    Then the output contains "--log-format must be text or json, not "xml""
+    And the exit code is 1
+
+  Scenario: --metrics-listen serves the metrics of requests and transfers while running
+    Given I use a fake server
+    And I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "APPLE"
+    And bucket "s3.barnybug.github.com" key "banana" contains "BANANA"
+    And the fake server takes "1s" to respond to gets of keys
+    When I run "s3 -p 1 --metrics-listen 127.0.0.1:39091 get s3://s3.barnybug.github.com/apple s3://s3.barnybug.github.com/banana" against the fake server and scrape its metrics after 1500ms
+    Then the output contains "s3_requests_total{operation="GetObject",status="200"} 1"
+    And the output contains "s3_transferred_bytes_total{action="get"} 5"
+    And the output contains "s3_transfer_duration_seconds_count{action="get"} 1"
+    And the output contains "s3_transfers_in_progress 1"
+    And the exit code is 0
+
+  Scenario: --metrics-listen counts the retries of requests
+    Given I use a fake server
+    And I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "APPLE"
+    And the fake server throttles the next 1 request
+    And the fake server takes "3s" to respond to gets of keys
+    When I run "s3 --metrics-listen 127.0.0.1:39091 get s3://s3.barnybug.github.com/apple" against the fake server and scrape its metrics after 1500ms
+    Then the output contains "s3_requests_total{operation="ListObjectsV2",status="503"} 1"
+    And the output contains "s3_request_retries_total{operation="ListObjectsV2"} 1"
+    And the exit code is 0
+
+  Scenario: --metrics-listen must be an address to listen on
+    When I run "s3 --metrics-listen nonsense ls"
+    Then the output contains "--metrics-listen: listen tcp: address nonsense: missing port in address"
+    And the exit code is 1
+
+  Scenario: --target uses the endpoint of a target of the config file
+    Given I use a fake server
+    And I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "APPLE"
+    And the config file contains "# local\ntargets:\n  fake:\n    endpoint: {fake-server}\n    region: 'eu-west-1'  # any\n"
+    When I run "s3 --target fake ls s3://s3.barnybug.github.com/" with a connection of its own
+    Then the output contains "s3://s3.barnybug.github.com/apple"
+    And the exit code is 0
+
+  Scenario: --target addresses buckets as the target does
+    Given I use a fake server
+    And I have bucket "barnybug"
+    And the config file contains "targets:\n  fake:\n    endpoint: {fake-server}\n    path-style: false\n"
+    When I run "s3 --max-retries 0 --target fake ls s3://barnybug/" with a connection of its own
+    Then the output contains "barnybug.localhost"
+    And the exit code is 1
+
+  Scenario: Flags override the settings of the --target
+    Given I use a fake server
+    And I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "APPLE"
+    And the config file contains "targets:\n  fake:\n    endpoint: http://127.0.0.1:1\n    path-style: false\n"
+    When I run "s3 --target fake --force-path-style ls s3://s3.barnybug.github.com/" against the fake server
+    Then the output contains "s3://s3.barnybug.github.com/apple"
+    And the exit code is 0
+
+  Scenario: --target must be in the config file
+    Given the config file contains "targets:\n  fake:\n    endpoint: http://127.0.0.1:1\n"
+    When I run "s3 --target minio-prod ls"
+    Then the output contains "--target minio-prod: not found in "
+    And the exit code is 1
+
+  Scenario: Targets of the config file have known settings only
+    Given the config file contains "targets:\n  fake:\n    endpoints: http://127.0.0.1:1\n"
+    When I run "s3 --target fake ls"
+    Then the output contains "unknown setting "endpoints" of target fake"
+    And the exit code is 1
+
+  Scenario: Buckets are addressed one way only
+    When I run "s3 --force-path-style --virtual-host-style ls"
+    Then the output contains "--force-path-style and --virtual-host-style can't be used together"
+    And the exit code is 1
+
+  Scenario: The fake server keeps tags given on upload
+    Given I use a fake server
+    And I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    When I run "s3 put --tagging env=prod apple s3://s3.barnybug.github.com/"
+    Then bucket "s3.barnybug.github.com" key "apple" has tags "env=prod"
+
+  Scenario: The fake server keeps object lock retention given on upload
+    Given I use a fake server
+    And I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    When I run "s3 put --object-lock-mode governance --retain-until 2099-01-02T15:04:05Z --legal-hold apple s3://s3.barnybug.github.com/"
+    Then bucket "s3.barnybug.github.com" key "apple" has header "X-Amz-Object-Lock-Mode" of "GOVERNANCE"
+    And bucket "s3.barnybug.github.com" key "apple" has header "X-Amz-Object-Lock-Retain-Until-Date" of "2099-01-02T15:04:05Z"
+    And bucket "s3.barnybug.github.com" key "apple" has header "X-Amz-Object-Lock-Legal-Hold" of "ON"
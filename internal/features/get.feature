@@ -7,6 +7,68 @@ Feature: get command
     When I run "s3 get s3://s3.barnybug.github.com/path/key"
     Then local file "key" has contents "123"
 
+  Scenario: I get a file with the object's modification time
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "path/key" contains "123"
+    And bucket "s3.barnybug.github.com" key "path/key" was last modified "2020-01-02T03:04:05Z"
+    When I run "s3 get s3://s3.barnybug.github.com/path/key"
+    Then local file "key" was last modified "2020-01-02T03:04:05Z"
+
+  Scenario: I can get a file to standard output
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "path/key" contains "123"
+    When I run "s3 get s3://s3.barnybug.github.com/path/key -"
+    Then the output is "123"
+    And local file "key" does not exist
+    And local file "-" does not exist
+
+  Scenario: get keeps .gz keys compressed by default
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "app.log.gz" contains "LINE ONE" gzipped
+    When I run "s3 get s3://s3.barnybug.github.com/app.log.gz"
+    Then local file "app.log" does not exist
+    And local file "app.log.gz" exists
+
+  Scenario: get --decompress auto gunzips .gz keys, dropping the extension
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "logs/app.log.gz" contains "LINE ONE" gzipped
+    And bucket "s3.barnybug.github.com" key "logs/plain.txt" contains "PLAIN"
+    When I run "s3 get --decompress auto s3://s3.barnybug.github.com/logs/"
+    Then local file "app.log" has contents "LINE ONE"
+    And local file "plain.txt" has contents "PLAIN"
+
+  Scenario: get --decompress auto gunzips keys with gzip content encoding
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "app.log" contains "LINE ONE" gzipped with content encoding
+    When I run "s3 get --decompress auto s3://s3.barnybug.github.com/app.log -"
+    Then the output is "LINE ONE"
+
+  Scenario: get fails a download that doesn't match the key's md5
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "key" contains "123456" uploaded in parts of 3 bytes
+    And bucket "s3.barnybug.github.com" key "key" is given metadata "md5_checksum" of "00000000000000000000000000000000"
+    When I run "s3 get s3://s3.barnybug.github.com/key"
+    Then the exit code is 1
+    And the output contains "failed checksum verification"
+    And local file "key" does not exist
+    And local file "key.s3part" does not exist
+
+  Scenario: get --no-verify skips the md5 check
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "key" contains "123456" uploaded in parts of 3 bytes
+    And bucket "s3.barnybug.github.com" key "key" is given metadata "md5_checksum" of "00000000000000000000000000000000"
+    When I run "s3 get --no-verify s3://s3.barnybug.github.com/key"
+    Then the exit code is 0
+    And local file "key" has contents "123456"
+
+  Scenario: get verifies downloads against the md5 recorded at upload
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "key" contains "123456" uploaded in parts of 3 bytes
+    And bucket "s3.barnybug.github.com" key "key" is given metadata "md5_checksum" of "e10adc3949ba59abbe56e057f20f883e"
+    When I run "s3 get s3://s3.barnybug.github.com/key"
+    Then the exit code is 0
+    And local file "key" has contents "123456"
+
   Scenario: I can get multiple files
     Given I have bucket "s3.barnybug.github.com"
     And bucket "s3.barnybug.github.com" key "aardvark" contains "AARDVARK"
@@ -43,3 +105,214 @@ Feature: get command
   	Given I have bucket "s3.barnybug.github.com"
     When I run "s3 get ."
     Then the exit code is 1
+
+  Scenario: get verifies each part of a multipart upload with part checksums
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "fruit" contains "APPLEBANANA" uploaded in parts of 5 bytes
+    And bucket "s3.barnybug.github.com" key "fruit" is given metadata "part_size" of "5"
+    And bucket "s3.barnybug.github.com" key "fruit" is given metadata "part_md5s" of "4c462d6dd59d782386bb1cdad0060c70,29fcd1834429c2e3d5a66b2c6ab78754,7fc56270e7a70fa81a5935b72eacbe29"
+    When I run "s3 get s3://s3.barnybug.github.com/fruit"
+    Then local file "fruit" has contents "APPLEBANANA"
+    And the exit code is 0
+
+  Scenario: get fails on a part that doesn't match its checksum
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "fruit" contains "APPLEBANANA" uploaded in parts of 5 bytes
+    And bucket "s3.barnybug.github.com" key "fruit" is given metadata "part_size" of "5"
+    And bucket "s3.barnybug.github.com" key "fruit" is given metadata "part_md5s" of "4c462d6dd59d782386bb1cdad0060c70,00000000000000000000000000000000,7fc56270e7a70fa81a5935b72eacbe29"
+    When I run "s3 get s3://s3.barnybug.github.com/fruit"
+    Then the output contains "part 2 (bytes 5-9) failed checksum verification"
+    And the exit code is 1
+
+  Scenario: I can get a prefix recursively into a local directory
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "photos/2020/a.jpg" contains "A"
+    And bucket "s3.barnybug.github.com" key "photos/2021/b.jpg" contains "B"
+    And bucket "s3.barnybug.github.com" key "photoshop/c.psd" contains "C"
+    When I run "s3 get -r s3://s3.barnybug.github.com/photos local"
+    Then local file "local/2020/a.jpg" has contents "A"
+    And local file "local/2021/b.jpg" has contents "B"
+    And local file "local/c.psd" does not exist
+    And the exit code is 0
+
+  Scenario: get -r needs a local destination
+    Given I have bucket "s3.barnybug.github.com"
+    When I run "s3 get -r s3://s3.barnybug.github.com/photos/"
+    Then the exit code is 1
+
+  Scenario: get resumes a partial download
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "APPLEBANANA"
+    And local file "apple.s3part" contains "APPLE"
+    When I run "s3 get s3://s3.barnybug.github.com/apple"
+    Then local file "apple" has contents "APPLEBANANA"
+    And local file "apple.s3part" does not exist
+    And the output contains "(6 bytes)"
+
+  Scenario: get starts over when the object changed since the partial download
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "APPLEBANANA"
+    And local file "apple.s3part" contains "APPLE"
+    And bucket "s3.barnybug.github.com" key "apple" is overwritten with "PEARSCHERRY" once listed
+    When I run "s3 get s3://s3.barnybug.github.com/apple"
+    Then local file "apple" has contents "PEARSCHERRY"
+    And local file "apple.s3part" does not exist
+    And the exit code is 0
+
+  Scenario: get --resume appends to an existing shorter file
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "APPLEBANANA"
+    And local file "apple" contains "APPLE"
+    When I run "s3 get --resume s3://s3.barnybug.github.com/apple"
+    Then local file "apple" has contents "APPLEBANANA"
+    And the output contains "(6 bytes)"
+
+  Scenario: get without --resume replaces an existing file
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "APPLEBANANA"
+    And local file "apple" contains "APPLE"
+    When I run "s3 get s3://s3.barnybug.github.com/apple"
+    Then local file "apple" has contents "APPLEBANANA"
+    And the output contains "(11 bytes)"
+
+  Scenario: a resumed download that fails verification is discarded
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "APPLEBANANA"
+    And local file "apple.s3part" contains "PEARS"
+    When I run "s3 get s3://s3.barnybug.github.com/apple"
+    Then the output contains "resumed download failed checksum verification"
+    And local file "apple.s3part" does not exist
+    And the exit code is 1
+
+  Scenario: get fetches large objects in concurrent ranges
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "fruit" contains "APPLEBANANACHERRYDAMSON"
+    When I run "s3 get --range-threshold 10 --range-size 4 --range-concurrency 3 s3://s3.barnybug.github.com/fruit"
+    Then local file "fruit" has contents "APPLEBANANACHERRYDAMSON"
+    And the output contains "(23 bytes)"
+
+  Scenario: get fails when a large object changes while fetched in ranges
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "fruit" contains "APPLEBANANACHERRYDAMSON"
+    And bucket "s3.barnybug.github.com" key "fruit" is overwritten with "ELDERBERRYFIGGRAPEHONEYDEW" once listed
+    When I run "s3 get --range-threshold 10 --range-size 4 --range-concurrency 3 s3://s3.barnybug.github.com/fruit"
+    Then the output contains "s3://s3.barnybug.github.com/fruit: changed during the download"
+    And local file "fruit" does not exist
+    And local file "fruit.s3part" does not exist
+    And the exit code is 1
+
+  Scenario: get resumes a large object in concurrent ranges
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "fruit" contains "APPLEBANANACHERRYDAMSON"
+    And local file "fruit.s3part" contains "APPLE"
+    When I run "s3 get --range-threshold 10 --range-size 4 --range-concurrency 3 s3://s3.barnybug.github.com/fruit"
+    Then local file "fruit" has contents "APPLEBANANACHERRYDAMSON"
+    And the output contains "(18 bytes)"
+
+  Scenario: get --skip-existing leaves existing files untouched
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "APPLE"
+    And bucket "s3.barnybug.github.com" key "banana" contains "BANANA"
+    And local file "apple" contains "OLD APPLE"
+    When I run "s3 get --skip-existing s3://s3.barnybug.github.com/apple s3://s3.barnybug.github.com/banana"
+    Then local file "apple" has contents "OLD APPLE"
+    And local file "banana" has contents "BANANA"
+    And the output contains "s3://s3.barnybug.github.com/apple -> apple (skipped, exists)"
+
+  Scenario: get --newer-only replaces only files older than the key
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "APPLE"
+    And bucket "s3.barnybug.github.com" key "apple" was last modified "2020-01-02T03:04:05Z"
+    And bucket "s3.barnybug.github.com" key "banana" contains "BANANA"
+    And bucket "s3.barnybug.github.com" key "banana" was last modified "2020-01-02T03:04:05Z"
+    And local file "apple" contains "OLD APPLE"
+    And local file "apple" is dated "2019-01-01T00:00:00Z"
+    And local file "banana" contains "NEW BANANA"
+    And local file "banana" is dated "2021-01-01T00:00:00Z"
+    When I run "s3 get --newer-only s3://s3.barnybug.github.com/apple s3://s3.barnybug.github.com/banana"
+    Then local file "apple" has contents "APPLE"
+    And local file "banana" has contents "NEW BANANA"
+
+  Scenario: overwrite policy flags are mutually exclusive
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "APPLE"
+    When I run "s3 get --skip-existing --newer-only s3://s3.barnybug.github.com/apple"
+    Then the exit code is 1
+    And the output contains "mutually exclusive"
+
+  Scenario: get lays out downloads by --output-template
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "logs/web/access.log" contains "ACCESS"
+    And bucket "s3.barnybug.github.com" key "logs/web/access.log" was last modified "2024-06-01T03:04:05Z"
+    When I run "s3 get --output-template {bucket}/{yyyy}/{mm}/{dd}/{basename} s3://s3.barnybug.github.com/logs/web/access.log"
+    Then local file "s3.barnybug.github.com/2024/06/01/access.log" has contents "ACCESS"
+
+  Scenario: get can flatten keys with --output-template
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "logs/a/apple.txt" contains "APPLE"
+    And bucket "s3.barnybug.github.com" key "logs/b/banana.txt" contains "BANANA"
+    When I run "s3 get -r --output-template {stem}{ext} s3://s3.barnybug.github.com/logs/ folder1"
+    Then local file "folder1/apple.txt" has contents "APPLE"
+    And local file "folder1/banana.txt" has contents "BANANA"
+
+  Scenario: An unknown template placeholder is an error
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "APPLE"
+    When I run "s3 get --output-template {name} s3://s3.barnybug.github.com/apple"
+    Then the exit code is 1
+    And the output contains "unknown placeholder {name}"
+
+  Scenario: get reads keys encrypted with a customer key from a file
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "sse.key" contains "0123456789abcdef0123456789abcdef"
+    And local file "upload/apple" contains "APPLE"
+    When I run "s3 put --sse-c-key sse.key upload/apple s3://s3.barnybug.github.com/"
+    And I run "s3 get --sse-c-key sse.key s3://s3.barnybug.github.com/apple"
+    Then local file "apple" has contents "APPLE"
+    And the exit code is 0
+
+  Scenario: --sse-c-key must be a 256 bit key
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    When I run "s3 put --sse-c-key c2hvcnQ= apple s3://s3.barnybug.github.com/"
+    Then the output contains "--sse-c-key must be a 256 bit key"
+    And bucket "s3.barnybug.github.com" key "apple" does not exist
+    And the exit code is 1
+
+  Scenario: get --checksum-algorithm verifies the recorded checksum
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "upload/apple" contains "APPLE"
+    When I run "s3 put --checksum-algorithm crc32c upload/apple s3://s3.barnybug.github.com/"
+    And I run "s3 get --checksum-algorithm crc32c s3://s3.barnybug.github.com/apple"
+    Then the exit code is 0
+    And local file "apple" has contents "APPLE"
+
+  Scenario: get --checksum-algorithm fails on a checksum mismatch
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "APPLE"
+    And bucket "s3.barnybug.github.com" key "apple" is given metadata "crc32c_checksum" of "AAAAAA=="
+    When I run "s3 get --checksum-algorithm crc32c s3://s3.barnybug.github.com/apple"
+    Then the exit code is 1
+    And the output contains "download failed checksum verification (crc32c 5zQNfg==, expected AAAAAA==)"
+    And local file "apple" does not exist
+
+  Scenario: get --accelerate checks the bucket has transfer acceleration enabled
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "APPLE"
+    When I run "s3 get --accelerate s3://s3.barnybug.github.com/apple"
+    Then the exit code is 1
+    And the output contains "--accelerate: transfer acceleration isn't enabled on bucket s3.barnybug.github.com"
+    And local file "apple" does not exist
+
+  Scenario: get --accelerate downloads from a bucket with transfer acceleration enabled
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" has transfer acceleration enabled
+    And bucket "s3.barnybug.github.com" key "apple" contains "APPLE"
+    When I run "s3 get --accelerate s3://s3.barnybug.github.com/apple"
+    Then the exit code is 0
+    And local file "apple" has contents "APPLE"
+
+  Scenario: get --accelerate can't be used with --endpoint
+    When I run "s3 --endpoint http://localhost:9000 get --accelerate s3://s3.barnybug.github.com/apple"
+    Then the exit code is 1
+    And the output contains "--accelerate uses aws's accelerate endpoint, so can't be used with --endpoint"
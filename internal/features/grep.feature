@@ -22,3 +22,152 @@ Feature: grep command
   	Given I have bucket "s3.barnybug.github.com"
     When I run "s3 grep carrot s3://s3.barnybug.github.com/key"
     Then the exit code is 1
+
+  Scenario: grep --json writes a json record per matching line
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "carrot" contains "CARROT"
+    When I run "s3 --json grep RR s3://s3.barnybug.github.com/"
+    Then the output is "{"type":"match","url":"s3://s3.barnybug.github.com/carrot","line":"CARROT"}\n"
+
+  Scenario: grep --json -l writes a json record per matching key
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "carrot" contains "CARROT"
+    When I run "s3 --json grep -l RR s3://s3.barnybug.github.com/"
+    Then the output contains "{"type":"key","url":"s3://s3.barnybug.github.com/carrot","size":6,"
+
+  Scenario: grep -v selects the lines not containing the string
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "fruit" contains "apple\nbanana\ncherry\n"
+    When I run "s3 grep -v an s3://s3.barnybug.github.com/fruit"
+    Then the output is "s3://s3.barnybug.github.com/fruit:apple\ns3://s3.barnybug.github.com/fruit:cherry\n"
+
+  Scenario: grep -c counts the lines selected in each key
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "fruit" contains "apple\nbanana\ncherry\n"
+    And bucket "s3.barnybug.github.com" key "veg" contains "carrot\n"
+    When I run "s3 grep -c a s3://s3.barnybug.github.com/"
+    Then the output is "s3://s3.barnybug.github.com/fruit:2\ns3://s3.barnybug.github.com/veg:1\n"
+
+  Scenario: grep -c counts keys without matches as 0
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "fruit" contains "apple\nbanana\n"
+    When I run "s3 grep -c --no-keys-prefix cherry s3://s3.barnybug.github.com/fruit"
+    Then the output is "0\n"
+
+  Scenario: grep -n and -b prefix lines with their number and offset
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "fruit" contains "apple\nbanana\ncherry\n"
+    When I run "s3 grep -n -b --no-keys-prefix cherry s3://s3.barnybug.github.com/fruit"
+    Then the output is "3:13:cherry\n"
+
+  Scenario: grep -A and -B write context around matches
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "log" contains "a\nb\nERROR\nc\nd\n"
+    When I run "s3 grep -n -B 1 -A 1 --no-keys-prefix ERROR s3://s3.barnybug.github.com/log"
+    Then the output is "2-b\n3:ERROR\n4-c\n"
+
+  Scenario: grep -C separates groups of context
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "log" contains "a\nb\nERROR\nc\nd\ne\nERROR\nf\nERROR\n"
+    When I run "s3 grep -C 1 --no-keys-prefix ERROR s3://s3.barnybug.github.com/log"
+    Then the output is "b\nERROR\nc\n--\ne\nERROR\nf\nERROR\n"
+
+  Scenario: grep --json -c writes a count record per key
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "fruit" contains "apple\nbanana\n"
+    When I run "s3 --json grep -c -n an s3://s3.barnybug.github.com/fruit"
+    Then the output is "{"type":"count","url":"s3://s3.barnybug.github.com/fruit","count":1}\n"
+
+  Scenario: grep --json -n includes line numbers and context
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "fruit" contains "apple\nbanana\n"
+    When I run "s3 --json grep -n -B 1 an s3://s3.barnybug.github.com/fruit"
+    Then the output contains "{"type":"context","url":"s3://s3.barnybug.github.com/fruit","line":"apple","line_number":1}\n"
+    And the output contains "{"type":"match","url":"s3://s3.barnybug.github.com/fruit","line":"banana","line_number":2}\n"
+
+  Scenario: grep context lines can't be negative
+    When I run "s3 grep -A -1 ERROR s3://s3.barnybug.github.com/log"
+    Then the exit code is 1
+
+  Scenario: grep --select filters csv keys with S3 Select
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "orders.csv" contains "id,item\n1,apple\n2,banana\n3,cherry\n"
+    And bucket "s3.barnybug.github.com" key "orders.csv" can only be read with S3 Select
+    When I run "s3 grep --select an s3://s3.barnybug.github.com/orders.csv"
+    Then the output is "s3://s3.barnybug.github.com/orders.csv:2,banana\n"
+
+  Scenario: grep --select -v and -c of json lines
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "events.jsonl" contains "{"level":"info"}\n{"level":"error"}\n{"level":"info"}\n"
+    And bucket "s3.barnybug.github.com" key "events.jsonl" can only be read with S3 Select
+    When I run "s3 grep --select -v -c --no-keys-prefix error s3://s3.barnybug.github.com/events.jsonl"
+    Then the output is "2\n"
+
+  Scenario: grep --select escapes the pattern
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "rates.csv" contains "a,50%\nb,5_0\nc,it's\n"
+    And bucket "s3.barnybug.github.com" key "rates.csv" can only be read with S3 Select
+    When I run "s3 grep --select --no-keys-prefix 0% s3://s3.barnybug.github.com/rates.csv"
+    And I run "s3 grep --select --no-keys-prefix 's s3://s3.barnybug.github.com/rates.csv"
+    Then the output is "a,50%\nc,it's\n"
+
+  Scenario: grep --select searches gzipped csv keys
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "orders.csv.gz" contains "1,apple" gzipped
+    And bucket "s3.barnybug.github.com" key "orders.csv.gz" can only be read with S3 Select
+    When I run "s3 grep --select --no-keys-prefix apple s3://s3.barnybug.github.com/orders.csv.gz"
+    Then the output is "1,apple\n"
+
+  Scenario: grep --select reads other keys whole
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "notes.txt" contains "apple\nbanana\n"
+    When I run "s3 grep --select --no-keys-prefix an s3://s3.barnybug.github.com/notes.txt"
+    Then the output is "banana\n"
+
+  Scenario: grep --select can't be given with context
+    When I run "s3 grep --select -C 1 an s3://s3.barnybug.github.com/orders.csv"
+    Then the exit code is 1
+
+  Scenario: grep --include and --exclude select the keys searched
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "logs/app.log" contains "ERROR app\n"
+    And bucket "s3.barnybug.github.com" key "logs/old/app.log" contains "ERROR old\n"
+    And bucket "s3.barnybug.github.com" key "logs/app.txt" contains "ERROR txt\n"
+    When I run "s3 grep --include *.log --exclude old/ ERROR s3://s3.barnybug.github.com/logs/"
+    Then the output is "s3://s3.barnybug.github.com/logs/app.log:ERROR app\n"
+
+  Scenario: grep skips binary keys
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "app.log" contains "ERROR text\n"
+    And bucket "s3.barnybug.github.com" key "core" contains "\0\0ERROR binary\n"
+    When I run "s3 grep --no-keys-prefix ERROR s3://s3.barnybug.github.com/"
+    Then the output is "ERROR text\n"
+
+  Scenario: grep -a searches binary keys as text
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "core" contains "\0\0\nERROR binary\n"
+    When I run "s3 grep -a --no-keys-prefix ERROR s3://s3.barnybug.github.com/"
+    Then the output is "ERROR binary\n"
+
+  Scenario: grep --max-matches stops after that many lines over all the keys
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "log/00" contains "ERROR a\nok\nERROR b\n"
+    And bucket "s3.barnybug.github.com" key "log/01" contains "ERROR c\nERROR d\n"
+    And bucket "s3.barnybug.github.com" key "log/02" contains "ERROR e\n"
+    When I run "s3 -p 3 grep --max-matches 3 --no-keys-prefix ERROR s3://s3.barnybug.github.com/log/"
+    Then the output is "ERROR a\nERROR b\nERROR c\n"
+    And the exit code is 0
+
+  Scenario: grep --max-matches writes the context after the last match
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "log" contains "ERROR a\nok\nmore\nERROR b\n"
+    When I run "s3 grep --max-matches 1 -A 1 --no-keys-prefix ERROR s3://s3.barnybug.github.com/log"
+    Then the output is "ERROR a\nok\n"
+
+  Scenario: grep --max-matches with -l
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "log/00" contains "ERROR a\n"
+    And bucket "s3.barnybug.github.com" key "log/01" contains "ERROR b\n"
+    And bucket "s3.barnybug.github.com" key "log/02" contains "ERROR c\n"
+    When I run "s3 grep -l --max-matches 2 ERROR s3://s3.barnybug.github.com/log/"
+    Then the output is "s3://s3.barnybug.github.com/log/00\ns3://s3.barnybug.github.com/log/01\n"
@@ -18,3 +18,200 @@ Feature: ls command
     And bucket "s3.barnybug.github.com" key "banana" contains "456"
     When I run "s3 ls s3://s3.barnybug.github.com/a"
     Then the output is "s3://s3.barnybug.github.com/aardvark\t1b\ns3://s3.barnybug.github.com/apple\t2b\n\n2 files, 3 bytes\n"
+
+  Scenario: Listings and errors can be written apart
+  	Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "23"
+    When I run "s3 ls s3://s3.barnybug.github.com/" with errors apart
+    Then the output is "s3://s3.barnybug.github.com/apple\t2b\n\n1 files, 2 bytes\n"
+    And the error output is empty
+
+  Scenario: Errors are written apart from listings
+    When I run "s3 ls s3://missing/" with errors apart
+    Then the output is ""
+    And the error output contains "Error: "
+    And the exit code is 1
+
+  Scenario: ls --output writes the listing to a file
+  	Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "23"
+    When I run "s3 --output listing.txt ls s3://s3.barnybug.github.com/"
+    Then local file "listing.txt" includes "s3://s3.barnybug.github.com/apple"
+    And local file "listing.txt" includes "1 files, 2 bytes"
+    And the output is ""
+    And the exit code is 0
+
+  Scenario: I can list local files skipping symlinks
+    Given local file "dir/apple" contains "APPLE"
+    And local symlink "dir/link" points to "apple"
+    When I run "s3 -q ls dir"
+    Then the output is "dir/apple\n"
+
+  Scenario: I can list local files following symlinks
+    Given local file "dir/apple" contains "APPLE"
+    And local symlink "dir/link" points to "apple"
+    When I run "s3 ls --follow-symlinks dir"
+    Then the output is "dir/apple\t5b\ndir/link\t5b\n\n2 files, 10 bytes\n"
+
+  Scenario: I can list local files preserving symlinks
+    Given local file "dir/apple" contains "APPLE"
+    And local symlink "dir/link" points to "apple"
+    When I run "s3 ls --preserve-symlinks dir"
+    Then the output is "dir/apple\t5b\ndir/link\t0b\n\n2 files, 5 bytes\n"
+
+  Scenario: symlink options are mutually exclusive
+    When I run "s3 ls --follow-symlinks --preserve-symlinks dir"
+    Then the exit code is 1
+
+  Scenario: I can list keys using the list alias
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "23"
+    When I run "s3 -q list s3://s3.barnybug.github.com/"
+    Then the output is "s3://s3.barnybug.github.com/apple\n"
+
+  Scenario: ls --dirs lists one level, showing deeper keys as directories
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "23"
+    And bucket "s3.barnybug.github.com" key "fruit/banana" contains "456"
+    And bucket "s3.barnybug.github.com" key "fruit/tropical/mango" contains "7"
+    And bucket "s3.barnybug.github.com" key "veg/carrot" contains "89"
+    When I run "s3 ls --dirs s3://s3.barnybug.github.com/"
+    Then the output is "s3://s3.barnybug.github.com/fruit/\tDIR\ns3://s3.barnybug.github.com/veg/\tDIR\ns3://s3.barnybug.github.com/apple\t2b\n\n2 directories, 1 files, 2 bytes\n"
+
+  Scenario: ls -d lists beneath a prefix
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "fruit/banana" contains "456"
+    And bucket "s3.barnybug.github.com" key "fruit/tropical/mango" contains "7"
+    When I run "s3 -q ls -d s3://s3.barnybug.github.com/fruit/"
+    Then the output is "s3://s3.barnybug.github.com/fruit/tropical/\ns3://s3.barnybug.github.com/fruit/banana\n"
+
+  Scenario: ls --dirs lists a level of more than a page
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" has 1001 keys under "logs/"
+    And bucket "s3.barnybug.github.com" key "logs/old/a" contains "1"
+    When I run "s3 ls --dirs s3://s3.barnybug.github.com/logs/"
+    Then the output contains "s3://s3.barnybug.github.com/logs/old/\tDIR\n"
+    And the output contains "\n1 directories, 1001 files, 1001 bytes\n"
+
+  Scenario: ls --dirs requires an s3 url
+    When I run "s3 ls --dirs dir"
+    Then the exit code is 1
+
+  Scenario: ls --json writes a json record per key
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "23"
+    And bucket "s3.barnybug.github.com" key "apple" was last modified "2024-06-01T12:00:00Z"
+    When I run "s3 --json ls s3://s3.barnybug.github.com/"
+    Then the output contains "{"type":"key","url":"s3://s3.barnybug.github.com/apple","size":2,"etag":"
+    And the output contains ""last_modified":"2024-06-01T12:00:00Z","storage_class":"STANDARD"}\n"
+    And the output does not contain "files"
+
+  Scenario: ls --json --dirs writes records for directories
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "fruit/banana" contains "456"
+    When I run "s3 --json ls --dirs s3://s3.barnybug.github.com/"
+    Then the output is "{"type":"dir","url":"s3://s3.barnybug.github.com/fruit/"}\n"
+
+  Scenario: ls --json lists buckets as json records
+    Given I have bucket "s3.barnybug.github.com"
+    When I run "s3 --json ls"
+    Then the output contains "{"type":"bucket","url":"s3://s3.barnybug.github.com/""
+
+  Scenario: ls --summarize prints the totals even when quiet
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "23"
+    And bucket "s3.barnybug.github.com" key "banana" contains "456"
+    When I run "s3 -q ls --summarize s3://s3.barnybug.github.com/"
+    Then the output is "s3://s3.barnybug.github.com/apple\ns3://s3.barnybug.github.com/banana\n\n2 files, 5 bytes\n"
+
+  Scenario: ls --summarize --json ends with a summary record
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "23"
+    And bucket "s3.barnybug.github.com" key "banana" contains "456"
+    When I run "s3 --json ls --summarize s3://s3.barnybug.github.com/"
+    Then the output contains "\n{"type":"summary","count":2,"size":5}\n"
+
+  Scenario: ls --sort size --max lists the biggest keys
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "23"
+    And bucket "s3.barnybug.github.com" key "banana" contains "456"
+    And bucket "s3.barnybug.github.com" key "cherry" contains "1"
+    And bucket "s3.barnybug.github.com" key "date" contains "7890"
+    When I run "s3 ls --sort size --max 2 s3://s3.barnybug.github.com/"
+    Then the output is "s3://s3.barnybug.github.com/date\t4b\ns3://s3.barnybug.github.com/banana\t3b\n\n2 files, 7 bytes\n"
+
+  Scenario: ls --sort size --reverse lists the smallest keys first
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "23"
+    And bucket "s3.barnybug.github.com" key "banana" contains "456"
+    And bucket "s3.barnybug.github.com" key "cherry" contains "1"
+    When I run "s3 -q ls --sort size --reverse s3://s3.barnybug.github.com/"
+    Then the output is "s3://s3.barnybug.github.com/cherry\ns3://s3.barnybug.github.com/apple\ns3://s3.barnybug.github.com/banana\n"
+
+  Scenario: ls --sort mtime lists the newest keys first
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "23"
+    And bucket "s3.barnybug.github.com" key "apple" was last modified "2024-06-01T12:00:00Z"
+    And bucket "s3.barnybug.github.com" key "banana" contains "456"
+    And bucket "s3.barnybug.github.com" key "banana" was last modified "2024-06-03T12:00:00Z"
+    And bucket "s3.barnybug.github.com" key "cherry" contains "1"
+    And bucket "s3.barnybug.github.com" key "cherry" was last modified "2024-06-02T12:00:00Z"
+    When I run "s3 -q ls --sort mtime --max 2 s3://s3.barnybug.github.com/"
+    Then the output is "s3://s3.barnybug.github.com/banana\ns3://s3.barnybug.github.com/cherry\n"
+
+  Scenario: ls --max alone lists the first keys
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" has 1500 keys under "logs/"
+    When I run "s3 -q ls --max 3 s3://s3.barnybug.github.com/logs/"
+    Then the output is "s3://s3.barnybug.github.com/logs/00000\ns3://s3.barnybug.github.com/logs/00001\ns3://s3.barnybug.github.com/logs/00002\n"
+
+  Scenario: ls --reverse lists keys z to a
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "23"
+    And bucket "s3.barnybug.github.com" key "banana" contains "456"
+    When I run "s3 -q ls --reverse s3://s3.barnybug.github.com/"
+    Then the output is "s3://s3.barnybug.github.com/banana\ns3://s3.barnybug.github.com/apple\n"
+
+  Scenario: an unknown ls sort is an error
+    When I run "s3 ls --sort colour s3://s3.barnybug.github.com/"
+    Then the output contains "invalid --sort"
+    And the exit code is 1
+
+  Scenario: ls --min-size and --max-size list keys by size
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "23"
+    And bucket "s3.barnybug.github.com" key "banana" contains "456"
+    And bucket "s3.barnybug.github.com" key "cherry" contains "1"
+    When I run "s3 ls --min-size 2 --max-size 2 s3://s3.barnybug.github.com/"
+    Then the output is "s3://s3.barnybug.github.com/apple\t2b\n\n1 files, 2 bytes\n"
+
+  Scenario: ls --older-than and --newer-than list keys by age
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "23"
+    And bucket "s3.barnybug.github.com" key "apple" was last modified "2024-06-01T12:00:00Z"
+    And bucket "s3.barnybug.github.com" key "banana" contains "456"
+    When I run "s3 -q ls --older-than 30d s3://s3.barnybug.github.com/"
+    And I run "s3 -q ls --newer-than 1h s3://s3.barnybug.github.com/"
+    Then the output is "s3://s3.barnybug.github.com/apple\ns3://s3.barnybug.github.com/banana\n"
+
+  Scenario: ls filters that select nothing are an error
+    When I run "s3 ls --min-size 10 --max-size 5 s3://s3.barnybug.github.com/"
+    Then the output contains "--min-size must not be more than --max-size"
+    And the exit code is 1
+
+  Scenario: ls --uploads lists incomplete uploads after the keys
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "banana" contains "456"
+    And local file "apple" contains "APPLE"
+    And bucket "s3.barnybug.github.com" key "apple" has an incomplete upload of local file "apple" with 1 part sent
+    And bucket "s3.barnybug.github.com" key "apple" upload was initiated "2024-06-01T12:00:00Z"
+    When I run "s3 ls --uploads s3://s3.barnybug.github.com/"
+    Then the output is "s3://s3.barnybug.github.com/banana\t3b\ns3://s3.barnybug.github.com/apple\tUPLOAD\t1\t2024-06-01T12:00:00Z\n\n1 files, 3 bytes, 1 incomplete uploads\n"
+
+  Scenario: ls --json --uploads writes upload records
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    And bucket "s3.barnybug.github.com" key "apple" has an incomplete upload of local file "apple" with 1 part sent
+    And bucket "s3.barnybug.github.com" key "apple" upload was initiated "2024-06-01T12:00:00Z"
+    When I run "s3 --json ls --uploads s3://s3.barnybug.github.com/"
+    Then the output is "{"type":"upload","url":"s3://s3.barnybug.github.com/apple","upload_id":"1","initiated":"2024-06-01T12:00:00Z"}\n"
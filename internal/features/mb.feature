@@ -9,3 +9,50 @@ Feature: mb command
   	Given I have bucket "s3.barnybug.github.com"
     When I run "s3 mb s3.barnybug.github.com"
     Then the exit code is 1
+
+  Scenario: mb creates the bucket in the region given
+    When I run "s3 --region eu-west-2 mb s3.barnybug.github.com"
+    Then the exit code is 0
+    And the bucket "s3.barnybug.github.com" is in region "eu-west-2"
+
+  Scenario: mb in us-east-1 sends no location constraint
+    When I run "s3 --region us-east-1 mb s3.barnybug.github.com"
+    Then the exit code is 0
+    And the bucket "s3.barnybug.github.com" is in region "us-east-1"
+
+  Scenario: mb --wait waits until the bucket exists
+    When I run "s3 mb --wait s3.barnybug.github.com"
+    Then the exit code is 0
+    And the bucket "s3.barnybug.github.com" exists
+
+  Scenario: mb --versioning enables versioning
+    When I run "s3 mb --versioning s3.barnybug.github.com"
+    Then the exit code is 0
+    And versioning is enabled on bucket "s3.barnybug.github.com"
+
+  Scenario: mb --object-lock enables object lock and versioning
+    When I run "s3 mb --object-lock s3.barnybug.github.com"
+    Then the exit code is 0
+    And object lock is enabled on bucket "s3.barnybug.github.com"
+    And versioning is enabled on bucket "s3.barnybug.github.com"
+
+  Scenario: mb --sse sets default encryption
+    When I run "s3 mb --sse aws:kms --sse-kms-key-id alias/mykey s3.barnybug.github.com"
+    And I run "s3 bucket encryption get s3.barnybug.github.com"
+    Then the output is "s3://s3.barnybug.github.com/: aws:kms key alias/mykey\n"
+
+  Scenario: mb --kms-key-id is --sse-kms-key-id, and implies aws:kms
+    When I run "s3 mb --kms-key-id alias/mykey s3.barnybug.github.com"
+    And I run "s3 bucket encryption get s3.barnybug.github.com"
+    Then the output is "s3://s3.barnybug.github.com/: aws:kms key alias/mykey\n"
+
+  Scenario: mb --tags tags the bucket
+    When I run "s3 mb --versioning --tags team=data s3.barnybug.github.com"
+    And I run "s3 bucket tag get s3.barnybug.github.com"
+    Then the output is "s3://s3.barnybug.github.com/: team=data\n"
+    And versioning is enabled on bucket "s3.barnybug.github.com"
+
+  Scenario: mb with an unknown encryption creates nothing
+    When I run "s3 mb --sse rot13 s3.barnybug.github.com"
+    Then the exit code is 1
+    And the bucket "s3.barnybug.github.com" does not exist
@@ -0,0 +1,84 @@
+@mpu
+Feature: mpu command
+
+  Scenario: I can list incomplete multipart uploads
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    And bucket "s3.barnybug.github.com" key "apple" has an incomplete upload of local file "apple" with 1 part sent
+    When I run "s3 mpu ls s3.barnybug.github.com"
+    Then the output contains "s3://s3.barnybug.github.com/apple"
+    And the output contains "5b"
+    And the output contains "1 uploads, 5 bytes"
+    And bucket "s3.barnybug.github.com" has 1 incomplete upload
+
+  Scenario: I can abort incomplete multipart uploads
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    And bucket "s3.barnybug.github.com" key "apple" has an incomplete upload of local file "apple" with 1 part sent
+    And bucket "s3.barnybug.github.com" key "banana" has an incomplete upload of local file "apple" with 0 parts sent
+    When I run "s3 mpu abort s3://s3.barnybug.github.com/"
+    Then the output contains "D s3://s3.barnybug.github.com/apple"
+    And the output contains "D s3://s3.barnybug.github.com/banana"
+    And the output contains "2 aborted"
+    And bucket "s3.barnybug.github.com" has 0 incomplete uploads
+
+  Scenario: abort --older-than leaves recent uploads
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    And bucket "s3.barnybug.github.com" key "apple" has an incomplete upload of local file "apple" with 1 part sent
+    And bucket "s3.barnybug.github.com" key "apple" upload was initiated "2020-01-02T03:04:05Z"
+    And bucket "s3.barnybug.github.com" key "banana" has an incomplete upload of local file "apple" with 1 part sent
+    When I run "s3 mpu abort --older-than 7d s3.barnybug.github.com"
+    Then the output contains "D s3://s3.barnybug.github.com/apple"
+    And the output does not contain "banana"
+    And bucket "s3.barnybug.github.com" has 1 incomplete upload
+
+  Scenario: abort under a prefix leaves other uploads
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    And bucket "s3.barnybug.github.com" key "logs/apple" has an incomplete upload of local file "apple" with 1 part sent
+    And bucket "s3.barnybug.github.com" key "apple" has an incomplete upload of local file "apple" with 1 part sent
+    When I run "s3 mpu abort s3://s3.barnybug.github.com/logs/"
+    Then the output contains "1 aborted"
+    And bucket "s3.barnybug.github.com" has 1 incomplete upload
+
+  Scenario: abort with -n aborts nothing
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    And bucket "s3.barnybug.github.com" key "apple" has an incomplete upload of local file "apple" with 1 part sent
+    When I run "s3 -n mpu abort s3.barnybug.github.com"
+    Then the output contains "D s3://s3.barnybug.github.com/apple"
+    And bucket "s3.barnybug.github.com" has 1 incomplete upload
+
+  Scenario: mpu of a non-existent bucket is an error
+    When I run "s3 mpu ls s3.barnybug.github.com"
+    Then the exit code is 1
+
+  Scenario: A completed upload is assembled from its parts
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "big" is 13000000 bytes long
+    And bucket "s3.barnybug.github.com" key "big" has an incomplete upload of local file "big" with 3 parts sent
+    When I complete the incomplete upload of bucket "s3.barnybug.github.com" key "big"
+    Then the exit code is 0
+    And bucket "s3.barnybug.github.com" key "big" matches local file "big"
+    And bucket "s3.barnybug.github.com" key "big" was uploaded in parts
+    And bucket "s3.barnybug.github.com" has 0 incomplete uploads
+
+  Scenario: An upload can't be completed with its parts out of order
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "big" is 13000000 bytes long
+    And bucket "s3.barnybug.github.com" key "big" has an incomplete upload of local file "big" with 3 parts sent
+    When I complete the incomplete upload of bucket "s3.barnybug.github.com" key "big" with its parts reversed
+    Then the exit code is 1
+    And the output contains "InvalidPartOrder"
+    And bucket "s3.barnybug.github.com" key "big" does not exist
+    And bucket "s3.barnybug.github.com" has 1 incomplete upload
+
+  Scenario: An upload can't be completed naming a part by a wrong ETag
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "big" is 13000000 bytes long
+    And bucket "s3.barnybug.github.com" key "big" has an incomplete upload of local file "big" with 3 parts sent
+    When I complete the incomplete upload of bucket "s3.barnybug.github.com" key "big" naming a part by a wrong ETag
+    Then the exit code is 1
+    And the output contains "InvalidPart"
+    And bucket "s3.barnybug.github.com" key "big" does not exist
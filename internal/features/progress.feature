@@ -0,0 +1,23 @@
+@progress
+Feature: json progress events
+
+  Scenario: sync emits json progress events
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "dir/apple" contains "APPLE"
+    When I run "s3 --progress-json sync dir s3://s3.barnybug.github.com/"
+    Then the output is "{"event":"start","key":"dir/apple","total":5}\n{"event":"chunk","key":"dir/apple","bytes":5,"total":5}\n{"event":"done","key":"dir/apple","bytes":5,"total":5}\n"
+    And bucket "s3.barnybug.github.com" has key "dir/apple" with contents "APPLE"
+
+  Scenario: get emits json progress events
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "APPLE"
+    When I run "s3 --progress-json get s3://s3.barnybug.github.com/apple"
+    Then the output contains "{"event":"start","key":"apple","total":5}\n"
+    And the output contains "{"event":"done","key":"apple","bytes":5,"total":5}\n"
+
+  Scenario: failed transfers emit json error events
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "x/y" contains "Y"
+    And local file "folder1/x" contains "X"
+    When I run "s3 --progress-json --ignore-errors sync s3://s3.barnybug.github.com/ folder1"
+    Then the output contains "{"event":"error","key":"x/y","total":1,"error":"
@@ -33,6 +33,370 @@ Feature: put command
     When I run "s3 put top/path/ s3://s3.barnybug.github.com/here/"
     Then bucket "s3.barnybug.github.com" has key "here/key" with contents "abc"
 
+  Scenario: put uploads a directory tree under a prefix
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "dir/apple" contains "APPLE"
+    And local file "dir/sub/banana" contains "BANANA"
+    And local file "dir/sub/deeper/cherry" contains "CHERRY"
+    When I run "s3 put dir/ s3://s3.barnybug.github.com/prefix"
+    Then bucket "s3.barnybug.github.com" has key "prefix/apple" with contents "APPLE"
+    And bucket "s3.barnybug.github.com" has key "prefix/sub/banana" with contents "BANANA"
+    And bucket "s3.barnybug.github.com" has key "prefix/sub/deeper/cherry" with contents "CHERRY"
+
+  Scenario: put --exclude and --include filter a directory tree
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "dir/apple" contains "APPLE"
+    And local file "dir/debug.log" contains "LOG"
+    And local file "dir/keep.log" contains "KEEP"
+    And local file "dir/tmp/scratch" contains "SCRATCH"
+    When I run "s3 put --exclude *.log --exclude tmp/ --include keep.log dir/ s3://s3.barnybug.github.com/"
+    Then bucket "s3.barnybug.github.com" has key "apple" with contents "APPLE"
+    And bucket "s3.barnybug.github.com" has key "keep.log" with contents "KEEP"
+    And bucket "s3.barnybug.github.com" key "debug.log" does not exist
+    And bucket "s3.barnybug.github.com" key "tmp/scratch" does not exist
+
+  Scenario: put --storage-class sets the storage class of uploads
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    When I run "s3 put --storage-class standard_ia apple s3://s3.barnybug.github.com/"
+    Then bucket "s3.barnybug.github.com" key "apple" has storage class "STANDARD_IA"
+
+  Scenario: put --storage-class must be a storage class
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    When I run "s3 put --storage-class COLD apple s3://s3.barnybug.github.com/"
+    Then the exit code is 1
+    And the output contains "unknown storage class"
+    And bucket "s3.barnybug.github.com" key "apple" does not exist
+
+  Scenario: put --sse encrypts uploads
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    When I run "s3 put --sse aes256 apple s3://s3.barnybug.github.com/"
+    Then bucket "s3.barnybug.github.com" key "apple" is encrypted with "AES256"
+
+  Scenario: put --sse aws:kms encrypts uploads with a kms key
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    When I run "s3 put --sse aws:kms --sse-kms-key-id alias/mykey apple s3://s3.barnybug.github.com/"
+    Then bucket "s3.barnybug.github.com" key "apple" is encrypted with "aws:kms" using key "alias/mykey"
+
+  Scenario: put --sse-kms-key-id requires aws:kms
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    When I run "s3 put --sse aes256 --sse-kms-key-id alias/mykey apple s3://s3.barnybug.github.com/"
+    Then the exit code is 1
+    And the output contains "--sse-kms-key-id requires --sse aws:kms"
+    And bucket "s3.barnybug.github.com" key "apple" does not exist
+
+  Scenario: put sets response headers
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    When I run "s3 put --cache-control max-age=60 --content-disposition attachment apple s3://s3.barnybug.github.com/"
+    Then bucket "s3.barnybug.github.com" key "apple" has header "Cache-Control" of "max-age=60"
+    And bucket "s3.barnybug.github.com" key "apple" has header "Content-Disposition" of "attachment"
+    And bucket "s3.barnybug.github.com" key "apple" has header "Content-Encoding" of ""
+
+  Scenario: put guesses the content type from the extension
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "apple.json" contains "{}"
+    When I run "s3 put apple.json s3://s3.barnybug.github.com/"
+    Then bucket "s3.barnybug.github.com" key "apple.json" has header "Content-Type" of "application/json"
+
+  Scenario: put sniffs the content type without a known extension
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    And local file "banana" contains "%PDF-1.4"
+    When I run "s3 put apple banana s3://s3.barnybug.github.com/"
+    Then bucket "s3.barnybug.github.com" key "apple" has header "Content-Type" of "text/plain; charset=utf-8"
+    And bucket "s3.barnybug.github.com" key "banana" has header "Content-Type" of "application/pdf"
+
+  Scenario: put --content-type overrides the guess
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "apple.txt" contains "APPLE"
+    When I run "s3 put --content-type application/x-apple apple.txt s3://s3.barnybug.github.com/"
+    Then bucket "s3.barnybug.github.com" key "apple.txt" has header "Content-Type" of "application/x-apple"
+
+  Scenario: put sends Content-MD5 so corrupted uploads are rejected
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" corrupts uploads
+    And local file "apple" contains "APPLE"
+    When I run "s3 put apple s3://s3.barnybug.github.com/"
+    Then the exit code is 1
+    And the output contains "BadDigest"
+    And bucket "s3.barnybug.github.com" key "apple" does not exist
+
+  Scenario: put --checksum-algorithm records a checksum
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    When I run "s3 put --checksum-algorithm sha256 apple s3://s3.barnybug.github.com/"
+    Then bucket "s3.barnybug.github.com" key "apple" has metadata "sha256_checksum" of "VVYjR/Q31lgpMDz2MH5xrPi4SgIJid0hjzFYbur9Aak="
+
+  Scenario: put --checksum-algorithm must be sha256 or crc32c
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    When I run "s3 put --checksum-algorithm sha1 apple s3://s3.barnybug.github.com/"
+    Then the exit code is 1
+    And the output contains "unknown checksum algorithm"
+    And bucket "s3.barnybug.github.com" key "apple" does not exist
+
+  Scenario: put - can't record a checksum
+    Given I have bucket "s3.barnybug.github.com"
+    And standard input contains "from a pipe"
+    When I run "s3 put --checksum-algorithm crc32c - s3://s3.barnybug.github.com/piped"
+    Then the exit code is 1
+    And the output contains "--checksum-algorithm can't be used putting standard input"
+
+  Scenario: put uploads files above --multipart-threshold in parts
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    And local file "fig" contains "FIG"
+    When I run "s3 put --multipart-threshold 5 apple fig s3://s3.barnybug.github.com/"
+    Then bucket "s3.barnybug.github.com" has key "apple" with contents "APPLE"
+    And bucket "s3.barnybug.github.com" key "apple" was uploaded in parts
+    And bucket "s3.barnybug.github.com" key "apple" has metadata "md5_checksum" of "4c462d6dd59d782386bb1cdad0060c70"
+    And bucket "s3.barnybug.github.com" has key "fig" with contents "FIG"
+    And bucket "s3.barnybug.github.com" key "fig" was not uploaded in parts
+
+  Scenario: put --preserve records file attributes of files uploaded in parts
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    And local file "apple" is mode "600"
+    When I run "s3 put --preserve --multipart-threshold 5 apple s3://s3.barnybug.github.com/"
+    Then bucket "s3.barnybug.github.com" key "apple" was uploaded in parts
+    And bucket "s3.barnybug.github.com" key "apple" has metadata "mode" of "600"
+
+  Scenario: put-part --preserve records file attributes
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    And local file "apple" is mode "600"
+    When I run "s3 put-part --preserve apple s3://s3.barnybug.github.com/"
+    Then bucket "s3.barnybug.github.com" key "apple" has metadata "mode" of "600"
+
+  Scenario: put-part uploads in parts
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "apple.txt" contains "APPLE"
+    When I run "s3 put-part --cache-control max-age=60 apple.txt s3://s3.barnybug.github.com/"
+    Then bucket "s3.barnybug.github.com" has key "apple.txt" with contents "APPLE"
+    And bucket "s3.barnybug.github.com" key "apple.txt" was uploaded in parts
+    And bucket "s3.barnybug.github.com" key "apple.txt" has header "Content-Type" of "text/plain; charset=utf-8"
+    And bucket "s3.barnybug.github.com" key "apple.txt" has header "Cache-Control" of "max-age=60"
+
+  Scenario: put-part sends Content-MD5 so corrupted parts are rejected
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" corrupts uploads
+    And local file "apple" contains "APPLE"
+    When I run "s3 put-part apple s3://s3.barnybug.github.com/"
+    Then the exit code is 1
+    And the output contains "BadDigest"
+    And bucket "s3.barnybug.github.com" key "apple" does not exist
+
+  Scenario: put-part streams files of several parts
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "big" is 13000000 bytes long
+    When I run "s3 put-part --checksum-algorithm sha256 big s3://s3.barnybug.github.com/"
+    Then the exit code is 0
+    And bucket "s3.barnybug.github.com" key "big" matches local file "big"
+    And bucket "s3.barnybug.github.com" key "big" was uploaded in parts
+    And bucket "s3.barnybug.github.com" key "big" has metadata "part_size" of "6000000"
+    When I run "s3 get --checksum-algorithm sha256 s3://s3.barnybug.github.com/big"
+    Then the exit code is 0
+
+  Scenario: put-part sends parts concurrently
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "big" is 31000000 bytes long
+    When I run "s3 -p 4 put-part big s3://s3.barnybug.github.com/"
+    Then the exit code is 0
+    And bucket "s3.barnybug.github.com" key "big" matches local file "big"
+    And bucket "s3.barnybug.github.com" has 0 incomplete uploads
+
+  Scenario: put-part aborts the upload when a part fails
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" corrupts uploads
+    And local file "big" is 13000000 bytes long
+    When I run "s3 put-part --part-concurrency 3 big s3://s3.barnybug.github.com/"
+    Then the exit code is 1
+    And the output contains "BadDigest"
+    And bucket "s3.barnybug.github.com" key "big" does not exist
+    And bucket "s3.barnybug.github.com" has 0 incomplete uploads
+
+  Scenario: put-part aborts the upload when it fails to complete
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" fails to complete uploads
+    And local file "big" is 13000000 bytes long
+    When I run "s3 put-part big s3://s3.barnybug.github.com/"
+    Then the exit code is 1
+    And the output contains "InternalError"
+    And bucket "s3.barnybug.github.com" key "big" does not exist
+    And bucket "s3.barnybug.github.com" has 0 incomplete uploads
+
+  Scenario: put-part --resume leaves the upload it fails to complete
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" fails to complete uploads
+    And local file "big" is 13000000 bytes long
+    When I run "s3 put-part --resume big s3://s3.barnybug.github.com/"
+    Then the exit code is 1
+    And bucket "s3.barnybug.github.com" has 1 incomplete upload
+
+  Scenario: put-part sends again parts stored otherwise than sent
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" misreports the ETag of 1 part
+    And local file "big" is 13000000 bytes long
+    When I run "s3 put-part big s3://s3.barnybug.github.com/"
+    Then the exit code is 0
+    And bucket "s3.barnybug.github.com" key "big" matches local file "big"
+
+  Scenario: put-part fails when parts are never stored as sent
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" misreports the ETags of 100 parts
+    And local file "big" is 13000000 bytes long
+    When I run "s3 put-part big s3://s3.barnybug.github.com/"
+    Then the exit code is 1
+    And the output contains "does not match md5"
+    And bucket "s3.barnybug.github.com" key "big" does not exist
+    And bucket "s3.barnybug.github.com" has 0 incomplete uploads
+
+  Scenario: put-part --max-retries 0 doesn't send parts again
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" misreports the ETag of 1 part
+    And local file "big" is 13000000 bytes long
+    When I run "s3 --max-retries 0 put-part big s3://s3.barnybug.github.com/"
+    Then the exit code is 1
+    And the output contains "does not match md5"
+    And bucket "s3.barnybug.github.com" has 0 incomplete uploads
+
+  Scenario: put --accelerate checks the bucket has transfer acceleration enabled
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    When I run "s3 put --accelerate apple s3://s3.barnybug.github.com/"
+    Then the exit code is 1
+    And the output contains "--accelerate: transfer acceleration isn't enabled on bucket s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" does not exist
+
+  Scenario: put --accelerate uploads to a bucket with transfer acceleration enabled
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" has transfer acceleration enabled
+    And local file "apple" contains "APPLE"
+    When I run "s3 put --accelerate apple s3://s3.barnybug.github.com/"
+    Then the exit code is 0
+    And bucket "s3.barnybug.github.com" key "apple" matches local file "apple"
+
+  Scenario: put --accelerate can't be used with --use-fips
+    Given local file "apple" contains "APPLE"
+    When I run "s3 --use-fips put --accelerate apple s3://s3.barnybug.github.com/"
+    Then the exit code is 1
+    And the output contains "can't be used with --use-fips"
+
+  Scenario: put-part checks the ETag of the completed upload
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" misreports the ETags of uploads
+    And local file "big" is 13000000 bytes long
+    When I run "s3 put-part big s3://s3.barnybug.github.com/"
+    Then the exit code is 1
+    And the output contains "computed from its parts"
+
+  Scenario: put-part --part-size sets the part size
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "big" is 13000000 bytes long
+    When I run "s3 put-part --part-size 5242880 big s3://s3.barnybug.github.com/"
+    Then the exit code is 0
+    And bucket "s3.barnybug.github.com" key "big" matches local file "big"
+    And bucket "s3.barnybug.github.com" key "big" has metadata "part_size" of "5242880"
+
+  Scenario: put --part-size splits large files into parts of that size
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "big" is 13000000 bytes long
+    When I run "s3 put --part-size 5242880 --part-concurrency 3 big s3://s3.barnybug.github.com/"
+    Then the exit code is 0
+    And bucket "s3.barnybug.github.com" key "big" matches local file "big"
+    And bucket "s3.barnybug.github.com" key "big" was uploaded in parts
+
+  Scenario: An interrupted multipart upload is aborted
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "big" contains "APPLEBANANACHERRYDAMSON"
+    When I put local file "big" to "s3://s3.barnybug.github.com/" in parts of 5 bytes, interrupted once a part is sent
+    Then the output contains "context canceled"
+    And bucket "s3.barnybug.github.com" key "big" does not exist
+    And bucket "s3.barnybug.github.com" has 0 incomplete uploads
+
+  Scenario: put --part-size must be one S3 accepts
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    When I run "s3 put --part-size 1000 apple s3://s3.barnybug.github.com/"
+    Then the exit code is 1
+    And the output contains "--part-size must be from 5242880 (5MiB) to 5368709120 (5GiB) bytes"
+    And bucket "s3.barnybug.github.com" key "apple" does not exist
+
+  Scenario: put-part --resume continues an incomplete upload
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "big" is 13000000 bytes long
+    And bucket "s3.barnybug.github.com" key "big" has an incomplete upload of local file "big" with 2 parts sent
+    When I run "s3 put-part --resume big s3://s3.barnybug.github.com/"
+    Then the exit code is 0
+    And bucket "s3.barnybug.github.com" key "big" matches local file "big"
+    And bucket "s3.barnybug.github.com" key "big" has metadata "upload" of "interrupted"
+    And bucket "s3.barnybug.github.com" has 0 incomplete uploads
+
+  Scenario: put-part --resume starts over when the incomplete upload is of other content
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "big" is 13000000 bytes long
+    And local file "other" contains "OTHER"
+    And bucket "s3.barnybug.github.com" key "big" has an incomplete upload of local file "other" with 1 part sent
+    When I run "s3 put-part --resume big s3://s3.barnybug.github.com/"
+    Then the exit code is 0
+    And bucket "s3.barnybug.github.com" key "big" matches local file "big"
+    And bucket "s3.barnybug.github.com" has 1 incomplete upload
+
+  Scenario: put --tagging tags uploads
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    When I run "s3 put --tagging project=orchard,owner=a&b apple s3://s3.barnybug.github.com/"
+    Then bucket "s3.barnybug.github.com" key "apple" has tags "owner=a&b project=orchard"
+
+  Scenario: put-part --tagging tags uploads
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    When I run "s3 put-part --tagging project=orchard apple s3://s3.barnybug.github.com/"
+    Then bucket "s3.barnybug.github.com" key "apple" has tags "project=orchard"
+
+  Scenario: put --tagging needs key=value pairs
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    When I run "s3 put --tagging project apple s3://s3.barnybug.github.com/"
+    Then the exit code is 1
+    And the output contains "expected key=value"
+    And bucket "s3.barnybug.github.com" key "apple" does not exist
+
+  Scenario: put --object-lock-mode retains uploads
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    When I run "s3 put --object-lock-mode compliance --retain-until 2099-01-02T15:04:05Z --legal-hold apple s3://s3.barnybug.github.com/"
+    Then bucket "s3.barnybug.github.com" key "apple" has header "X-Amz-Object-Lock-Mode" of "COMPLIANCE"
+    And bucket "s3.barnybug.github.com" key "apple" has header "X-Amz-Object-Lock-Retain-Until-Date" of "2099-01-02T15:04:05Z"
+    And bucket "s3.barnybug.github.com" key "apple" has header "X-Amz-Object-Lock-Legal-Hold" of "ON"
+
+  Scenario: put-part --object-lock-mode retains uploads
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    When I run "s3 put-part --object-lock-mode governance --retain-until 30d apple s3://s3.barnybug.github.com/"
+    Then bucket "s3.barnybug.github.com" key "apple" has header "X-Amz-Object-Lock-Mode" of "GOVERNANCE"
+    And bucket "s3.barnybug.github.com" key "apple" has header "X-Amz-Object-Lock-Legal-Hold" of ""
+
+  Scenario: put --object-lock-mode needs --retain-until
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    When I run "s3 put --object-lock-mode governance apple s3://s3.barnybug.github.com/"
+    Then the exit code is 1
+    And the output contains "--object-lock-mode requires --retain-until"
+    And bucket "s3.barnybug.github.com" key "apple" does not exist
+
+  Scenario: put --retain-until must be in the future
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    When I run "s3 put --object-lock-mode governance --retain-until 2001-01-01T00:00:00Z apple s3://s3.barnybug.github.com/"
+    Then the exit code is 1
+    And the output contains "is in the past"
+
   Scenario: put a non-existent file is an error
     When I run "s3 put missing s3://s3.barnybug.github.com/"
     Then the exit code is 1
@@ -46,3 +410,74 @@ Feature: put command
     Given local file "key" contains "abc"
     When I run "s3 put key path"
     Then the exit code is 1
+
+  Scenario: put honours .s3ignore at the root of a local source
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "dir/.s3ignore" contains "*.log"
+    And local file "dir/apple" contains "APPLE"
+    And local file "dir/debug.log" contains "LOG"
+    When I run "s3 put dir s3://s3.barnybug.github.com/"
+    Then bucket "s3.barnybug.github.com" has key "dir/apple" with contents "APPLE"
+    And bucket "s3.barnybug.github.com" key "dir/debug.log" does not exist
+
+  Scenario: put --acl drops the acl with a warning on buckets with acls disabled
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" has acls disabled
+    And local file "apple" contains "APPLE"
+    When I run "s3 put --acl public-read apple s3://s3.barnybug.github.com/"
+    Then the output contains "ignoring --acl public-read"
+    And bucket "s3.barnybug.github.com" has key "apple" with contents "APPLE"
+
+  Scenario: put uses the acl of the --target
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" has acls disabled
+    And local file "apple" contains "APPLE"
+    And the config file contains "targets:\n  shared:\n    acl: public-read\n"
+    When I run "s3 --target shared put apple s3://s3.barnybug.github.com/"
+    Then the output contains "ignoring --acl public-read"
+
+  Scenario: put --verify-visibility waits for the upload to become visible
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" shows new keys after 2 checks
+    And local file "apple" contains "APPLE"
+    When I run "s3 --progress-json put --verify-visibility apple s3://s3.barnybug.github.com/"
+    Then the exit code is 0
+    And the output contains ""event":"visible","key":"apple""
+    And bucket "s3.barnybug.github.com" has key "apple" with contents "APPLE"
+
+  Scenario: put --verify-visibility fails an upload that doesn't become visible
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" shows new keys after 1000 checks
+    And local file "apple" contains "APPLE"
+    When I run "s3 put --verify-visibility --visibility-timeout 300ms apple s3://s3.barnybug.github.com/"
+    Then the exit code is 1
+    And the output contains "apple not visible after 300ms"
+
+  Scenario: put stops once --max-total-files is reached
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    And local file "banana" contains "BANANA"
+    When I run "s3 -p 1 put --max-total-files 1 apple banana s3://s3.barnybug.github.com/"
+    Then bucket "s3.barnybug.github.com" has key "apple" with contents "APPLE"
+    And bucket "s3.barnybug.github.com" key "banana" does not exist
+    And the output contains "1 files (6 bytes) not transferred"
+
+  Scenario: put - uploads standard input
+    Given I have bucket "s3.barnybug.github.com"
+    And standard input contains "from a pipe"
+    When I run "s3 put - s3://s3.barnybug.github.com/piped.txt"
+    Then the exit code is 0
+    And bucket "s3.barnybug.github.com" has key "piped.txt" with contents "from a pipe"
+
+  Scenario: put - sniffs the content type of standard input
+    Given I have bucket "s3.barnybug.github.com"
+    And standard input contains "<html><body>hi</body></html>"
+    When I run "s3 put - s3://s3.barnybug.github.com/page"
+    Then bucket "s3.barnybug.github.com" key "page" has header "Content-Type" of "text/html; charset=utf-8"
+
+  Scenario: put - needs a destination key
+    Given I have bucket "s3.barnybug.github.com"
+    And standard input contains "from a pipe"
+    When I run "s3 put - s3://s3.barnybug.github.com/"
+    Then the exit code is 1
+    And the output contains "a destination key is required"
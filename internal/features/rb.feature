@@ -15,3 +15,19 @@ Feature: rb command
     And bucket "s3.barnybug.github.com" key "path/key" contains "123"
     When I run "s3 rb s3.barnybug.github.com"
     Then the exit code is 1
+
+  Scenario: rb -i asks before removing buckets
+    Given I have bucket "s3.barnybug.github.com"
+    And standard input contains "n\n"
+    When I run "s3 rb -i s3.barnybug.github.com"
+    Then the output contains "remove buckets s3.barnybug.github.com? [y/N]"
+    And the output contains "not confirmed, nothing removed"
+    And the exit code is 1
+    And the bucket "s3.barnybug.github.com" exists
+
+  Scenario: rb -i removes buckets once confirmed
+    Given I have bucket "s3.barnybug.github.com"
+    And standard input contains "y\n"
+    When I run "s3 rb -i s3.barnybug.github.com"
+    Then the exit code is 0
+    And the bucket "s3.barnybug.github.com" does not exist
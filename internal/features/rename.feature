@@ -0,0 +1,56 @@
+@rename
+Feature: plan-rename and cp commands
+
+  Scenario: I can preview renames
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "logs/2020/a.log" contains "A"
+    And bucket "s3.barnybug.github.com" key "logs/2021/b.log" contains "B"
+    When I run "s3 plan-rename --transform s|logs/([0-9]+)/|archive/$1/| s3://s3.barnybug.github.com/logs/"
+    Then the output contains "s3://s3.barnybug.github.com/logs/2020/a.log -> s3://s3.barnybug.github.com/archive/2020/a.log\n"
+    And the output contains "2 renamed 0 unchanged 0 conflicts\n"
+    And bucket "s3.barnybug.github.com" key "archive/2020/a.log" does not exist
+
+  Scenario: plan-rename reports conflicting renames
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "a1" contains "A"
+    And bucket "s3.barnybug.github.com" key "a2" contains "B"
+    When I run "s3 plan-rename --transform s/[0-9]// s3://s3.barnybug.github.com/"
+    Then the output contains "! s3://s3.barnybug.github.com/a2 -> s3://s3.barnybug.github.com/a conflicts with s3://s3.barnybug.github.com/a1\n"
+    And the exit code is 1
+
+  Scenario: I can copy the keys in a rename manifest
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "old/apple" contains "APPLE"
+    When I run "s3 plan-rename --transform s/^old/new/ --manifest plan.json s3://s3.barnybug.github.com/old/"
+    And I run "s3 cp --manifest plan.json"
+    Then bucket "s3.barnybug.github.com" has key "new/apple" with contents "APPLE"
+    And bucket "s3.barnybug.github.com" key "old/apple" exists
+
+  Scenario: I can copy a key
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "APPLE"
+    When I run "s3 cp s3://s3.barnybug.github.com/apple s3://s3.barnybug.github.com/pear"
+    Then bucket "s3.barnybug.github.com" has key "pear" with contents "APPLE"
+
+  Scenario: cp --sse encrypts the copy
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "APPLE"
+    When I run "s3 cp --sse aes256 s3://s3.barnybug.github.com/apple s3://s3.barnybug.github.com/pear"
+    Then bucket "s3.barnybug.github.com" key "pear" is encrypted with "AES256"
+
+  Scenario: cp --metadata-directive REPLACE sets headers, keeping the rest
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "apple.txt" contains "APPLE"
+    When I run "s3 put --cache-control max-age=60 apple.txt s3://s3.barnybug.github.com/"
+    And I run "s3 cp --metadata-directive REPLACE --content-disposition attachment s3://s3.barnybug.github.com/apple.txt s3://s3.barnybug.github.com/pear.txt"
+    Then bucket "s3.barnybug.github.com" key "pear.txt" has header "Content-Disposition" of "attachment"
+    And bucket "s3.barnybug.github.com" key "pear.txt" has header "Cache-Control" of "max-age=60"
+    And bucket "s3.barnybug.github.com" key "pear.txt" has header "Content-Type" of "text/plain; charset=utf-8"
+
+  Scenario: cp headers require --metadata-directive REPLACE
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "APPLE"
+    When I run "s3 cp --cache-control max-age=60 s3://s3.barnybug.github.com/apple s3://s3.barnybug.github.com/pear"
+    Then the exit code is 1
+    And the output contains "setting headers on a copy requires --metadata-directive REPLACE"
+    And bucket "s3.barnybug.github.com" key "pear" does not exist
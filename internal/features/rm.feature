@@ -31,3 +31,233 @@ Feature: rm command
     When I run "s3 rm localfile"
     Then the exit code is 1
     And local file "localfile" has contents "abc"
+
+  Scenario: I can remove a key using the del alias
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "key" contains "123"
+    When I run "s3 del s3://s3.barnybug.github.com/key"
+    Then bucket "s3.barnybug.github.com" key "key" does not exist
+
+  Scenario: rm leaves keys listed in the bucket's .s3keep
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key ".s3keep" contains "/logs/keep-*"
+    And bucket "s3.barnybug.github.com" key "logs/keep-me" contains "1"
+    And bucket "s3.barnybug.github.com" key "logs/other" contains "1"
+    When I run "s3 rm s3://s3.barnybug.github.com/"
+    Then bucket "s3.barnybug.github.com" key "logs/other" does not exist
+    And bucket "s3.barnybug.github.com" key "logs/keep-me" exists
+    And bucket "s3.barnybug.github.com" key ".s3keep" exists
+    And the output contains "K s3://s3.barnybug.github.com/logs/keep-me"
+
+  Scenario: rm leaves keys matching --protect
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "1"
+    And bucket "s3.barnybug.github.com" key "avocado" contains "1"
+    When I run "s3 rm --protect avocado s3://s3.barnybug.github.com/a"
+    Then bucket "s3.barnybug.github.com" key "apple" does not exist
+    And bucket "s3.barnybug.github.com" key "avocado" exists
+
+  Scenario: rm -r removes every key under a prefix, a page at a time
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" has 2500 keys under "logs/"
+    And bucket "s3.barnybug.github.com" key "other" contains "1"
+    When I run "s3 rm -r s3://s3.barnybug.github.com/logs/"
+    Then the exit code is 0
+    And the output contains "2500 deleted"
+    And bucket "s3.barnybug.github.com" key "logs/00000" does not exist
+    And bucket "s3.barnybug.github.com" key "logs/02499" does not exist
+    And bucket "s3.barnybug.github.com" key "other" exists
+
+  Scenario: rm -r with dry-run removes nothing
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" has 1500 keys under "logs/"
+    When I run "s3 -n rm -r s3://s3.barnybug.github.com/logs/"
+    Then the exit code is 0
+    And the output contains "D s3://s3.barnybug.github.com/logs/01499"
+    And the output contains "1500 deleted"
+    And bucket "s3.barnybug.github.com" key "logs/00000" exists
+    And bucket "s3.barnybug.github.com" key "logs/01499" exists
+
+  Scenario: rm fails on keys S3 refuses to delete
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "1"
+    And bucket "s3.barnybug.github.com" key "avocado" contains "1"
+    And bucket "s3.barnybug.github.com" key "apple" can't be deleted
+    When I run "s3 rm s3://s3.barnybug.github.com/a"
+    Then the exit code is 1
+    And the output contains "s3://s3.barnybug.github.com/apple: api error AccessDenied"
+    And bucket "s3.barnybug.github.com" key "apple" exists
+    And bucket "s3.barnybug.github.com" key "avocado" does not exist
+
+  Scenario: rm --ignore-errors reports keys S3 refuses to delete
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "1"
+    And bucket "s3.barnybug.github.com" key "avocado" contains "1"
+    And bucket "s3.barnybug.github.com" key "apple" can't be deleted
+    When I run "s3 --ignore-errors rm s3://s3.barnybug.github.com/a"
+    Then the exit code is 0
+    And the output contains "E s3://s3.barnybug.github.com/apple: api error AccessDenied"
+    And the output contains "0 added 1 deleted"
+    And bucket "s3.barnybug.github.com" key "apple" exists
+
+  Scenario: rm -i asks before removing keys
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "1"
+    And bucket "s3.barnybug.github.com" key "avocado" contains "1"
+    And standard input contains "n\n"
+    When I run "s3 rm -i s3://s3.barnybug.github.com/a"
+    Then the output contains "remove 2 keys under s3://s3.barnybug.github.com/a? [y/N]"
+    And the output contains "not confirmed, nothing removed"
+    And the exit code is 1
+    And bucket "s3.barnybug.github.com" key "apple" exists
+    And bucket "s3.barnybug.github.com" key "avocado" exists
+
+  Scenario: rm -i removes keys once confirmed
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "1"
+    And standard input contains "yes\n"
+    When I run "s3 rm -i s3://s3.barnybug.github.com/apple"
+    Then the exit code is 0
+    And bucket "s3.barnybug.github.com" key "apple" does not exist
+
+  Scenario: rm --confirm-over asks only before removing more keys
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "1"
+    And bucket "s3.barnybug.github.com" key "avocado" contains "1"
+    And bucket "s3.barnybug.github.com" key "banana" contains "1"
+    And standard input contains "n\n"
+    When I run "s3 rm --confirm-over 2 s3://s3.barnybug.github.com/b"
+    Then the exit code is 0
+    And bucket "s3.barnybug.github.com" key "banana" does not exist
+    When I run "s3 rm --confirm-over 1 s3://s3.barnybug.github.com/a"
+    Then the output contains "remove 2 keys under s3://s3.barnybug.github.com/a? [y/N]"
+    And the exit code is 1
+    And bucket "s3.barnybug.github.com" key "apple" exists
+
+  Scenario: rm asks before removing more keys than the confirm-over of the target
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "1"
+    And bucket "s3.barnybug.github.com" key "avocado" contains "1"
+    And the config file contains "targets:\n  careful:\n    confirm-over: 1\n"
+    And standard input contains "n\n"
+    When I run "s3 --target careful rm s3://s3.barnybug.github.com/a"
+    Then the output contains "remove 2 keys under s3://s3.barnybug.github.com/a? [y/N]"
+    And the exit code is 1
+    And bucket "s3.barnybug.github.com" key "apple" exists
+    When I run "s3 --target careful rm --confirm-over 2 s3://s3.barnybug.github.com/a"
+    Then the exit code is 0
+    And bucket "s3.barnybug.github.com" key "apple" does not exist
+
+  Scenario: rm --force never asks
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "1"
+    When I run "s3 rm -i --force s3://s3.barnybug.github.com/apple"
+    Then the exit code is 0
+    And the output does not contain "[y/N]"
+    And bucket "s3.barnybug.github.com" key "apple" does not exist
+
+  Scenario: rm --version-id removes an old version of a key
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" has versioning enabled
+    And bucket "s3.barnybug.github.com" key "apple" contains "1"
+    And bucket "s3.barnybug.github.com" key "apple" contains "2"
+    When I run "s3 rm --version-id v1 s3://s3.barnybug.github.com/apple"
+    Then the exit code is 0
+    And the output contains "D s3://s3.barnybug.github.com/apple (version v1)"
+    And bucket "s3.barnybug.github.com" has key "apple" with contents "2"
+    And bucket "s3.barnybug.github.com" key "apple" has versions "v2"
+
+  Scenario: rm --version-id of a delete marker undeletes the key
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" has versioning enabled
+    And bucket "s3.barnybug.github.com" key "apple" contains "1"
+    When I run "s3 rm s3://s3.barnybug.github.com/apple"
+    Then bucket "s3.barnybug.github.com" key "apple" does not exist
+    And bucket "s3.barnybug.github.com" key "apple" has versions "v1 v2 (delete marker)"
+    When I run "s3 rm --version-id v2 s3://s3.barnybug.github.com/apple"
+    Then the exit code is 0
+    And bucket "s3.barnybug.github.com" has key "apple" with contents "1"
+
+  Scenario: rm --version-id of a missing version is an error
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" has versioning enabled
+    And bucket "s3.barnybug.github.com" key "apple" contains "1"
+    When I run "s3 rm --version-id v9 s3://s3.barnybug.github.com/apple"
+    Then the exit code is 1
+    And the output contains "NoSuchVersion"
+    And bucket "s3.barnybug.github.com" has key "apple" with contents "1"
+
+  Scenario: rm --version-id takes a single key
+    Given I have bucket "s3.barnybug.github.com"
+    When I run "s3 rm --version-id v1 s3://s3.barnybug.github.com/apple s3://s3.barnybug.github.com/banana"
+    Then the exit code is 1
+    And the output contains "--version-id removes a version of a single key"
+
+  Scenario: rm --bypass-governance-retention removes versions under governance retention
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" has versioning enabled
+    And local file "apple" contains "APPLE"
+    When I run "s3 put --object-lock-mode governance --retain-until 30d apple s3://s3.barnybug.github.com/"
+    And I run "s3 rm --version-id v1 s3://s3.barnybug.github.com/apple"
+    Then the exit code is 1
+    And the output contains "AccessDenied"
+    And bucket "s3.barnybug.github.com" has key "apple" with contents "APPLE"
+    When I run "s3 rm --bypass-governance-retention --version-id v1 s3://s3.barnybug.github.com/apple"
+    Then bucket "s3.barnybug.github.com" key "apple" does not exist
+    And bucket "s3.barnybug.github.com" key "apple" has versions ""
+
+  Scenario: rm --bypass-governance-retention can't remove versions under compliance retention
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" has versioning enabled
+    And local file "apple" contains "APPLE"
+    When I run "s3 put --object-lock-mode compliance --retain-until 30d apple s3://s3.barnybug.github.com/"
+    And I run "s3 rm --bypass-governance-retention --version-id v1 s3://s3.barnybug.github.com/apple"
+    Then the exit code is 1
+    And the output contains "AccessDenied"
+    And bucket "s3.barnybug.github.com" has key "apple" with contents "APPLE"
+
+  Scenario: rm --older-than only removes old keys
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "logs/old" contains "1"
+    And bucket "s3.barnybug.github.com" key "logs/old" was last modified "2024-06-01T12:00:00Z"
+    And bucket "s3.barnybug.github.com" key "logs/new" contains "2"
+    When I run "s3 rm --older-than 30d s3://s3.barnybug.github.com/logs/"
+    Then the exit code is 0
+    And bucket "s3.barnybug.github.com" key "logs/old" does not exist
+    And bucket "s3.barnybug.github.com" has key "logs/new" with contents "2"
+
+  Scenario: rm --version-id in a bucket with MFA delete needs a code
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" has versioning enabled
+    And bucket "s3.barnybug.github.com" has MFA delete enabled for device "arn:aws:iam::123456789012:mfa/me"
+    And bucket "s3.barnybug.github.com" key "apple" contains "1"
+    And bucket "s3.barnybug.github.com" key "apple" contains "2"
+    When I run "s3 rm --version-id v1 s3://s3.barnybug.github.com/apple"
+    Then the exit code is 1
+    And the output contains "AccessDenied"
+    When I run "s3 --mfa-serial arn:aws:iam::123456789012:mfa/me --token-code 123456 rm --version-id v1 s3://s3.barnybug.github.com/apple"
+    Then the exit code is 0
+    And bucket "s3.barnybug.github.com" key "apple" has versions "v2"
+
+  Scenario: rm --version-id asks for the MFA code
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" has versioning enabled
+    And bucket "s3.barnybug.github.com" has MFA delete enabled for device "arn:aws:iam::123456789012:mfa/me"
+    And bucket "s3.barnybug.github.com" key "apple" contains "1"
+    And bucket "s3.barnybug.github.com" key "apple" contains "2"
+    And standard input contains "654321\n"
+    When I run "s3 --mfa-serial arn:aws:iam::123456789012:mfa/me rm --version-id v1 s3://s3.barnybug.github.com/apple" with errors apart
+    Then the error output contains "MFA code for arn:aws:iam::123456789012:mfa/me: "
+    And the output does not contain "MFA code"
+    And the exit code is 0
+    And bucket "s3.barnybug.github.com" key "apple" has versions "v2"
+
+  Scenario: An MFA code must be 6 digits
+    When I run "s3 --mfa-serial arn:aws:iam::123456789012:mfa/me --token-code 12 ls"
+    Then the output contains "--token-code must be 6 digits"
+    And the exit code is 1
+
+  Scenario: An MFA code needs a device
+    When I run "s3 --token-code 123456 ls"
+    Then the output contains "--token-code needs an --mfa-serial"
+    And the exit code is 1
@@ -0,0 +1,72 @@
+@sso
+Feature: AWS SSO logins
+
+  Scenario: A profile is logged in with the device code flow, caching the token
+    Given my home directory is "home"
+    And local file "aws-config" contains "[profile sso]\nsso_start_url = https://mock.awsapps.com/start\nsso_region = eu-west-1\n"
+    And the environment variable "AWS_CONFIG_FILE" is "aws-config"
+    And a mock AWS SSO service
+    When I log in to AWS SSO with profile "sso"
+    Then AWS SSO was logged in 1 time
+    And the output contains "Log in to AWS SSO at https://mock.awsapps.com/start/device?user_code=MOCK-CODE and confirm the code MOCK-CODE\n"
+    And the AWS SSO token of "https://mock.awsapps.com/start" is cached as "mock-token"
+
+  Scenario: A valid cached token is used without logging in
+    Given my home directory is "home"
+    And local file "aws-config" contains "[profile sso]\nsso_start_url = https://mock.awsapps.com/start\nsso_region = eu-west-1\n"
+    And the environment variable "AWS_CONFIG_FILE" is "aws-config"
+    And a mock AWS SSO service
+    And the AWS SSO token of "https://mock.awsapps.com/start" is cached, expiring in "1h"
+    When I log in to AWS SSO with profile "sso"
+    Then AWS SSO was logged in 0 times
+    And the output is ""
+    And the AWS SSO token of "https://mock.awsapps.com/start" is cached as "cached-token"
+
+  Scenario: An expired cached token is replaced by logging in again
+    Given my home directory is "home"
+    And local file "aws-config" contains "[profile sso]\nsso_start_url = https://mock.awsapps.com/start\nsso_region = eu-west-1\n"
+    And the environment variable "AWS_CONFIG_FILE" is "aws-config"
+    And a mock AWS SSO service
+    And the AWS SSO token of "https://mock.awsapps.com/start" is cached, expiring in "-1h"
+    When I log in to AWS SSO with profile "sso"
+    Then AWS SSO was logged in 1 time
+    And the AWS SSO token of "https://mock.awsapps.com/start" is cached as "mock-token"
+
+  Scenario: A token about to expire is replaced by logging in again
+    Given my home directory is "home"
+    And local file "aws-config" contains "[profile sso]\nsso_start_url = https://mock.awsapps.com/start\nsso_region = eu-west-1\n"
+    And the environment variable "AWS_CONFIG_FILE" is "aws-config"
+    And a mock AWS SSO service
+    And the AWS SSO token of "https://mock.awsapps.com/start" is cached, expiring in "30s"
+    When I log in to AWS SSO with profile "sso"
+    Then AWS SSO was logged in 1 time
+
+  Scenario: The token is polled for until the login is confirmed
+    Given my home directory is "home"
+    And local file "aws-config" contains "[profile sso]\nsso_start_url = https://mock.awsapps.com/start\nsso_region = eu-west-1\n"
+    And the environment variable "AWS_CONFIG_FILE" is "aws-config"
+    And a mock AWS SSO service
+    And the mock AWS SSO service answers 2 polls pending
+    When I log in to AWS SSO with profile "sso"
+    Then AWS SSO was logged in 1 time
+    And the mock AWS SSO service was polled 3 times
+    And the AWS SSO token of "https://mock.awsapps.com/start" is cached as "mock-token"
+
+  Scenario: Polls slow down when asked to
+    Given my home directory is "home"
+    And local file "aws-config" contains "[profile sso]\nsso_start_url = https://mock.awsapps.com/start\nsso_region = eu-west-1\n"
+    And the environment variable "AWS_CONFIG_FILE" is "aws-config"
+    And a mock AWS SSO service
+    And the mock AWS SSO service answers 1 polls pending
+    And the mock AWS SSO service answers 1 polls slow down
+    When I log in to AWS SSO with profile "sso"
+    Then AWS SSO was logged in 1 time
+    And the mock AWS SSO service was polled 3 times
+    And the mock AWS SSO service was polled more slowly after asking to slow down
+
+  Scenario: A profile without AWS SSO can't be logged in
+    Given local file "aws-config" contains "[profile plain]\nregion = eu-west-1\n"
+    And the environment variable "AWS_CONFIG_FILE" is "aws-config"
+    And a mock AWS SSO service
+    When I log in to AWS SSO with profile "plain"
+    Then the client failed with "profile "plain" doesn't sign in with AWS SSO"
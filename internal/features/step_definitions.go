@@ -2,66 +2,236 @@ package features
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/signal"
 	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	awss3 "github.com/aws/aws-sdk-go/service/s3"
-	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/barnybug/s3"
+	"github.com/barnybug/s3/pkg/mys3"
 	. "github.com/gucumber/gucumber"
 )
 
-var conn s3iface.S3API
+var conn s3.S3API
 var testBuckets []string
 var out bytes.Buffer
+var errOut bytes.Buffer   // of commands run with errors apart
+var otherOut bytes.Buffer // of the second of two commands run at once
 var lastExitCode int
+
+// of the last call of a Client
+var lastResult *s3.Result
+var lastRecords []s3.Record
+var lastErr error
+var lastRunTime time.Duration // of the last command run against the fake server
 var tempDir string
+var stdin = os.Stdin
 
-var replacer = strings.NewReplacer(`\n`, "\n", `\t`, "\t")
+// environment variables set by the scenario, unset after it
+var setEnv []string
 
-func deleteAllKeys(bucket string) {
-	truncated := true
-	marker := ""
-	for truncated {
-		input := awss3.ListObjectsInput{
-			Bucket: aws.String(bucket),
-			Marker: aws.String(marker),
+// home is the home directory before the scenario set one, restored after it
+var home *string
+
+// ssoService is the mock AWS SSO OIDC service of the scenario's logins
+var ssoService *s3.MockSSOOIDC
+
+// fakeServer, when started, serves the buckets conn talks to, saving them
+// to fakeDir.
+var fakeServer *httptest.Server
+var fakeDir string
+
+// fakeTLS serves the fake server over https, with a certificate of its own
+var fakeTLS bool
+
+// fakeDelay holds up each response of the fake server, in nanoseconds
+var fakeDelay int64
+
+// fakeDelayGets holds up only the responses of gets of keys
+var fakeDelayGets int32
+
+// fakeFaults is how many more requests the fake server fails, as fakeFault
+// says
+var fakeFaults int32
+
+// fakeFault is how the fake server fails requests: "throttles", "times out"
+// or "resets the connection of"
+var fakeFault string
+
+// ssoTokenPath returns where the AWS SSO token of startURL is cached, as the
+// aws cli and sdks cache it.
+func ssoTokenPath(startURL string) string {
+	sum := sha1.Sum([]byte(startURL))
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".aws", "sso", "cache", hex.EncodeToString(sum[:])+".json")
+}
+
+// startFakeServer serves the buckets saved in fakeDir, and points conn at
+// them.
+func startFakeServer() {
+	ms, err := s3.LoadMockS3(fakeDir)
+	if err != nil {
+		T.Errorf("Couldn't load fake server: %s", err)
+		return
+	}
+	handler := faulting(delayed(s3.NewFakeServer(ms, fakeDir)))
+	if fakeTLS {
+		fakeServer = httptest.NewTLSServer(handler)
+	} else {
+		fakeServer = httptest.NewServer(handler)
+	}
+	conn = awss3.New(awss3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(fakeServer.URL),
+		Credentials:  credentials.NewStaticCredentialsProvider("fake", "fake", ""),
+		UsePathStyle: true,
+		// trusting the server's own certificate, whatever AWS_CA_BUNDLE is
+		HTTPClient: fakeServer.Client(),
+		// checksums are sent as commands ask, as they are outside of tests
+		RequestChecksumCalculation: aws.RequestChecksumCalculationWhenRequired,
+		ResponseChecksumValidation: aws.ResponseChecksumValidationWhenRequired,
+	})
+}
+
+// fakeServerArgs returns the arguments of command run against the fake
+// server, with a connection of its own to the --endpoint as outside of
+// tests. {fake-server} in command is the url of the fake server.
+func fakeServerArgs(command string) []string {
+	command = strings.Replace(command, "{fake-server}", fakeServerURL(), -1)
+	args := strings.Split(command, " ")
+	args = append([]string{args[0], "--endpoint", fakeServerURL()}, args[1:]...)
+	setFakeCredentials()
+	return args
+}
+
+// fakeServerURL returns the url of the fake server for commands. Over http
+// it's by host name rather than IP address, as buckets can't be addressed by
+// host name under an IP address; over https it's by the IP address its
+// certificate is for.
+func fakeServerURL() string {
+	return strings.Replace(fakeServer.URL, "http://127.0.0.1", "http://localhost", 1)
+}
+
+// setFakeCredentials sets the credentials of commands making connections of
+// their own for the scenario.
+func setFakeCredentials() {
+	for _, name := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY"} {
+		os.Setenv(name, "fake")
+		setEnv = append(setEnv, name)
+	}
+}
+
+// interruptingMys3 cancels a run once it has sent a part of an upload.
+type interruptingMys3 struct {
+	mys3.Mys3
+	cancel context.CancelFunc
+}
+
+func (im interruptingMys3) UploadPart(ctx context.Context, input *awss3.UploadPartInput, optFns ...func(*awss3.Options)) (*awss3.UploadPartOutput, error) {
+	output, err := im.Mys3.UploadPart(ctx, input, optFns...)
+	im.cancel()
+	return output, err
+}
+
+// delayed holds up the responses of handler by fakeDelay, or until the client
+// gives up on them.
+func delayed(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		isKey := strings.Contains(strings.Trim(r.URL.Path, "/"), "/")
+		if atomic.LoadInt32(&fakeDelayGets) == 1 && !(r.Method == http.MethodGet && isKey) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		select {
+		case <-time.After(time.Duration(atomic.LoadInt64(&fakeDelay))):
+			handler.ServeHTTP(w, r)
+		case <-r.Context().Done():
+		}
+	})
+}
+
+// faulting fails requests while fakeFaults lasts, as a flaky endpoint does:
+// with 503 SlowDown, 400 RequestTimeout, or by resetting the connection.
+func faulting(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&fakeFaults, -1) < 0 {
+			atomic.StoreInt32(&fakeFaults, 0)
+			handler.ServeHTTP(w, r)
+			return
 		}
-		output, err := conn.ListObjects(&input)
+		switch fakeFault {
+		case "times out":
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>RequestTimeout</Code><Message>Your socket connection to the server was not read from or written to within the timeout period.</Message></Error>`)
+		case "resets the connection of":
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				return
+			}
+			if tcp, ok := conn.(*net.TCPConn); ok {
+				// closing at once with RST, rather than FIN
+				tcp.SetLinger(0)
+			}
+			conn.Close()
+		default:
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>SlowDown</Code><Message>Please reduce your request rate.</Message></Error>`)
+		}
+	})
+}
+
+func stopFakeServer() {
+	if fakeServer != nil {
+		fakeServer.Close()
+		fakeServer = nil
+	}
+}
+
+var replacer = strings.NewReplacer(`\n`, "\n", `\t`, "\t", `\0`, "\x00")
+
+func deleteAllKeys(bucket string) {
+	pages := awss3.NewListObjectsV2Paginator(conn, &awss3.ListObjectsV2Input{Bucket: aws.String(bucket)})
+	for pages.HasMorePages() {
+		output, err := pages.NextPage(context.Background())
 		if err != nil {
 			log.Fatal(err.Error())
 		}
-		last_key := ""
-		var objects []*awss3.ObjectIdentifier
+		var objects []types.ObjectIdentifier
 		for _, object := range output.Contents {
-			id := awss3.ObjectIdentifier{
-				Key: object.Key,
-			}
-			objects = append(objects, &id)
-			last_key = *object.Key
+			objects = append(objects, types.ObjectIdentifier{Key: object.Key})
 		}
 		deleteObjectsInput := awss3.DeleteObjectsInput{
 			Bucket: aws.String(bucket),
-			Delete: &awss3.Delete{
+			Delete: &types.Delete{
 				Objects: objects,
 			},
 		}
-		conn.DeleteObjects(&deleteObjectsInput)
-
-		truncated = *output.IsTruncated
-		if output.NextMarker != nil {
-			marker = *output.NextMarker
-		}
-		if marker == "" {
-			// Response may not include NextMarker.
-			marker = last_key
-		}
+		conn.DeleteObjects(context.Background(), &deleteObjectsInput)
 	}
 }
 
@@ -70,12 +240,12 @@ func cleanupBucket(bucket string) {
 	input := awss3.DeleteBucketInput{
 		Bucket: aws.String(bucket),
 	}
-	conn.DeleteBucket(&input)
+	conn.DeleteBucket(context.Background(), &input)
 }
 
 func bucketExists(bucket string) bool {
 	input := awss3.ListBucketsInput{}
-	output, _ := conn.ListBuckets(&input)
+	output, _ := conn.ListBuckets(context.Background(), &input)
 	for _, b := range output.Buckets {
 		if *b.Name == bucket {
 			return true
@@ -99,6 +269,9 @@ func init() {
 	Before("", func() {
 		conn = s3.NewMockS3()
 		out = bytes.Buffer{}
+		errOut = bytes.Buffer{}
+		otherOut = bytes.Buffer{}
+		os.Stdin = stdin
 		tempDir, _ = ioutil.TempDir("", "")
 		os.Chdir(tempDir)
 	})
@@ -108,141 +281,1139 @@ func init() {
 		for _, bucket := range testBuckets {
 			cleanupBucket(bucket)
 		}
+		stopFakeServer()
+		fakeTLS = false
+		atomic.StoreInt64(&fakeDelay, 0)
+		atomic.StoreInt32(&fakeDelayGets, 0)
+		atomic.StoreInt32(&fakeFaults, 0)
+		for _, name := range setEnv {
+			os.Unsetenv(name)
+		}
+		setEnv = nil
+		if home != nil {
+			os.Setenv("HOME", *home)
+			home = nil
+		}
+		ssoService = nil
+		if fakeDir != "" {
+			os.RemoveAll(fakeDir)
+			fakeDir = ""
+		}
 		// Cleanup temp dir
 		if tempDir != "" {
 			os.RemoveAll(tempDir)
 		}
 	})
 
+	Given(`^I use a fake server$`, func() {
+		fakeDir, _ = ioutil.TempDir("", "")
+		startFakeServer()
+	})
+
+	Given(`^I use a fake server over https with its certificate in "(.+?)"$`, func(filename string) {
+		fakeDir, _ = ioutil.TempDir("", "")
+		fakeTLS = true
+		startFakeServer()
+		cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: fakeServer.Certificate().Raw})
+		if err := ioutil.WriteFile(filename, cert, 0644); err != nil {
+			T.Errorf("Couldn't write certificate: %s\n%s", filename, err)
+		}
+	})
+
+	Given(`^the fake server takes "(.+?)" to respond( to gets of keys)?$`, func(delay string, gets string) {
+		d, err := time.ParseDuration(delay)
+		if err != nil {
+			T.Errorf("Bad delay: %s", err)
+			return
+		}
+		atomic.StoreInt64(&fakeDelay, int64(d))
+		if gets != "" {
+			atomic.StoreInt32(&fakeDelayGets, 1)
+		}
+	})
+
+	Given(`^the fake server (throttles|times out|resets the connection of) the next (\d+) requests?$`, func(fault string, n int) {
+		fakeFault = fault
+		atomic.StoreInt32(&fakeFaults, int32(n))
+	})
+
+	When(`^the fake server restarts$`, func() {
+		stopFakeServer()
+		startFakeServer()
+	})
+
 	Given(`^I have bucket "(.+?)"$`, func(bucket string) {
 		input := awss3.CreateBucketInput{
 			Bucket: aws.String(bucket),
 		}
-		conn.CreateBucket(&input)
+		conn.CreateBucket(context.Background(), &input)
+	})
+
+	Given(`^bucket "(.+?)" has acls disabled$`, func(bucket string) {
+		_, err := conn.PutBucketOwnershipControls(context.Background(), &awss3.PutBucketOwnershipControlsInput{
+			Bucket: aws.String(bucket),
+			OwnershipControls: &types.OwnershipControls{
+				Rules: []types.OwnershipControlsRule{
+					{ObjectOwnership: types.ObjectOwnershipBucketOwnerEnforced},
+				},
+			},
+		})
+		if err != nil {
+			T.Errorf("Couldn't set ownership controls: %s\n%s", bucket, err)
+		}
 	})
 
 	Given(`^bucket "(.+?)" key "(.+?)" contains "(.+?)"$`, func(bucket string, key string, content string) {
-		body := bytes.NewReader([]byte(content))
+		body := bytes.NewReader([]byte(replacer.Replace(content)))
 		input := awss3.PutObjectInput{
 			Bucket: aws.String(bucket),
 			Key:    aws.String(key),
 			Body:   body,
 		}
-		conn.PutObject(&input)
+		conn.PutObject(context.Background(), &input)
 	})
 
-	Given(`^local file "(.+?)" contains "(.+?)"$`, func(filename string, content string) {
-		// create containing directory if necessary
-		dirname := path.Dir(filename)
-		if dirname != "" {
-			if _, err := os.Stat(dirname); os.IsNotExist(err) {
-				err := os.MkdirAll(dirname, 0755)
-				if err != nil {
-					T.Errorf("Couldn't create directory: %s\n%s", dirname, err)
-					return
-				}
+	Given(`^bucket "(.+?)" has (\d+) keys under "(.+?)"$`, func(bucket string, n int, prefix string) {
+		for i := 0; i < n; i++ {
+			_, err := conn.PutObject(context.Background(), &awss3.PutObjectInput{
+				Bucket: aws.String(bucket),
+				Key:    aws.String(fmt.Sprintf("%s%05d", prefix, i)),
+				Body:   strings.NewReader("1"),
+			})
+			if err != nil {
+				T.Errorf("Couldn't put key: %s\n%s", bucket, err)
+				return
 			}
 		}
+	})
 
-		file, err := os.Create(filename)
+	Given(`^bucket "(.+?)" key "(.+?)" contains (\d+) numbered lines$`, func(bucket string, key string, n int) {
+		var content strings.Builder
+		for i := 1; i <= n; i++ {
+			fmt.Fprintf(&content, "line %d\n", i)
+		}
+		_, err := conn.PutObject(context.Background(), &awss3.PutObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+			Body:   strings.NewReader(content.String()),
+		})
 		if err != nil {
-			T.Errorf("Couldn't create file: %s\n%s", filename, err)
-			return
+			T.Errorf("Couldn't put key: %s\n%s", key, err)
 		}
-		defer file.Close()
-		file.WriteString(content)
 	})
 
-	When(`^I run "(.+?)"$`, func(s1 string) {
-		args := strings.Split(s1, " ")
-		o := threadSafeWriter{&out, sync.Mutex{}}
-		lastExitCode = s3.Main(conn, args, &o)
+	Given(`^bucket "(.+?)" key "(.+?)" contains "(.+?)" gzipped( with content encoding)?$`, func(bucket string, key string, content string, encoded string) {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write([]byte(content))
+		gz.Close()
+		input := awss3.PutObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+			Body:   bytes.NewReader(buf.Bytes()),
+		}
+		if encoded != "" {
+			input.ContentEncoding = aws.String("gzip")
+		}
+		conn.PutObject(context.Background(), &input)
 	})
 
-	Then(`^local file "(.+?)" has contents "(.+?)"$`, func(filename string, exp string) {
-		file, err := os.Open(filename)
+	Given(`^bucket "(.+?)" key "(.+?)" contains "(.+?)" uploaded in parts of (\d+) bytes$`, func(bucket string, key string, content string, partSize int) {
+		err := conn.(*s3.MockS3).PutMultipartObject(bucket, key, []byte(content), int64(partSize))
 		if err != nil {
-			T.Errorf("Local file error:\n%s", err)
+			T.Errorf("Couldn't put multipart object: %s\n%s", key, err)
+		}
+	})
+
+	Given(`^bucket "(.+?)" key "(.+?)" has an incomplete upload of local file "(.+?)" with (\d+) parts? sent$`, func(bucket string, key string, filename string, n int) {
+		content, err := ioutil.ReadFile(filename)
+		if err != nil {
+			T.Errorf("Couldn't read file: %s\n%s", filename, err)
 			return
 		}
-		defer file.Close()
-		content, err := ioutil.ReadAll(file)
+		upload, err := conn.CreateMultipartUpload(context.Background(), &awss3.CreateMultipartUploadInput{
+			Bucket:   aws.String(bucket),
+			Key:      aws.String(key),
+			Metadata: map[string]string{"upload": "interrupted"},
+		})
 		if err != nil {
-			T.Errorf("Local file error:\n%s", err)
+			T.Errorf("Couldn't create upload: %s\n%s", key, err)
 			return
 		}
-		act := string(content)
-		if act != exp {
-			T.Errorf("%s contents expected:\n%s\ngot:\n%s", filename, exp, act)
+		for i := 0; i < n; i++ {
+			start := i * s3.PART_SIZE
+			end := start + s3.PART_SIZE
+			if end > len(content) {
+				end = len(content)
+			}
+			_, err = conn.UploadPart(context.Background(), &awss3.UploadPartInput{
+				Bucket:     aws.String(bucket),
+				Key:        aws.String(key),
+				UploadId:   upload.UploadId,
+				PartNumber: aws.Int32(int32(i + 1)),
+				Body:       bytes.NewReader(content[start:end]),
+			})
+			if err != nil {
+				T.Errorf("Couldn't upload part: %s\n%s", key, err)
+				return
+			}
 		}
 	})
 
-	Then(`^the output is "(.*?)"$`, func(exp string) {
-		// replace newlines
-		exp = replacer.Replace(exp)
-		act := string(out.Bytes())
-		if act != exp {
-			T.Errorf("Output expected:\n%s\ngot:\n%s", exp, act)
+	Given(`^bucket "(.+?)" shows new keys after (\d+) checks$`, func(bucket string, n int) {
+		err := conn.(*s3.MockS3).SetVisibilityLag(bucket, n)
+		if err != nil {
+			T.Errorf("Couldn't set visibility lag: %s\n%s", bucket, err)
 		}
 	})
 
-	Then(`^the output contains "(.*?)"$`, func(exp string) {
-		// replace newlines
-		exp = replacer.Replace(exp)
-		act := string(out.Bytes())
-		if !strings.Contains(act, exp) {
-			T.Errorf("Output does not contain:\n%s\ngot:\n%s", exp, act)
+	Given(`^bucket "(.+?)" corrupts uploads$`, func(bucket string) {
+		err := conn.(*s3.MockS3).SetCorruptUploads(bucket)
+		if err != nil {
+			T.Errorf("Couldn't corrupt uploads: %s\n%s", bucket, err)
 		}
 	})
 
-	Then(`^the exit code is (\d+?)$`, func(code int) {
-		if code != lastExitCode {
-			T.Errorf("Exit code expected:\n%d\ngot:\n%d", code, lastExitCode)
+	Given(`^bucket "(.+?)" misreports the ETags? of (\d+) parts?$`, func(bucket string, n int) {
+		err := conn.(*s3.MockS3).SetMisreportedETags(bucket, n, false)
+		if err != nil {
+			T.Errorf("Couldn't misreport ETags: %s\n%s", bucket, err)
 		}
 	})
 
-	Then(`^the bucket "(.+?)" exists$`, func(bucket string) {
-		if !bucketExists(bucket) {
-			T.Errorf("Bucket %s does not exist", bucket)
+	Given(`^bucket "(.+?)" misreports the ETags of uploads$`, func(bucket string) {
+		err := conn.(*s3.MockS3).SetMisreportedETags(bucket, 0, true)
+		if err != nil {
+			T.Errorf("Couldn't misreport ETags: %s\n%s", bucket, err)
 		}
 	})
 
-	Then(`^the bucket "(.+?)" does not exist$`, func(bucket string) {
-		if bucketExists(bucket) {
-			T.Errorf("Bucket %s exists", bucket)
+	Given(`^bucket "(.+?)" fails to complete uploads$`, func(bucket string) {
+		err := conn.(*s3.MockS3).SetFailCompletes(bucket)
+		if err != nil {
+			T.Errorf("Couldn't fail completions: %s\n%s", bucket, err)
 		}
 	})
 
-	Then(`^bucket "(.+?)" has key "(.+?)" with contents "(.+?)"$`, func(bucket string, key string, exp string) {
-		input := awss3.GetObjectInput{
+	Given(`^bucket "(.+?)" has transfer acceleration enabled$`, func(bucket string) {
+		_, err := conn.PutBucketAccelerateConfiguration(context.Background(), &awss3.PutBucketAccelerateConfigurationInput{
 			Bucket: aws.String(bucket),
-			Key:    aws.String(key),
+			AccelerateConfiguration: &types.AccelerateConfiguration{
+				Status: types.BucketAccelerateStatusEnabled,
+			},
+		})
+		if err != nil {
+			T.Errorf("Couldn't enable transfer acceleration: %s\n%s", bucket, err)
+		}
+	})
+
+	Given(`^bucket "(.+?)" has versioning enabled$`, func(bucket string) {
+		_, err := conn.PutBucketVersioning(context.Background(), &awss3.PutBucketVersioningInput{
+			Bucket: aws.String(bucket),
+			VersioningConfiguration: &types.VersioningConfiguration{
+				Status: types.BucketVersioningStatusEnabled,
+			},
+		})
+		if err != nil {
+			T.Errorf("Couldn't enable versioning: %s\n%s", bucket, err)
 		}
-		output, err := conn.GetObject(&input)
+	})
+
+	Given(`^bucket "(.+?)" key "(.+?)" can't be deleted$`, func(bucket string, key string) {
+		err := conn.(*s3.MockS3).SetUndeletable(bucket, key)
 		if err != nil {
-			T.Errorf("Bucket %s Key %s error:\n%s", bucket, key, err)
+			T.Errorf("Couldn't deny deletes: %s\n%s", key, err)
+		}
+	})
+
+	Given(`^the environment variable "(.+?)" is "(.*?)"$`, func(name string, value string) {
+		os.Setenv(name, value)
+		setEnv = append(setEnv, name)
+	})
+
+	Given(`^my home directory is "(.+?)"$`, func(dir string) {
+		if home == nil {
+			saved := os.Getenv("HOME")
+			home = &saved
+		}
+		abs, _ := filepath.Abs(dir)
+		os.Setenv("HOME", abs)
+	})
+
+	Given(`^a mock AWS SSO service$`, func() {
+		ssoService = &s3.MockSSOOIDC{}
+	})
+
+	Given(`^the mock AWS SSO service answers (\d+) polls (pending|slow down)$`, func(n int, answer string) {
+		if answer == "pending" {
+			ssoService.Pending = n
+		} else {
+			ssoService.SlowDowns = n
+		}
+	})
+
+	Given(`^the AWS SSO token of "(.+?)" is cached, expiring in "(.+?)"$`, func(startURL string, expiry string) {
+		d, err := time.ParseDuration(expiry)
+		if err != nil {
+			T.Errorf("Invalid duration: %s", expiry)
 			return
 		}
-		content, err := ioutil.ReadAll(output.Body)
+		data := fmt.Sprintf(`{"startUrl":%q,"accessToken":"cached-token","expiresAt":%q}`,
+			startURL, time.Now().Add(d).UTC().Format(time.RFC3339))
+		path := ssoTokenPath(startURL)
+		os.MkdirAll(filepath.Dir(path), 0700)
+		if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+			T.Errorf("Couldn't cache token: %s", err)
+		}
+	})
+
+	Given(`^bucket "(.+?)" has MFA delete enabled for device "(.+?)"$`, func(bucket string, serial string) {
+		err := conn.(*s3.MockS3).SetMFADelete(bucket, serial)
+		if err != nil {
+			T.Errorf("Couldn't enable MFA delete: %s\n%s", bucket, err)
+		}
+	})
+
+	Given(`^bucket "(.+?)" key "(.+?)" can only be read with S3 Select$`, func(bucket string, key string) {
+		err := conn.(*s3.MockS3).SetSelectOnly(bucket, key)
+		if err != nil {
+			T.Errorf("Couldn't deny reads: %s\n%s", key, err)
+		}
+	})
+
+	Given(`^bucket "(.+?)" key "(.+?)" is overwritten with "(.*?)" once listed$`, func(bucket string, key string, content string) {
+		err := conn.(*s3.MockS3).SetOverwriteOnList(bucket, key, []byte(content))
+		if err != nil {
+			T.Errorf("Couldn't set overwrite: %s\n%s", key, err)
+		}
+	})
+
+	Given(`^bucket "(.+?)" key "(.+?)" was last modified "(.+?)"$`, func(bucket string, key string, modified string) {
+		t, err := time.Parse(time.RFC3339, modified)
+		if err == nil {
+			err = conn.(*s3.MockS3).SetModified(bucket, key, t)
+		}
+		if err != nil {
+			T.Errorf("Couldn't set last modified: %s\n%s", key, err)
+		}
+	})
+
+	Given(`^bucket "(.+?)" key "(.+?)" upload was initiated "(.+?)"$`, func(bucket string, key string, initiated string) {
+		t, err := time.Parse(time.RFC3339, initiated)
+		if err == nil {
+			err = conn.(*s3.MockS3).SetUploadsInitiated(bucket, key, t)
+		}
+		if err != nil {
+			T.Errorf("Couldn't set upload initiated: %s\n%s", key, err)
+		}
+	})
+
+	Given(`^bucket "(.+?)" key "(.+?)" is given metadata "(.+?)" of "(.+?)"$`, func(bucket string, key string, name string, value string) {
+		head, err := conn.HeadObject(context.Background(), &awss3.HeadObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+		})
 		if err != nil {
 			T.Errorf("Bucket %s Key %s error:\n%s", bucket, key, err)
 			return
 		}
-		act := string(content)
-		if act != exp {
-			T.Errorf("%s Key %s contents expected:\n%s\ngot:\n%s", bucket, key, exp, act)
+		metadata := map[string]string{name: value}
+		for k, v := range head.Metadata {
+			if _, ok := metadata[k]; !ok {
+				metadata[k] = v
+			}
+		}
+		_, err = conn.CopyObject(context.Background(), &awss3.CopyObjectInput{
+			Bucket:            aws.String(bucket),
+			Key:               aws.String(key),
+			CopySource:        aws.String(bucket + "/" + key),
+			Metadata:          metadata,
+			MetadataDirective: types.MetadataDirectiveReplace,
+			ContentType:       head.ContentType,
+		})
+		if err != nil {
+			T.Errorf("Couldn't set metadata: %s\n%s", key, err)
+		}
+	})
+
+	Given(`^local file "(.+?)" contains "(.+?)"$`, func(filename string, content string) {
+		// create containing directory if necessary
+		dirname := path.Dir(filename)
+		if dirname != "" {
+			if _, err := os.Stat(dirname); os.IsNotExist(err) {
+				err := os.MkdirAll(dirname, 0755)
+				if err != nil {
+					T.Errorf("Couldn't create directory: %s\n%s", dirname, err)
+					return
+				}
+			}
+		}
+
+		file, err := os.Create(filename)
+		if err != nil {
+			T.Errorf("Couldn't create file: %s\n%s", filename, err)
 			return
 		}
+		defer file.Close()
+		file.WriteString(replacer.Replace(content))
 	})
 
-	Then(`^bucket "(.+?)" key "(.+?)" exists$`, func(bucket string, key string) {
-		input := awss3.GetObjectInput{
-			Bucket: aws.String(bucket),
-			Key:    aws.String(key),
+	Given(`^the config file contains "(.+?)"$`, func(content string) {
+		// {fake-server} is the url of the fake server
+		if fakeServer != nil {
+			content = strings.Replace(content, "{fake-server}", fakeServerURL(), -1)
 		}
-		_, err := conn.GetObject(&input)
+		dir, _ := os.Getwd()
+		filename := filepath.Join(dir, "config.yaml")
+		err := ioutil.WriteFile(filename, []byte(replacer.Replace(content)), 0644)
 		if err != nil {
-			T.Errorf("Bucket %s Key %s does not exist", bucket, key)
+			T.Errorf("Couldn't create file: %s\n%s", filename, err)
+		}
+		os.Setenv("S3_CONFIG_FILE", filename)
+		setEnv = append(setEnv, "S3_CONFIG_FILE")
+	})
+
+	Given(`^local file "(.+?)" is (\d+) bytes long$`, func(filename string, size int) {
+		// content that differs from part to part, so misordered or
+		// repeated parts are noticed
+		content := make([]byte, size)
+		for i := range content {
+			content[i] = byte(i % 251)
+		}
+		err := ioutil.WriteFile(filename, content, 0644)
+		if err != nil {
+			T.Errorf("Couldn't create file: %s\n%s", filename, err)
+		}
+	})
+
+	Given(`^local symlink "(.+?)" points to "(.+?)"$`, func(filename string, target string) {
+		err := os.Symlink(target, filename)
+		if err != nil {
+			T.Errorf("Couldn't create symlink: %s\n%s", filename, err)
+		}
+	})
+
+	Given(`^standard input contains "(.+?)"$`, func(content string) {
+		file, err := ioutil.TempFile(tempDir, "stdin")
+		if err == nil {
+			_, err = file.WriteString(replacer.Replace(content))
+		}
+		if err == nil {
+			_, err = file.Seek(0, io.SeekStart)
+		}
+		if err != nil {
+			T.Errorf("Couldn't create standard input:\n%s", err)
+			return
+		}
+		os.Stdin = file
+	})
+
+	Given(`^local file "(.+?)" is mode "(.+?)"$`, func(filename string, mode string) {
+		perm, _ := strconv.ParseUint(mode, 8, 32)
+		err := os.Chmod(filename, os.FileMode(perm))
+		if err != nil {
+			T.Errorf("Couldn't chmod file: %s\n%s", filename, err)
+		}
+	})
+
+	Given(`^local file "(.+?)" is dated "(.+?)"$`, func(filename string, modified string) {
+		t, err := time.Parse(time.RFC3339, modified)
+		if err == nil {
+			err = os.Chtimes(filename, t, t)
+		}
+		if err != nil {
+			T.Errorf("Couldn't set modification time: %s\n%s", filename, err)
+		}
+	})
+
+	When(`^I run "(.+?)"$`, func(s1 string) {
+		args := strings.Split(s1, " ")
+		o := threadSafeWriter{&out, sync.Mutex{}}
+		lastExitCode = s3.Main(conn, args, &o)
+	})
+
+	When(`^I run "(.+?)" with errors apart$`, func(s1 string) {
+		args := strings.Split(s1, " ")
+		o := threadSafeWriter{&out, sync.Mutex{}}
+		e := threadSafeWriter{&errOut, sync.Mutex{}}
+		lastExitCode = s3.MainStreams(conn, args, s3.Streams{Out: &o, Err: &e})
+	})
+
+	When(`^I run "(.+?)" and "(.+?)" at once$`, func(s1 string, s2 string) {
+		// several times over, each run writing to its own buffer, which
+		// must all come out the same for each command
+		const runs = 10
+		var outputs [2][runs]bytes.Buffer
+		var wg sync.WaitGroup
+		for i := 0; i < runs; i++ {
+			for j, cmd := range []string{s1, s2} {
+				wg.Add(1)
+				go func(j, i int, args []string) {
+					defer wg.Done()
+					s3.Main(conn, args, &outputs[j][i])
+				}(j, i, strings.Split(cmd, " "))
+			}
+		}
+		wg.Wait()
+		for j, cmd := range []string{s1, s2} {
+			for i := 1; i < runs; i++ {
+				if outputs[j][i].String() != outputs[j][0].String() {
+					T.Errorf("Runs of %s differ:\n%s\nand:\n%s", cmd, outputs[j][0].String(), outputs[j][i].String())
+				}
+			}
+		}
+		out.Write(outputs[0][0].Bytes())
+		otherOut.Write(outputs[1][0].Bytes())
+	})
+
+	When(`^I run "(.+?)" against the fake server$`, func(s1 string) {
+		o := threadSafeWriter{&out, sync.Mutex{}}
+		start := time.Now()
+		lastExitCode = s3.Main(nil, fakeServerArgs(s1), &o)
+		lastRunTime = time.Since(start)
+	})
+
+	When(`^I run "(.+?)" with a connection of its own$`, func(s1 string) {
+		setFakeCredentials()
+		o := threadSafeWriter{&out, sync.Mutex{}}
+		lastExitCode = s3.Main(nil, strings.Split(s1, " "), &o)
+	})
+
+	When(`^I run "(.+?)" against the fake server and interrupt it$`, func(s1 string) {
+		// caught here too, should the command have stopped catching it
+		caught := make(chan os.Signal, 1)
+		signal.Notify(caught, os.Interrupt)
+		defer signal.Stop(caught)
+		o := threadSafeWriter{&out, sync.Mutex{}}
+		exited := make(chan int)
+		go func() {
+			exited <- s3.Main(nil, fakeServerArgs(s1), &o)
+		}()
+		time.Sleep(300 * time.Millisecond)
+		syscall.Kill(os.Getpid(), syscall.SIGINT)
+		lastExitCode = <-exited
+	})
+
+	When(`^I run "(.+?)" against the fake server and scrape its metrics after (\S+)$`, func(s1 string, delay string) {
+		d, err := time.ParseDuration(delay)
+		if err != nil {
+			T.Errorf("Bad delay: %s", err)
+			return
+		}
+		args := fakeServerArgs(s1)
+		var addr string
+		for i, arg := range args {
+			if arg == "--metrics-listen" && i+1 < len(args) {
+				addr = args[i+1]
+			}
+		}
+		o := threadSafeWriter{&out, sync.Mutex{}}
+		exited := make(chan int)
+		go func() {
+			exited <- s3.Main(nil, args, &o)
+		}()
+		time.Sleep(d)
+		resp, err := http.Get("http://" + addr + "/metrics")
+		if err != nil {
+			T.Errorf("Couldn't scrape metrics: %s", err)
+		} else {
+			io.Copy(&o, resp.Body)
+			resp.Body.Close()
+		}
+		lastExitCode = <-exited
+	})
+
+	When(`^I complete the incomplete upload of bucket "(.+?)" key "(.+?)"(| with its parts reversed| naming a part by a wrong ETag)$`, func(bucket string, key string, how string) {
+		ctx := context.Background()
+		err := func() error {
+			uploads, err := conn.ListMultipartUploads(ctx, &awss3.ListMultipartUploadsInput{Bucket: aws.String(bucket), Prefix: aws.String(key)})
+			if err != nil {
+				return err
+			}
+			if len(uploads.Uploads) == 0 {
+				return fmt.Errorf("no incomplete upload of %s", key)
+			}
+			id := uploads.Uploads[0].UploadId
+			parts, err := conn.ListParts(ctx, &awss3.ListPartsInput{Bucket: aws.String(bucket), Key: aws.String(key), UploadId: id})
+			if err != nil {
+				return err
+			}
+			var completed []types.CompletedPart
+			for _, part := range parts.Parts {
+				completed = append(completed, types.CompletedPart{ETag: part.ETag, PartNumber: part.PartNumber})
+			}
+			switch how {
+			case " with its parts reversed":
+				sort.Slice(completed, func(i, j int) bool {
+					return aws.ToInt32(completed[i].PartNumber) > aws.ToInt32(completed[j].PartNumber)
+				})
+			case " naming a part by a wrong ETag":
+				completed[0].ETag = aws.String(`"00000000000000000000000000000000"`)
+			}
+			_, err = conn.CompleteMultipartUpload(ctx, &awss3.CompleteMultipartUploadInput{
+				Bucket:          aws.String(bucket),
+				Key:             aws.String(key),
+				UploadId:        id,
+				MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+			})
+			return err
+		}()
+		lastExitCode = 0
+		if err != nil {
+			fmt.Fprintf(&out, "Error: %s\n", err)
+			lastExitCode = 1
+		}
+	})
+
+	When(`^I put local file "(.+?)" to "(.+?)" in parts of (\d+) bytes, interrupted once a part is sent$`, func(filename string, dest string, partSize int) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		opts := s3.PutOptions{Multipart: true}
+		opts.Parallel = 1
+		opts.Quiet = true
+		opts.Parts.Size = int64(partSize)
+		parts := interruptingMys3{mys3.NewFromAPI(conn), cancel}
+		err := s3.RunPut(ctx, conn, parts, []string{filename}, dest, opts)
+		lastExitCode = 0
+		if err != nil {
+			fmt.Fprintf(&out, "Error: %s\n", err)
+			lastExitCode = 1
+		}
+	})
+
+	When(`^I sync "(.+?)" to "(.+?)" with a canceled context$`, func(src string, dest string) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		opts := s3.SyncOptions{}
+		opts.Parallel = 1
+		opts.Quiet = true
+		err := s3.RunSync(ctx, conn, mys3.NewFromAPI(conn), src, dest, opts)
+		lastExitCode = 0
+		if err != nil {
+			fmt.Fprintf(&out, "Error: %s\n", err)
+			lastExitCode = 1
+		}
+	})
+
+	Then(`^local file "(.+?)" has contents "(.+?)"$`, func(filename string, exp string) {
+		file, err := os.Open(filename)
+		if err != nil {
+			T.Errorf("Local file error:\n%s", err)
+			return
+		}
+		defer file.Close()
+		content, err := ioutil.ReadAll(file)
+		if err != nil {
+			T.Errorf("Local file error:\n%s", err)
+			return
+		}
+		act := string(content)
+		if act != exp {
+			T.Errorf("%s contents expected:\n%s\ngot:\n%s", filename, exp, act)
+		}
+	})
+
+	Then(`^local file "(.+?)" includes "(.+?)"$`, func(filename string, exp string) {
+		content, err := ioutil.ReadFile(filename)
+		if err != nil {
+			T.Errorf("Local file error:\n%s", err)
+			return
+		}
+		act := string(content)
+		if !strings.Contains(act, exp) {
+			T.Errorf("%s does not include:\n%s\ngot:\n%s", filename, exp, act)
+		}
+	})
+
+	Then(`^local file "(.+?)" was last modified "(.+?)"$`, func(filename string, exp string) {
+		info, err := os.Stat(filename)
+		if err != nil {
+			T.Errorf("Local file error:\n%s", err)
+			return
+		}
+		act := info.ModTime().UTC().Format(time.RFC3339)
+		if act != exp {
+			T.Errorf("%s modified expected:\n%s\ngot:\n%s", filename, exp, act)
+		}
+	})
+
+	Then(`^local file "(.+?)" is empty$`, func(filename string) {
+		info, err := os.Stat(filename)
+		if err != nil {
+			T.Errorf("Local file error:\n%s", err)
+			return
+		}
+		if info.Size() != 0 {
+			T.Errorf("Local file %s is %d bytes long", filename, info.Size())
+		}
+	})
+
+	Then(`^local file "(.+?)" exists$`, func(filename string) {
+		if _, err := os.Lstat(filename); err != nil {
+			T.Errorf("Local file error:\n%s", err)
+		}
+	})
+
+	Then(`^local file "(.+?)" does not exist$`, func(filename string) {
+		if _, err := os.Lstat(filename); !os.IsNotExist(err) {
+			T.Errorf("Local file %s exists", filename)
+		}
+	})
+
+	Then(`^local file "(.+?)" has mode "(.+?)"$`, func(filename string, exp string) {
+		info, err := os.Stat(filename)
+		if err != nil {
+			T.Errorf("Local file error:\n%s", err)
+			return
+		}
+		act := strconv.FormatUint(uint64(info.Mode().Perm()), 8)
+		if act != exp {
+			T.Errorf("%s mode expected:\n%s\ngot:\n%s", filename, exp, act)
+		}
+	})
+
+	Then(`^bucket "(.+?)" key "(.+?)" has metadata "(.+?)" of "(.+?)"$`, func(bucket string, key string, name string, exp string) {
+		input := awss3.HeadObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+		}
+		output, err := conn.HeadObject(context.Background(), &input)
+		if err != nil {
+			T.Errorf("Bucket %s Key %s error:\n%s", bucket, key, err)
+			return
+		}
+		act := output.Metadata[name]
+		if act != exp {
+			T.Errorf("%s Key %s metadata %s expected:\n%s\ngot:\n%s", bucket, key, name, exp, act)
+		}
+	})
+
+	Then(`^the other output is "(.*?)"$`, func(exp string) {
+		exp = replacer.Replace(exp)
+		act := otherOut.String()
+		if act != exp {
+			T.Errorf("Other output expected:\n%s\ngot:\n%s", exp, act)
+		}
+	})
+
+	Then(`^the output is "(.*?)"$`, func(exp string) {
+		// replace newlines
+		exp = replacer.Replace(exp)
+		act := string(out.Bytes())
+		if act != exp {
+			T.Errorf("Output expected:\n%s\ngot:\n%s", exp, act)
+		}
+	})
+
+	Then(`^the output contains "(.*?)"$`, func(exp string) {
+		// replace newlines
+		exp = replacer.Replace(exp)
+		act := string(out.Bytes())
+		if !strings.Contains(act, exp) {
+			T.Errorf("Output does not contain:\n%s\ngot:\n%s", exp, act)
+		}
+	})
+
+	Then(`^the output contains "(.*?)" (\d+) times?$`, func(exp string, n int) {
+		exp = replacer.Replace(exp)
+		act := string(out.Bytes())
+		if count := strings.Count(act, exp); count != n {
+			T.Errorf("Output contains %d times, not %d:\n%s\ngot:\n%s", count, n, exp, act)
+		}
+	})
+
+	Then(`^the error output contains "(.*?)"$`, func(exp string) {
+		exp = replacer.Replace(exp)
+		act := string(errOut.Bytes())
+		if !strings.Contains(act, exp) {
+			T.Errorf("Error output does not contain:\n%s\ngot:\n%s", exp, act)
+		}
+	})
+
+	Then(`^the error output is empty$`, func() {
+		if errOut.Len() > 0 {
+			T.Errorf("Error output unexpectedly:\n%s", errOut.String())
+		}
+	})
+
+	Then(`^the output does not contain "(.*?)"$`, func(exp string) {
+		exp = replacer.Replace(exp)
+		act := string(out.Bytes())
+		if strings.Contains(act, exp) {
+			T.Errorf("Output unexpectedly contains:\n%s\ngot:\n%s", exp, act)
+		}
+	})
+
+	Then(`^the output is not "(.*?)"$`, func(exp string) {
+		exp = replacer.Replace(exp)
+		act := string(out.Bytes())
+		if act == exp {
+			T.Errorf("Output unexpectedly:\n%s", act)
+		}
+	})
+
+	When(`^I sync "(.+?)" to "(.+?)" with a client$`, func(src, dest string) {
+		opts := s3.SyncOptions{CommonOptions: s3.CommonOptions{Parallel: 4}}
+		lastResult, lastErr = s3.NewClient(conn).Sync(context.Background(), src, dest, opts)
+	})
+
+	When(`^I sync "(.+?)" to "(.+?)" with a client and a canceled context$`, func(src, dest string) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		opts := s3.SyncOptions{CommonOptions: s3.CommonOptions{Parallel: 4}}
+		lastResult, lastErr = s3.NewClient(conn).Sync(ctx, src, dest, opts)
+	})
+
+	When(`^I put "(.+?)" to "(.+?)" with a client$`, func(src, dest string) {
+		opts := s3.PutOptions{CommonOptions: s3.CommonOptions{Parallel: 4}}
+		lastResult, lastErr = s3.NewClient(conn).Put(context.Background(), []string{src}, dest, opts)
+	})
+
+	When(`^I get "(.+?)" with a client$`, func(url string) {
+		opts := s3.GetOptions{CommonOptions: s3.CommonOptions{Parallel: 4}}
+		lastResult, lastErr = s3.NewClient(conn).Get(context.Background(), []string{url}, opts)
+	})
+
+	When(`^I remove "(.+?)" with a client$`, func(url string) {
+		opts := s3.RmOptions{CommonOptions: s3.CommonOptions{Parallel: 4}}
+		lastResult, lastErr = s3.NewClient(conn).Remove(context.Background(), []string{url}, opts)
+	})
+
+	When(`^I list "(.+?)" with a client$`, func(url string) {
+		opts := s3.ListOptions{CommonOptions: s3.CommonOptions{Parallel: 4}}
+		lastRecords, lastErr = s3.NewClient(conn).List(context.Background(), []string{url}, opts)
+	})
+
+	When(`^I log in to AWS SSO with profile "(.+?)"$`, func(profile string) {
+		o := threadSafeWriter{&out, sync.Mutex{}}
+		lastErr = s3.SSOLogin(context.Background(), profile, ssoService, &o, s3.MockSSOSecond)
+	})
+
+	Then(`^AWS SSO was logged in (\d+) times?$`, func(n int) {
+		if lastErr != nil {
+			T.Errorf("Login failed: %s", lastErr)
+			return
+		}
+		if act := ssoService.Logins(); act != n {
+			T.Errorf("Logins expected: %d got: %d", n, act)
+		}
+	})
+
+	Then(`^the mock AWS SSO service was polled (\d+) times$`, func(n int) {
+		if act := len(ssoService.PollIntervals()) + 1; act != n {
+			T.Errorf("Polls expected: %d got: %d", n, act)
+		}
+	})
+
+	Then(`^the mock AWS SSO service was polled more slowly after asking to slow down$`, func() {
+		intervals := ssoService.PollIntervals()
+		if len(intervals) < 2 || intervals[len(intervals)-1] <= intervals[0] {
+			T.Errorf("Polls didn't slow down: %v", intervals)
+		}
+	})
+
+	Then(`^the AWS SSO token of "(.+?)" is cached as "(.+?)"$`, func(startURL string, exp string) {
+		data, err := ioutil.ReadFile(ssoTokenPath(startURL))
+		if err != nil {
+			T.Errorf("Token not cached: %s", err)
+			return
+		}
+		if !strings.Contains(string(data), fmt.Sprintf(`"accessToken":%q`, exp)) {
+			T.Errorf("Token expected: %s got:\n%s", exp, data)
+		}
+	})
+
+	Then(`^the client's result is "(.+?)"$`, func(exp string) {
+		if lastErr != nil {
+			T.Errorf("Client failed: %s", lastErr)
+			return
+		}
+		act := fmt.Sprintf("%d added %d deleted %d updated %d unchanged %d bytes",
+			lastResult.Added, lastResult.Deleted, lastResult.Updated, lastResult.Unchanged, lastResult.Bytes)
+		if act != exp {
+			T.Errorf("Result expected:\n%s\ngot:\n%s", exp, act)
+		}
+	})
+
+	Then(`^the client listed "(.+?)"$`, func(exp string) {
+		if lastErr != nil {
+			T.Errorf("Client failed: %s", lastErr)
+			return
+		}
+		var urls []string
+		for _, record := range lastRecords {
+			if record.Type == "summary" {
+				urls = append(urls, fmt.Sprintf("%d files, %d bytes", *record.Count, *record.Size))
+			} else {
+				urls = append(urls, record.URL)
+			}
+		}
+		if act := strings.Join(urls, " "); act != exp {
+			T.Errorf("Listing expected:\n%s\ngot:\n%s", exp, act)
+		}
+	})
+
+	Then(`^the client failed with "(.+?)"$`, func(exp string) {
+		if lastErr == nil || !strings.Contains(lastErr.Error(), exp) {
+			T.Errorf("Client error expected:\n%s\ngot:\n%v", exp, lastErr)
+		}
+	})
+
+	Then(`^the exit code is (\d+?)$`, func(code int) {
+		if code != lastExitCode {
+			T.Errorf("Exit code expected:\n%d\ngot:\n%d", code, lastExitCode)
+		}
+	})
+
+	Then(`^it took (at least|less than) "(.+?)"$`, func(bound string, limit string) {
+		d, err := time.ParseDuration(limit)
+		if err != nil {
+			T.Errorf("Bad duration: %s", err)
+			return
+		}
+		if (bound == "at least") != (lastRunTime >= d) {
+			T.Errorf("Expected to take %s %s, took %s", bound, d, lastRunTime)
+		}
+	})
+
+	Then(`^the bucket "(.+?)" exists$`, func(bucket string) {
+		if !bucketExists(bucket) {
+			T.Errorf("Bucket %s does not exist", bucket)
+		}
+	})
+
+	Then(`^versioning is enabled on bucket "(.+?)"$`, func(bucket string) {
+		output, err := conn.GetBucketVersioning(context.Background(), &awss3.GetBucketVersioningInput{Bucket: aws.String(bucket)})
+		if err != nil {
+			T.Errorf("Couldn't get versioning: %s\n%s", bucket, err)
+			return
+		}
+		if act := output.Status; act != types.BucketVersioningStatusEnabled {
+			T.Errorf("Versioning expected: %s got: %s", types.BucketVersioningStatusEnabled, act)
+		}
+	})
+
+	Then(`^object lock is enabled on bucket "(.+?)"$`, func(bucket string) {
+		output, err := conn.GetObjectLockConfiguration(context.Background(), &awss3.GetObjectLockConfigurationInput{Bucket: aws.String(bucket)})
+		if err != nil {
+			T.Errorf("Couldn't get object lock: %s\n%s", bucket, err)
+			return
+		}
+		if act := output.ObjectLockConfiguration.ObjectLockEnabled; act != types.ObjectLockEnabledEnabled {
+			T.Errorf("Object lock expected: %s got: %s", types.ObjectLockEnabledEnabled, act)
+		}
+	})
+
+	Then(`^the bucket "(.+?)" is in region "(.+?)"$`, func(bucket string, exp string) {
+		output, err := conn.GetBucketLocation(context.Background(), &awss3.GetBucketLocationInput{Bucket: aws.String(bucket)})
+		if err != nil {
+			T.Errorf("Couldn't get location: %s\n%s", bucket, err)
+			return
+		}
+		// S3 gives no location for us-east-1
+		act := string(output.LocationConstraint)
+		if act == "" {
+			act = "us-east-1"
+		}
+		if act != exp {
+			T.Errorf("Region expected: %s got: %s", exp, act)
+		}
+	})
+
+	Then(`^the bucket "(.+?)" does not exist$`, func(bucket string) {
+		if bucketExists(bucket) {
+			T.Errorf("Bucket %s exists", bucket)
+		}
+	})
+
+	Then(`^bucket "(.+?)" has key "(.+?)" with contents "(.+?)"$`, func(bucket string, key string, exp string) {
+		input := awss3.GetObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+		}
+		output, err := conn.GetObject(context.Background(), &input)
+		if err != nil {
+			T.Errorf("Bucket %s Key %s error:\n%s", bucket, key, err)
+			return
+		}
+		content, err := ioutil.ReadAll(output.Body)
+		if err != nil {
+			T.Errorf("Bucket %s Key %s error:\n%s", bucket, key, err)
+			return
+		}
+		act := string(content)
+		if act != exp {
+			T.Errorf("%s Key %s contents expected:\n%s\ngot:\n%s", bucket, key, exp, act)
+			return
+		}
+	})
+
+	Then(`^bucket "(.+?)" key "(.+?)" matches local file "(.+?)"$`, func(bucket string, key string, filename string) {
+		exp, err := ioutil.ReadFile(filename)
+		if err != nil {
+			T.Errorf("Couldn't read file: %s\n%s", filename, err)
+			return
+		}
+		output, err := conn.GetObject(context.Background(), &awss3.GetObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			T.Errorf("Bucket %s Key %s error:\n%s", bucket, key, err)
+			return
+		}
+		act, err := ioutil.ReadAll(output.Body)
+		if err != nil {
+			T.Errorf("Bucket %s Key %s error:\n%s", bucket, key, err)
+			return
+		}
+		if !bytes.Equal(act, exp) {
+			T.Errorf("%s Key %s contents differ from %s (%d bytes, expected %d)", bucket, key, filename, len(act), len(exp))
+		}
+	})
+
+	Then(`^bucket "(.+?)" key "(.+?)" exists$`, func(bucket string, key string) {
+		input := awss3.GetObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+		}
+		_, err := conn.GetObject(context.Background(), &input)
+		if err != nil {
+			T.Errorf("Bucket %s Key %s does not exist", bucket, key)
+		}
+	})
+
+	Then(`^bucket "(.+?)" key "(.+?)" has storage class "(.+?)"$`, func(bucket string, key string, exp string) {
+		head, err := conn.HeadObject(context.Background(), &awss3.HeadObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			T.Errorf("Bucket %s Key %s does not exist", bucket, key)
+			return
+		}
+		// STANDARD is not returned by head
+		storageClass := string(head.StorageClass)
+		if storageClass == "" {
+			storageClass = string(types.StorageClassStandard)
+		}
+		if storageClass != exp {
+			T.Errorf("Storage class expected: %s got: %s", exp, storageClass)
+		}
+	})
+
+	Then(`^bucket "(.+?)" key "(.+?)" is encrypted with "(.+?)"( using key "(.+?)")?$`, func(bucket string, key string, exp string, _ string, expKey string) {
+		head, err := conn.HeadObject(context.Background(), &awss3.HeadObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			T.Errorf("Bucket %s Key %s does not exist", bucket, key)
+			return
+		}
+		if act := string(head.ServerSideEncryption); act != exp {
+			T.Errorf("Encryption expected: %s got: %s", exp, act)
+		}
+		if act := aws.ToString(head.SSEKMSKeyId); act != expKey {
+			T.Errorf("KMS key expected: %s got: %s", expKey, act)
+		}
+	})
+
+	Then(`^bucket "(.+?)" key "(.+?)" has header "(.+?)" of "(.*?)"$`, func(bucket string, key string, name string, exp string) {
+		head, err := conn.HeadObject(context.Background(), &awss3.HeadObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			T.Errorf("Bucket %s Key %s does not exist", bucket, key)
+			return
+		}
+		headers := map[string]*string{
+			"Cache-Control":       head.CacheControl,
+			"Content-Encoding":    head.ContentEncoding,
+			"Content-Disposition": head.ContentDisposition,
+			"Content-Type":        head.ContentType,
+
+			"X-Amz-Object-Lock-Mode":       aws.String(string(head.ObjectLockMode)),
+			"X-Amz-Object-Lock-Legal-Hold": aws.String(string(head.ObjectLockLegalHoldStatus)),
+		}
+		if head.ObjectLockRetainUntilDate != nil {
+			headers["X-Amz-Object-Lock-Retain-Until-Date"] = aws.String(head.ObjectLockRetainUntilDate.UTC().Format(time.RFC3339))
+		}
+		if act := aws.ToString(headers[name]); act != exp {
+			T.Errorf("%s expected: %s got: %s", name, exp, act)
+		}
+	})
+
+	Then(`^bucket "(.+?)" key "(.+?)" (was|was not) uploaded in parts$`, func(bucket string, key string, was string) {
+		head, err := conn.HeadObject(context.Background(), &awss3.HeadObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			T.Errorf("Bucket %s Key %s does not exist", bucket, key)
+			return
+		}
+		// multipart uploads have an etag of "<md5>-<parts>"
+		multipart := strings.Contains(aws.ToString(head.ETag), "-")
+		if multipart != (was == "was") {
+			T.Errorf("Key %s %s expected to be uploaded in parts, etag: %s", key, was, aws.ToString(head.ETag))
+		}
+	})
+
+	Then(`^bucket "(.+?)" key "(.+?)" has tags "(.*?)"$`, func(bucket string, key string, exp string) {
+		output, err := conn.GetObjectTagging(context.Background(), &awss3.GetObjectTaggingInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			T.Errorf("Couldn't get tags: %s\n%s", key, err)
+			return
+		}
+		var pairs []string
+		for _, tag := range output.TagSet {
+			pairs = append(pairs, aws.ToString(tag.Key)+"="+aws.ToString(tag.Value))
+		}
+		sort.Strings(pairs)
+		if act := strings.Join(pairs, " "); act != exp {
+			T.Errorf("Tags expected: %s got: %s", exp, act)
+		}
+	})
+
+	Then(`^bucket "(.+?)" has (\d+) incomplete uploads?$`, func(bucket string, exp int) {
+		output, err := conn.ListMultipartUploads(context.Background(), &awss3.ListMultipartUploadsInput{Bucket: aws.String(bucket)})
+		if err != nil {
+			T.Errorf("Bucket %s error:\n%s", bucket, err)
+			return
+		}
+		if act := len(output.Uploads); act != exp {
+			T.Errorf("Incomplete uploads expected: %d got: %d", exp, act)
+		}
+	})
+
+	Then(`^bucket "(.+?)" key "(.+?)" has versions "(.*?)"$`, func(bucket string, key string, exp string) {
+		output, err := conn.ListObjectVersions(context.Background(), &awss3.ListObjectVersionsInput{
+			Bucket: aws.String(bucket),
+			Prefix: aws.String(key),
+		})
+		if err != nil {
+			T.Errorf("Couldn't list versions: %s\n%s", key, err)
+			return
+		}
+		var versions []string
+		for _, version := range output.Versions {
+			if *version.Key == key {
+				versions = append(versions, *version.VersionId)
+			}
+		}
+		for _, marker := range output.DeleteMarkers {
+			if *marker.Key == key {
+				versions = append(versions, *marker.VersionId+" (delete marker)")
+			}
+		}
+		sort.Strings(versions)
+		if act := strings.Join(versions, " "); act != exp {
+			T.Errorf("Versions expected: %s got: %s", exp, act)
 		}
 	})
 
@@ -251,7 +1422,7 @@ func init() {
 			Bucket: aws.String(bucket),
 			Key:    aws.String(key),
 		}
-		_, err := conn.GetObject(&input)
+		_, err := conn.GetObject(context.Background(), &input)
 		if err == nil {
 			T.Errorf("Bucket %s Key %s exists", bucket, key)
 		}
@@ -13,6 +13,43 @@ Feature: sync command
     And the output contains "A banana\n"
     And the output contains "1 added 0 deleted 1 updated 0 unchanged\n"
 
+  Scenario: sync -v logs what's done with each file, and why
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "orange"
+    And bucket "s3.barnybug.github.com" key "cherry" contains "CHERRY"
+    And bucket "s3.barnybug.github.com" key "date" contains "DATE"
+    And local file "apple" contains "APPLE"
+    And local file "banana" contains "BANANA"
+    And local file "cherry" contains "CHERRY"
+    When I run "s3 -v sync . s3://s3.barnybug.github.com/"
+    Then the output contains "update apple: size 5 differs from 6\n"
+    And the output contains "add banana: not in the destination\n"
+    And the output contains "unchanged cherry: same size and md5\n"
+    And the output contains "leave date: not in the source, without --delete or left out by the filter\n"
+    And the exit code is 0
+
+  Scenario: sync -v --log-format json logs a record of each decision
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "banana" contains "BANANA"
+    When I run "s3 -v --log-format json sync . s3://s3.barnybug.github.com/"
+    Then the output contains ""level":"info","msg":"not in the destination","operation":"add","key":"banana"}"
+    And the output contains ""operation":"create","key":"banana","bytes":6"
+    And the exit code is 0
+
+  Scenario: sync -v logs apart from the output
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "banana" contains "BANANA"
+    When I run "s3 -v sync . s3://s3.barnybug.github.com/" with errors apart
+    Then the output contains "A banana\n"
+    And the output does not contain "not in the destination"
+    And the error output contains "add banana: not in the destination\n"
+
+  Scenario: sync logs no decisions without -v
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    When I run "s3 sync . s3://s3.barnybug.github.com/"
+    Then the output does not contain "not in the destination"
+
   Scenario: I can sync local to S3 deletes
     Given I have bucket "s3.barnybug.github.com"
     And bucket "s3.barnybug.github.com" key "banana" contains "BANANA"
@@ -23,6 +60,54 @@ Feature: sync command
     And the output contains "D banana\n"
     And the output contains "1 added 1 deleted 0 updated 0 unchanged\n"
 
+  Scenario: sync --delete removes keys in batches
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" has 2500 keys under "backup/old"
+    And local file "dir/apple" contains "APPLE"
+    When I run "s3 -q sync --delete dir/ s3://s3.barnybug.github.com/backup/"
+    Then the exit code is 0
+    And bucket "s3.barnybug.github.com" has key "backup/apple" with contents "APPLE"
+    And bucket "s3.barnybug.github.com" key "backup/old00000" does not exist
+    And bucket "s3.barnybug.github.com" key "backup/old02499" does not exist
+    And the output contains "1 added 2500 deleted 0 updated 0 unchanged\n"
+
+  Scenario: sync --delete --ignore-errors records keys S3 refuses to delete
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "banana" contains "BANANA"
+    And bucket "s3.barnybug.github.com" key "cherry" contains "CHERRY"
+    And bucket "s3.barnybug.github.com" key "banana" can't be deleted
+    And local file "dir/apple" contains "APPLE"
+    When I run "s3 --ignore-errors sync --delete --failures-file failed.json dir/ s3://s3.barnybug.github.com/"
+    Then the output contains "E banana: api error AccessDenied"
+    And the output contains "1 failed\n"
+    And local file "failed.json" includes ""action": "delete""
+    And bucket "s3.barnybug.github.com" key "banana" exists
+    And bucket "s3.barnybug.github.com" key "cherry" does not exist
+
+  Scenario: sync --delete --confirm-over asks before deleting more files
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "banana" contains "BANANA"
+    And bucket "s3.barnybug.github.com" key "cherry" contains "CHERRY"
+    And local file "dir/apple" contains "APPLE"
+    And standard input contains "n\n"
+    When I run "s3 sync --delete --confirm-over 1 dir/ s3://s3.barnybug.github.com/"
+    Then the output contains "delete 2 files from s3://s3.barnybug.github.com/? [y/N]"
+    And the output contains "not confirmed, nothing removed"
+    And the exit code is 1
+    And bucket "s3.barnybug.github.com" has key "apple" with contents "APPLE"
+    And bucket "s3.barnybug.github.com" key "banana" exists
+    And bucket "s3.barnybug.github.com" key "cherry" exists
+
+  Scenario: sync --delete -i deletes once confirmed
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "banana" contains "BANANA"
+    And local file "dir/apple" contains "APPLE"
+    And standard input contains "y\n"
+    When I run "s3 sync --delete -i dir/ s3://s3.barnybug.github.com/"
+    Then the exit code is 0
+    And the output contains "D banana\n"
+    And bucket "s3.barnybug.github.com" key "banana" does not exist
+
   Scenario: I can sync S3 to local
     Given I have bucket "s3.barnybug.github.com"
     And bucket "s3.barnybug.github.com" key "apple" contains "APPLE"
@@ -64,3 +149,303 @@ Feature: sync command
     Given I have bucket "s3.barnybug.github.com"
     When I run "s3 sync s3://s3.barnybug.github.com/ s3://s3b.barnybug.github.com/"
     Then the exit code is 1
+
+  Scenario: I can sync local to S3 following symlinks
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "dir/apple" contains "APPLE"
+    And local symlink "dir/link" points to "apple"
+    When I run "s3 sync --follow-symlinks dir s3://s3.barnybug.github.com/"
+    Then bucket "s3.barnybug.github.com" has key "dir/link" with contents "APPLE"
+
+  Scenario: I can sync waiting for uploads to become visible
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" shows new keys after 1 checks
+    And local file "dir/apple" contains "APPLE"
+    When I run "s3 sync --verify-visibility dir s3://s3.barnybug.github.com/"
+    Then the exit code is 0
+    And bucket "s3.barnybug.github.com" has key "dir/apple" with contents "APPLE"
+
+  Scenario: I can cap the number of files a sync transfers
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "dir/apple" contains "APPLE"
+    And local file "dir/banana" contains "BANANA"
+    And local file "dir/cherry" contains "CHERRY"
+    When I run "s3 sync --max-total-files 2 dir s3://s3.barnybug.github.com/"
+    Then bucket "s3.barnybug.github.com" has key "dir/apple" with contents "APPLE"
+    And bucket "s3.barnybug.github.com" has key "dir/banana" with contents "BANANA"
+    And bucket "s3.barnybug.github.com" key "dir/cherry" does not exist
+    And the output contains "quota reached after 2 files (11 bytes): 1 files (6 bytes) not transferred"
+
+  Scenario: I can cap the bytes a sync transfers
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "dir/apple" contains "APPLE"
+    And local file "dir/banana" contains "BANANA"
+    And local file "dir/cherry" contains "CHERRY"
+    When I run "s3 sync --max-total-bytes 10 dir s3://s3.barnybug.github.com/"
+    Then bucket "s3.barnybug.github.com" has key "dir/apple" with contents "APPLE"
+    And bucket "s3.barnybug.github.com" key "dir/banana" does not exist
+    And the output contains "1 added 0 deleted 0 updated 0 unchanged"
+    And the output contains "2 files (12 bytes) not transferred"
+
+  Scenario: sync --delete keeps paths listed in the destination's .s3keep
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key ".s3keep" contains "backups/\n*.lock"
+    And bucket "s3.barnybug.github.com" key "backups/db" contains "DB"
+    And bucket "s3.barnybug.github.com" key "run.lock" contains "LOCK"
+    And bucket "s3.barnybug.github.com" key "old" contains "OLD"
+    And local file "apple" contains "APPLE"
+    When I run "s3 sync --delete . s3://s3.barnybug.github.com/"
+    Then bucket "s3.barnybug.github.com" key "old" does not exist
+    And bucket "s3.barnybug.github.com" key "backups/db" exists
+    And bucket "s3.barnybug.github.com" key "run.lock" exists
+    And bucket "s3.barnybug.github.com" key ".s3keep" exists
+    And the output contains "K backups/db\n"
+    And the output contains "1 added 1 deleted 0 updated 0 unchanged\n"
+
+  Scenario: sync --delete keeps paths matching --protect
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "dir/apple" contains "APPLE"
+    And bucket "s3.barnybug.github.com" key "dir/banana" contains "BANANA"
+    And local file "folder1/dir/apple" contains "APPLE"
+    And local file "folder1/dir/banana" contains "BANANA"
+    And local file "folder1/notes.txt" contains "NOTES"
+    And local file "folder1/scratch" contains "SCRATCH"
+    When I run "s3 sync --delete --protect *.txt s3://s3.barnybug.github.com/ folder1/"
+    Then local file "folder1/notes.txt" has contents "NOTES"
+    And local file "folder1/scratch" does not exist
+    And the output contains "K notes.txt\n"
+
+  Scenario: sync --exclude leaves out matching local files
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    And local file "debug.log" contains "LOG"
+    When I run "s3 sync --exclude *.log . s3://s3.barnybug.github.com/"
+    Then bucket "s3.barnybug.github.com" has key "apple" with contents "APPLE"
+    And bucket "s3.barnybug.github.com" key "debug.log" does not exist
+
+  Scenario: sync --storage-class sets the storage class of uploads
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    When I run "s3 sync --storage-class GLACIER_IR . s3://s3.barnybug.github.com/"
+    Then bucket "s3.barnybug.github.com" key "apple" has storage class "GLACIER_IR"
+
+  Scenario: sync --sse encrypts uploads
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    When I run "s3 sync --sse aws:kms . s3://s3.barnybug.github.com/"
+    Then bucket "s3.barnybug.github.com" key "apple" is encrypted with "aws:kms"
+
+  Scenario: sync --legal-hold holds uploads
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    When I run "s3 sync --legal-hold . s3://s3.barnybug.github.com/"
+    Then bucket "s3.barnybug.github.com" key "apple" has header "X-Amz-Object-Lock-Legal-Hold" of "ON"
+
+  Scenario: sync --tagging tags uploads
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    When I run "s3 sync --tagging env=prod . s3://s3.barnybug.github.com/"
+    Then bucket "s3.barnybug.github.com" key "apple" has tags "env=prod"
+
+  Scenario: sync sets response headers
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    When I run "s3 sync --content-encoding gzip . s3://s3.barnybug.github.com/"
+    Then bucket "s3.barnybug.github.com" key "apple" has header "Content-Encoding" of "gzip"
+
+  Scenario: sync --skip-existing leaves existing local files untouched
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "APPLE"
+    And bucket "s3.barnybug.github.com" key "banana" contains "BANANA"
+    And local file "folder1/apple" contains "OLD APPLE"
+    When I run "s3 sync --skip-existing s3://s3.barnybug.github.com/ folder1/"
+    Then local file "folder1/apple" has contents "OLD APPLE"
+    And local file "folder1/banana" has contents "BANANA"
+    And the output contains "S apple\n"
+    And the output contains "1 added 0 deleted 0 updated 1 unchanged"
+
+  Scenario: sync --newer-only replaces local files older than the key
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "APPLE"
+    And bucket "s3.barnybug.github.com" key "apple" was last modified "2020-01-02T03:04:05Z"
+    And local file "folder1/apple" contains "OLD APPLE"
+    And local file "folder1/apple" is dated "2019-01-01T00:00:00Z"
+    When I run "s3 sync --newer-only s3://s3.barnybug.github.com/ folder1/"
+    Then local file "folder1/apple" has contents "APPLE"
+    And the output contains "U apple\n"
+
+  Scenario: I sync files down with the objects' modification times
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "dir/apple" contains "APPLE"
+    And bucket "s3.barnybug.github.com" key "dir/apple" was last modified "2020-01-02T03:04:05Z"
+    When I run "s3 sync s3://s3.barnybug.github.com/ folder1"
+    Then local file "folder1/dir/apple" was last modified "2020-01-02T03:04:05Z"
+
+  Scenario: I can sync preserving file attributes
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "dir/apple" contains "APPLE"
+    And local file "dir/apple" is mode "600"
+    When I run "s3 sync --preserve dir s3://s3.barnybug.github.com/"
+    Then bucket "s3.barnybug.github.com" key "dir/apple" has metadata "mode" of "600"
+    When I run "s3 sync --preserve s3://s3.barnybug.github.com/ folder1"
+    Then local file "folder1/dir/apple" has mode "600"
+
+  Scenario: I can write a manifest of transferred files
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "dir/apple" contains "APPLE"
+    When I run "s3 sync --manifest out.json dir s3://s3.barnybug.github.com/"
+    Then local file "out.json" includes ""key": "dir/apple""
+    And local file "out.json" includes ""size": 5"
+    And local file "out.json" includes ""md5": "4c462d6dd59d782386bb1cdad0060c70""
+
+  Scenario: I can sync only the keys listed in a manifest
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "dir/apple" contains "APPLE"
+    And local file "dir/banana" contains "BANANA"
+    And local file "list.json" contains "[{"key": "dir/banana"}]"
+    When I run "s3 sync --from-manifest list.json dir s3://s3.barnybug.github.com/"
+    Then bucket "s3.barnybug.github.com" has key "dir/banana" with contents "BANANA"
+    And bucket "s3.barnybug.github.com" key "dir/apple" does not exist
+    And the output contains "1 added 0 deleted 0 updated 0 unchanged\n"
+
+  Scenario: sync treats matching multipart uploads as unchanged
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "APPLE" uploaded in parts of 6000000 bytes
+    And local file "apple" contains "APPLE"
+    When I run "s3 sync . s3://s3.barnybug.github.com/"
+    Then the output contains "0 added 0 deleted 0 updated 1 unchanged\n"
+
+  Scenario: sync updates differing multipart uploads
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "ORANGE" uploaded in parts of 6000000 bytes
+    And local file "apple" contains "APPLES"
+    When I run "s3 sync . s3://s3.barnybug.github.com/"
+    Then bucket "s3.barnybug.github.com" has key "apple" with contents "APPLES"
+    And the output contains "0 added 0 deleted 1 updated 0 unchanged\n"
+
+  Scenario: sync uploads large files in parts, and finds them unchanged after
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "big" is 13000000 bytes long
+    When I run "s3 sync . s3://s3.barnybug.github.com/"
+    Then the exit code is 0
+    And bucket "s3.barnybug.github.com" key "big" matches local file "big"
+    And bucket "s3.barnybug.github.com" key "big" was uploaded in parts
+    And bucket "s3.barnybug.github.com" has 0 incomplete uploads
+    When I run "s3 sync . s3://s3.barnybug.github.com/"
+    Then the output contains "0 added 0 deleted 0 updated 1 unchanged\n"
+
+  Scenario: I can sync with adaptive parallelism
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    And local file "banana" contains "BANANA"
+    When I run "s3 sync --adaptive . s3://s3.barnybug.github.com/"
+    Then bucket "s3.barnybug.github.com" has key "apple" with contents "APPLE"
+    And bucket "s3.barnybug.github.com" has key "banana" with contents "BANANA"
+    And the output contains "2 added 0 deleted 0 updated 0 unchanged\n"
+
+  Scenario: sync --ignore-errors writes failed keys to a retry file
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "x/y" contains "Y"
+    And local file "folder1/x" contains "X"
+    When I run "s3 --ignore-errors sync --failures-file failed.json s3://s3.barnybug.github.com/ folder1"
+    Then the output contains "E x/y: "
+    And the output contains "1 failed\n"
+    And local file "failed.json" includes ""key": "x/y""
+    And local file "failed.json" includes ""action": "create""
+
+  Scenario: sync stops at a failed key without --ignore-errors
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "x/y" contains "Y"
+    And local file "folder1/x" contains "X"
+    When I run "s3 sync --failures-file failed.json s3://s3.barnybug.github.com/ folder1"
+    Then the exit code is 1
+    And the output contains "Error: x/y: "
+    And the output does not contain "-- summary --"
+    And local file "failed.json" includes ""key": "x/y""
+
+  Scenario: sync --retry-file transfers only the failed keys
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "dir/apple" contains "APPLE"
+    And local file "dir/banana" contains "BANANA"
+    And local file "failed.json" contains "[{"key": "dir/banana", "action": "create", "error": "timeout"}]"
+    When I run "s3 sync --retry-file failed.json dir s3://s3.barnybug.github.com/"
+    Then bucket "s3.barnybug.github.com" has key "dir/banana" with contents "BANANA"
+    And bucket "s3.barnybug.github.com" key "dir/apple" does not exist
+    And the output contains "1 added 0 deleted 0 updated 0 unchanged\n"
+
+  Scenario: sync honours .s3ignore at the root of a local source
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "dir/.s3ignore" contains "*.log\nbuild/\n/secret\n!keep.log\n"
+    And local file "dir/apple" contains "APPLE"
+    And local file "dir/debug.log" contains "LOG"
+    And local file "dir/keep.log" contains "KEEP"
+    And local file "dir/build/out.o" contains "OUT"
+    And local file "dir/secret" contains "SECRET"
+    And local file "dir/sub/secret" contains "SUB"
+    When I run "s3 sync dir s3://s3.barnybug.github.com/"
+    Then bucket "s3.barnybug.github.com" has key "dir/apple" with contents "APPLE"
+    And bucket "s3.barnybug.github.com" has key "dir/keep.log" with contents "KEEP"
+    And bucket "s3.barnybug.github.com" has key "dir/sub/secret" with contents "SUB"
+    And bucket "s3.barnybug.github.com" key "dir/debug.log" does not exist
+    And bucket "s3.barnybug.github.com" key "dir/build/out.o" does not exist
+    And bucket "s3.barnybug.github.com" key "dir/secret" does not exist
+
+  Scenario: sync --public drops the acl with a warning on buckets with acls disabled
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" has acls disabled
+    And local file "dir/apple" contains "APPLE"
+    When I run "s3 sync --public dir s3://s3.barnybug.github.com/"
+    Then the output contains "Warning: bucket s3.barnybug.github.com has acls disabled (object ownership BucketOwnerEnforced), ignoring --acl public-read\n"
+    And bucket "s3.barnybug.github.com" has key "dir/apple" with contents "APPLE"
+    And the exit code is 0
+
+  Scenario: sync --strict-acl fails fast on buckets with acls disabled
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" has acls disabled
+    And local file "dir/apple" contains "APPLE"
+    When I run "s3 sync --public --strict-acl dir s3://s3.barnybug.github.com/"
+    Then the output contains "grant access with a bucket policy instead"
+    And bucket "s3.barnybug.github.com" key "dir/apple" does not exist
+    And the exit code is 1
+
+  Scenario: sync accepts bucket-owner-full-control on buckets with acls disabled
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" has acls disabled
+    And local file "dir/apple" contains "APPLE"
+    When I run "s3 sync --acl bucket-owner-full-control dir s3://s3.barnybug.github.com/"
+    Then bucket "s3.barnybug.github.com" has key "dir/apple" with contents "APPLE"
+
+  Scenario: sync can draw a dashboard of transfers
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "apple" contains "APPLE"
+    And local file "banana" contains "BANANA"
+    When I run "s3 --dashboard -p 4 sync . s3://s3.barnybug.github.com/"
+    Then bucket "s3.barnybug.github.com" has key "banana" with contents "BANANA"
+    And the output contains "2/2 files  11B/11B"
+    And the output contains "workers: 0/4 active  0 failed"
+    And the output does not contain "A apple"
+
+  Scenario: sync stops when its context is canceled
+    Given I have bucket "s3.barnybug.github.com"
+    And local file "dir/apple" contains "APPLE"
+    When I sync "dir" to "s3://s3.barnybug.github.com/" with a canceled context
+    Then the output is "Error: context canceled after 0 files (0 bytes)\n"
+    And bucket "s3.barnybug.github.com" key "dir/apple" does not exist
+    And the exit code is 1
+
+  Scenario: sync --newer-than leaves older keys alone on both sides
+    Given I have bucket "s3.barnybug.github.com"
+    And I have bucket "s3b.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "old" contains "OLD"
+    And bucket "s3.barnybug.github.com" key "old" was last modified "2024-06-01T12:00:00Z"
+    And bucket "s3.barnybug.github.com" key "new" contains "NEW"
+    And bucket "s3b.barnybug.github.com" key "old" contains "STALE"
+    And bucket "s3b.barnybug.github.com" key "gone" contains "GONE"
+    And bucket "s3b.barnybug.github.com" key "gone" was last modified "2024-06-01T12:00:00Z"
+    And bucket "s3b.barnybug.github.com" key "orphan" contains "ORPHAN"
+    When I run "s3 sync --delete --newer-than 1d s3://s3.barnybug.github.com/ s3://s3b.barnybug.github.com/"
+    Then the exit code is 0
+    And bucket "s3b.barnybug.github.com" has key "new" with contents "NEW"
+    And bucket "s3b.barnybug.github.com" has key "old" with contents "STALE"
+    And bucket "s3b.barnybug.github.com" has key "gone" with contents "GONE"
+    And bucket "s3b.barnybug.github.com" key "orphan" does not exist
@@ -0,0 +1,37 @@
+@tier
+Feature: tier command
+
+  Scenario: I can transition old keys to another storage class
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "logs/apple" contains "APPLE"
+    And bucket "s3.barnybug.github.com" key "logs/apple" was last modified "2020-01-02T03:04:05Z"
+    And bucket "s3.barnybug.github.com" key "logs/banana" contains "BANANA"
+    When I run "s3 tier --older-than 90d --to GLACIER s3://s3.barnybug.github.com/logs/"
+    Then bucket "s3.barnybug.github.com" key "logs/apple" has storage class "GLACIER"
+    And bucket "s3.barnybug.github.com" has key "logs/apple" with contents "APPLE"
+    And bucket "s3.barnybug.github.com" key "logs/banana" has storage class "STANDARD"
+    And the output is "T s3://s3.barnybug.github.com/logs/apple\n\n1 transitioned 1 skipped\n"
+
+  Scenario: Keys already in the storage class are skipped
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "APPLE"
+    And bucket "s3.barnybug.github.com" key "apple" was last modified "2020-01-02T03:04:05Z"
+    When I run "s3 tier --older-than 90d --to standard_ia s3://s3.barnybug.github.com/"
+    And bucket "s3.barnybug.github.com" key "apple" was last modified "2020-01-02T03:04:05Z"
+    And I run "s3 tier --older-than 90d --to STANDARD_IA s3://s3.barnybug.github.com/"
+    Then bucket "s3.barnybug.github.com" key "apple" has storage class "STANDARD_IA"
+    And the output contains "0 transitioned 1 skipped\n"
+
+  Scenario: Dry run transitions nothing
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "apple" contains "APPLE"
+    And bucket "s3.barnybug.github.com" key "apple" was last modified "2020-01-02T03:04:05Z"
+    When I run "s3 -n tier --to GLACIER s3://s3.barnybug.github.com/"
+    Then bucket "s3.barnybug.github.com" key "apple" has storage class "STANDARD"
+    And the output contains "T s3://s3.barnybug.github.com/apple\n"
+
+  Scenario: An invalid age is an error
+    Given I have bucket "s3.barnybug.github.com"
+    When I run "s3 tier --older-than 90x --to GLACIER s3://s3.barnybug.github.com/"
+    Then the exit code is 1
+    And the output contains "invalid age"
@@ -0,0 +1,19 @@
+@version
+Feature: version command
+
+  Scenario: I can show the version
+    When I run "s3 version"
+    Then the output is "s3 version master\n"
+
+  Scenario: I can show build details and endpoint capabilities
+    Given I have bucket "s3.barnybug.github.com"
+    When I run "s3 version --verbose s3://s3.barnybug.github.com/"
+    Then the output contains "aws-sdk-go-v2: "
+    And the output contains "features: symlinks"
+    And the output contains "  tagging: supported (not configured)\n"
+
+  Scenario: Commands run at once write to their own output
+    Given I have bucket "s3.barnybug.github.com"
+    When I run "s3 version" and "s3 -vv ls" at once
+    Then the output is "s3 version master\n"
+    And the other output is "s3://s3.barnybug.github.com/\n"
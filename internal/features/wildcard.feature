@@ -0,0 +1,53 @@
+@wildcard
+Feature: wildcard key arguments
+
+  Scenario: get expands wildcards
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "logs/2024-06-01.log" contains "JUNE1"
+    And bucket "s3.barnybug.github.com" key "logs/2024-06-02.log" contains "JUNE2"
+    And bucket "s3.barnybug.github.com" key "logs/2024-07-01.log" contains "JULY1"
+    And bucket "s3.barnybug.github.com" key "logs/old/2024-06-03.log" contains "OLD"
+    When I run "s3 get s3://s3.barnybug.github.com/logs/2024-06-*.log"
+    Then local file "2024-06-01.log" has contents "JUNE1"
+    And local file "2024-06-02.log" has contents "JUNE2"
+    And local file "2024-07-01.log" does not exist
+    And local file "old/2024-06-03.log" does not exist
+
+  Scenario: cat expands wildcards
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "logs/2024-06-01.log" contains "JUNE1"
+    And bucket "s3.barnybug.github.com" key "logs/2024-06-02.log" contains "JUNE2"
+    And bucket "s3.barnybug.github.com" key "logs/2024-07-01.log" contains "JULY1"
+    And bucket "s3.barnybug.github.com" key "logs/old/2024-06-03.log" contains "OLD"
+    When I run "s3 cat s3://s3.barnybug.github.com/logs/*/2024-06-0?.log"
+    Then the output is "OLD"
+
+  Scenario: grep expands wildcards
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "logs/2024-06-01.log" contains "JUNE1"
+    And bucket "s3.barnybug.github.com" key "logs/2024-06-02.log" contains "JUNE2"
+    And bucket "s3.barnybug.github.com" key "logs/2024-07-01.log" contains "JULY1"
+    And bucket "s3.barnybug.github.com" key "logs/old/2024-06-03.log" contains "OLD"
+    When I run "s3 grep JU s3://s3.barnybug.github.com/logs/2024-0[7]-*"
+    Then the output is "s3://s3.barnybug.github.com/logs/2024-07-01.log:JULY1\n"
+
+  Scenario: rm expands wildcards
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "logs/2024-06-01.log" contains "JUNE1"
+    And bucket "s3.barnybug.github.com" key "logs/2024-06-02.log" contains "JUNE2"
+    And bucket "s3.barnybug.github.com" key "logs/2024-07-01.log" contains "JULY1"
+    And bucket "s3.barnybug.github.com" key "logs/old/2024-06-03.log" contains "OLD"
+    When I run "s3 rm s3://s3.barnybug.github.com/logs/2024-06-*"
+    Then bucket "s3.barnybug.github.com" key "logs/2024-06-01.log" does not exist
+    And bucket "s3.barnybug.github.com" key "logs/2024-06-02.log" does not exist
+    And bucket "s3.barnybug.github.com" key "logs/2024-07-01.log" exists
+    And bucket "s3.barnybug.github.com" key "logs/old/2024-06-03.log" exists
+
+  Scenario: a wildcard matching nothing is an error
+    Given I have bucket "s3.barnybug.github.com"
+    And bucket "s3.barnybug.github.com" key "logs/2024-06-01.log" contains "JUNE1"
+    And bucket "s3.barnybug.github.com" key "logs/2024-06-02.log" contains "JUNE2"
+    And bucket "s3.barnybug.github.com" key "logs/2024-07-01.log" contains "JULY1"
+    And bucket "s3.barnybug.github.com" key "logs/old/2024-06-03.log" contains "OLD"
+    When I run "s3 cat s3://s3.barnybug.github.com/logs/2023-*"
+    Then the exit code is 1
@@ -0,0 +1,72 @@
+package s3
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// interrupts cancels a command's context on SIGINT or SIGTERM, so it stops
+// its transfers and cleans up after them, rather than dying part way. A
+// second signal kills the process as usual.
+type interrupts struct {
+	ch   chan os.Signal
+	done chan struct{}
+
+	mu     sync.Mutex
+	signal os.Signal // caught, if any
+}
+
+// notifyInterrupts catches SIGINT and SIGTERM until stopped, calling cancel
+// on the first.
+func notifyInterrupts(cancel context.CancelFunc) *interrupts {
+	in := &interrupts{ch: make(chan os.Signal, 1), done: make(chan struct{})}
+	signal.Notify(in.ch, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-in.ch:
+			signal.Stop(in.ch)
+			in.mu.Lock()
+			in.signal = sig
+			in.mu.Unlock()
+			cancel()
+		case <-in.done:
+		}
+	}()
+	return in
+}
+
+// stop stops catching the signals.
+func (in *interrupts) stop() {
+	signal.Stop(in.ch)
+	close(in.done)
+}
+
+// caught returns the signal caught, or nil.
+func (in *interrupts) caught() os.Signal {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return in.signal
+}
+
+// signalName returns the usual name of an interrupting signal.
+func signalName(sig os.Signal) string {
+	switch sig {
+	case os.Interrupt:
+		return "SIGINT"
+	case syscall.SIGTERM:
+		return "SIGTERM"
+	}
+	return sig.String()
+}
+
+// interruptedExitCode is the exit code of a command stopped by sig: 128 plus
+// the signal's number, as shells report for processes it kills.
+func interruptedExitCode(sig os.Signal) int {
+	if s, ok := sig.(syscall.Signal); ok {
+		return 128 + int(s)
+	}
+	return 1
+}
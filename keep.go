@@ -0,0 +1,81 @@
+package s3
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// keepFile names a file at the root of a sync destination, or a key at the
+// root of a bucket for rm, listing paths never to delete, in gitignore
+// syntax. It protects itself.
+const keepFile = ".s3keep"
+
+// loadKeepRules reads the .s3keep at the root of the local directory or s3
+// url, adding the --protect patterns given.
+func loadKeepRules(ctx context.Context, conn S3API, root string, patterns []string) (*ignoreRules, error) {
+	rules := &ignoreRules{}
+	err := rules.add("/" + keepFile)
+	if err != nil {
+		return nil, err
+	}
+	var data []byte
+	if isS3Url(root) {
+		bucket, prefix := extractBucketPath(root)
+		if prefix != "" && !strings.HasSuffix(prefix, "/") {
+			prefix += "/"
+		}
+		output, err := conn.GetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(prefix + keepFile),
+		})
+		if err == nil {
+			defer output.Body.Close()
+			data, err = ioutil.ReadAll(output.Body)
+		}
+		if err != nil && !isAWSErrorCode(err, "NoSuchKey") {
+			return nil, err
+		}
+	} else {
+		data, err = ioutil.ReadFile(filepath.Join(root, keepFile))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		err = rules.add(scanner.Text())
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, pattern := range patterns {
+		err = rules.add(pattern)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rules, scanner.Err()
+}
+
+// protected reports whether the slash separated path of a file, relative to
+// the root, is kept from deletion, either itself or by a directory above it.
+func (rules *ignoreRules) protected(rel string) bool {
+	if rules.matches(rel, false) {
+		return true
+	}
+	for dir := path.Dir(rel); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if rules.matches(dir, true) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// KeyFilter selects the keys and files listed by their age and size.
+type KeyFilter struct {
+	newerThan time.Time // modified after this, if set
+	olderThan time.Time // modified before this, if set
+	minSize   int64     // at least this many bytes
+	maxSize   int64     // at most this many bytes, or any size if negative
+}
+
+// ParseKeyFilter parses the --newer-than and --older-than ages, such as 7d,
+// either of which may be empty, and the --min-size and --max-size bytes, the
+// latter negative if not given. It returns nil if nothing is filtered.
+func ParseKeyFilter(newerThan, olderThan string, minSize, maxSize int64) (*KeyFilter, error) {
+	if newerThan == "" && olderThan == "" && minSize <= 0 && maxSize < 0 {
+		return nil, nil
+	}
+	now := time.Now()
+	filter := &KeyFilter{minSize: minSize, maxSize: maxSize}
+	if newerThan != "" {
+		age, err := ParseAge(newerThan)
+		if err != nil {
+			return nil, err
+		}
+		filter.newerThan = now.Add(-age)
+	}
+	if olderThan != "" {
+		age, err := ParseAge(olderThan)
+		if err != nil {
+			return nil, err
+		}
+		filter.olderThan = now.Add(-age)
+	}
+	if !filter.newerThan.IsZero() && !filter.olderThan.IsZero() && !filter.newerThan.Before(filter.olderThan) {
+		return nil, errors.New("--newer-than must be longer ago than --older-than")
+	}
+	if maxSize >= 0 && minSize > maxSize {
+		return nil, errors.New("--min-size must not be more than --max-size")
+	}
+	return filter, nil
+}
+
+// selects reports whether file passes the filter. A nil filter selects every
+// file.
+func (f *KeyFilter) selects(file File) bool {
+	if f == nil {
+		return true
+	}
+	size := file.Size()
+	if size < f.minSize || (f.maxSize >= 0 && size > f.maxSize) {
+		return false
+	}
+	if !f.newerThan.IsZero() || !f.olderThan.IsZero() {
+		modified := modTime(file)
+		if !f.newerThan.IsZero() && !modified.After(f.newerThan) {
+			return false
+		}
+		if !f.olderThan.IsZero() && !modified.Before(f.olderThan) {
+			return false
+		}
+	}
+	return true
+}
+
+// files passes on those files from ch the filter selects, as they're listed.
+func (f *KeyFilter) files(ctx context.Context, ch <-chan File) <-chan File {
+	if f == nil {
+		return ch
+	}
+	filtered := make(chan File, 1000)
+	go func() {
+		defer close(filtered)
+		for file := range ch {
+			if f.selects(file) && send(ctx, filtered, file) != nil {
+				return
+			}
+		}
+	}()
+	return filtered
+}
@@ -0,0 +1,172 @@
+package s3
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/barnybug/s3/pkg/mys3"
+)
+
+// listingHeader is the first row of an exported listing
+var listingHeader = []string{"key", "size", "etag", "last_modified"}
+
+// ListingEntry is one key of a listing exported by changes --save.
+type ListingEntry struct {
+	Key          string
+	Size         int64
+	ETag         string
+	LastModified time.Time
+}
+
+// ChangesOptions configure RunChanges.
+type ChangesOptions struct {
+	CommonOptions
+	FilesystemOptions
+	Since string // listing to compare against, if any
+	Save  string // export the current listing here
+}
+
+// ReadListing loads a listing exported by changes --save.
+func ReadListing(filename string) ([]ListingEntry, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = len(listingHeader)
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+	if header[0] != listingHeader[0] {
+		return nil, fmt.Errorf("%s: not a listing, expected header %v", filename, listingHeader)
+	}
+	var entries []ListingEntry
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", filename, err)
+		}
+		entry := ListingEntry{Key: record[0], ETag: record[2]}
+		entry.Size, err = strconv.ParseInt(record[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", filename, err)
+		}
+		if record[3] != "" {
+			entry.LastModified, err = time.Parse(time.RFC3339, record[3])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", filename, err)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func writeListing(filename string, entries []ListingEntry) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	w.Write(listingHeader)
+	for _, entry := range entries {
+		modified := ""
+		if !entry.LastModified.IsZero() {
+			modified = entry.LastModified.UTC().Format(time.RFC3339)
+		}
+		w.Write([]string{entry.Key, strconv.FormatInt(entry.Size, 10), entry.ETag, modified})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// listingEntry returns the listing entry for file.
+func listingEntry(file File) ListingEntry {
+	entry := ListingEntry{Key: file.Relative(), Size: file.Size()}
+	if s3f, ok := file.(*S3File); ok {
+		entry.ETag = aws.ToString(s3f.object.ETag)
+		entry.LastModified = aws.ToTime(s3f.object.LastModified)
+	}
+	return entry
+}
+
+// RunChanges reports the keys under url created (A), modified (U) or deleted
+// (D) since the listing in Since was saved, and optionally saves the current
+// listing for next time. Keys are compared by size and etag.
+func RunChanges(ctx context.Context, conn S3API, mys3Conn mys3.Mys3, url string, opts ChangesOptions) error {
+	if !isS3Url(url) {
+		return errors.New("s3:// url required")
+	}
+	previous := map[string]ListingEntry{}
+	if opts.Since != "" {
+		entries, err := ReadListing(opts.Since)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			previous[entry.Key] = entry
+		}
+	}
+
+	var current []ListingEntry
+	err := iterateKeys(ctx, conn, []string{url}, opts.FilesystemOptions, func(file File) error {
+		current = append(current, listingEntry(file))
+		return nil
+	}, mys3Conn)
+	if err != nil && err != ErrNotFound {
+		return err
+	}
+
+	type change struct {
+		code string
+		key  string
+	}
+	var changes []change
+	var created, modified, deleted int
+	for _, entry := range current {
+		old, ok := previous[entry.Key]
+		delete(previous, entry.Key)
+		if !ok {
+			changes = append(changes, change{"A", entry.Key})
+			created += 1
+		} else if old.Size != entry.Size || old.ETag != entry.ETag {
+			changes = append(changes, change{"U", entry.Key})
+			modified += 1
+		}
+	}
+	for key := range previous {
+		changes = append(changes, change{"D", key})
+		deleted += 1
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].key < changes[j].key
+	})
+	for _, c := range changes {
+		fmt.Fprintf(outOf(ctx), "%s %s\n", c.code, c.key)
+	}
+	if !opts.Quiet {
+		fmt.Fprintf(outOf(ctx), "\n%d created, %d modified, %d deleted\n", created, modified, deleted)
+	}
+
+	if opts.Save != "" {
+		return writeListing(opts.Save, current)
+	}
+	return nil
+}
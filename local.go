@@ -1,7 +1,9 @@
 package s3
 
 import (
+	"context"
 	"crypto/md5"
+	"encoding/hex"
 	"io"
 	"io/ioutil"
 	"log"
@@ -13,13 +15,32 @@ import (
 type LocalFilesystem struct {
 	err  error
 	path string
+	opts FilesystemOptions
 }
 
+// SymlinkMode controls how symbolic links are treated when scanning local
+// files.
+type SymlinkMode int
+
+const (
+	// SymlinkSkip ignores symbolic links entirely.
+	SymlinkSkip SymlinkMode = iota
+	// SymlinkFollow resolves links and treats the target as if it were in
+	// place of the link.
+	SymlinkFollow
+	// SymlinkPreserve stores links as zero-byte objects recording the link
+	// target in metadata.
+	SymlinkPreserve
+)
+
+// metadata key used to record the target of a preserved symlink
+const symlinkTargetKey = "symlink_target"
+
 func (lfs *LocalFilesystem) Error() error {
 	return lfs.err
 }
 
-func scanFiles(ch chan<- File, fullpath string, relpath string) error {
+func scanFiles(ctx context.Context, ch chan<- File, fullpath string, relpath string, symlinks SymlinkMode, ignore *ignoreRules) error {
 	entries, err := ioutil.ReadDir(fullpath)
 	if os.IsNotExist(err) {
 		// this is fine - indicates no files are there
@@ -29,26 +50,74 @@ func scanFiles(ch chan<- File, fullpath string, relpath string) error {
 		return err
 	}
 	for _, entry := range entries {
+		if done(ctx) {
+			return ctx.Err()
+		}
 		f := filepath.Join(fullpath, entry.Name())
 		r := filepath.Join(relpath, entry.Name())
+		var target string
+		if entry.Mode()&os.ModeSymlink != 0 {
+			switch symlinks {
+			case SymlinkSkip:
+				continue
+			case SymlinkPreserve:
+				target, err = os.Readlink(f)
+				if err != nil {
+					return err
+				}
+			case SymlinkFollow:
+				info, err := os.Stat(f)
+				if os.IsNotExist(err) {
+					// dangling link, nothing to follow
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				if info.IsDir() && isSymlinkLoop(fullpath, f) {
+					continue
+				}
+				entry = info
+			}
+		}
+		if ignore.ignored(f, entry.IsDir()) {
+			continue
+		}
 		if entry.IsDir() {
 			// recurse
-			err := scanFiles(ch, f, r)
+			err := scanFiles(ctx, ch, f, r, symlinks, ignore)
 			if err != nil {
 				return err
 			}
 		} else {
-			ch <- &LocalFile{entry, f, r, nil}
+			err = send(ctx, ch, &LocalFile{entry, f, r, nil, target})
+			if err != nil {
+				return err
+			}
 		}
 	}
 	return nil
 }
 
-func (lfs *LocalFilesystem) CreateMultiPart(src File, buffer []byte) error {
+// isSymlinkLoop reports whether following the directory link at path would
+// lead back into one of its own parents.
+func isSymlinkLoop(parent, path string) bool {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return true
+	}
+	resolvedParent, err := filepath.EvalSymlinks(parent)
+	if err != nil {
+		return true
+	}
+	return strings.HasPrefix(resolvedParent+string(filepath.Separator), resolved+string(filepath.Separator))
+}
+
+func (lfs *LocalFilesystem) CreateMultiPart(ctx context.Context, src File) error {
 	return nil
 }
 
-func (lfs *LocalFilesystem) Files() <-chan File {
+func (lfs *LocalFilesystem) Files(ctx context.Context) <-chan File {
 	ch := make(chan File, 1000)
 
 	// use relative path to file or directory:
@@ -68,25 +137,45 @@ func (lfs *LocalFilesystem) Files() <-chan File {
 			return
 		}
 		if fi.IsDir() {
-			err := scanFiles(ch, lfs.path, relpath)
+			ignore, err := loadIgnoreRules(lfs.path)
+			if err == nil {
+				ignore, err = ignore.filter(lfs.path, lfs.opts.Exclude, lfs.opts.Include)
+			}
+			if err != nil {
+				lfs.err = err
+				return
+			}
+			err = scanFiles(ctx, ch, lfs.path, relpath, lfs.opts.Symlinks, ignore)
 			if err != nil {
 				lfs.err = err
 			}
 		} else {
-			ch <- &LocalFile{fi, lfs.path, relpath, nil}
+			ch <- &LocalFile{fi, lfs.path, relpath, nil, ""}
 		}
 	}()
 	return ch
 }
 
-func (lfs *LocalFilesystem) Create(src File) error {
-	reader, err := src.Reader()
+func (lfs *LocalFilesystem) Create(ctx context.Context, src File) error {
+	reader, err := src.Reader(ctx)
 	if err != nil {
 		return err
 	}
 	defer reader.Close()
 	fullpath := filepath.Join(lfs.path, src.Relative())
-	if src.IsDirectory() {
+	var target string
+	if s3f, ok := src.(*S3File); ok && lfs.opts.Symlinks == SymlinkPreserve {
+		target = s3f.SymlinkTarget(ctx)
+	}
+	if target != "" {
+		err = os.MkdirAll(filepath.Dir(fullpath), 0777)
+		if err != nil {
+			return err
+		}
+		// replace whatever is there with the link
+		os.Remove(fullpath)
+		err = os.Symlink(target, fullpath)
+	} else if src.IsDirectory() {
 		err = os.MkdirAll(fullpath, 0777)
 	} else {
 		// create containing directory
@@ -100,12 +189,37 @@ func (lfs *LocalFilesystem) Create(src File) error {
 			return err
 		}
 		defer writer.Close()
-		_, err = io.Copy(writer, reader)
+		_, err = io.Copy(writer, readContext(ctx, lfs.opts.Progress.wrap(src, reader)))
+		if err != nil {
+			if done(ctx) {
+				// rather than leave a truncated file
+				writer.Close()
+				os.Remove(fullpath)
+			}
+			return err
+		}
+		// close first, so the restored mtime isn't clobbered by the write
+		err = writer.Close()
+		if err != nil {
+			return err
+		}
+		err = restoreModTime(fullpath, src)
+		if err != nil {
+			return err
+		}
+		if s3f, ok := src.(*S3File); ok && lfs.opts.Preserve {
+			// the mtime recorded at upload takes precedence
+			metadata, err := s3f.Metadata(ctx)
+			if err != nil {
+				return err
+			}
+			err = restorePosixMetadata(fullpath, metadata)
+		}
 	}
 	return err
 }
 
-func (lfs *LocalFilesystem) Delete(path string) error {
+func (lfs *LocalFilesystem) Delete(ctx context.Context, path string) error {
 	fullpath := filepath.Join(lfs.path, path)
 	return os.Remove(fullpath)
 }
@@ -115,6 +229,7 @@ type LocalFile struct {
 	fullpath string
 	relpath  string
 	md5      []byte
+	target   string // symlink target, when preserving symlinks
 }
 
 func (lf *LocalFile) Relative() string {
@@ -122,6 +237,9 @@ func (lf *LocalFile) Relative() string {
 }
 
 func (lf *LocalFile) Size() int64 {
+	if lf.target != "" {
+		return 0
+	}
 	return lf.info.Size()
 }
 
@@ -129,23 +247,36 @@ func (lf *LocalFile) IsDirectory() bool {
 	return false
 }
 
-func (lf *LocalFile) CheckSum() (string, error) {
-	data, err := ioutil.ReadFile(lf.fullpath)
+func (lf *LocalFile) CheckSum(ctx context.Context) (string, error) {
+	if lf.target != "" {
+		return strMd5(""), nil
+	}
+	reader, err := lf.Reader(ctx)
 	if err != nil {
 		return "", err
 	}
-	return strMd5(string(data)), nil
+	defer reader.Close()
+	h := md5.New()
+	if _, err := io.Copy(h, reader); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
 }
 
-func (lf *LocalFile) MD5() []byte {
+func (lf *LocalFile) MD5(ctx context.Context) []byte {
 	if lf.md5 == nil {
 		// cache md5
 		h := md5.New()
-		reader, err := os.Open(lf.fullpath)
+		reader, err := lf.Reader(ctx)
 		if err != nil {
 			log.Fatal(err)
 		}
+		defer reader.Close()
 		_, err = io.Copy(h, reader)
+		if err != nil && done(ctx) {
+			// unknown, the run is being canceled
+			return nil
+		}
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -154,11 +285,18 @@ func (lf *LocalFile) MD5() []byte {
 	return lf.md5
 }
 
-func (lf *LocalFile) Reader() (io.ReadCloser, error) {
-	return os.Open(lf.fullpath)
+func (lf *LocalFile) Reader(ctx context.Context) (io.ReadCloser, error) {
+	if lf.target != "" {
+		return ioutil.NopCloser(strings.NewReader("")), nil
+	}
+	file, err := os.Open(lf.fullpath)
+	if err != nil {
+		return nil, err
+	}
+	return readCloser{readContext(ctx, file), file}, nil
 }
 
-func (lf *LocalFile) Delete() error {
+func (lf *LocalFile) Delete(ctx context.Context) error {
 	return os.Remove(lf.fullpath)
 }
 
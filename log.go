@@ -0,0 +1,293 @@
+package s3
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/logging"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// LogLevel is how much a command logs as it runs, raised by -v, -vv and
+// --debug. Logs are written with the command's errors.
+type LogLevel int
+
+const (
+	LogErrors    LogLevel = iota // only errors and warnings, the default
+	LogDecisions                 // -v: also what's done with each key or file, and why
+	LogRequests                  // -vv: also a summary of each request made
+	LogWire                      // --debug: also the headers of each request and response
+)
+
+// ParseLogLevel returns the level of the -v, -vv and --debug flags, the
+// highest given.
+func ParseLogLevel(v, vv, debug bool) LogLevel {
+	switch {
+	case debug:
+		return LogWire
+	case vv:
+		return LogRequests
+	case v:
+		return LogDecisions
+	}
+	return LogErrors
+}
+
+// name returns the level of records logged at level with --log-format json.
+func (level LogLevel) name() string {
+	switch level {
+	case LogErrors:
+		return "error"
+	case LogDecisions:
+		return "info"
+	case LogRequests:
+		return "debug"
+	}
+	return "trace"
+}
+
+// LogFormat is how logs are written, chosen by --log-format.
+type LogFormat string
+
+const (
+	LogText LogFormat = "text" // lines for reading, the default
+	LogJSON LogFormat = "json" // a LogRecord a line, for log pipelines
+)
+
+// ParseLogFormat checks the --log-format flag.
+func ParseLogFormat(format string) (LogFormat, error) {
+	switch LogFormat(format) {
+	case LogText, LogJSON:
+		return LogFormat(format), nil
+	}
+	return "", fmt.Errorf("--log-format must be text or json, not %q", format)
+}
+
+// LogRecord is a line logged with --log-format json. Fields that don't apply
+// are left out.
+type LogRecord struct {
+	Time      string `json:"time"`  // RFC 3339, UTC
+	Level     string `json:"level"` // error, warn, info (-v), debug (-vv) or trace (--debug)
+	Message   string `json:"msg,omitempty"`
+	Operation string `json:"operation,omitempty"` // of the request, or what's done with a key or file
+	Bucket    string `json:"bucket,omitempty"`
+	Key       string `json:"key,omitempty"`   // or path of a local file
+	Bytes     int64  `json:"bytes,omitempty"` // sent and received
+	Duration  int64  `json:"duration_ms,omitempty"`
+	Status    int    `json:"status,omitempty"` // http status of the response
+	Error     string `json:"error,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// logRecord logs record at level to the output of the run of ctx, if the run
+// logs that much: as json with --log-format json, and as text otherwise.
+func logRecord(ctx context.Context, level LogLevel, record LogRecord, text string) {
+	outputOf(ctx).log(level, record, text)
+}
+
+// log logs record at level, if o logs that much, as logRecord does.
+func (o *runOutput) log(level LogLevel, record LogRecord, text string) {
+	if o.level < level {
+		return
+	}
+	o.logMu.Lock()
+	defer o.logMu.Unlock()
+	if o.format != LogJSON {
+		fmt.Fprintln(o.errOut, text)
+		return
+	}
+	record.Time = time.Now().UTC().Format(time.RFC3339Nano)
+	if record.Level == "" {
+		record.Level = level.name()
+	}
+	enc := json.NewEncoder(o.errOut)
+	enc.SetEscapeHTML(false)
+	enc.Encode(record)
+}
+
+// logError logs the error a command failed with.
+func logError(ctx context.Context, err error) {
+	logRecord(ctx, LogErrors, LogRecord{Error: err.Error()}, "Error: "+err.Error())
+}
+
+// logWarning logs a warning, which doesn't stop the command.
+func logWarning(ctx context.Context, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	logRecord(ctx, LogErrors, LogRecord{Level: "warn", Message: msg}, "Warning: "+msg)
+}
+
+// logDecision logs with -v what's done with file, and why. name is how the
+// file is shown in text.
+func logDecision(ctx context.Context, action string, file File, name, reason string) {
+	record := LogRecord{Operation: action, Message: reason}
+	record.Bucket, record.Key = fileLocation(file)
+	logRecord(ctx, LogDecisions, record, fmt.Sprintf("%s %s: %s", action, name, reason))
+}
+
+// logTransfer logs with -v a transfer of file that's done: its bytes and the
+// time it took.
+func logTransfer(ctx context.Context, action string, file File, name string, nbytes int64, took time.Duration) {
+	record := LogRecord{Operation: action, Bytes: nbytes, Duration: took.Milliseconds()}
+	record.Bucket, record.Key = fileLocation(file)
+	logRecord(ctx, LogDecisions, record, fmt.Sprintf("%s %s: done, %d bytes in %s", action, name, nbytes, took.Round(time.Millisecond)))
+}
+
+// mys3Logger logs the diagnostics of mys3 with the command's, to its output:
+// its errors and warnings always, what it does with -v and its details with
+// -vv.
+type mys3Logger struct {
+	output *runOutput
+}
+
+func (l mys3Logger) Debug(msg string, args ...interface{}) { l.log(LogRequests, "", msg, args) }
+func (l mys3Logger) Info(msg string, args ...interface{})  { l.log(LogDecisions, "", msg, args) }
+func (l mys3Logger) Warn(msg string, args ...interface{})  { l.log(LogErrors, "warn", msg, args) }
+func (l mys3Logger) Error(msg string, args ...interface{}) { l.log(LogErrors, "error", msg, args) }
+
+// log logs msg at level, with the alternating keys and values of args:
+// as the fields of the record they name with --log-format json, or else
+// appended to the message, and all as key=value in text.
+func (l mys3Logger) log(level LogLevel, name, msg string, args []interface{}) {
+	record := LogRecord{Level: name, Message: msg}
+	text := msg
+	for i := 0; i+1 < len(args); i += 2 {
+		key, value := fmt.Sprint(args[i]), fmt.Sprint(args[i+1])
+		text += fmt.Sprintf(" %s=%s", key, value)
+		switch key {
+		case "bucket":
+			record.Bucket = value
+		case "key":
+			record.Key = value
+		case "error":
+			record.Error = value
+		default:
+			record.Message += fmt.Sprintf(" %s=%s", key, value)
+		}
+	}
+	switch name {
+	case "warn":
+		text = "Warning: " + text
+	case "error":
+		text = "Error: " + text
+	}
+	l.output.log(level, record, text)
+}
+
+// fileLocation returns the bucket and key of an s3 file, or the path of a
+// local one.
+func fileLocation(file File) (bucket, key string) {
+	if s3f, ok := file.(*S3File); ok {
+		return s3f.bucket, *s3f.object.Key
+	}
+	return "", file.Relative()
+}
+
+// wireLogger returns the logger of the sdk's dumps of requests and responses
+// with --debug, or nil below that level.
+func (o *runOutput) wireLogger() logging.Logger {
+	if o.level < LogWire {
+		return nil
+	}
+	return logging.LoggerFunc(func(_ logging.Classification, format string, args ...interface{}) {
+		msg := strings.TrimSuffix(fmt.Sprintf(format, args...), "\n")
+		o.log(LogWire, LogRecord{Message: msg}, msg)
+	})
+}
+
+// install adds the middleware logging a summary of each attempt of a
+// request with -vv: its operation, method and url, the status of the
+// response, the time it took, the request id and any error.
+func (o *runOutput) install(stack *middleware.Stack) error {
+	if o.level < LogRequests {
+		return nil
+	}
+	location := middleware.InitializeMiddlewareFunc("s3.LogRequestLocation", func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+		bucket, key := requestLocation(in.Parameters)
+		ctx = middleware.WithStackValue(ctx, requestLocationKey{}, [2]string{bucket, key})
+		return next.HandleInitialize(ctx, in)
+	})
+	if err := stack.Initialize.Add(location, middleware.After); err != nil {
+		return err
+	}
+	attempt := middleware.FinalizeMiddlewareFunc("s3.LogRequest", func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+		start := time.Now()
+		out, metadata, err := next.HandleFinalize(ctx, in)
+		req, ok := in.Request.(*smithyhttp.Request)
+		if !ok {
+			return out, metadata, err
+		}
+		took := time.Since(start)
+		operation := middleware.GetOperationName(ctx)
+		requestID, _ := awsmiddleware.GetRequestIDMetadata(metadata)
+		record := LogRecord{
+			Operation: operation,
+			Duration:  took.Milliseconds(),
+			RequestID: requestID,
+		}
+		if location, ok := middleware.GetStackValue(ctx, requestLocationKey{}).([2]string); ok {
+			record.Bucket, record.Key = location[0], location[1]
+		}
+		if req.ContentLength > 0 {
+			record.Bytes = req.ContentLength
+		}
+		status := "-"
+		if resp, ok := awsmiddleware.GetRawResponse(metadata).(*smithyhttp.Response); ok {
+			record.Status = resp.StatusCode
+			status = fmt.Sprint(resp.StatusCode)
+			if resp.ContentLength > 0 {
+				record.Bytes += resp.ContentLength
+			}
+		}
+		url := *req.URL
+		url.RawQuery = ""
+		fields := []string{operation, req.Method, url.String(), status,
+			took.Round(time.Millisecond).String()}
+		if requestID != "" {
+			fields = append(fields, "request-id="+requestID)
+		}
+		var aerr smithy.APIError
+		if errors.As(err, &aerr) {
+			record.Error = aerr.ErrorCode()
+			fields = append(fields, "error="+aerr.ErrorCode())
+		} else if err != nil {
+			record.Error = err.Error()
+			fields = append(fields, "error="+err.Error())
+		}
+		o.log(LogRequests, record, "request: "+strings.Join(fields, " "))
+		return out, metadata, err
+	})
+	// innermost, so each attempt is logged as it's sent
+	return stack.Finalize.Add(attempt, middleware.After)
+}
+
+// requestLocationKey keeps the bucket and key of a request for its log.
+type requestLocationKey struct{}
+
+// requestLocation returns the bucket and key of a request, from its input.
+func requestLocation(params interface{}) (bucket, key string) {
+	v := reflect.Indirect(reflect.ValueOf(params))
+	if v.Kind() != reflect.Struct {
+		return "", ""
+	}
+	return stringField(v, "Bucket"), stringField(v, "Key")
+}
+
+// stringField returns the *string field name of input, or "" if unset.
+func stringField(input reflect.Value, name string) string {
+	f := input.FieldByName(name)
+	if !f.IsValid() || !f.CanInterface() {
+		return ""
+	}
+	if s, ok := f.Interface().(*string); ok && s != nil {
+		return *s
+	}
+	return ""
+}
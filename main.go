@@ -1,29 +1,42 @@
 package s3
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
-	"strings"
+	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go/middleware"
 	"github.com/barnybug/s3/pkg/mys3"
-	"github.com/urfave/cli"
+	"github.com/urfave/cli/v2"
 )
 
-var (
-	parallel     int
-	dryRun       bool
-	deleteExtra  bool
-	public       bool
-	quiet        bool
-	ignoreErrors bool
-	acl          string
-	onlyShow     bool
-)
+// Options are the settings of the flags shared by the commands of a run of
+// Main, each run having its own.
+type Options struct {
+	Parallel     int    // -p
+	DryRun       bool   // -n
+	Quiet        bool   // -q
+	IgnoreErrors bool   // --ignore-errors
+	OnlyShow     bool   // --onlyShow
+	ACL          string // --acl, or public-read with --public
+	Public       bool   // --public
+	DeleteExtra  bool   // --delete
+
+	FollowSymlinks   bool // --follow-symlinks
+	PreserveSymlinks bool // --preserve-symlinks
+	Preserve         bool // --preserve
+	ProgressJSON     bool // --progress-json
+	Dashboard        bool // --dashboard
+	JSONOutput       bool // --json
+}
+
 var version = "master" /* passed in by go build */
 
 var ValidACLs = map[string]bool{
@@ -36,116 +49,931 @@ var ValidACLs = map[string]bool{
 	"log-delivery-write":        true,
 }
 
-func validACL() bool {
-	if acl != "" && !ValidACLs[acl] {
-		fmt.Fprintln(os.Stderr, "acl should be one of: private, public-read, public-read-write, authenticated-read, bucket-owner-read, bucket-owner-full-control, log-delivery-write")
+// validACL reports whether the --acl is one S3 knows, writing which are
+// otherwise.
+func (o *Options) validACL(ctx context.Context) bool {
+	if o.ACL != "" && !ValidACLs[o.ACL] {
+		fmt.Fprintln(errOutOf(ctx), "acl should be one of: private, public-read, public-read-write, authenticated-read, bucket-owner-read, bucket-owner-full-control, log-delivery-write")
 		return false
 	}
 	return true
 }
 
-func Main(conn s3iface.S3API, args []string, output io.Writer) int {
-	out = output
+// symlinkMode returns how symlinks are transferred, reporting false for
+// contradictory flags.
+func (o *Options) symlinkMode(ctx context.Context) (SymlinkMode, bool) {
+	switch {
+	case o.FollowSymlinks && o.PreserveSymlinks:
+		fmt.Fprintln(errOutOf(ctx), "--follow-symlinks and --preserve-symlinks are mutually exclusive")
+		return SymlinkSkip, false
+	case o.FollowSymlinks:
+		return SymlinkFollow, true
+	case o.PreserveSymlinks:
+		return SymlinkPreserve, true
+	}
+	return SymlinkSkip, true
+}
+
+func init() {
+	// -v logs more, so the version is only shown by --version
+	cli.VersionFlag = &cli.BoolFlag{Name: "version", Usage: "print the version"}
+}
+
+// Main runs the command line args, writing both results and errors to
+// output, and returns its exit code. Requests are made with conn, if not nil.
+func Main(conn S3API, args []string, output io.Writer) int {
+	return MainStreams(conn, args, Streams{Out: output, Err: output})
+}
+
+// Streams are where a command writes: its results to Out, and its errors,
+// warnings, logs and prompts to Err.
+type Streams struct {
+	Out io.Writer
+	Err io.Writer
+}
+
+// MainStreams runs the command line args as Main does, writing to streams.
+func MainStreams(conn S3API, args []string, streams Streams) int {
+	// where this run writes, logging only errors until the flags are parsed
+	output := &runOutput{out: streams.Out, errOut: streams.Err, level: LogErrors, format: LogText}
+	// the settings of the flags, for this run only
+	var o Options
+	// the file of --output, closed once the command is done
+	var outputFile *os.File
 	exitCode := 0
+	// canceled by SIGINT or SIGTERM, stopping the command
+	ctx, cancel := context.WithCancel(withOutput(context.Background(), output))
+	defer cancel()
+	interrupted := notifyInterrupts(cancel)
+	defer interrupted.stop()
+	// set once an error is reported
+	var reported bool
+
+	// the dashboard, once started, is stopped when the command returns
+	var dash *Dashboard
+	stopDashboard := func() {
+		if dash != nil {
+			dash.Stop()
+			dash = nil
+		}
+	}
 
 	checkErr := func(err error) {
-		if err != nil {
-			fmt.Fprintf(out, "Error: %s\n", err)
-			exitCode = 1
+		if err == nil {
+			return
 		}
+		// leave the error below the final dashboard
+		stopDashboard()
+		reported = true
+		if sig := interrupted.caught(); sig != nil {
+			// whatever failed most likely did so for the interruption
+			var canceled *CanceledError
+			if errors.As(err, &canceled) {
+				fmt.Fprintf(output.errOut, "Interrupted by %s after %d files (%d bytes)\n", signalName(sig), canceled.Files, canceled.Bytes)
+			} else {
+				fmt.Fprintf(output.errOut, "Interrupted by %s\n", signalName(sig))
+			}
+			exitCode = interruptedExitCode(sig)
+			return
+		}
+		logError(ctx, err)
+		exitCode = 1
 	}
 
-	getConnection := func(c *cli.Context) s3iface.S3API {
+	// failover spreads requests over a comma separated --endpoint
+	// list, and is nil for a single endpoint
+	var failover *endpointPool
+	// set once the connection checks --expected-bucket-owner
+	var ownerChecked bool
+	getEndpoint := func(c *cli.Context) string {
+		endpoints := parseEndpoints(c.String("endpoint"))
+		if len(endpoints) == 0 {
+			// checked before the command is run
+			endpoint, _ := awsEndpoint(c.String("region"), c.Bool("use-fips"), c.Bool("use-dualstack"))
+			return endpoint
+		}
+		if len(endpoints) > 1 && failover == nil {
+			pool, err := newEndpointPool(endpoints)
+			checkErr(err)
+			failover = pool
+		}
+		return endpoints[0]
+	}
+	// the --mfa-serial device, checked before the command is run
+	var mfa *MFA
+	// the --access-key and --secret-key, checked before the command is
+	// run, nil for the credentials of the --profile or the default ones
+	var keys *StaticKeys
+	// the client of --ca-bundle, --insecure-skip-verify and --timeout, made
+	// before the command is run, nil for the default client
+	var httpClient *http.Client
+	// the --max-retries and --retry-mode policy, checked before the
+	// command is run
+	var retry *RetryPolicy
+	// the --rps and --list-rps limits, nil without any
+	var rates *requestRates
+	// the metrics served on --metrics-listen while the command runs, nil
+	// without, and the stopping of their server
+	var metrics *Metrics
+	var stopMetrics func()
+	// credentials of the --access-key, --profile and --role-arn, loaded
+	// once for every connection, nil for the default credentials
+	var creds aws.CredentialsProvider
+	var credsLoaded bool
+	getCredentials := func(c *cli.Context) aws.CredentialsProvider {
+		if !credsLoaded {
+			credsLoaded = true
+			region := c.String("region")
+			profile, err := profileCredentials(c.Context, c.String("profile"), region, httpClient)
+			checkErr(err)
+			if keys != nil {
+				profile = keys.provider()
+			}
+			// checked before the command is run
+			role, _ := ParseAssumeRole(c.String("role-arn"), c.String("external-id"), c.String("role-session-name"))
+			role.MFA = mfa
+			assumed, err := role.credentials(c.Context, region, profile, httpClient)
+			checkErr(err)
+			creds = profile
+			if assumed != nil {
+				creds = assumed
+			}
+		}
+		return creds
+	}
+	// pathStyle reports whether buckets are addressed by path rather than by
+	// host name: with --force-path-style or --virtual-host-style, or else by
+	// path with an --endpoint, which needn't resolve bucket hosts
+	pathStyle := func(c *cli.Context) bool {
+		if c.Bool("force-path-style") || c.Bool("virtual-host-style") {
+			return c.Bool("force-path-style")
+		}
+		return c.String("endpoint") != ""
+	}
+	// apiOptions are the middleware of the requests of the run: endpoint
+	// failover, the --timeout of response bodies, adaptive retries, the rate
+	// limits and the logs of -vv
+	apiOptions := func(c *cli.Context) []func(*middleware.Stack) error {
+		var options []func(*middleware.Stack) error
+		if failover != nil {
+			options = append(options, failover.install)
+		}
+		if timeout := c.Duration("timeout"); timeout > 0 {
+			options = append(options, requestTimeout(timeout).install)
+		}
+		return append(options, retry.install, rates.install, metrics.install, output.install)
+	}
+	// getConnection returns the connection of every request of the run,
+	// made once by mys3.NewClient, so that both the requests made with it
+	// directly and those of getSession share its endpoint, credentials,
+	// http client, retries and bucket addressing
+	getConnection := func(c *cli.Context) S3API {
+		owner := c.String("expected-bucket-owner")
 		if conn == nil {
-			region := c.Parent().String("region")
-			endpoint := c.Parent().String("endpoint")
-			config := aws.Config{
-				Region:   aws.String(region),
-				Endpoint: &endpoint,
+			// first, as it makes the failover pool of apiOptions
+			endpoint := getEndpoint(c)
+			options := apiOptions(c)
+			if owner != "" {
+				options = append(options, expectedOwner(owner).install)
 			}
-			sess, _ := session.NewSession(&config)
-			conn = s3.New(sess)
+			opts := mys3.Options{
+				Credentials:      getCredentials(c),
+				HTTPClient:       httpClient,
+				Retryer:          retry,
+				VirtualHostStyle: !pathStyle(c),
+				Accelerate:       c.Bool("accelerate"),
+				WireLogger:       output.wireLogger(),
+			}
+			svc, err := mys3.NewClient(endpoint, c.String("region"), opts, options...)
+			checkErr(err)
+			conn = svc
+			ownerChecked = true
+		}
+		if svc, ok := conn.(*s3.Client); ok && owner != "" && !ownerChecked {
+			// on a copy, leaving a client passed in as it was
+			conn = s3.New(svc.Options(), func(o *s3.Options) {
+				o.APIOptions = append(o.APIOptions, expectedOwner(owner).install)
+			})
+			ownerChecked = true
 		}
 		return conn
 	}
-
+	// getSession returns the connection for uploads with the sdk's upload
+	// manager, logging with the command, or silent under -q
 	getSession := func(c *cli.Context) mys3.Mys3 {
-
-		region := c.Parent().String("region")
-		endpoint := c.Parent().String("endpoint")
-		config := aws.Config{
-			Region:   aws.String(region),
-			Endpoint: &endpoint,
-		}
-		endPointSplit := strings.Split(*config.Endpoint, "://")
-		able := false
-		if endPointSplit[0] == "http" {
-			able = true
-		}
-		mys3Conn := mys3.New(endpoint, region, able)
-
-		return mys3Conn
+		var logger mys3.Logger = mys3Logger{output}
+		if o.Quiet {
+			logger = mys3.Discard
+		}
+		return mys3.NewFromAPIWithOptions(getConnection(c), mys3.Options{Logger: logger})
+	}
+	commonOptions := func() CommonOptions {
+		return CommonOptions{
+			Parallel:     o.Parallel,
+			DryRun:       o.DryRun,
+			Quiet:        o.Quiet || o.ProgressJSON || o.Dashboard,
+			IgnoreErrors: o.IgnoreErrors,
+			Metrics:      metrics,
+		}
+	}
+	// progress reports json events, or draws the dashboard, in place of the
+	// human-oriented output
+	progress := func() *ProgressReporter {
+		if o.Dashboard {
+			dash = NewDashboard(output.errOut, o.Parallel)
+			dash.Start()
+			return NewDashboardReporter(dash)
+		}
+		if !o.ProgressJSON {
+			return nil
+		}
+		return NewProgressReporter(output.out)
+	}
+	// records writes listings and matches as json, in place of text
+	records := func() *RecordWriter {
+		if !o.JSONOutput {
+			return nil
+		}
+		return NewRecordWriter(output.out)
 	}
-	commonFlags := []cli.Flag{
-		cli.IntFlag{
+	// showHelp prints usage for the command and flags the invocation as failed
+	showHelp := func(c *cli.Context) error {
+		exitCode = 1
+		return cli.ShowCommandHelp(c, c.Command.Name)
+	}
+	olderThanUploadFlag := &cli.StringFlag{
+		Name:  "older-than",
+		Usage: "only uploads initiated at least this long ago, e.g. 7d or 12h",
+		Value: "0d",
+	}
+	// multipartAction runs an mpu subcommand on its bucket and url arguments
+	multipartAction := func(c *cli.Context, run func(context.Context, S3API, []string, MultipartOptions) error) error {
+		if c.Args().Len() == 0 {
+			return showHelp(c)
+		}
+		age, err := ParseAge(c.String("older-than"))
+		if err != nil {
+			checkErr(err)
+			return nil
+		}
+		conn := getConnection(c)
+		opts := MultipartOptions{
+			CommonOptions: commonOptions(),
+			OlderThan:     age,
+		}
+		err = run(ctx, conn, c.Args().Slice(), opts)
+		checkErr(err)
+		return nil
+	}
+
+	operationFlags := []cli.Flag{
+		&cli.IntFlag{
 			Name:        "p",
 			Value:       32,
 			Usage:       "number of parallel operations to run",
-			Destination: &parallel,
+			Destination: &o.Parallel,
 		},
-		cli.BoolFlag{
+		&cli.BoolFlag{
 			Name:        "n",
 			Usage:       "dry-run, no actions taken",
-			Destination: &dryRun,
+			Destination: &o.DryRun,
 		},
-		cli.BoolFlag{
+		&cli.BoolFlag{
 			Name:        "ignore-errors",
-			Usage:       "",
-			Destination: &ignoreErrors,
+			Usage:       "carry on past failed transfers",
+			Destination: &o.IgnoreErrors,
+		},
+		&cli.StringFlag{
+			Name:  "output",
+			Usage: "write results to this file in place of stdout, leaving errors and logs on stderr",
 		},
-		cli.BoolFlag{
+		&cli.BoolFlag{
 			Name:        "q",
-			Usage:       "",
-			Destination: &quiet,
+			Usage:       "quiet, only output errors and listings",
+			Destination: &o.Quiet,
 		},
-		cli.StringFlag{
-			Name:   "region",
-			Usage:  "set region, otherwise environment variable AWS_REGION is checked, finally defaulting to us-east-1",
-			Value:  "us-east-1",
-			EnvVar: "AWS_REGION",
+	}
+	commonFlags := append(operationFlags,
+		&cli.StringFlag{
+			Name:    "region",
+			Usage:   "set region, defaulting to us-east-1",
+			Value:   "us-east-1",
+			EnvVars: []string{"AWS_REGION"},
 		},
-		cli.StringFlag{
-			Name:   "endpoint",
-			Usage:  "set s3 endpoint",
-			Value:  "",
-			EnvVar: "AWS_ENDPOINT",
+		&cli.StringFlag{
+			Name:    "target",
+			Usage:   "use the endpoint, region, profile, path style and acl of this target of ~/.config/s3/config.yaml, as defaults of their flags",
+			EnvVars: []string{"S3_TARGET"},
 		},
-		cli.StringFlag{
-			Name:   "directory",
-			Usage:  "download directory",
-			Value:  "",
-			EnvVar: "",
+		&cli.StringFlag{
+			Name:    "endpoint",
+			Usage:   "set s3 endpoint, an http or https url or a host reached over https, or a comma separated list to fail over between",
+			Value:   "",
+			EnvVars: []string{"AWS_ENDPOINT"},
 		},
-		cli.BoolFlag{
-			Name:  "onlyShow",
-			Usage: "only show data when get file",
+		&cli.BoolFlag{
+			Name:  "use-dualstack",
+			Usage: "use the region's dual-stack aws endpoint, reached over IPv6 as well as IPv4",
 		},
-	}
+		&cli.BoolFlag{
+			Name:  "use-fips",
+			Usage: "use the region's FIPS 140-2 validated aws endpoint",
+		},
+		&cli.BoolFlag{
+			Name:  "force-path-style",
+			Usage: "address buckets by path (endpoint/bucket/key), the default with an --endpoint",
+		},
+		&cli.BoolFlag{
+			Name:  "virtual-host-style",
+			Usage: "address buckets by host name (bucket.endpoint/key), the default without an --endpoint",
+		},
+		&cli.StringFlag{
+			Name:  "expected-bucket-owner",
+			Usage: "fail writes and deletes to buckets not owned by this account id",
+		},
+		&cli.StringFlag{
+			Name:  "access-key",
+			Usage: "make requests with this access key id, and the --secret-key, rather than the credentials of the shared aws files",
+		},
+		&cli.StringFlag{
+			Name:  "access-key-file",
+			Usage: "read the --access-key from this file",
+		},
+		&cli.StringFlag{
+			Name:  "secret-key",
+			Usage: "secret access key of the --access-key",
+		},
+		&cli.StringFlag{
+			Name:  "secret-key-file",
+			Usage: "read the --secret-key from this file",
+		},
+		&cli.StringFlag{
+			Name:  "session-token",
+			Usage: "session token of temporary credentials, with the --access-key",
+		},
+		&cli.StringFlag{
+			Name:  "session-token-file",
+			Usage: "read the --session-token from this file",
+		},
+		&cli.StringFlag{
+			Name:    "profile",
+			Usage:   "use the credentials of this profile of the shared aws config, logging in to AWS SSO profiles as needed",
+			EnvVars: []string{"AWS_PROFILE"},
+		},
+		&cli.StringFlag{
+			Name:    "role-arn",
+			Usage:   "make requests as this role, assumed with the default credentials",
+			EnvVars: []string{"S3_ROLE_ARN"},
+		},
+		&cli.StringFlag{
+			Name:  "external-id",
+			Usage: "external id the role's trust policy requires, with --role-arn",
+		},
+		&cli.StringFlag{
+			Name:  "role-session-name",
+			Usage: "name of the role session, with --role-arn, generated by default",
+		},
+		&cli.StringFlag{
+			Name:    "mfa-serial",
+			Usage:   "serial number or arn of the MFA device the role, or deleting versions with MFA delete, requires codes from",
+			EnvVars: []string{"S3_MFA_SERIAL"},
+		},
+		&cli.StringFlag{
+			Name:  "token-code",
+			Usage: "code from the --mfa-serial device, asked for when needed if not given",
+		},
+		&cli.StringFlag{
+			Name:  "ca-bundle",
+			Usage: "pem file of CA certificates to trust as well as the system's, for https endpoints signed by a private CA",
+		},
+		&cli.BoolFlag{
+			Name:  "insecure-skip-verify",
+			Usage: "don't verify the certificates of https endpoints, for testing only",
+		},
+		&cli.DurationFlag{
+			Name:  "timeout",
+			Usage: "fail requests (to be retried) that wait on the endpoint this long (eg 30s): connecting, for a response, or between reads of it",
+		},
+		&cli.DurationFlag{
+			Name:  "connect-timeout",
+			Usage: "give up connecting to the endpoint, TLS handshake included, after this long, rather than after --timeout",
+		},
+		&cli.IntFlag{
+			Name:  "max-idle-conns",
+			Usage: "idle connections kept for reuse, to the endpoint as well as in all, for high -p against a single host (default: go's 2 per host)",
+		},
+		&cli.IntFlag{
+			Name:  "max-conns-per-host",
+			Usage: "connections to the endpoint at once, beyond which requests wait (default: no limit)",
+		},
+		&cli.DurationFlag{
+			Name:  "idle-conn-timeout",
+			Usage: "close connections left idle this long (default: 90s)",
+		},
+		&cli.DurationFlag{
+			Name:  "keep-alive",
+			Usage: "interval of TCP keep-alive probes of connections, negative for none (default: 30s)",
+		},
+		&cli.IntFlag{
+			Name:  "max-retries",
+			Usage: "times a failed request, or a part transferred corrupted, is retried",
+			Value: DefaultMaxRetries,
+		},
+		&cli.StringFlag{
+			Name:  "retry-mode",
+			Usage: "standard: back off each retry exponentially, with jitter; adaptive: also hold back every request while one is throttled",
+			Value: string(RetryStandard),
+		},
+		&cli.Float64Flag{
+			Name:  "rps",
+			Usage: "at most this many requests a second for keys, such as gets and puts, to spare small endpoints",
+		},
+		&cli.Float64Flag{
+			Name:  "list-rps",
+			Usage: "at most this many list requests a second, limited apart from those for keys (default: --rps)",
+		},
+		&cli.StringFlag{
+			Name:  "metrics-listen",
+			Usage: "serve Prometheus metrics of requests and transfers on /metrics at this address (eg :9090) while the command runs",
+		},
+		&cli.BoolFlag{
+			Name:  "v",
+			Usage: "log what's done with each key or file, and why",
+		},
+		&cli.BoolFlag{
+			Name:  "vv",
+			Usage: "also log each request: its method, status, request id and latency",
+		},
+		&cli.BoolFlag{
+			Name:  "debug",
+			Usage: "also log the headers of each request and response",
+		},
+		&cli.StringFlag{
+			Name:  "log-format",
+			Usage: "logs as text or json, a record a line",
+			Value: string(LogText),
+		},
+		&cli.StringFlag{
+			Name:  "directory",
+			Usage: "download directory",
+			Value: "",
+		},
+		&cli.BoolFlag{
+			Name:        "onlyShow",
+			Usage:       "only show data when get file",
+			Destination: &o.OnlyShow,
+		},
+		&cli.BoolFlag{
+			Name:        "progress-json",
+			Usage:       "write newline-delimited json progress events (start, chunk, done, error) instead of text",
+			Destination: &o.ProgressJSON,
+		},
+		&cli.BoolFlag{
+			Name:        "dashboard",
+			Usage:       "draw a full screen dashboard of transfers in progress instead of text",
+			Destination: &o.Dashboard,
+		},
+		&cli.BoolFlag{
+			Name:        "json",
+			Usage:       "write newline-delimited json records from ls and grep instead of text",
+			Destination: &o.JSONOutput,
+		},
+	)
 
-	aclFlag := cli.StringFlag{
+	aclFlag := &cli.StringFlag{
 		Name:        "acl",
 		Usage:       "set acl to one of: private, public-read, public-read-write, authenticated-read, bucket-owner-read, bucket-owner-full-control, log-delivery-write",
-		Destination: &acl,
+		Destination: &o.ACL,
+	}
+	strictACLFlag := &cli.BoolFlag{
+		Name:  "strict-acl",
+		Usage: "fail, rather than warn and drop the acl, when the bucket has acls disabled",
+	}
+	verifyVisibilityFlag := &cli.BoolFlag{
+		Name:  "verify-visibility",
+		Usage: "after each upload, wait until the key is visible with the size and md5 uploaded, for eventually consistent stores",
+	}
+	visibilityTimeoutFlag := &cli.DurationFlag{
+		Name:  "visibility-timeout",
+		Usage: "with --verify-visibility, fail an upload not visible within this time",
+		Value: 30 * time.Second,
+	}
+	maxTotalBytesFlag := &cli.Int64Flag{
+		Name:  "max-total-bytes",
+		Usage: "stop transferring once this many bytes have been transferred",
+	}
+	maxTotalFilesFlag := &cli.IntFlag{
+		Name:  "max-total-files",
+		Usage: "stop transferring once this many files have been transferred",
+	}
+	partSizeFlag := &cli.Int64Flag{
+		Name:  "part-size",
+		Usage: "bytes per part of uploads in parts, at least 5MiB (0 for 6000000 on put-part, 10MiB otherwise)",
+	}
+	partConcurrencyFlag := &cli.IntFlag{
+		Name:  "part-concurrency",
+		Usage: "parts sent at once (0 for 2 per file, or for put-part -p across all files)",
+	}
+	// partOptions parses the --part-size and --part-concurrency flags,
+	// flagging the invocation as failed if invalid
+	partOptions := func(c *cli.Context) (mys3.PartOptions, bool) {
+		parts, err := ParsePartOptions(c.Int64("part-size"), c.Int("part-concurrency"))
+		checkErr(err)
+		return parts, err == nil
+	}
+	limits := func(c *cli.Context) TransferLimits {
+		return TransferLimits{
+			MaxBytes: c.Int64("max-total-bytes"),
+			MaxFiles: c.Int("max-total-files"),
+		}
+	}
+	decompressFlag := func(value string) *cli.StringFlag {
+		return &cli.StringFlag{
+			Name:  "decompress",
+			Usage: "gunzip contents: auto (.gz keys and those with Content-Encoding gzip), always or never",
+			Value: value,
+		}
 	}
-	publicFlag := cli.BoolFlag{
-		Name:        "public, P",
-		Usage:       "",
-		Destination: &public,
+	// decompress parses the --decompress flag, flagging the invocation as
+	// failed if invalid
+	decompress := func(c *cli.Context) (DecompressMode, bool) {
+		mode, err := ParseDecompressMode(c.String("decompress"))
+		checkErr(err)
+		return mode, err == nil
 	}
-	deleteFlag := cli.BoolFlag{
+	overwriteFlags := []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "overwrite",
+			Usage: "replace existing local files (the default)",
+		},
+		&cli.BoolFlag{
+			Name:  "skip-existing",
+			Usage: "leave existing local files untouched",
+		},
+		&cli.BoolFlag{
+			Name:  "newer-only",
+			Usage: "only replace existing local files older than the key",
+		},
+	}
+	// overwrite parses the overwrite policy flags, flagging the invocation
+	// as failed if more than one is given
+	overwrite := func(c *cli.Context) (OverwritePolicy, bool) {
+		policy, err := ParseOverwritePolicy(c.Bool("overwrite"), c.Bool("skip-existing"), c.Bool("newer-only"))
+		checkErr(err)
+		return policy, err == nil
+	}
+	// visibility returns the time to wait for uploads to become visible
+	visibility := func(c *cli.Context) time.Duration {
+		if !c.Bool("verify-visibility") {
+			return 0
+		}
+		return c.Duration("visibility-timeout")
+	}
+	publicFlag := &cli.BoolFlag{
+		Name:        "public",
+		Aliases:     []string{"P"},
+		Usage:       "shorthand for --acl public-read",
+		Destination: &o.Public,
+	}
+	protectFlag := &cli.StringSliceFlag{
+		Name:  "protect",
+		Usage: "never delete paths matching this pattern (gitignore syntax, as in " + keepFile + "), repeatable",
+	}
+	interactiveFlag := &cli.BoolFlag{
+		Name:  "i",
+		Usage: "ask before removing anything",
+	}
+	forceFlag := &cli.BoolFlag{
+		Name:  "force",
+		Usage: "never ask before removing, overriding -i and --confirm-over",
+	}
+	confirmOverFlag := &cli.IntFlag{
+		Name:    "confirm-over",
+		Usage:   "ask before removing more than this many keys (0 never asks)",
+		EnvVars: []string{"S3_CONFIRM_OVER"},
+	}
+	confirmFlags := []cli.Flag{interactiveFlag, forceFlag, confirmOverFlag}
+	// confirmation returns when to ask before removing, answered on stdin
+	confirmation := func(c *cli.Context) Confirmation {
+		return Confirmation{
+			Interactive: c.Bool("i"),
+			Over:        c.Int("confirm-over"),
+			Force:       c.Bool("force"),
+			In:          os.Stdin,
+		}
+	}
+	filterFlags := []cli.Flag{
+		&cli.StringFlag{
+			Name:  "newer-than",
+			Usage: "only keys modified less than this long ago, such as 7d or 12h",
+		},
+		&cli.StringFlag{
+			Name:  "older-than",
+			Usage: "only keys modified more than this long ago, such as 90d",
+		},
+		&cli.Int64Flag{
+			Name:  "min-size",
+			Usage: "only keys of at least this many bytes",
+		},
+		&cli.Int64Flag{
+			Name:  "max-size",
+			Usage: "only keys of at most this many bytes",
+		},
+	}
+	// keyFilter parses the age and size filters, flagging the invocation as
+	// failed if invalid
+	keyFilter := func(c *cli.Context) (*KeyFilter, bool) {
+		maxSize := int64(-1)
+		if c.IsSet("max-size") {
+			maxSize = c.Int64("max-size")
+		}
+		filter, err := ParseKeyFilter(c.String("newer-than"), c.String("older-than"), c.Int64("min-size"), maxSize)
+		checkErr(err)
+		return filter, err == nil
+	}
+	storageClassFlag := &cli.StringFlag{
+		Name:  "storage-class",
+		Usage: "storage class of uploaded keys, e.g. STANDARD_IA, GLACIER_IR or INTELLIGENT_TIERING",
+	}
+	// storageClass parses the --storage-class flag, flagging the invocation
+	// as failed if unknown
+	storageClass := func(c *cli.Context) (string, bool) {
+		if c.String("storage-class") == "" {
+			return "", true
+		}
+		class, err := ParseStorageClass(c.String("storage-class"))
+		checkErr(err)
+		return class, err == nil
+	}
+	sseFlags := []cli.Flag{
+		&cli.StringFlag{
+			Name:  "sse",
+			Usage: "server-side encryption of uploaded keys: aes256 or aws:kms",
+		},
+		&cli.StringFlag{
+			Name:  "sse-kms-key-id",
+			Usage: "kms key id, arn or alias for --sse aws:kms, instead of the aws managed key",
+		},
+	}
+	sseCustomerKeyFlag := &cli.StringFlag{
+		Name:  "sse-c-key",
+		Usage: "customer-provided 256 bit key (SSE-C), base64 encoded or in this file",
+	}
+	// encryption parses the --sse and --sse-c-key flags, flagging the
+	// invocation as failed if invalid
+	encryption := func(c *cli.Context) (Encryption, bool) {
+		e, err := ParseEncryption(c.String("sse"), c.String("sse-kms-key-id"), c.String("sse-c-key"))
+		checkErr(err)
+		return e, err == nil
+	}
+	headerFlags := []cli.Flag{
+		&cli.StringFlag{
+			Name:  "cache-control",
+			Usage: "Cache-Control header of uploaded keys, e.g. max-age=31536000",
+		},
+		&cli.StringFlag{
+			Name:  "content-encoding",
+			Usage: "Content-Encoding header of uploaded keys, e.g. gzip for precompressed files",
+		},
+		&cli.StringFlag{
+			Name:  "content-disposition",
+			Usage: "Content-Disposition header of uploaded keys, e.g. attachment",
+		},
+	}
+	contentTypeFlag := &cli.StringFlag{
+		Name:  "content-type",
+		Usage: "Content-Type of uploaded keys, instead of guessing from the extension or content",
+	}
+	checksumAlgorithmFlag := &cli.StringFlag{
+		Name:  "checksum-algorithm",
+		Usage: "sha256 or crc32c checksum recorded with uploads, or verified on download if recorded",
+	}
+	// checksumAlgorithm parses the --checksum-algorithm flag, flagging the
+	// invocation as failed if unknown
+	checksumAlgorithm := func(c *cli.Context) (string, bool) {
+		algorithm, err := ParseChecksumAlgorithm(c.String("checksum-algorithm"))
+		checkErr(err)
+		return algorithm, err == nil
+	}
+	multipartThresholdFlag := &cli.Int64Flag{
+		Name:  "multipart-threshold",
+		Usage: "upload files of at least this many bytes in parts, as put-part does (0 never)",
+		Value: DefaultMultipartThreshold,
+	}
+	taggingFlag := &cli.StringFlag{
+		Name:  "tagging",
+		Usage: "tag uploaded keys with comma separated key=value pairs, e.g. project=x,env=prod",
+	}
+	// objectTagging parses the --tagging flag, flagging the invocation as
+	// failed if invalid
+	objectTagging := func(c *cli.Context) (string, bool) {
+		tagging, err := ParseTagging(c.String("tagging"))
+		checkErr(err)
+		return tagging, err == nil
+	}
+	accelerateFlag := &cli.BoolFlag{
+		Name:  "accelerate",
+		Usage: "transfer through the bucket's transfer acceleration endpoint, checking first that it's enabled",
+	}
+	// accelerate checks the --accelerate flag, which needs aws's own
+	// endpoints, flagging the invocation as failed if it can't be used
+	accelerate := func(c *cli.Context) (bool, bool) {
+		if !c.Bool("accelerate") {
+			return false, true
+		}
+		var err error
+		switch {
+		case c.String("endpoint") != "":
+			err = errors.New("--accelerate uses aws's accelerate endpoint, so can't be used with --endpoint")
+		case c.Bool("use-fips"):
+			err = errors.New("--accelerate has no FIPS endpoint, so can't be used with --use-fips")
+		case c.Bool("force-path-style"):
+			err = errors.New("--accelerate addresses buckets by host name, so can't be used with --force-path-style")
+		}
+		checkErr(err)
+		return true, err == nil
+	}
+	resumeFlag := &cli.BoolFlag{
+		Name:  "resume",
+		Usage: "continue an incomplete upload of the same file from its next part, and leave failed uploads to be continued",
+	}
+	objectLockFlags := []cli.Flag{
+		&cli.StringFlag{
+			Name:  "object-lock-mode",
+			Usage: "object lock retention of uploaded keys: governance or compliance",
+		},
+		&cli.StringFlag{
+			Name:  "retain-until",
+			Usage: "end of the --object-lock-mode retention, a time such as 2030-01-02T15:04:05Z or an age such as 365d",
+		},
+		&cli.BoolFlag{
+			Name:  "legal-hold",
+			Usage: "place an object lock legal hold on uploaded keys",
+		},
+	}
+	// objectLock parses the object lock flags, flagging the invocation as
+	// failed if invalid
+	objectLock := func(c *cli.Context) (ObjectLock, bool) {
+		lock, err := ParseObjectLock(c.String("object-lock-mode"), c.String("retain-until"), c.Bool("legal-hold"))
+		checkErr(err)
+		return lock, err == nil
+	}
+	headers := func(c *cli.Context) Headers {
+		return Headers{
+			CacheControl:       c.String("cache-control"),
+			ContentEncoding:    c.String("content-encoding"),
+			ContentDisposition: c.String("content-disposition"),
+		}
+	}
+	excludeFlag := &cli.StringSliceFlag{
+		Name:  "exclude",
+		Usage: "leave out local paths matching this pattern (gitignore syntax, as in " + ignoreFile + "), repeatable",
+	}
+	includeFlag := &cli.StringSliceFlag{
+		Name:  "include",
+		Usage: "keep local paths matching this pattern despite --exclude, repeatable",
+	}
+	deleteFlag := &cli.BoolFlag{
 		Name:        "delete",
 		Usage:       "delete extraneous files from destination",
-		Destination: &deleteExtra,
+		Destination: &o.DeleteExtra,
+	}
+	followSymlinksFlag := &cli.BoolFlag{
+		Name:        "follow-symlinks",
+		Usage:       "follow symlinks and transfer their targets (default is to skip symlinks)",
+		Destination: &o.FollowSymlinks,
+	}
+	preserveFlag := &cli.BoolFlag{
+		Name:        "preserve",
+		Usage:       "store file mtime, mode and ownership in metadata on upload, and restore them on download",
+		Destination: &o.Preserve,
+	}
+	preserveSymlinksFlag := &cli.BoolFlag{
+		Name:        "preserve-symlinks",
+		Usage:       "store symlinks as zero-byte objects recording the link target, and restore them on download",
+		Destination: &o.PreserveSymlinks,
+	}
+
+	listBucketsAction := func(c *cli.Context) error {
+		conn := getConnection(c)
+		checkErr(RunListBuckets(ctx, conn, records()))
+		return nil
+	}
+	makeBucketAction := func(c *cli.Context) error {
+		if c.Args().Len() != 1 {
+			return showHelp(c)
+		}
+		tags, err := ParseTags(c.StringSlice("tag"))
+		if err != nil {
+			checkErr(err)
+			return nil
+		}
+		conn := getConnection(c)
+		opts := MakeBucketOptions{
+			ACL:    o.ACL,
+			Tags:   tags,
+			Region: c.String("region"),
+			Wait:   c.Bool("wait"),
+			// object lock implies versioning, which S3 enables with it
+			Versioning: c.Bool("versioning"),
+			ObjectLock: c.Bool("object-lock"),
+		}
+		if c.IsSet("sse") || c.IsSet("sse-kms-key-id") {
+			opts.Encryption = &BucketEncryptionOptions{
+				Algorithm: c.String("sse"),
+				KMSKeyID:  c.String("sse-kms-key-id"),
+			}
+			if !c.IsSet("sse") {
+				// a key implies kms
+				opts.Encryption.Algorithm = string(types.ServerSideEncryptionAwsKms)
+			}
+		}
+		err = RunMakeBucket(ctx, conn, c.Args().Slice(), opts)
+		checkErr(err)
+		return nil
+	}
+	waitFlag := &cli.BoolFlag{
+		Name:  "wait",
+		Usage: "wait until the bucket exists before returning",
+	}
+	bucketTagFlag := &cli.StringSliceFlag{
+		Name:    "tag",
+		Aliases: []string{"tags"},
+		Usage:   "tag the bucket with key=value, such as a cost allocation tag; may be repeated",
+	}
+	makeBucketFlags := []cli.Flag{
+		aclFlag,
+		bucketTagFlag,
+		waitFlag,
+		&cli.BoolFlag{
+			Name:  "versioning",
+			Usage: "enable versioning on the bucket",
+		},
+		&cli.BoolFlag{
+			Name:  "object-lock",
+			Usage: "enable object lock on the bucket, which also enables versioning",
+		},
+		&cli.StringFlag{
+			Name:  "sse",
+			Usage: "default encryption: aes256 (SSE-S3) or aws:kms (SSE-KMS)",
+		},
+		&cli.StringFlag{
+			Name:    "sse-kms-key-id",
+			Aliases: []string{"kms-key-id"},
+			Usage:   "kms key for aws:kms default encryption",
+		},
+	}
+	removeBucketsAction := func(c *cli.Context) error {
+		if c.Args().Len() == 0 {
+			return showHelp(c)
+		}
+		conn := getConnection(c)
+		err := RunRemoveBuckets(ctx, conn, c.Args().Slice(), RemoveBucketOptions{Confirm: confirmation(c)})
+		checkErr(err)
+		return nil
+	}
+
+	const (
+		categoryKeys     = "Keys"
+		categoryTransfer = "Transfer"
+		categoryBuckets  = "Buckets"
+	)
+
+	// useTarget sets the flags not given, on the command line or by their
+	// environment variables, to the settings of the --target name
+	useTarget := func(c *cli.Context, name string) error {
+		target, err := LoadTarget(configFile(), name)
+		if err != nil {
+			return err
+		}
+		for _, setting := range []struct{ flag, value string }{
+			{"endpoint", target.Endpoint},
+			{"region", target.Region},
+			{"profile", target.Profile},
+		} {
+			if setting.value != "" && !c.IsSet(setting.flag) {
+				if err := c.Set(setting.flag, setting.value); err != nil {
+					return err
+				}
+			}
+		}
+		if target.PathStyle != nil && !c.IsSet("force-path-style") && !c.IsSet("virtual-host-style") {
+			flag := "virtual-host-style"
+			if *target.PathStyle {
+				flag = "force-path-style"
+			}
+			if err := c.Set(flag, "true"); err != nil {
+				return err
+			}
+		}
+		if target.ACL != "" {
+			// the command's flags are yet to be parsed
+			aclFlag.Value = target.ACL
+		}
+		if target.ConfirmOver != 0 {
+			confirmOverFlag.Value = target.ConfirmOver
+		}
+		return nil
 	}
 
 	app := cli.NewApp()
@@ -153,215 +981,1203 @@ func Main(conn s3iface.S3API, args []string, output io.Writer) int {
 	app.Usage = "S3 utility knife"
 	app.Version = version
 	app.Flags = commonFlags
-	app.Writer = out
-	app.Commands = []cli.Command{
+	app.Before = func(c *cli.Context) error {
+		output.level = ParseLogLevel(c.Bool("v"), c.Bool("vv"), c.Bool("debug"))
+		format, err := ParseLogFormat(c.String("log-format"))
+		if err == nil {
+			output.format = format
+			if name := c.String("target"); name != "" {
+				err = useTarget(c, name)
+			}
+		}
+		if err == nil {
+			_, err = ParseExpectedBucketOwner(c.String("expected-bucket-owner"))
+		}
+		if err == nil {
+			_, err = ParseAssumeRole(c.String("role-arn"), c.String("external-id"), c.String("role-session-name"))
+		}
+		if err == nil {
+			keys, err = ParseStaticKeys(c.String("access-key"), c.String("access-key-file"),
+				c.String("secret-key"), c.String("secret-key-file"),
+				c.String("session-token"), c.String("session-token-file"))
+		}
+		if err == nil && keys != nil && c.String("profile") != "" {
+			err = errors.New("--access-key and --profile can't be used together")
+		}
+		if err == nil && c.String("profile") != "" {
+			_, err = loadProfile(c.String("profile"))
+		}
+		if err == nil {
+			mfa, err = ParseMFA(c.String("mfa-serial"), c.String("token-code"), os.Stdin)
+			if mfa != nil {
+				mfa.Out = output.errOut
+			}
+		}
+		if err == nil && (c.Bool("use-fips") || c.Bool("use-dualstack")) {
+			if c.String("endpoint") != "" {
+				err = errors.New("--use-fips and --use-dualstack choose an aws endpoint, so can't be used with --endpoint")
+			} else {
+				_, err = awsEndpoint(c.String("region"), c.Bool("use-fips"), c.Bool("use-dualstack"))
+			}
+		}
+		for _, endpoint := range parseEndpoints(c.String("endpoint")) {
+			if err == nil {
+				_, err = mys3.ParseEndpoint(endpoint)
+			}
+		}
+		if err == nil && c.Bool("force-path-style") && c.Bool("virtual-host-style") {
+			err = errors.New("--force-path-style and --virtual-host-style can't be used together")
+		}
+		if err == nil && c.Duration("timeout") < 0 {
+			err = errors.New("--timeout can't be negative")
+		}
+		if err == nil {
+			retry, err = ParseRetryPolicy(c.Int("max-retries"), c.String("retry-mode"))
+		}
+		if err == nil && (c.Float64("rps") < 0 || c.Float64("list-rps") < 0) {
+			err = errors.New("--rps and --list-rps can't be negative")
+		}
+		if err == nil {
+			listRPS := c.Float64("rps")
+			if c.IsSet("list-rps") {
+				listRPS = c.Float64("list-rps")
+			}
+			rates = newRequestRates(c.Float64("rps"), listRPS)
+		}
+		if err == nil {
+			tuning := TransportOptions{
+				MaxIdleConns:    c.Int("max-idle-conns"),
+				MaxConnsPerHost: c.Int("max-conns-per-host"),
+				IdleConnTimeout: c.Duration("idle-conn-timeout"),
+				KeepAlive:       c.Duration("keep-alive"),
+				ConnectTimeout:  c.Duration("connect-timeout"),
+			}
+			err = tuning.check()
+			if err == nil {
+				httpClient, err = newHTTPClient(c.String("ca-bundle"), c.Bool("insecure-skip-verify"), c.Duration("timeout"), tuning)
+			}
+		}
+		if err == nil && c.String("metrics-listen") != "" {
+			metrics = NewMetrics()
+			stopMetrics, err = serveMetrics(c.String("metrics-listen"), metrics)
+		}
+		if err == nil && c.String("output") != "" {
+			outputFile, err = os.Create(c.String("output"))
+			if err == nil {
+				output.out = outputFile
+				c.App.Writer = outputFile
+			}
+		}
+		checkErr(err)
+		return err
+	}
+	app.Writer = output.out
+	app.ErrWriter = output.errOut
+	app.Commands = []*cli.Command{
 		{
 			Name:      "cat",
 			Usage:     "Cat key contents",
 			ArgsUsage: "key ...",
-			Flags:     commonFlags,
-			Action: func(c *cli.Context) {
-				if len(c.Args()) == 0 {
-					cli.ShowCommandHelp(c, "cat")
-					exitCode = 1
-					return
+			Category:  categoryKeys,
+			Flags: append(operationFlags, decompressFlag("auto"), sseCustomerKeyFlag,
+				&cli.StringFlag{
+					Name:  "range",
+					Usage: "write only these bytes of each key, as stored: bytes=start-end, start- or -suffix (the last bytes)",
+				},
+				&cli.Int64Flag{
+					Name:  "offset",
+					Usage: "write each key from this byte, as stored",
+				},
+				&cli.Int64Flag{
+					Name:  "length",
+					Usage: "write only this many bytes of each key, as stored",
+				},
+				&cli.IntFlag{
+					Name:  "head",
+					Usage: "write only the first N lines of each key, reading no further",
+				},
+				&cli.IntFlag{
+					Name:  "tail",
+					Usage: "write only the last N lines of each key, fetching just the bytes at its end",
+				},
+			),
+			Action: func(c *cli.Context) error {
+				if c.Args().Len() == 0 {
+					return showHelp(c)
+				}
+				mode, ok := decompress(c)
+				if !ok {
+					return nil
+				}
+				byteRange, err := ParseByteRange(c.String("range"), c.Int64("offset"), c.Int64("length"))
+				head, tail := c.Int("head"), c.Int("tail")
+				switch {
+				case err != nil:
+				case head < 0 || tail < 0:
+					err = errors.New("--head and --tail can't be negative")
+				case head > 0 && tail > 0:
+					err = errors.New("--head and --tail can't be given together")
+				case byteRange != nil && (head > 0 || tail > 0):
+					err = errors.New("--head and --tail can't be given with a range")
+				}
+				if err != nil {
+					checkErr(err)
+					return nil
+				}
+				sse, ok := encryption(c)
+				if !ok {
+					return nil
 				}
 				conn := getConnection(c)
 				mys3 := getSession(c)
-				err := catKeys(conn, c.Args(), mys3)
+				opts := CatOptions{
+					CommonOptions: commonOptions(),
+					Decompress:    mode,
+					Range:         byteRange,
+					Head:          head,
+					Tail:          tail,
+				}
+				opts.Encryption = sse
+				err = RunCat(ctx, conn, mys3, c.Args().Slice(), opts)
 				checkErr(err)
+				return nil
+			},
+		},
+		{
+			Name:      "changes",
+			Usage:     "Report keys created, modified or deleted since a saved listing",
+			ArgsUsage: "s3://bucket/prefix",
+			Category:  categoryKeys,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "since",
+					Usage: "compare against this listing (csv), as written by --save",
+				},
+				&cli.StringFlag{
+					Name:  "save",
+					Usage: "write the current listing (csv) to this file, for a later --since",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				if c.Args().Len() != 1 {
+					return showHelp(c)
+				}
+				conn := getConnection(c)
+				mys3 := getSession(c)
+				opts := ChangesOptions{
+					CommonOptions: commonOptions(),
+					Since:         c.String("since"),
+					Save:          c.String("save"),
+				}
+				err := RunChanges(ctx, conn, mys3, c.Args().First(), opts)
+				checkErr(err)
+				return nil
+			},
+		},
+		{
+			Name:      "cp",
+			Usage:     "Copy a key, or every key in a plan-rename manifest, within s3",
+			ArgsUsage: "source dest",
+			Category:  categoryTransfer,
+			Flags: append([]cli.Flag{
+				&cli.StringFlag{
+					Name:  "manifest",
+					Usage: "copy each source to dest listed in this file (see plan-rename)",
+				},
+				&cli.StringFlag{
+					Name:  "metadata-directive",
+					Usage: "COPY the source's metadata and headers, or REPLACE the headers given",
+					Value: string(types.MetadataDirectiveCopy),
+				},
+			}, append(sseFlags, headerFlags...)...),
+			Action: func(c *cli.Context) error {
+				manifest := c.String("manifest")
+				if (manifest == "" && c.Args().Len() != 2) || (manifest != "" && c.Args().Len() != 0) {
+					return showHelp(c)
+				}
+				sse, ok := encryption(c)
+				if !ok {
+					return nil
+				}
+				directive, err := ParseMetadataDirective(c.String("metadata-directive"), headers(c))
+				if err != nil {
+					checkErr(err)
+					return nil
+				}
+				conn := getConnection(c)
+				opts := CopyOptions{CommonOptions: commonOptions(), Manifest: manifest, Encryption: sse}
+				opts.MetadataDirective = directive
+				opts.Headers = headers(c)
+				err = RunCopy(ctx, conn, c.Args().Get(0), c.Args().Get(1), opts)
+				checkErr(err)
+				return nil
 			},
 		},
 		{
 			Name:      "get",
 			Usage:     "Download keys",
-			ArgsUsage: "key ...",
-			Action: func(c *cli.Context) {
-				if len(c.Args()) == 0 {
-					cli.ShowCommandHelp(c, "get")
-					exitCode = 1
-					return
+			ArgsUsage: "key ... [-] | -r prefix ... localdir",
+			Category:  categoryTransfer,
+			Flags: append([]cli.Flag{
+				&cli.BoolFlag{
+					Name:    "recursive",
+					Aliases: []string{"r"},
+					Usage:   "download every key under each prefix into localdir, preserving the key hierarchy",
+				},
+				&cli.Int64Flag{
+					Name:  "range-threshold",
+					Usage: "fetch objects of at least this many bytes in concurrent ranges",
+					Value: DefaultRangeOptions.Threshold,
+				},
+				&cli.Int64Flag{
+					Name:  "range-size",
+					Usage: "bytes per range",
+					Value: DefaultRangeOptions.Size,
+				},
+				&cli.IntFlag{
+					Name:  "range-concurrency",
+					Usage: "ranges of an object fetched at once (1 disables ranged downloads)",
+					Value: DefaultRangeOptions.Concurrency,
+				},
+				decompressFlag("never"),
+				&cli.BoolFlag{
+					Name:  "no-verify",
+					Usage: "don't check downloads against the key's md5 (its etag, or the md5 recorded by put-part)",
+				},
+				&cli.StringFlag{
+					Name:  "output-template",
+					Usage: "lay out downloads by this template, e.g. {bucket}/{yyyy}/{mm}/{basename} (see README for placeholders)",
+				},
+				&cli.BoolFlag{
+					Name:  "resume",
+					Usage: "resume into existing local files shorter than their keys (partial " + partialSuffix + " files are always resumed)",
+				},
+				sseCustomerKeyFlag,
+				checksumAlgorithmFlag,
+				accelerateFlag,
+			}, overwriteFlags...),
+			Action: func(c *cli.Context) error {
+				recursive := c.Bool("recursive")
+				if c.Args().Len() == 0 || (recursive && c.Args().Len() < 2) {
+					return showHelp(c)
+				}
+				mode, ok := decompress(c)
+				if !ok {
+					return nil
+				}
+				policy, ok := overwrite(c)
+				if !ok {
+					return nil
+				}
+				sse, ok := encryption(c)
+				if !ok {
+					return nil
+				}
+				algorithm, ok := checksumAlgorithm(c)
+				if !ok {
+					return nil
+				}
+				accelerated, ok := accelerate(c)
+				if !ok {
+					return nil
+				}
+				var template *OutputTemplate
+				if c.IsSet("output-template") {
+					var err error
+					template, err = ParseOutputTemplate(c.String("output-template"))
+					if err != nil {
+						checkErr(err)
+						return nil
+					}
 				}
-				directory := c.Parent().String("directory")
-				onlyShow = c.Parent().Bool("onlyShow")
 				conn := getConnection(c)
 				mys3 := getSession(c)
-				err := getKeys(conn, c.Args(), mys3, directory)
+				opts := GetOptions{
+					CommonOptions: commonOptions(),
+					Directory:     c.String("directory"),
+					OnlyShow:      o.OnlyShow,
+					Recursive:     recursive,
+					Resume:        c.Bool("resume"),
+					Decompress:    mode,
+					NoVerify:      c.Bool("no-verify"),
+					Overwrite:     policy,
+					Template:      template,
+					Ranges: RangeOptions{
+						Threshold:   c.Int64("range-threshold"),
+						Size:        c.Int64("range-size"),
+						Concurrency: c.Int("range-concurrency"),
+					},
+				}
+				opts.Encryption = sse
+				opts.ChecksumAlgorithm = algorithm
+				opts.Accelerate = accelerated
+				opts.Progress = progress()
+				opts.Retry = retry
+				urls := c.Args().Slice()
+				if !recursive && len(urls) > 1 && urls[len(urls)-1] == streamArg {
+					opts.Stdout = true
+					urls = urls[:len(urls)-1]
+				}
+				if recursive {
+					opts.Directory = urls[len(urls)-1]
+					urls = urls[:len(urls)-1]
+					if isS3Url(opts.Directory) {
+						checkErr(errors.New("local destination directory required"))
+						return nil
+					}
+				}
+				err := RunGet(ctx, conn, mys3, urls, opts)
 				checkErr(err)
+				return nil
 			},
 		},
 		{
 			Name:      "grep",
 			Usage:     "Grep keys",
 			ArgsUsage: "string key ...",
+			Category:  categoryKeys,
 			Flags: []cli.Flag{
-				cli.BoolFlag{
+				&cli.BoolFlag{
 					Name:  "no-keys-prefix",
 					Usage: "Suppress the prefixing of key names on output",
 				},
-				cli.BoolFlag{
-					Name:  "keys-with-matches, l",
-					Usage: "only print the name of each key which contains matches",
+				&cli.BoolFlag{
+					Name:    "keys-with-matches",
+					Aliases: []string{"l"},
+					Usage:   "only print the name of each key which contains matches",
+				},
+				&cli.BoolFlag{
+					Name:    "invert-match",
+					Aliases: []string{"v"},
+					Usage:   "select the lines not containing the string",
+				},
+				&cli.BoolFlag{
+					Name:    "count",
+					Aliases: []string{"c"},
+					Usage:   "only print the number of lines selected in each key",
+				},
+				&cli.BoolFlag{
+					Name:    "line-number",
+					Aliases: []string{"n"},
+					Usage:   "prefix each line with its line number",
+				},
+				&cli.BoolFlag{
+					Name:    "byte-offset",
+					Aliases: []string{"b"},
+					Usage:   "prefix each line with the offset of its first byte in the key",
+				},
+				&cli.IntFlag{
+					Name:    "after-context",
+					Aliases: []string{"A"},
+					Usage:   "print this many lines after each selected line",
 				},
+				&cli.IntFlag{
+					Name:    "before-context",
+					Aliases: []string{"B"},
+					Usage:   "print this many lines before each selected line",
+				},
+				&cli.IntFlag{
+					Name:    "context",
+					Aliases: []string{"C"},
+					Usage:   "print this many lines before and after each selected line",
+				},
+				&cli.BoolFlag{
+					Name:  "select",
+					Usage: "search csv and json keys with S3 Select, fetching only the lines selected",
+				},
+				&cli.StringSliceFlag{
+					Name:  "include",
+					Usage: "search only keys matching this pattern (as in " + ignoreFile + "), repeatable",
+				},
+				&cli.StringSliceFlag{
+					Name:  "exclude",
+					Usage: "skip keys matching this pattern (as in " + ignoreFile + "), repeatable",
+				},
+				&cli.Int64Flag{
+					Name:  "max-matches",
+					Usage: "stop after this many lines are selected, over all the keys",
+				},
+				&cli.BoolFlag{
+					Name:    "text",
+					Aliases: []string{"a"},
+					Usage:   "search binary keys, those with a NUL byte near the start, which are otherwise skipped",
+				},
+				decompressFlag("auto"),
 			},
-			Action: func(c *cli.Context) {
-				if len(c.Args()) < 2 {
-					cli.ShowCommandHelp(c, "grep")
-					exitCode = 1
-					return
+			Action: func(c *cli.Context) error {
+				if c.Args().Len() < 2 {
+					return showHelp(c)
+				}
+				mode, ok := decompress(c)
+				if !ok {
+					return nil
+				}
+				before, after := c.Int("context"), c.Int("context")
+				if c.IsSet("before-context") {
+					before = c.Int("before-context")
+				}
+				if c.IsSet("after-context") {
+					after = c.Int("after-context")
+				}
+				if before < 0 || after < 0 {
+					checkErr(errors.New("context lines can't be negative"))
+					return nil
+				}
+				names, err := ParseNameFilter(c.StringSlice("include"), c.StringSlice("exclude"))
+				if err != nil {
+					checkErr(err)
+					return nil
 				}
 				conn := getConnection(c)
 				find := c.Args().First()
 				urls := c.Args().Tail()
 				mys3 := getSession(c)
-				err := grepKeys(conn, find, urls, c.Bool("no-keys-prefix"), c.Bool("keys-with-matches"), mys3)
+				opts := GrepOptions{
+					CommonOptions:   commonOptions(),
+					NoKeysPrefix:    c.Bool("no-keys-prefix"),
+					KeysWithMatches: c.Bool("keys-with-matches"),
+					Invert:          c.Bool("invert-match"),
+					Count:           c.Bool("count"),
+					LineNumbers:     c.Bool("line-number"),
+					ByteOffsets:     c.Bool("byte-offset"),
+					Before:          before,
+					After:           after,
+					Select:          c.Bool("select"),
+					Names:           names,
+					Text:            c.Bool("text"),
+					MaxMatches:      c.Int64("max-matches"),
+					Decompress:      mode,
+					Records:         records(),
+				}
+				err = RunGrep(ctx, conn, mys3, find, urls, opts)
 				checkErr(err)
+				return nil
 			},
 		},
 		{
 			Name:      "ls",
+			Aliases:   []string{"list"},
 			Usage:     "List buckets or keys",
 			ArgsUsage: "[bucket]",
-			Action: func(c *cli.Context) {
-				var err error
-				if len(c.Args()) < 1 {
-					conn := getConnection(c)
-					err = listBuckets(conn)
-				} else {
-					conn := getConnection(c)
-					mys3 := getSession(c)
-					err = listKeys(conn, c.Args(), mys3)
+			Category:  categoryKeys,
+			Flags: append([]cli.Flag{
+				followSymlinksFlag,
+				preserveSymlinksFlag,
+				&cli.BoolFlag{
+					Name:    "dirs",
+					Aliases: []string{"d"},
+					Usage:   "list one level, showing the prefixes beneath as directories",
+				},
+				&cli.BoolFlag{
+					Name:  "summarize",
+					Usage: "end with the total keys and bytes, even with -q or --json",
+				},
+				&cli.StringFlag{
+					Name:  "sort",
+					Usage: "order keys by name (a to z), size (biggest first) or mtime (newest first)",
+				},
+				&cli.BoolFlag{
+					Name:  "reverse",
+					Usage: "reverse the order of keys",
+				},
+				&cli.IntFlag{
+					Name:  "max",
+					Usage: "list only the first N keys in order",
+				},
+				&cli.BoolFlag{
+					Name:  "uploads",
+					Usage: "list incomplete multipart uploads (key, upload id and when initiated) after the keys",
+				},
+			}, filterFlags...),
+			Action: func(c *cli.Context) error {
+				symlinks, ok := o.symlinkMode(ctx)
+				if !ok {
+					exitCode = 1
+					return nil
+				}
+				if c.Args().Len() < 1 {
+					return listBucketsAction(c)
+				}
+				order, err := ParseListSort(c.String("sort"))
+				if err != nil {
+					checkErr(err)
+					return nil
+				}
+				filter, ok := keyFilter(c)
+				if !ok {
+					return nil
+				}
+				conn := getConnection(c)
+				mys3 := getSession(c)
+				opts := ListOptions{
+					CommonOptions: commonOptions(),
+					Dirs:          c.Bool("dirs"),
+					Summarize:     c.Bool("summarize"),
+					Records:       records(),
+					Sort:          order,
+					Reverse:       c.Bool("reverse"),
+					Max:           c.Int("max"),
+					Uploads:       c.Bool("uploads"),
 				}
+				opts.Symlinks = symlinks
+				opts.Filter = filter
+				err = RunList(ctx, conn, mys3, c.Args().Slice(), opts)
 				checkErr(err)
+				return nil
 			},
 		},
 		{
-			Name:      "mb",
-			Usage:     "Create bucket",
-			ArgsUsage: "bucket",
-			Action: func(c *cli.Context) {
-				if len(c.Args()) != 1 {
-					cli.ShowCommandHelp(c, "mb")
-					exitCode = 1
-					return
+			Name:      "plan-rename",
+			Usage:     "Preview the key renames produced by transform rules",
+			ArgsUsage: "url ...",
+			Category:  categoryKeys,
+			Flags: []cli.Flag{
+				&cli.StringSliceFlag{
+					Name:  "transform",
+					Usage: "sed-style rule s/pattern/replacement/[g] applied to each key; may be repeated",
+				},
+				&cli.StringFlag{
+					Name:  "manifest",
+					Usage: "write the old to new mapping to this file, for cp --manifest",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				if c.Args().Len() == 0 {
+					return showHelp(c)
 				}
 				conn := getConnection(c)
 				mys3 := getSession(c)
-				err := putBuckets(conn, c.Args(), mys3)
+				opts := PlanRenameOptions{
+					CommonOptions: commonOptions(),
+					Transforms:    c.StringSlice("transform"),
+					Manifest:      c.String("manifest"),
+				}
+				err := RunPlanRename(ctx, conn, mys3, c.Args().Slice(), opts)
 				checkErr(err)
+				return nil
 			},
 		},
 		{
 			Name:      "put",
 			Usage:     "Upload files",
 			ArgsUsage: "source [source ...] dest",
-			Flags:     []cli.Flag{aclFlag, publicFlag},
-			Action: func(c *cli.Context) {
-				if len(c.Args()) < 2 {
-					cli.ShowCommandHelp(c, "put")
-					exitCode = 1
-					return
+			Category:  categoryTransfer,
+			Flags:     append([]cli.Flag{aclFlag, publicFlag, strictACLFlag, followSymlinksFlag, preserveSymlinksFlag, preserveFlag, excludeFlag, includeFlag, storageClassFlag, verifyVisibilityFlag, visibilityTimeoutFlag, maxTotalBytesFlag, maxTotalFilesFlag, sseCustomerKeyFlag, contentTypeFlag, checksumAlgorithmFlag, multipartThresholdFlag, taggingFlag, partSizeFlag, partConcurrencyFlag, accelerateFlag}, append(sseFlags, append(headerFlags, objectLockFlags...)...)...),
+			Action: func(c *cli.Context) error {
+				if c.Args().Len() < 2 {
+					return showHelp(c)
 				}
-				if public {
-					acl = "public-read"
+				if o.Public {
+					o.ACL = "public-read"
 				}
-				if !validACL() {
+				symlinks, ok := o.symlinkMode(ctx)
+				if !o.validACL(ctx) || !ok {
 					exitCode = 1
-					return
+					return nil
+				}
+				class, ok := storageClass(c)
+				if !ok {
+					return nil
+				}
+				sse, ok := encryption(c)
+				if !ok {
+					return nil
+				}
+				algorithm, ok := checksumAlgorithm(c)
+				if !ok {
+					return nil
+				}
+				accelerated, ok := accelerate(c)
+				if !ok {
+					return nil
 				}
 				conn := getConnection(c)
-				args := c.Args()
+				args := c.Args().Slice()
 				sources := args[:len(args)-1]
 				destination := args[len(args)-1]
 				mys3 := getSession(c)
-				err := putKeys(conn, sources, destination, mys3)
+				opts := PutOptions{
+					CommonOptions:      commonOptions(),
+					MultipartThreshold: c.Int64("multipart-threshold"),
+				}
+				opts.ACL = o.ACL
+				opts.StrictACL = c.Bool("strict-acl")
+				opts.Visibility = visibility(c)
+				opts.Limits = limits(c)
+				opts.Exclude = c.StringSlice("exclude")
+				opts.Include = c.StringSlice("include")
+				opts.StorageClass = class
+				opts.Encryption = sse
+				opts.ChecksumAlgorithm = algorithm
+				opts.Accelerate = accelerated
+				opts.Headers = headers(c)
+				opts.ContentType = c.String("content-type")
+				opts.Tagging, ok = objectTagging(c)
+				if !ok {
+					return nil
+				}
+				opts.ObjectLock, ok = objectLock(c)
+				if !ok {
+					return nil
+				}
+				opts.Parts, ok = partOptions(c)
+				if !ok {
+					return nil
+				}
+				opts.Symlinks = symlinks
+				opts.Preserve = o.Preserve
+				opts.Progress = progress()
+				opts.Retry = retry
+				opts.Stdin = os.Stdin
+				err := RunPut(ctx, conn, mys3, sources, destination, opts)
 				checkErr(err)
+				return nil
 			},
 		},
 		{
 			Name:      "put-part",
 			Usage:     "Multipart Upload files",
 			ArgsUsage: "source [source ...] dest",
-			Flags:     []cli.Flag{aclFlag, publicFlag},
-			Action: func(c *cli.Context) {
-				if len(c.Args()) < 2 {
-					cli.ShowCommandHelp(c, "put-part")
-					exitCode = 1
-					return
+			Category:  categoryTransfer,
+			Flags:     append([]cli.Flag{aclFlag, publicFlag, strictACLFlag, followSymlinksFlag, preserveFlag, excludeFlag, includeFlag, storageClassFlag, verifyVisibilityFlag, visibilityTimeoutFlag, maxTotalBytesFlag, maxTotalFilesFlag, sseCustomerKeyFlag, contentTypeFlag, checksumAlgorithmFlag, taggingFlag, resumeFlag, partSizeFlag, partConcurrencyFlag}, append(sseFlags, append(headerFlags, objectLockFlags...)...)...),
+			Action: func(c *cli.Context) error {
+				if c.Args().Len() < 2 {
+					return showHelp(c)
 				}
-				if public {
-					acl = "public-read"
+				if o.Public {
+					o.ACL = "public-read"
 				}
-				if !validACL() {
+				symlinks, ok := o.symlinkMode(ctx)
+				if !o.validACL(ctx) || !ok {
 					exitCode = 1
-					return
+					return nil
+				}
+				class, ok := storageClass(c)
+				if !ok {
+					return nil
+				}
+				sse, ok := encryption(c)
+				if !ok {
+					return nil
+				}
+				algorithm, ok := checksumAlgorithm(c)
+				if !ok {
+					return nil
 				}
 				conn := getConnection(c)
-				args := c.Args()
+				args := c.Args().Slice()
 				sources := args[:len(args)-1]
 				destination := args[len(args)-1]
 				mys3 := getSession(c)
-				err := multiPartPutKeys(conn, sources, destination, mys3)
-				checkErr(err)
-			},
-		},
-		{
-			Name:      "rb",
-			Usage:     "Remove bucket(s)",
-			ArgsUsage: "bucket ...",
-			Action: func(c *cli.Context) {
-				if len(c.Args()) == 0 {
-					cli.ShowCommandHelp(c, "rb")
-					exitCode = 1
-					return
+				opts := PutOptions{
+					CommonOptions: commonOptions(),
+					Multipart:     true,
 				}
-				conn := getConnection(c)
-				mys3 := getSession(c)
-				err := rmBuckets(conn, c.Args(), mys3)
+				opts.ACL = o.ACL
+				opts.StrictACL = c.Bool("strict-acl")
+				opts.Visibility = visibility(c)
+				opts.Limits = limits(c)
+				opts.Exclude = c.StringSlice("exclude")
+				opts.Include = c.StringSlice("include")
+				opts.StorageClass = class
+				opts.Encryption = sse
+				opts.ChecksumAlgorithm = algorithm
+				opts.Headers = headers(c)
+				opts.ContentType = c.String("content-type")
+				opts.Tagging, ok = objectTagging(c)
+				if !ok {
+					return nil
+				}
+				opts.ObjectLock, ok = objectLock(c)
+				if !ok {
+					return nil
+				}
+				opts.Parts, ok = partOptions(c)
+				if !ok {
+					return nil
+				}
+				opts.Resume = c.Bool("resume")
+				opts.Symlinks = symlinks
+				opts.Preserve = o.Preserve
+				opts.Progress = progress()
+				opts.Retry = retry
+				opts.Stdin = os.Stdin
+				err := RunPut(ctx, conn, mys3, sources, destination, opts)
 				checkErr(err)
+				return nil
 			},
 		},
 		{
 			Name:      "rm",
+			Aliases:   []string{"del"},
 			Usage:     "Remove keys",
-			ArgsUsage: "key ...",
-			Action: func(c *cli.Context) {
-				if len(c.Args()) == 0 {
-					cli.ShowCommandHelp(c, "rm")
-					exitCode = 1
-					return
+			ArgsUsage: "key ... | -r prefix ... | --version-id id key",
+			Category:  categoryKeys,
+			Flags: append([]cli.Flag{protectFlag,
+				&cli.BoolFlag{
+					Name:    "recursive",
+					Aliases: []string{"r"},
+					Usage:   "remove every key under each prefix (always the case, accepted as for aws s3 rm)",
+				},
+				&cli.StringFlag{
+					Name:  "version-id",
+					Usage: "remove this version of a single key, or delete marker, undeleting the key if it was the latest",
+				},
+				&cli.BoolFlag{
+					Name:  "bypass-governance-retention",
+					Usage: "remove versions under governance mode object lock retention (requires s3:BypassGovernanceRetention)",
+				},
+			}, append(filterFlags, confirmFlags...)...),
+			Action: func(c *cli.Context) error {
+				if c.Args().Len() == 0 {
+					return showHelp(c)
+				}
+				filter, ok := keyFilter(c)
+				if !ok {
+					return nil
 				}
 				conn := getConnection(c)
 				mys3 := getSession(c)
-				err := rmKeys(conn, c.Args(), mys3)
+				opts := RmOptions{
+					CommonOptions:    commonOptions(),
+					Protect:          c.StringSlice("protect"),
+					Confirm:          confirmation(c),
+					VersionID:        c.String("version-id"),
+					BypassGovernance: c.Bool("bypass-governance-retention"),
+					MFA:              mfa,
+				}
+				opts.Filter = filter
+				err := RunRm(ctx, conn, mys3, c.Args().Slice(), opts)
 				checkErr(err)
+				return nil
 			},
 		},
 		{
 			Name:      "sync",
 			Usage:     "Synchronise local to s3, s3 to s3 or s3 to local",
 			ArgsUsage: "source dest",
-			Flags:     []cli.Flag{aclFlag, publicFlag, deleteFlag},
-			Action: func(c *cli.Context) {
-				if len(c.Args()) != 2 {
-					cli.ShowCommandHelp(c, "sync")
-					exitCode = 1
-					return
+			Category:  categoryTransfer,
+			Flags: append([]cli.Flag{aclFlag, publicFlag, strictACLFlag, deleteFlag, protectFlag, followSymlinksFlag, preserveSymlinksFlag, preserveFlag, excludeFlag, includeFlag, storageClassFlag, verifyVisibilityFlag, visibilityTimeoutFlag, maxTotalBytesFlag, maxTotalFilesFlag,
+				&cli.StringFlag{
+					Name:  "manifest",
+					Usage: "write a json manifest of transferred files (key, size, md5, version id) to this file",
+				},
+				&cli.StringFlag{
+					Name:  "from-manifest",
+					Usage: "only transfer the keys listed in this manifest file",
+				},
+				&cli.StringFlag{
+					Name:  "failures-file",
+					Usage: "with --ignore-errors, write the failed keys and errors to this file",
+				},
+				&cli.StringFlag{
+					Name:  "retry-file",
+					Usage: "only transfer the keys listed in a file written by --failures-file",
+				},
+				&cli.BoolFlag{
+					Name:  "adaptive",
+					Usage: "tune parallelism from observed throughput and throttling (ignored if -p is given)",
+				},
+				contentTypeFlag,
+				checksumAlgorithmFlag,
+				taggingFlag,
+				partSizeFlag,
+				partConcurrencyFlag,
+			}, append(overwriteFlags, append(sseFlags, append(headerFlags, append(objectLockFlags, append(filterFlags, confirmFlags...)...)...)...)...)...),
+			Action: func(c *cli.Context) error {
+				if c.Args().Len() != 2 {
+					return showHelp(c)
 				}
-				if public {
-					acl = "public-read"
+				if o.Public {
+					o.ACL = "public-read"
 				}
-				if !validACL() {
+				symlinks, ok := o.symlinkMode(ctx)
+				if !o.validACL(ctx) || !ok {
 					exitCode = 1
-					return
+					return nil
+				}
+				class, ok := storageClass(c)
+				if !ok {
+					return nil
+				}
+				sse, ok := encryption(c)
+				if !ok {
+					return nil
+				}
+				algorithm, ok := checksumAlgorithm(c)
+				if !ok {
+					return nil
+				}
+				policy, ok := overwrite(c)
+				if !ok {
+					return nil
+				}
+				filter, ok := keyFilter(c)
+				if !ok {
+					return nil
 				}
 				conn := getConnection(c)
 				mys3 := getSession(c)
-				err := syncFiles(conn, c.Args()[0], c.Args()[1], mys3)
+				opts := SyncOptions{
+					CommonOptions: commonOptions(),
+					Delete:        o.DeleteExtra,
+					Manifest:      c.String("manifest"),
+					FromManifest:  c.String("from-manifest"),
+					FailuresFile:  c.String("failures-file"),
+					RetryFile:     c.String("retry-file"),
+					Protect:       c.StringSlice("protect"),
+					Overwrite:     policy,
+					Confirm:       confirmation(c),
+					// an explicit -p fixes the parallelism
+					Adaptive: c.Bool("adaptive") && !c.IsSet("p"),
+				}
+				opts.ACL = o.ACL
+				opts.StrictACL = c.Bool("strict-acl")
+				opts.Visibility = visibility(c)
+				opts.Limits = limits(c)
+				opts.Exclude = c.StringSlice("exclude")
+				opts.Include = c.StringSlice("include")
+				opts.Filter = filter
+				opts.StorageClass = class
+				opts.Encryption = sse
+				opts.ChecksumAlgorithm = algorithm
+				opts.Headers = headers(c)
+				opts.ContentType = c.String("content-type")
+				opts.Tagging, ok = objectTagging(c)
+				if !ok {
+					return nil
+				}
+				opts.ObjectLock, ok = objectLock(c)
+				if !ok {
+					return nil
+				}
+				opts.Parts, ok = partOptions(c)
+				if !ok {
+					return nil
+				}
+				opts.Symlinks = symlinks
+				opts.Preserve = o.Preserve
+				opts.Progress = progress()
+				opts.Retry = retry
+				err := RunSync(ctx, conn, mys3, c.Args().Get(0), c.Args().Get(1), opts)
 				checkErr(err)
+				return nil
 			},
 		},
+		{
+			Name:      "tier",
+			Usage:     "Transition old keys to another storage class by copying them in place",
+			ArgsUsage: "url ...",
+			Category:  categoryKeys,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "older-than",
+					Usage: "only keys last modified at least this long ago, e.g. 90d or 12h",
+					Value: "0d",
+				},
+				&cli.StringFlag{
+					Name:  "to",
+					Usage: "storage class to transition to, e.g. STANDARD_IA or GLACIER",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				if c.Args().Len() == 0 {
+					return showHelp(c)
+				}
+				age, err := ParseAge(c.String("older-than"))
+				if err != nil {
+					checkErr(err)
+					return nil
+				}
+				conn := getConnection(c)
+				mys3 := getSession(c)
+				opts := TierOptions{
+					CommonOptions: commonOptions(),
+					OlderThan:     age,
+					StorageClass:  c.String("to"),
+				}
+				err = RunTier(ctx, conn, mys3, c.Args().Slice(), opts)
+				checkErr(err)
+				return nil
+			},
+		},
+		{
+			Name:     "mpu",
+			Usage:    "List or abort incomplete multipart uploads, whose parts are billed until aborted",
+			Category: categoryTransfer,
+			Subcommands: []*cli.Command{
+				{
+					Name:      "ls",
+					Usage:     "List incomplete multipart uploads and the size of their parts",
+					ArgsUsage: "bucket|url ...",
+					Flags:     []cli.Flag{olderThanUploadFlag},
+					Action: func(c *cli.Context) error {
+						return multipartAction(c, RunListMultipartUploads)
+					},
+				},
+				{
+					Name:      "abort",
+					Usage:     "Abort incomplete multipart uploads, deleting their parts",
+					ArgsUsage: "bucket|url ...",
+					Flags:     []cli.Flag{olderThanUploadFlag},
+					Action: func(c *cli.Context) error {
+						return multipartAction(c, RunAbortMultipartUploads)
+					},
+				},
+			},
+		},
+		{
+			Name:  "fake-server",
+			Usage: "Serve a minimal S3 API backed by a local directory, for testing offline",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "addr",
+					Usage: "address to listen on",
+					Value: ":9000",
+				},
+				&cli.StringFlag{
+					Name:  "dir",
+					Usage: "directory to keep buckets in, or in memory if not given",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				opts := FakeServerOptions{
+					Addr: c.String("addr"),
+					Dir:  c.String("dir"),
+				}
+				err := RunFakeServer(ctx, opts)
+				checkErr(err)
+				return nil
+			},
+		},
+		{
+			Name:      "version",
+			Usage:     "Show version, and with --verbose build details and endpoint capabilities",
+			ArgsUsage: "[s3://bucket]",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  "verbose",
+					Usage: "include build details, and probe the endpoint when a bucket is given",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				var conn S3API
+				url := c.Args().First()
+				if url != "" {
+					conn = getConnection(c)
+				}
+				err := RunVersion(ctx, conn, url, VersionOptions{Verbose: c.Bool("verbose")})
+				checkErr(err)
+				return nil
+			},
+		},
+		{
+			Name:     "bucket",
+			Usage:    "Manage buckets",
+			Category: categoryBuckets,
+			Subcommands: []*cli.Command{
+				{
+					Name:    "list",
+					Aliases: []string{"ls"},
+					Usage:   "List buckets",
+					Action:  listBucketsAction,
+				},
+				{
+					Name:      "create",
+					Aliases:   []string{"mb"},
+					Usage:     "Create bucket",
+					ArgsUsage: "bucket",
+					Flags:     makeBucketFlags,
+					Action:    makeBucketAction,
+				},
+				{
+					Name:      "remove",
+					Aliases:   []string{"rb"},
+					Usage:     "Remove bucket(s)",
+					ArgsUsage: "bucket ...",
+					Flags:     []cli.Flag{interactiveFlag, forceFlag},
+					Action:    removeBucketsAction,
+				},
+				{
+					Name:  "encryption",
+					Usage: "Show or set default bucket encryption",
+					Subcommands: []*cli.Command{
+						{
+							Name:      "get",
+							Usage:     "Show default encryption",
+							ArgsUsage: "bucket ...",
+							Action: func(c *cli.Context) error {
+								if c.Args().Len() == 0 {
+									return showHelp(c)
+								}
+								conn := getConnection(c)
+								err := RunGetBucketEncryption(ctx, conn, c.Args().Slice())
+								checkErr(err)
+								return nil
+							},
+						},
+						{
+							Name:      "set",
+							Usage:     "Set default encryption",
+							ArgsUsage: "bucket ...",
+							Flags: []cli.Flag{
+								&cli.StringFlag{
+									Name:  "sse",
+									Usage: "encryption: aes256 (SSE-S3) or aws:kms (SSE-KMS)",
+									Value: "aes256",
+								},
+								&cli.StringFlag{
+									Name:    "sse-kms-key-id",
+									Aliases: []string{"kms-key-id"},
+									Usage:   "kms key for aws:kms, defaulting to the aws managed key",
+								},
+								&cli.BoolFlag{
+									Name:  "bucket-key",
+									Usage: "use an s3 bucket key to reduce kms requests",
+								},
+							},
+							Action: func(c *cli.Context) error {
+								if c.Args().Len() == 0 {
+									return showHelp(c)
+								}
+								conn := getConnection(c)
+								opts := BucketEncryptionOptions{
+									Algorithm: c.String("sse"),
+									KMSKeyID:  c.String("sse-kms-key-id"),
+									BucketKey: c.Bool("bucket-key"),
+								}
+								err := RunSetBucketEncryption(ctx, conn, c.Args().Slice(), opts)
+								checkErr(err)
+								return nil
+							},
+						},
+					},
+				},
+				{
+					Name:  "tag",
+					Usage: "Show or set bucket tags",
+					Subcommands: []*cli.Command{
+						{
+							Name:      "get",
+							Usage:     "Show bucket tags",
+							ArgsUsage: "bucket ...",
+							Action: func(c *cli.Context) error {
+								if c.Args().Len() == 0 {
+									return showHelp(c)
+								}
+								conn := getConnection(c)
+								err := RunGetBucketTagging(ctx, conn, c.Args().Slice())
+								checkErr(err)
+								return nil
+							},
+						},
+						{
+							Name:      "set",
+							Usage:     "Replace bucket tags",
+							ArgsUsage: "bucket ...",
+							Flags:     []cli.Flag{bucketTagFlag},
+							Action: func(c *cli.Context) error {
+								if c.Args().Len() == 0 {
+									return showHelp(c)
+								}
+								tags, err := ParseTags(c.StringSlice("tag"))
+								if err != nil {
+									checkErr(err)
+									return nil
+								}
+								conn := getConnection(c)
+								err = RunSetBucketTagging(ctx, conn, c.Args().Slice(), tags)
+								checkErr(err)
+								return nil
+							},
+						},
+					},
+				},
+				{
+					Name:  "public-access-block",
+					Usage: "Show or set the bucket public access block",
+					Subcommands: []*cli.Command{
+						{
+							Name:      "get",
+							Usage:     "Show the public access block",
+							ArgsUsage: "bucket ...",
+							Action: func(c *cli.Context) error {
+								if c.Args().Len() == 0 {
+									return showHelp(c)
+								}
+								conn := getConnection(c)
+								err := RunGetPublicAccessBlock(ctx, conn, c.Args().Slice())
+								checkErr(err)
+								return nil
+							},
+						},
+						{
+							Name:      "set",
+							Usage:     "Set the public access block, blocking all public access unless told otherwise",
+							ArgsUsage: "bucket ...",
+							Flags: []cli.Flag{
+								&cli.BoolFlag{Name: "block-public-acls", Value: true, Usage: "reject requests that grant public acls"},
+								&cli.BoolFlag{Name: "ignore-public-acls", Value: true, Usage: "ignore existing public acls"},
+								&cli.BoolFlag{Name: "block-public-policy", Value: true, Usage: "reject bucket policies that grant public access"},
+								&cli.BoolFlag{Name: "restrict-public-buckets", Value: true, Usage: "restrict access under public policies to aws principals"},
+							},
+							Action: func(c *cli.Context) error {
+								if c.Args().Len() == 0 {
+									return showHelp(c)
+								}
+								conn := getConnection(c)
+								opts := PublicAccessBlockOptions{
+									BlockPublicAcls:       c.Bool("block-public-acls"),
+									IgnorePublicAcls:      c.Bool("ignore-public-acls"),
+									BlockPublicPolicy:     c.Bool("block-public-policy"),
+									RestrictPublicBuckets: c.Bool("restrict-public-buckets"),
+								}
+								err := RunSetPublicAccessBlock(ctx, conn, c.Args().Slice(), opts)
+								checkErr(err)
+								return nil
+							},
+						},
+					},
+				},
+			},
+		},
+		// short forms of the bucket commands, kept for compatibility
+		{
+			Name:      "mb",
+			Usage:     "Create bucket",
+			ArgsUsage: "bucket",
+			Hidden:    true,
+			Flags:     makeBucketFlags,
+			Action:    makeBucketAction,
+		},
+		{
+			Name:      "rb",
+			Usage:     "Remove bucket(s)",
+			ArgsUsage: "bucket ...",
+			Hidden:    true,
+			Flags:     []cli.Flag{interactiveFlag, forceFlag},
+			Action:    removeBucketsAction,
+		},
+	}
+	err := app.RunContext(ctx, args)
+	stopDashboard()
+	if stopMetrics != nil {
+		stopMetrics()
+	}
+	if outputFile != nil {
+		if cerr := outputFile.Close(); cerr != nil && err == nil {
+			checkErr(cerr)
+		}
+	}
+	if err != nil {
+		// flag parsing and validation errors have already been reported
+		exitCode = 1
+	}
+	if sig := interrupted.caught(); sig != nil {
+		if !reported {
+			fmt.Fprintf(output.errOut, "Interrupted by %s\n", signalName(sig))
+		}
+		exitCode = interruptedExitCode(sig)
 	}
-	app.Run(args)
 	return exitCode
 }
@@ -0,0 +1,86 @@
+package s3
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+	"sync"
+)
+
+// ManifestEntry records a single transferred file.
+type ManifestEntry struct {
+	Key       string `json:"key"`
+	Size      int64  `json:"size"`
+	MD5       string `json:"md5"`
+	VersionID string `json:"version_id,omitempty"`
+}
+
+// Versioned is implemented by filesystems able to report the version id
+// assigned to files they have created.
+type Versioned interface {
+	VersionID(path string) string
+}
+
+// manifestRecorder collects entries from concurrent sync workers.
+type manifestRecorder struct {
+	sync.Mutex
+	entries []ManifestEntry
+}
+
+func (m *manifestRecorder) record(ctx context.Context, file File, fs Filesystem) {
+	entry := ManifestEntry{
+		Key:  file.Relative(),
+		Size: file.Size(),
+		MD5:  hex.EncodeToString(file.MD5(ctx)),
+	}
+	if v, ok := fs.(Versioned); ok {
+		entry.VersionID = v.VersionID(file.Relative())
+	}
+	m.Lock()
+	defer m.Unlock()
+	m.entries = append(m.entries, entry)
+}
+
+func (m *manifestRecorder) write(filename string) error {
+	m.Lock()
+	defer m.Unlock()
+	sort.Slice(m.entries, func(i, j int) bool {
+		return m.entries[i].Key < m.entries[j].Key
+	})
+	entries := m.entries
+	if entries == nil {
+		entries = []ManifestEntry{}
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, append(data, '\n'), 0666)
+}
+
+// ReadManifest loads the entries of a manifest written by sync --manifest.
+func ReadManifest(filename string) ([]ManifestEntry, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var entries []ManifestEntry
+	err = json.Unmarshal(data, &entries)
+	return entries, err
+}
+
+// filterFiles passes through only those files whose relative path is in keys.
+func filterFiles(ch <-chan File, keys map[string]bool) <-chan File {
+	filtered := make(chan File, 1000)
+	go func() {
+		defer close(filtered)
+		for file := range ch {
+			if keys[file.Relative()] {
+				filtered <- file
+			}
+		}
+	}()
+	return filtered
+}
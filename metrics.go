@@ -0,0 +1,225 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// transferBuckets are the upper bounds, in seconds, of the buckets of the
+// histogram of transfer durations.
+var transferBuckets = []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300}
+
+// Metrics are the Prometheus metrics of a run, served on --metrics-listen
+// for long-running syncs to be watched: requests by operation and status,
+// their retries, the bytes transferred, the transfers queued and in
+// progress, and how long they took. A nil *Metrics records nothing.
+type Metrics struct {
+	mu         sync.Mutex
+	requests   map[[2]string]int64       // by operation and status
+	retries    map[string]int64          // by operation
+	bytes      map[string]int64          // by action
+	durations  map[string]*durationCount // by action
+	queued     int64                     // transfers of sync waiting their turn
+	inProgress int64
+}
+
+// durationCount is a histogram of durations, counted by transferBuckets.
+type durationCount struct {
+	buckets []int64 // not cumulative, with the last above them all
+	sum     float64
+	count   int64
+}
+
+// NewMetrics returns metrics with nothing recorded.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		requests:  map[[2]string]int64{},
+		retries:   map[string]int64{},
+		bytes:     map[string]int64{},
+		durations: map[string]*durationCount{},
+	}
+}
+
+// queue records a transfer waiting its turn.
+func (m *Metrics) queue() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.queued++
+}
+
+// dequeue records a queued transfer's turn having come.
+func (m *Metrics) dequeue() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.queued--
+}
+
+// start records that a transfer has begun.
+func (m *Metrics) start() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inProgress++
+}
+
+// done records the end of a transfer begun with start, which returned err:
+// the bytes and duration of those that succeeded.
+func (m *Metrics) done(action string, nbytes int64, took time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inProgress--
+	if err != nil {
+		return
+	}
+	m.bytes[action] += nbytes
+	d := m.durations[action]
+	if d == nil {
+		d = &durationCount{buckets: make([]int64, len(transferBuckets)+1)}
+		m.durations[action] = d
+	}
+	seconds := took.Seconds()
+	d.buckets[sort.SearchFloat64s(transferBuckets, seconds)]++
+	d.sum += seconds
+	d.count++
+}
+
+// metricsAttemptsKey keeps the attempts made of a request.
+type metricsAttemptsKey struct{}
+
+// install adds the middleware counting requests by operation and the status
+// of their responses, and the retries of them.
+func (m *Metrics) install(stack *middleware.Stack) error {
+	if m == nil {
+		return nil
+	}
+	operation := middleware.InitializeMiddlewareFunc("s3.MetricsAttempts", func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+		ctx = middleware.WithStackValue(ctx, metricsAttemptsKey{}, new(int))
+		return next.HandleInitialize(ctx, in)
+	})
+	if err := stack.Initialize.Add(operation, middleware.After); err != nil {
+		return err
+	}
+	attempt := middleware.FinalizeMiddlewareFunc("s3.Metrics", func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+		out, metadata, err := next.HandleFinalize(ctx, in)
+		name := middleware.GetOperationName(ctx)
+		status := "none"
+		if resp, ok := awsmiddleware.GetRawResponse(metadata).(*smithyhttp.Response); ok {
+			status = fmt.Sprint(resp.StatusCode)
+		}
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.requests[[2]string{name, status}]++
+		if attempts, ok := middleware.GetStackValue(ctx, metricsAttemptsKey{}).(*int); ok {
+			if *attempts++; *attempts > 1 {
+				m.retries[name]++
+			}
+		}
+		return out, metadata, err
+	})
+	// innermost, so each attempt is counted as it's sent
+	return stack.Finalize.Add(attempt, middleware.After)
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.write(w)
+}
+
+// write writes the metrics in the Prometheus text format, their series in
+// order of their labels.
+func (m *Metrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fmt.Fprintln(w, "# HELP s3_requests_total Requests made, by operation and the http status of the response.")
+	fmt.Fprintln(w, "# TYPE s3_requests_total counter")
+	var requests [][2]string
+	for labels := range m.requests {
+		requests = append(requests, labels)
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		return requests[i][0] < requests[j][0] || requests[i][0] == requests[j][0] && requests[i][1] < requests[j][1]
+	})
+	for _, labels := range requests {
+		fmt.Fprintf(w, "s3_requests_total{operation=%q,status=%q} %d\n", labels[0], labels[1], m.requests[labels])
+	}
+	fmt.Fprintln(w, "# HELP s3_request_retries_total Requests sent again after failing, by operation.")
+	fmt.Fprintln(w, "# TYPE s3_request_retries_total counter")
+	for _, name := range sortedKeys(m.retries) {
+		fmt.Fprintf(w, "s3_request_retries_total{operation=%q} %d\n", name, m.retries[name])
+	}
+	fmt.Fprintln(w, "# HELP s3_transferred_bytes_total Bytes of the files transferred, by action.")
+	fmt.Fprintln(w, "# TYPE s3_transferred_bytes_total counter")
+	for _, action := range sortedKeys(m.bytes) {
+		fmt.Fprintf(w, "s3_transferred_bytes_total{action=%q} %d\n", action, m.bytes[action])
+	}
+	fmt.Fprintln(w, "# HELP s3_transfer_duration_seconds How long the files transferred took, by action.")
+	fmt.Fprintln(w, "# TYPE s3_transfer_duration_seconds histogram")
+	var actions []string
+	for action := range m.durations {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+	for _, action := range actions {
+		d := m.durations[action]
+		var cumulative int64
+		for i, le := range transferBuckets {
+			cumulative += d.buckets[i]
+			fmt.Fprintf(w, "s3_transfer_duration_seconds_bucket{action=%q,le=\"%g\"} %d\n", action, le, cumulative)
+		}
+		fmt.Fprintf(w, "s3_transfer_duration_seconds_bucket{action=%q,le=\"+Inf\"} %d\n", action, d.count)
+		fmt.Fprintf(w, "s3_transfer_duration_seconds_sum{action=%q} %g\n", action, d.sum)
+		fmt.Fprintf(w, "s3_transfer_duration_seconds_count{action=%q} %d\n", action, d.count)
+	}
+	fmt.Fprintln(w, "# HELP s3_transfers_queued Transfers of a sync waiting their turn.")
+	fmt.Fprintln(w, "# TYPE s3_transfers_queued gauge")
+	fmt.Fprintf(w, "s3_transfers_queued %d\n", m.queued)
+	fmt.Fprintln(w, "# HELP s3_transfers_in_progress Transfers begun and not yet done.")
+	fmt.Fprintln(w, "# TYPE s3_transfers_in_progress gauge")
+	fmt.Fprintf(w, "s3_transfers_in_progress %d\n", m.inProgress)
+}
+
+// sortedKeys returns the keys of counts in order.
+func sortedKeys(counts map[string]int64) []string {
+	var keys []string
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// serveMetrics serves m on /metrics at addr until stopped, returning an
+// error if it can't listen there.
+func serveMetrics(addr string, m *Metrics) (stop func(), err error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("--metrics-listen: %s", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m)
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	return func() { server.Close() }, nil
+}
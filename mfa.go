@@ -0,0 +1,91 @@
+package s3
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+var tokenCodePattern = regexp.MustCompile(`^\d{6}$`)
+
+// MFA is the multi-factor authentication device whose codes authorize
+// assuming a role and deleting versions of keys in buckets with MFA delete.
+type MFA struct {
+	Serial string    // serial number or arn of the device
+	In     io.Reader // codes asked for, normally stdin
+	Out    io.Writer // prompted for, normally stderr
+
+	mu   sync.Mutex
+	code string // given, or the last entered
+	// the code has been used to assume a role, which a code can be only once
+	assumed bool
+}
+
+// ParseMFA checks the --mfa-serial and --token-code flags, codes otherwise
+// being asked for from in. It returns nil without a device.
+func ParseMFA(serial, code string, in io.Reader) (*MFA, error) {
+	if serial == "" {
+		if code != "" {
+			return nil, errors.New("--token-code needs an --mfa-serial")
+		}
+		return nil, nil
+	}
+	if code != "" && !tokenCodePattern.MatchString(code) {
+		return nil, fmt.Errorf("--token-code must be 6 digits, not %q", code)
+	}
+	return &MFA{Serial: serial, In: in, Out: os.Stderr, code: code}, nil
+}
+
+// ask prompts for a code from the device. The caller must hold the lock.
+func (m *MFA) ask() (string, error) {
+	fmt.Fprintf(m.Out, "MFA code for %s: ", m.Serial)
+	answer, err := bufio.NewReader(m.In).ReadString('\n')
+	answer = strings.TrimSpace(answer)
+	if answer == "" && err != nil {
+		return "", fmt.Errorf("no MFA code entered: %s", err)
+	}
+	if !tokenCodePattern.MatchString(answer) {
+		return "", fmt.Errorf("MFA code must be 6 digits, not %q", answer)
+	}
+	m.code = answer
+	return answer, nil
+}
+
+// tokenCode returns a code from the device, asking for one unless already
+// given or entered.
+func (m *MFA) tokenCode() (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.code != "" {
+		return m.code, nil
+	}
+	return m.ask()
+}
+
+// roleTokenCode returns a code for assuming a role: the code given or
+// entered the first time, and a new one each time the role is renewed.
+func (m *MFA) roleTokenCode() (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.code != "" && !m.assumed {
+		m.assumed = true
+		return m.code, nil
+	}
+	m.assumed = true
+	return m.ask()
+}
+
+// header returns the value of the x-amz-mfa header authorizing a delete:
+// the device's serial and a code.
+func (m *MFA) header() (string, error) {
+	code, err := m.tokenCode()
+	if err != nil {
+		return "", err
+	}
+	return m.Serial + " " + code, nil
+}
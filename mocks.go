@@ -2,46 +2,253 @@ package s3
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
-
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/client/metadata"
-	"github.com/aws/aws-sdk-go/aws/request"
-	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssooidc"
+	ssooidctypes "github.com/aws/aws-sdk-go-v2/service/ssooidc/types"
+	"github.com/aws/smithy-go"
 )
 
 var (
-	ErrNoSuchBucket  = errors.New("NoSuchBucket: The specified bucket does not exist")
-	ErrBucketExists  = errors.New("bucket already exists")
-	ErrBucketHasKeys = errors.New("bucket has keys so cannot be deleted")
+	ErrNoSuchBucket              = errors.New("NoSuchBucket: The specified bucket does not exist")
+	ErrBucketExists              = errors.New("bucket already exists")
+	ErrBucketHasKeys             = errors.New("bucket has keys so cannot be deleted")
+	ErrNoSuchKey                 = &smithy.GenericAPIError{Code: "NoSuchKey", Message: "The specified key does not exist."}
+	ErrNoSuchUpload              = &smithy.GenericAPIError{Code: "NoSuchUpload", Message: "The specified upload does not exist."}
+	ErrBadDigest                 = &smithy.GenericAPIError{Code: "BadDigest", Message: "The Content-MD5 you specified did not match what was received."}
+	ErrAccessDenied              = &smithy.GenericAPIError{Code: "AccessDenied", Message: "Access Denied"}
+	ErrNoSuchVersion             = &smithy.GenericAPIError{Code: "NoSuchVersion", Message: "The specified version does not exist."}
+	ErrInvalidLocationConstraint = &smithy.GenericAPIError{Code: "InvalidLocationConstraint", Message: "The specified location-constraint is not valid"}
+	ErrMalformedXML              = &smithy.GenericAPIError{Code: "MalformedXML", Message: "The XML you provided was not well-formed or did not validate against our published schema"}
+	ErrInvalidPart               = &smithy.GenericAPIError{Code: "InvalidPart", Message: "One or more of the specified parts could not be found. The part may not have been uploaded, or the specified entity tag may not match the part's entity tag."}
+	ErrInvalidPartOrder          = &smithy.GenericAPIError{Code: "InvalidPartOrder", Message: "The list of parts was not in ascending order. Parts must be ordered by part number."}
+	ErrInvalidPartNumber         = &smithy.GenericAPIError{Code: "InvalidArgument", Message: "Part number must be an integer between 1 and 10000, inclusive"}
+	ErrInternalError             = &smithy.GenericAPIError{Code: "InternalError", Message: "We encountered an internal error. Please try again."}
+	ErrPreconditionFailed        = &smithy.GenericAPIError{Code: "PreconditionFailed", Message: "At least one of the pre-conditions you specified did not hold"}
 )
 
-type MockBucket map[string][]byte
+type MockObject struct {
+	Content         []byte
+	Metadata        map[string]string
+	ContentType     *string
+	ContentEncoding *string
+	StorageClass    types.StorageClass // empty for STANDARD
+	ETag            *string            // overrides the computed md5 ETag
+	Modified        time.Time
+
+	// response headers set on upload, nil for none
+	CacheControl       *string
+	ContentDisposition *string
+
+	Tags []types.Tag // object tags, sorted by key
+
+	// object lock retention and legal hold, empty for none
+	ObjectLockMode            types.ObjectLockMode
+	ObjectLockRetainUntilDate *time.Time
+	ObjectLockLegalHoldStatus types.ObjectLockLegalHoldStatus
+
+	// server-side encryption requested, empty for none
+	ServerSideEncryption types.ServerSideEncryption
+	SSEKMSKeyId          *string
+	SSECustomerKeyMD5    *string // of the SSE-C key needed to read the object
+
+	VersionId *string // in buckets with versioning enabled, nil otherwise
+
+	hidden       int  // head requests left before the object becomes visible
+	deleteMarker bool // a version recording the key's deletion
+}
+
+// storageClass returns the storage class as listed.
+func (mo *MockObject) storageClass() types.ObjectStorageClass {
+	if mo.StorageClass == "" {
+		return types.ObjectStorageClassStandard
+	}
+	return types.ObjectStorageClass(mo.StorageClass)
+}
+
+// ErrSSECustomerKey is returned reading an object without the SSE-C key it
+// was written with.
+var ErrSSECustomerKey = &smithy.GenericAPIError{Code: "InvalidRequest", Message: "The object was stored using a form of Server Side Encryption. The correct parameters must be provided to retrieve the object."}
+
+// customerKeyMD5 returns the base64 md5 of a base64 SSE-C key, as S3
+// records it, or nil without one.
+func customerKeyMD5(key *string) *string {
+	if key == nil {
+		return nil
+	}
+	raw, _ := base64.StdEncoding.DecodeString(*key)
+	sum := md5.Sum(raw)
+	return aws.String(base64.StdEncoding.EncodeToString(sum[:]))
+}
+
+// checkCustomerKey fails unless key is the SSE-C key the object was written
+// with, if any.
+func (mo *MockObject) checkCustomerKey(key *string) error {
+	if aws.ToString(mo.SSECustomerKeyMD5) != aws.ToString(customerKeyMD5(key)) {
+		return ErrSSECustomerKey
+	}
+	return nil
+}
+
+func (mo *MockObject) etag() *string {
+	if mo.ETag != nil {
+		return mo.ETag
+	}
+	return aws.String(etag(mo.Content))
+}
+
+type MockBucket map[string]*MockObject
+
+// mockBucketConfig holds the bucket level settings of a mock bucket.
+type mockBucketConfig struct {
+	location          string // LocationConstraint, empty for us-east-1
+	objectLock        bool   // enabled at creation
+	encryption        *types.ServerSideEncryptionConfiguration
+	publicAccessBlock *types.PublicAccessBlockConfiguration
+	ownership         *types.OwnershipControls
+	tags              []types.Tag
+	accelerate        types.BucketAccelerateStatus // once set
+	// head requests for which a newly written key is reported missing,
+	// emulating an eventually consistent store
+	visibilityLag int
+	// flip a byte of each upload received, emulating damage in transit
+	corruptUploads bool
+	// parts for which the next ETags returned are wrong
+	misreportedParts int
+	// return a wrong ETag for completed multipart uploads
+	misreportUploads bool
+	// fail to complete multipart uploads, leaving their parts
+	failCompletes bool
+	// keys that can't be deleted, as if denied by policy
+	undeletable map[string]bool
+	// keys that can only be read with S3 Select, as if GetObject were denied
+	selectOnly map[string]bool
+	// contents keys are overwritten with once listed, as if changed while
+	// being downloaded
+	overwrites map[string][]byte
+	// with versioning enabled, every version of each key, oldest first,
+	// including delete markers
+	versioning  bool
+	versions    map[string][]*MockObject
+	nextVersion int
+	// serial of the device whose codes version deletes need, with MFA
+	// delete enabled
+	mfaDelete string
+}
+
+// rejectsACL reports whether an upload with acl must fail because the bucket
+// has acls disabled. The caller must hold the lock.
+func (ms *MockS3) rejectsACL(bucket string, acl types.ObjectCannedACL) bool {
+	config, ok := ms.config[bucket]
+	if !ok || config.ownership == nil || acl == "" || acl == types.ObjectCannedACLBucketOwnerFullControl {
+		return false
+	}
+	for _, rule := range config.ownership.Rules {
+		if rule.ObjectOwnership == types.ObjectOwnershipBucketOwnerEnforced {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrACLNotSupported is returned for uploads with acls to buckets with acls
+// disabled.
+var ErrACLNotSupported = &smithy.GenericAPIError{Code: "AccessControlListNotSupported", Message: "The bucket does not allow ACLs"}
 
 type MockS3 struct {
 	sync.RWMutex
 	// bucket: {key: value}
 	data map[string]MockBucket
+	// bucket: settings
+	config map[string]*mockBucketConfig
+	// upload id: multipart upload in progress
+	uploads    map[string]*mockUpload
+	nextUpload int
+}
+
+// mockUpload is a multipart upload in progress.
+type mockUpload struct {
+	bucket, key string
+	object      MockObject // as given on creation, without content
+	parts       map[int32][]byte
+	initiated   time.Time
+}
+
+// upload returns the incomplete upload id of key in bucket, or NoSuchUpload
+// if it's of another key, as S3 does. The caller must hold the lock.
+func (ms *MockS3) upload(id *string, bucket, key *string) (*mockUpload, error) {
+	upload, ok := ms.uploads[aws.ToString(id)]
+	if !ok || upload.bucket != aws.ToString(bucket) || upload.key != aws.ToString(key) {
+		return nil, ErrNoSuchUpload
+	}
+	return upload, nil
+}
+
+// bucketConfig returns the settings of an existing bucket. The caller must
+// hold the write lock.
+func (ms *MockS3) bucketConfig(bucket string) (*mockBucketConfig, error) {
+	if _, ok := ms.data[bucket]; !ok {
+		return nil, ErrNoSuchBucket
+	}
+	config, ok := ms.config[bucket]
+	if !ok {
+		config = &mockBucketConfig{}
+		ms.config[bucket] = config
+	}
+	return config, nil
+}
+
+// etag returns the quoted md5 hex of value, as S3 does for simple uploads.
+func etag(value []byte) string {
+	sum := md5.Sum(value)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
 }
 
 func NewMockS3() *MockS3 {
 	return &MockS3{
-		data: map[string]MockBucket{},
+		data:    map[string]MockBucket{},
+		config:  map[string]*mockBucketConfig{},
+		uploads: map[string]*mockUpload{},
+	}
+}
+
+// mockCanceled returns the error of a request made with a done context, as
+// the sdk's, or nil.
+func mockCanceled(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return &aws.RequestCanceledError{Err: err}
 	}
+	return nil
 }
 
-func (ms *MockS3) ListBuckets(*s3.ListBucketsInput) (*s3.ListBucketsOutput, error) {
+func (ms *MockS3) ListBuckets(ctx context.Context, _ *s3.ListBucketsInput, _ ...func(*s3.Options)) (*s3.ListBucketsOutput, error) {
+	if err := mockCanceled(ctx); err != nil {
+		return nil, err
+	}
 	ms.RLock()
 	defer ms.RUnlock()
-	buckets := []*s3.Bucket{}
+	buckets := []types.Bucket{}
 	for name := range ms.data {
-		bucket := s3.Bucket{Name: aws.String(name)}
-		buckets = append(buckets, &bucket)
+		buckets = append(buckets, types.Bucket{Name: aws.String(name)})
 	}
 	output := s3.ListBucketsOutput{
 		Buckets: buckets,
@@ -49,7 +256,24 @@ func (ms *MockS3) ListBuckets(*s3.ListBucketsInput) (*s3.ListBucketsOutput, erro
 	return &output, nil
 }
 
-func (ms *MockS3) DeleteBucket(input *s3.DeleteBucketInput) (*s3.DeleteBucketOutput, error) {
+func (ms *MockS3) HeadBucket(ctx context.Context, input *s3.HeadBucketInput, _ ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	if err := mockCanceled(ctx); err != nil {
+		return nil, err
+	}
+	ms.RLock()
+	defer ms.RUnlock()
+	// missing buckets fail the sdk's waiters at once, as buckets are
+	// created immediately
+	if _, ok := ms.data[*input.Bucket]; !ok {
+		return nil, ErrNoSuchBucket
+	}
+	return &s3.HeadBucketOutput{}, nil
+}
+
+func (ms *MockS3) DeleteBucket(ctx context.Context, input *s3.DeleteBucketInput, _ ...func(*s3.Options)) (*s3.DeleteBucketOutput, error) {
+	if err := mockCanceled(ctx); err != nil {
+		return nil, err
+	}
 	ms.Lock()
 	defer ms.Unlock()
 	if bucket, exists := ms.data[*input.Bucket]; exists {
@@ -57,23 +281,48 @@ func (ms *MockS3) DeleteBucket(input *s3.DeleteBucketInput) (*s3.DeleteBucketOut
 			return nil, ErrBucketHasKeys
 		}
 		delete(ms.data, *input.Bucket)
+		delete(ms.config, *input.Bucket)
 		return &s3.DeleteBucketOutput{}, nil
 	} else {
 		return nil, ErrNoSuchBucket
 	}
 }
 
-func (ms *MockS3) CreateBucket(input *s3.CreateBucketInput) (*s3.CreateBucketOutput, error) {
+func (ms *MockS3) CreateBucket(ctx context.Context, input *s3.CreateBucketInput, _ ...func(*s3.Options)) (*s3.CreateBucketOutput, error) {
+	if err := mockCanceled(ctx); err != nil {
+		return nil, err
+	}
 	ms.Lock()
 	defer ms.Unlock()
 	if _, exists := ms.data[*input.Bucket]; exists {
 		return nil, ErrBucketExists
 	}
+	var location string
+	if input.CreateBucketConfiguration != nil {
+		location = string(input.CreateBucketConfiguration.LocationConstraint)
+		if location == "us-east-1" {
+			// us-east-1 is the default, and can't be given
+			return nil, ErrInvalidLocationConstraint
+		}
+	}
 	ms.data[*input.Bucket] = MockBucket{}
+	config := &mockBucketConfig{location: location}
+	if aws.ToBool(input.ObjectLockEnabledForBucket) {
+		// object lock keeps versions, so enables versioning
+		config.objectLock = true
+		config.versioning = true
+		config.versions = map[string][]*MockObject{}
+	}
+	ms.config[*input.Bucket] = config
 	return &s3.CreateBucketOutput{}, nil
 }
 
-func (ms *MockS3) ListObjects(input *s3.ListObjectsInput) (*s3.ListObjectsOutput, error) {
+// ListObjects lists keys as the original version of the listing does, by
+// marker, for the fake server's clients.
+func (ms *MockS3) ListObjects(ctx context.Context, input *s3.ListObjectsInput, _ ...func(*s3.Options)) (*s3.ListObjectsOutput, error) {
+	if err := mockCanceled(ctx); err != nil {
+		return nil, err
+	}
 	ms.RLock()
 	defer ms.RUnlock()
 	bucket, ok := ms.data[*input.Bucket]
@@ -82,1087 +331,1277 @@ func (ms *MockS3) ListObjects(input *s3.ListObjectsInput) (*s3.ListObjectsOutput
 	}
 	var keys []string
 	for key := range bucket {
-		if strings.HasPrefix(key, *input.Prefix) {
+		if strings.HasPrefix(key, aws.ToString(input.Prefix)) && key > aws.ToString(input.Marker) {
 			keys = append(keys, key)
 		}
 	}
 	sort.Strings(keys)
-	contents := []*s3.Object{}
+	// a page at a time, as S3 lists
+	maxKeys := 1000
+	if input.MaxKeys != nil {
+		maxKeys = int(*input.MaxKeys)
+	}
+	prefix, delimiter := aws.ToString(input.Prefix), aws.ToString(input.Delimiter)
+	contents := []types.Object{}
+	var commonPrefixes []types.CommonPrefix
+	var truncated bool
+	var last string
 	for _, key := range keys {
-		value := bucket[key]
-		object := s3.Object{
-			Key:  aws.String(key),
-			Size: aws.Int64(int64(len(value))),
+		// keys containing the delimiter past the prefix are grouped into one
+		// common prefix, counting once towards the page
+		commonPrefix := ""
+		if i := strings.Index(key[len(prefix):], delimiter); delimiter != "" && i != -1 {
+			commonPrefix = key[:len(prefix)+i+len(delimiter)]
+			if commonPrefix <= aws.ToString(input.Marker) || commonPrefix == last {
+				continue
+			}
 		}
-		contents = append(contents, &object)
+		if len(contents)+len(commonPrefixes) == maxKeys {
+			truncated = true
+			break
+		}
+		if commonPrefix != "" {
+			commonPrefixes = append(commonPrefixes, types.CommonPrefix{Prefix: aws.String(commonPrefix)})
+			last = commonPrefix
+			continue
+		}
+		last = key
+		value := bucket[key]
+		contents = append(contents, types.Object{
+			Key:          aws.String(key),
+			Size:         aws.Int64(int64(len(value.Content))),
+			ETag:         value.etag(),
+			LastModified: aws.Time(value.Modified),
+			StorageClass: value.storageClass(),
+		})
 	}
 
 	output := s3.ListObjectsOutput{
-		Contents:    contents,
-		IsTruncated: aws.Bool(false),
+		Contents:       contents,
+		CommonPrefixes: commonPrefixes,
+		IsTruncated:    aws.Bool(truncated),
+	}
+	// S3 only gives the next marker for delimited listings
+	if truncated && delimiter != "" {
+		output.NextMarker = aws.String(last)
 	}
 	return &output, nil
 }
 
-func (ms *MockS3) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+// ListObjectsV2 lists keys a page at a time, continuing from the last key
+// or common prefix of the page before.
+func (ms *MockS3) ListObjectsV2(ctx context.Context, input *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	marker := aws.ToString(input.StartAfter)
+	if token := aws.ToString(input.ContinuationToken); token > marker {
+		marker = token
+	}
+	listed, err := ms.ListObjects(ctx, &s3.ListObjectsInput{
+		Bucket:    input.Bucket,
+		Prefix:    input.Prefix,
+		Delimiter: input.Delimiter,
+		Marker:    aws.String(marker),
+		MaxKeys:   input.MaxKeys,
+	})
+	if err != nil {
+		return nil, err
+	}
+	ms.overwriteListed(aws.ToString(input.Bucket), listed.Contents)
+	output := &s3.ListObjectsV2Output{
+		Contents:          listed.Contents,
+		CommonPrefixes:    listed.CommonPrefixes,
+		IsTruncated:       listed.IsTruncated,
+		KeyCount:          aws.Int32(int32(len(listed.Contents) + len(listed.CommonPrefixes))),
+		ContinuationToken: input.ContinuationToken,
+		StartAfter:        input.StartAfter,
+	}
+	if aws.ToBool(listed.IsTruncated) {
+		output.NextContinuationToken = listed.NextMarker
+		if output.NextContinuationToken == nil {
+			output.NextContinuationToken = listed.Contents[len(listed.Contents)-1].Key
+		}
+	}
+	return output, nil
+}
+
+func (ms *MockS3) GetObject(ctx context.Context, input *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	if err := mockCanceled(ctx); err != nil {
+		return nil, err
+	}
 	ms.RLock()
 	defer ms.RUnlock()
 	bucket := ms.data[*input.Bucket]
 	if object, ok := bucket[*input.Key]; ok {
-		body := ioutil.NopCloser(bytes.NewReader(object))
+		if err := object.checkCustomerKey(input.SSECustomerKey); err != nil {
+			return nil, err
+		}
+		if config, ok := ms.config[*input.Bucket]; ok && config.selectOnly[*input.Key] {
+			return nil, ErrAccessDenied
+		}
+		if input.IfMatch != nil && *input.IfMatch != *object.etag() {
+			return nil, ErrPreconditionFailed
+		}
+		content := object.Content
+		var contentRange *string
+		if input.Range != nil {
+			start, end, ok := parseRange(*input.Range, len(content))
+			if !ok {
+				return nil, errors.New("InvalidRange: The requested range is not satisfiable")
+			}
+			contentRange = aws.String(fmt.Sprintf("bytes %d-%d/%d", start, end, len(content)))
+			content = content[start : end+1]
+		}
+		body := ioutil.NopCloser(bytes.NewReader(content))
 		output := s3.GetObjectOutput{
-			Body: body,
+			Body:            body,
+			ContentLength:   aws.Int64(int64(len(content))),
+			ContentRange:    contentRange,
+			ContentType:     object.ContentType,
+			ContentEncoding: object.ContentEncoding,
+			ETag:            object.etag(),
+			LastModified:    aws.Time(object.Modified),
+			Metadata:        object.Metadata,
+			StorageClass:    object.StorageClass,
+
+			CacheControl:         object.CacheControl,
+			ContentDisposition:   object.ContentDisposition,
+			ServerSideEncryption: object.ServerSideEncryption,
+			SSEKMSKeyId:          object.SSEKMSKeyId,
+			SSECustomerAlgorithm: input.SSECustomerAlgorithm,
+			SSECustomerKeyMD5:    object.SSECustomerKeyMD5,
+
+			ObjectLockMode:            object.ObjectLockMode,
+			ObjectLockRetainUntilDate: object.ObjectLockRetainUntilDate,
+			ObjectLockLegalHoldStatus: object.ObjectLockLegalHoldStatus,
 		}
 		return &output, nil
 	} else {
-		return nil, errors.New("missing key")
+		return nil, ErrNoSuchKey
+	}
+}
+
+// parseRange interprets an http byte range (bytes=a-b, bytes=a- or bytes=-n)
+// against content of size bytes, returning the inclusive start and end.
+func parseRange(header string, size int) (int, int, bool) {
+	spec := strings.TrimPrefix(header, "bytes=")
+	dash := strings.IndexByte(spec, '-')
+	if dash == -1 || spec == header {
+		return 0, 0, false
+	}
+	start, end := 0, size-1
+	var err error
+	switch {
+	case dash == 0:
+		// suffix range: the last n bytes
+		var n int
+		n, err = strconv.Atoi(spec[1:])
+		if n < size {
+			start = size - n
+		}
+	case dash == len(spec)-1:
+		start, err = strconv.Atoi(spec[:dash])
+	default:
+		start, err = strconv.Atoi(spec[:dash])
+		if err == nil {
+			end, err = strconv.Atoi(spec[dash+1:])
+		}
+		if end >= size {
+			end = size - 1
+		}
 	}
+	if err != nil || start > end || start >= size {
+		return 0, 0, false
+	}
+	return start, end, true
 }
 
-func (ms *MockS3) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+func (ms *MockS3) PutObject(ctx context.Context, input *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	if err := mockCanceled(ctx); err != nil {
+		return nil, err
+	}
 	ms.Lock()
 	defer ms.Unlock()
 	content, _ := ioutil.ReadAll(input.Body)
-	if bucket, ok := ms.data[*input.Bucket]; ok {
-		bucket[*input.Key] = content
+	if ms.rejectsACL(*input.Bucket, input.ACL) {
+		return nil, ErrACLNotSupported
+	}
+	content, err := ms.receive(*input.Bucket, content, input.ContentMD5)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := ms.data[*input.Bucket]; ok {
+		ms.put(*input.Bucket, *input.Key, &MockObject{Content: content, Metadata: input.Metadata, ContentType: input.ContentType, ContentEncoding: input.ContentEncoding, CacheControl: input.CacheControl, ContentDisposition: input.ContentDisposition, Tags: parseTagging(input.Tagging), ObjectLockMode: input.ObjectLockMode, ObjectLockRetainUntilDate: input.ObjectLockRetainUntilDate, ObjectLockLegalHoldStatus: input.ObjectLockLegalHoldStatus, StorageClass: input.StorageClass, ServerSideEncryption: input.ServerSideEncryption, SSEKMSKeyId: input.SSEKMSKeyId, SSECustomerKeyMD5: customerKeyMD5(input.SSECustomerKey), Modified: time.Now(), hidden: ms.visibilityLag(*input.Bucket)})
 	} else {
 		return nil, ErrNoSuchBucket
 	}
 	return &s3.PutObjectOutput{}, nil
 }
 
-func (ms *MockS3) PutObjectRequest(input *s3.PutObjectInput) (*request.Request, *s3.PutObjectOutput) {
+// parseTagging returns url encoded tags, as uploads give them, sorted by key.
+func parseTagging(tagging *string) []types.Tag {
+	values, _ := url.ParseQuery(aws.ToString(tagging))
+	var tags []types.Tag
+	for key := range values {
+		tags = append(tags, types.Tag{Key: aws.String(key), Value: aws.String(values.Get(key))})
+	}
+	sort.Slice(tags, func(i, j int) bool { return *tags[i].Key < *tags[j].Key })
+	return tags
+}
+
+// SetCorruptUploads makes uploads to bucket arrive with a byte changed, so
+// they are stored corrupted unless sent with a Content-MD5 to check.
+func (ms *MockS3) SetCorruptUploads(bucket string) error {
 	ms.Lock()
 	defer ms.Unlock()
-	// required for s3manager.Upload
-	// TODO: should only alter bucket on Send()
-	content, _ := ioutil.ReadAll(input.Body)
-	req := request.New(aws.Config{}, metadata.ClientInfo{}, request.Handlers{}, nil, &request.Operation{}, nil, nil)
-	if bucket, ok := ms.data[*input.Bucket]; ok {
-		bucket[*input.Key] = content
-	} else {
-		// pre-set the error on the request
-		req.Build()
-		req.Error = ErrNoSuchBucket
+	config, err := ms.bucketConfig(bucket)
+	if err != nil {
+		return err
 	}
-	return req, &s3.PutObjectOutput{}
+	config.corruptUploads = true
+	return nil
 }
 
-func (ms *MockS3) DeleteObjects(input *s3.DeleteObjectsInput) (*s3.DeleteObjectsOutput, error) {
+// SetMisreportedETags makes the next parts uploaded to bucket return wrong
+// ETags, and completed multipart uploads too if uploads is set, as if stored
+// otherwise than sent.
+func (ms *MockS3) SetMisreportedETags(bucket string, parts int, uploads bool) error {
 	ms.Lock()
 	defer ms.Unlock()
-	bucket := ms.data[*input.Bucket]
-	for _, id := range input.Delete.Objects {
-		delete(bucket, *id.Key)
+	config, err := ms.bucketConfig(bucket)
+	if err != nil {
+		return err
 	}
-	return &s3.DeleteObjectsOutput{}, nil
+	config.misreportedParts = parts
+	config.misreportUploads = uploads
+	return nil
 }
 
-func (ms *MockS3) DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error) {
+// SetFailCompletes makes completing multipart uploads to bucket fail with
+// InternalError, leaving the uploads incomplete.
+func (ms *MockS3) SetFailCompletes(bucket string) error {
 	ms.Lock()
 	defer ms.Unlock()
-	bucket := ms.data[*input.Bucket]
-	delete(bucket, *input.Key)
-	return &s3.DeleteObjectOutput{}, nil
+	config, err := ms.bucketConfig(bucket)
+	if err != nil {
+		return err
+	}
+	config.failCompletes = true
+	return nil
 }
 
-// unimplemented
-
-func (ms *MockS3) AbortMultipartUploadRequest(*s3.AbortMultipartUploadInput) (*request.Request, *s3.AbortMultipartUploadOutput) {
-	return nil, &s3.AbortMultipartUploadOutput{}
-}
-func (ms *MockS3) AbortMultipartUpload(*s3.AbortMultipartUploadInput) (*s3.AbortMultipartUploadOutput, error) {
-	return &s3.AbortMultipartUploadOutput{}, nil
-}
-func (ms *MockS3) CompleteMultipartUploadRequest(*s3.CompleteMultipartUploadInput) (*request.Request, *s3.CompleteMultipartUploadOutput) {
-	return nil, &s3.CompleteMultipartUploadOutput{}
-}
-func (ms *MockS3) CompleteMultipartUpload(*s3.CompleteMultipartUploadInput) (*s3.CompleteMultipartUploadOutput, error) {
-	return &s3.CompleteMultipartUploadOutput{}, nil
-}
-func (ms *MockS3) CopyObjectRequest(*s3.CopyObjectInput) (*request.Request, *s3.CopyObjectOutput) {
-	return nil, &s3.CopyObjectOutput{}
-}
-func (ms *MockS3) CopyObject(*s3.CopyObjectInput) (*s3.CopyObjectOutput, error) {
-	return &s3.CopyObjectOutput{}, nil
-}
-func (ms *MockS3) CreateBucketRequest(*s3.CreateBucketInput) (*request.Request, *s3.CreateBucketOutput) {
-	return nil, &s3.CreateBucketOutput{}
+// SetUndeletable makes deletes of key from bucket fail with AccessDenied.
+func (ms *MockS3) SetUndeletable(bucket, key string) error {
+	ms.Lock()
+	defer ms.Unlock()
+	config, err := ms.bucketConfig(bucket)
+	if err != nil {
+		return err
+	}
+	if config.undeletable == nil {
+		config.undeletable = map[string]bool{}
+	}
+	config.undeletable[key] = true
+	return nil
 }
-func (ms *MockS3) CreateMultipartUploadRequest(*s3.CreateMultipartUploadInput) (*request.Request, *s3.CreateMultipartUploadOutput) {
-	return nil, &s3.CreateMultipartUploadOutput{}
+
+// SetMFADelete requires codes from the device with serial to delete versions
+// of keys from bucket, as MFA delete does.
+func (ms *MockS3) SetMFADelete(bucket, serial string) error {
+	ms.Lock()
+	defer ms.Unlock()
+	config, err := ms.bucketConfig(bucket)
+	if err != nil {
+		return err
+	}
+	config.mfaDelete = serial
+	return nil
 }
-func (ms *MockS3) CreateMultipartUpload(*s3.CreateMultipartUploadInput) (*s3.CreateMultipartUploadOutput, error) {
-	return &s3.CreateMultipartUploadOutput{}, nil
+
+// SetSelectOnly makes reads of key from bucket fail with AccessDenied,
+// except with S3 Select.
+func (ms *MockS3) SetSelectOnly(bucket, key string) error {
+	ms.Lock()
+	defer ms.Unlock()
+	config, err := ms.bucketConfig(bucket)
+	if err != nil {
+		return err
+	}
+	if config.selectOnly == nil {
+		config.selectOnly = map[string]bool{}
+	}
+	config.selectOnly[key] = true
+	return nil
 }
-func (ms *MockS3) DeleteBucketRequest(*s3.DeleteBucketInput) (*request.Request, *s3.DeleteBucketOutput) {
-	return nil, &s3.DeleteBucketOutput{}
+
+// SetOverwriteOnList makes the next listing of key in bucket overwrite it
+// with content, as if it changed between being listed and downloaded.
+func (ms *MockS3) SetOverwriteOnList(bucket, key string, content []byte) error {
+	ms.Lock()
+	defer ms.Unlock()
+	config, err := ms.bucketConfig(bucket)
+	if err != nil {
+		return err
+	}
+	if config.overwrites == nil {
+		config.overwrites = map[string][]byte{}
+	}
+	config.overwrites[key] = content
+	return nil
 }
-func (ms *MockS3) DeleteBucketCorsRequest(*s3.DeleteBucketCorsInput) (*request.Request, *s3.DeleteBucketCorsOutput) {
-	return nil, &s3.DeleteBucketCorsOutput{}
+
+// overwriteListed overwrites the keys of bucket just listed that were set to
+// be overwritten once listed.
+func (ms *MockS3) overwriteListed(bucket string, listed []types.Object) {
+	ms.Lock()
+	defer ms.Unlock()
+	config, ok := ms.config[bucket]
+	if !ok || len(config.overwrites) == 0 {
+		return
+	}
+	for _, object := range listed {
+		key := aws.ToString(object.Key)
+		if content, ok := config.overwrites[key]; ok {
+			ms.put(bucket, key, &MockObject{Content: content, Modified: time.Now()})
+			delete(config.overwrites, key)
+		}
+	}
 }
-func (ms *MockS3) DeleteBucketCors(*s3.DeleteBucketCorsInput) (*s3.DeleteBucketCorsOutput, error) {
-	return &s3.DeleteBucketCorsOutput{}, nil
+
+// undeletable reports whether key can't be deleted from bucket. The caller
+// must hold the lock.
+func (ms *MockS3) undeletable(bucket, key string) bool {
+	config, ok := ms.config[bucket]
+	return ok && config.undeletable[key]
 }
-func (ms *MockS3) DeleteBucketLifecycleRequest(*s3.DeleteBucketLifecycleInput) (*request.Request, *s3.DeleteBucketLifecycleOutput) {
-	return nil, &s3.DeleteBucketLifecycleOutput{}
+
+// receive returns the content of an upload to bucket as received, failing
+// if it doesn't match contentMD5, if given. The caller must hold the lock.
+func (ms *MockS3) receive(bucket string, content []byte, contentMD5 *string) ([]byte, error) {
+	if config, ok := ms.config[bucket]; ok && config.corruptUploads && len(content) > 0 {
+		content = append([]byte{}, content...)
+		content[0] ^= 0xff
+	}
+	if contentMD5 != nil {
+		sum := md5.Sum(content)
+		if base64.StdEncoding.EncodeToString(sum[:]) != *contentMD5 {
+			return nil, ErrBadDigest
+		}
+	}
+	return content, nil
 }
-func (ms *MockS3) DeleteBucketLifecycle(*s3.DeleteBucketLifecycleInput) (*s3.DeleteBucketLifecycleOutput, error) {
-	return &s3.DeleteBucketLifecycleOutput{}, nil
+
+// SetVisibilityLag makes keys written to bucket appear missing to the next n
+// head requests.
+func (ms *MockS3) SetVisibilityLag(bucket string, n int) error {
+	ms.Lock()
+	defer ms.Unlock()
+	config, err := ms.bucketConfig(bucket)
+	if err != nil {
+		return err
+	}
+	config.visibilityLag = n
+	return nil
 }
-func (ms *MockS3) DeleteBucketPolicyRequest(*s3.DeleteBucketPolicyInput) (*request.Request, *s3.DeleteBucketPolicyOutput) {
-	return nil, &s3.DeleteBucketPolicyOutput{}
+
+// visibilityLag returns the lag set for bucket. The caller must hold the
+// lock.
+func (ms *MockS3) visibilityLag(bucket string) int {
+	if config, ok := ms.config[bucket]; ok {
+		return config.visibilityLag
+	}
+	return 0
 }
-func (ms *MockS3) DeleteBucketPolicy(*s3.DeleteBucketPolicyInput) (*s3.DeleteBucketPolicyOutput, error) {
-	return &s3.DeleteBucketPolicyOutput{}, nil
+
+// SetModified sets the last modified time of an existing key.
+func (ms *MockS3) SetModified(bucket, key string, modified time.Time) error {
+	ms.Lock()
+	defer ms.Unlock()
+	object, ok := ms.data[bucket][key]
+	if !ok {
+		return errors.New("missing key")
+	}
+	object.Modified = modified
+	return nil
 }
-func (ms *MockS3) DeleteBucketReplicationRequest(*s3.DeleteBucketReplicationInput) (*request.Request, *s3.DeleteBucketReplicationOutput) {
-	return nil, &s3.DeleteBucketReplicationOutput{}
+
+// SetUploadsInitiated backdates the incomplete multipart uploads of key.
+func (ms *MockS3) SetUploadsInitiated(bucket, key string, initiated time.Time) error {
+	ms.Lock()
+	defer ms.Unlock()
+	found := false
+	for _, upload := range ms.uploads {
+		if upload.bucket == bucket && upload.key == key {
+			upload.initiated = initiated
+			found = true
+		}
+	}
+	if !found {
+		return ErrNoSuchUpload
+	}
+	return nil
 }
-func (ms *MockS3) DeleteBucketReplication(*s3.DeleteBucketReplicationInput) (*s3.DeleteBucketReplicationOutput, error) {
-	return &s3.DeleteBucketReplicationOutput{}, nil
+
+// PutMultipartObject stores content as if it had been uploaded in parts of
+// partSize, giving it a multipart ETag.
+func (ms *MockS3) PutMultipartObject(bucket, key string, content []byte, partSize int64) error {
+	ms.Lock()
+	defer ms.Unlock()
+	b, ok := ms.data[bucket]
+	if !ok {
+		return ErrNoSuchBucket
+	}
+	tag, err := multipartETag(bytes.NewReader(content), partSize)
+	if err != nil {
+		return err
+	}
+	b[key] = &MockObject{Content: content, ETag: aws.String(`"` + tag + `"`), Modified: time.Now()}
+	return nil
 }
-func (ms *MockS3) DeleteBucketTaggingRequest(*s3.DeleteBucketTaggingInput) (*request.Request, *s3.DeleteBucketTaggingOutput) {
-	return nil, &s3.DeleteBucketTaggingOutput{}
+
+func (ms *MockS3) CreateMultipartUpload(ctx context.Context, input *s3.CreateMultipartUploadInput, _ ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	if err := mockCanceled(ctx); err != nil {
+		return nil, err
+	}
+	ms.Lock()
+	defer ms.Unlock()
+	if _, ok := ms.data[*input.Bucket]; !ok {
+		return nil, ErrNoSuchBucket
+	}
+	if ms.rejectsACL(*input.Bucket, input.ACL) {
+		return nil, ErrACLNotSupported
+	}
+	ms.nextUpload += 1
+	id := strconv.Itoa(ms.nextUpload)
+	ms.uploads[id] = &mockUpload{
+		bucket:    *input.Bucket,
+		key:       *input.Key,
+		object:    MockObject{Metadata: input.Metadata, ContentType: input.ContentType, ContentEncoding: input.ContentEncoding, CacheControl: input.CacheControl, ContentDisposition: input.ContentDisposition, Tags: parseTagging(input.Tagging), ObjectLockMode: input.ObjectLockMode, ObjectLockRetainUntilDate: input.ObjectLockRetainUntilDate, ObjectLockLegalHoldStatus: input.ObjectLockLegalHoldStatus, StorageClass: input.StorageClass, ServerSideEncryption: input.ServerSideEncryption, SSEKMSKeyId: input.SSEKMSKeyId, SSECustomerKeyMD5: customerKeyMD5(input.SSECustomerKey)},
+		parts:     map[int32][]byte{},
+		initiated: time.Now(),
+	}
+	return &s3.CreateMultipartUploadOutput{Bucket: input.Bucket, Key: input.Key, UploadId: aws.String(id)}, nil
 }
-func (ms *MockS3) DeleteBucketTagging(*s3.DeleteBucketTaggingInput) (*s3.DeleteBucketTaggingOutput, error) {
-	return &s3.DeleteBucketTaggingOutput{}, nil
+
+func (ms *MockS3) UploadPart(ctx context.Context, input *s3.UploadPartInput, _ ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	if err := mockCanceled(ctx); err != nil {
+		return nil, err
+	}
+	ms.Lock()
+	defer ms.Unlock()
+	upload, err := ms.upload(input.UploadId, input.Bucket, input.Key)
+	if err != nil {
+		return nil, err
+	}
+	if number := aws.ToInt32(input.PartNumber); number < 1 || number > 10000 {
+		return nil, ErrInvalidPartNumber
+	}
+	content, _ := ioutil.ReadAll(input.Body)
+	content, err = ms.receive(upload.bucket, content, input.ContentMD5)
+	if err != nil {
+		return nil, err
+	}
+	upload.parts[aws.ToInt32(input.PartNumber)] = content
+	if config, ok := ms.config[upload.bucket]; ok && config.misreportedParts > 0 {
+		config.misreportedParts -= 1
+		return &s3.UploadPartOutput{ETag: aws.String(etag(append(content, 0)))}, nil
+	}
+	return &s3.UploadPartOutput{ETag: aws.String(etag(content))}, nil
 }
-func (ms *MockS3) DeleteBucketWebsiteRequest(*s3.DeleteBucketWebsiteInput) (*request.Request, *s3.DeleteBucketWebsiteOutput) {
-	return nil, &s3.DeleteBucketWebsiteOutput{}
+
+func (ms *MockS3) CompleteMultipartUpload(ctx context.Context, input *s3.CompleteMultipartUploadInput, _ ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	if err := mockCanceled(ctx); err != nil {
+		return nil, err
+	}
+	ms.Lock()
+	defer ms.Unlock()
+	if _, ok := ms.data[aws.ToString(input.Bucket)]; !ok {
+		return nil, ErrNoSuchBucket
+	}
+	upload, err := ms.upload(input.UploadId, input.Bucket, input.Key)
+	if err != nil {
+		return nil, err
+	}
+	if input.MultipartUpload == nil || len(input.MultipartUpload.Parts) == 0 {
+		return nil, ErrMalformedXML
+	}
+	if config, ok := ms.config[upload.bucket]; ok && config.failCompletes {
+		return nil, ErrInternalError
+	}
+	// the parts are assembled in ascending order of their numbers, each
+	// named by the ETag it was stored with
+	var content, sums []byte
+	var last int32
+	for _, part := range input.MultipartUpload.Parts {
+		number := aws.ToInt32(part.PartNumber)
+		if number <= last {
+			return nil, ErrInvalidPartOrder
+		}
+		last = number
+		data, ok := upload.parts[number]
+		if !ok || strings.Trim(aws.ToString(part.ETag), `"`) != strings.Trim(etag(data), `"`) {
+			return nil, ErrInvalidPart
+		}
+		content = append(content, data...)
+		sum := md5.Sum(data)
+		sums = append(sums, sum[:]...)
+	}
+	sum := md5.Sum(sums)
+	object := upload.object
+	object.Content = content
+	object.ETag = aws.String(fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(sum[:]), len(input.MultipartUpload.Parts)))
+	object.Modified = time.Now()
+	object.hidden = ms.visibilityLag(upload.bucket)
+	ms.put(upload.bucket, upload.key, &object)
+	delete(ms.uploads, aws.ToString(input.UploadId))
+	if config, ok := ms.config[upload.bucket]; ok && config.misreportUploads {
+		return &s3.CompleteMultipartUploadOutput{Bucket: aws.String(upload.bucket), Key: aws.String(upload.key), ETag: aws.String(etag(content))}, nil
+	}
+	return &s3.CompleteMultipartUploadOutput{Bucket: aws.String(upload.bucket), Key: aws.String(upload.key), ETag: object.ETag}, nil
 }
-func (ms *MockS3) DeleteBucketWebsite(*s3.DeleteBucketWebsiteInput) (*s3.DeleteBucketWebsiteOutput, error) {
-	return &s3.DeleteBucketWebsiteOutput{}, nil
+
+func (ms *MockS3) AbortMultipartUpload(ctx context.Context, input *s3.AbortMultipartUploadInput, _ ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	if err := mockCanceled(ctx); err != nil {
+		return nil, err
+	}
+	ms.Lock()
+	defer ms.Unlock()
+	if _, err := ms.upload(input.UploadId, input.Bucket, input.Key); err != nil {
+		return nil, err
+	}
+	delete(ms.uploads, aws.ToString(input.UploadId))
+	return &s3.AbortMultipartUploadOutput{}, nil
 }
-func (ms *MockS3) DeleteObjectRequest(*s3.DeleteObjectInput) (*request.Request, *s3.DeleteObjectOutput) {
-	return nil, &s3.DeleteObjectOutput{}
+
+// ListMultipartUploads lists the incomplete uploads under the prefix, in the
+// order they were created, in one page.
+func (ms *MockS3) ListMultipartUploads(ctx context.Context, input *s3.ListMultipartUploadsInput, _ ...func(*s3.Options)) (*s3.ListMultipartUploadsOutput, error) {
+	if err := mockCanceled(ctx); err != nil {
+		return nil, err
+	}
+	ms.RLock()
+	defer ms.RUnlock()
+	if _, ok := ms.data[*input.Bucket]; !ok {
+		return nil, ErrNoSuchBucket
+	}
+	var ids []int
+	for id, upload := range ms.uploads {
+		if upload.bucket == *input.Bucket && strings.HasPrefix(upload.key, aws.ToString(input.Prefix)) {
+			n, _ := strconv.Atoi(id)
+			ids = append(ids, n)
+		}
+	}
+	sort.Ints(ids)
+	output := &s3.ListMultipartUploadsOutput{Bucket: input.Bucket, Prefix: input.Prefix, IsTruncated: aws.Bool(false)}
+	for _, n := range ids {
+		id := strconv.Itoa(n)
+		upload := ms.uploads[id]
+		output.Uploads = append(output.Uploads, types.MultipartUpload{
+			Key:          aws.String(upload.key),
+			UploadId:     aws.String(id),
+			Initiated:    aws.Time(upload.initiated),
+			StorageClass: upload.object.StorageClass,
+		})
+	}
+	return output, nil
 }
-func (ms *MockS3) DeleteObjectsRequest(*s3.DeleteObjectsInput) (*request.Request, *s3.DeleteObjectsOutput) {
-	return nil, &s3.DeleteObjectsOutput{}
+
+// ListParts lists the parts sent to an upload, in one page.
+func (ms *MockS3) ListParts(ctx context.Context, input *s3.ListPartsInput, _ ...func(*s3.Options)) (*s3.ListPartsOutput, error) {
+	if err := mockCanceled(ctx); err != nil {
+		return nil, err
+	}
+	ms.RLock()
+	defer ms.RUnlock()
+	upload, err := ms.upload(input.UploadId, input.Bucket, input.Key)
+	if err != nil {
+		return nil, err
+	}
+	var numbers []int
+	for number := range upload.parts {
+		numbers = append(numbers, int(number))
+	}
+	sort.Ints(numbers)
+	output := &s3.ListPartsOutput{Bucket: input.Bucket, Key: input.Key, UploadId: input.UploadId, IsTruncated: aws.Bool(false)}
+	for _, number := range numbers {
+		content := upload.parts[int32(number)]
+		output.Parts = append(output.Parts, types.Part{
+			PartNumber: aws.Int32(int32(number)),
+			ETag:       aws.String(etag(content)),
+			Size:       aws.Int64(int64(len(content))),
+		})
+	}
+	return output, nil
 }
-func (ms *MockS3) GetBucketAccelerateConfiguration(*s3.GetBucketAccelerateConfigurationInput) (*s3.GetBucketAccelerateConfigurationOutput, error) {
-	return &s3.GetBucketAccelerateConfigurationOutput{}, nil
+
+func (ms *MockS3) DeleteObjects(ctx context.Context, input *s3.DeleteObjectsInput, _ ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	if err := mockCanceled(ctx); err != nil {
+		return nil, err
+	}
+	ms.Lock()
+	defer ms.Unlock()
+	if len(input.Delete.Objects) > 1000 {
+		return nil, ErrMalformedXML
+	}
+	output := s3.DeleteObjectsOutput{}
+	for _, id := range input.Delete.Objects {
+		deleted, err := ms.remove(*input.Bucket, *id.Key, id.VersionId, aws.ToBool(input.BypassGovernanceRetention), input.MFA)
+		if err != nil {
+			var e smithy.APIError
+			errors.As(err, &e)
+			output.Errors = append(output.Errors, types.Error{Key: id.Key, VersionId: id.VersionId, Code: aws.String(e.ErrorCode()), Message: aws.String(e.ErrorMessage())})
+			continue
+		}
+		if !aws.ToBool(input.Delete.Quiet) {
+			output.Deleted = append(output.Deleted, types.DeletedObject{Key: id.Key, VersionId: id.VersionId, DeleteMarker: deleted.DeleteMarker, DeleteMarkerVersionId: deleted.VersionId})
+		}
+	}
+	return &output, nil
 }
-func (ms *MockS3) GetBucketAccelerateConfigurationRequest(*s3.GetBucketAccelerateConfigurationInput) (*request.Request, *s3.GetBucketAccelerateConfigurationOutput) {
-	return nil, &s3.GetBucketAccelerateConfigurationOutput{}
+
+func (ms *MockS3) DeleteObject(ctx context.Context, input *s3.DeleteObjectInput, _ ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	if err := mockCanceled(ctx); err != nil {
+		return nil, err
+	}
+	ms.Lock()
+	defer ms.Unlock()
+	return ms.remove(*input.Bucket, *input.Key, input.VersionId, aws.ToBool(input.BypassGovernanceRetention), input.MFA)
 }
-func (ms *MockS3) GetBucketAclRequest(*s3.GetBucketAclInput) (*request.Request, *s3.GetBucketAclOutput) {
-	return nil, &s3.GetBucketAclOutput{}
+
+// put stores object as the current version of key, keeping those it
+// replaces if bucket has versioning enabled. The caller must hold the lock.
+func (ms *MockS3) put(bucket, key string, object *MockObject) {
+	if config, ok := ms.config[bucket]; ok && config.versioning {
+		object.VersionId = config.newVersionId()
+		config.versions[key] = append(config.versions[key], object)
+	}
+	ms.data[bucket][key] = object
+}
+
+// remove deletes key, or with versionId that version of it. Deleting a key
+// of a bucket with versioning enabled leaves a delete marker in its place,
+// and deleting the latest version of a key, or its delete marker, makes the
+// version before current again. Versions under object lock retention or
+// legal hold can't be deleted, unless bypassGovernance is set for governance
+// mode retention, and in buckets with MFA delete only with the device's
+// serial and a code in mfa. The caller must hold the lock.
+func (ms *MockS3) remove(bucket, key string, versionId *string, bypassGovernance bool, mfa *string) (*s3.DeleteObjectOutput, error) {
+	if ms.undeletable(bucket, key) {
+		return nil, ErrAccessDenied
+	}
+	config, ok := ms.config[bucket]
+	if !ok || !config.versioning {
+		if versionId != nil {
+			return nil, ErrNoSuchVersion
+		}
+		delete(ms.data[bucket], key)
+		return &s3.DeleteObjectOutput{}, nil
+	}
+	versions := config.versions[key]
+	if versionId == nil {
+		marker := &MockObject{VersionId: config.newVersionId(), Modified: time.Now(), deleteMarker: true}
+		config.versions[key] = append(versions, marker)
+		delete(ms.data[bucket], key)
+		return &s3.DeleteObjectOutput{DeleteMarker: aws.Bool(true), VersionId: marker.VersionId}, nil
+	}
+	if config.mfaDelete != "" {
+		code := strings.TrimPrefix(aws.ToString(mfa), config.mfaDelete+" ")
+		if code == aws.ToString(mfa) || !tokenCodePattern.MatchString(code) {
+			return nil, ErrAccessDenied
+		}
+	}
+	for i, version := range versions {
+		if aws.ToString(version.VersionId) != *versionId {
+			continue
+		}
+		if version.locked(bypassGovernance) {
+			return nil, ErrAccessDenied
+		}
+		versions = append(versions[:i:i], versions[i+1:]...)
+		config.versions[key] = versions
+		delete(ms.data[bucket], key)
+		if n := len(versions); n > 0 && !versions[n-1].deleteMarker {
+			ms.data[bucket][key] = versions[n-1]
+		}
+		return &s3.DeleteObjectOutput{DeleteMarker: aws.Bool(version.deleteMarker), VersionId: version.VersionId}, nil
+	}
+	return nil, ErrNoSuchVersion
 }
-func (ms *MockS3) GetBucketAcl(*s3.GetBucketAclInput) (*s3.GetBucketAclOutput, error) {
-	return &s3.GetBucketAclOutput{}, nil
+
+// locked reports whether object lock protects the version from deletion.
+func (mo *MockObject) locked(bypassGovernance bool) bool {
+	if mo.ObjectLockLegalHoldStatus == types.ObjectLockLegalHoldStatusOn {
+		return true
+	}
+	if mo.ObjectLockRetainUntilDate == nil || !mo.ObjectLockRetainUntilDate.After(time.Now()) {
+		return false
+	}
+	return mo.ObjectLockMode == types.ObjectLockModeCompliance || !bypassGovernance
 }
-func (ms *MockS3) GetBucketCorsRequest(*s3.GetBucketCorsInput) (*request.Request, *s3.GetBucketCorsOutput) {
-	return nil, &s3.GetBucketCorsOutput{}
+
+// newVersionId returns the id of the next version written to the bucket.
+func (config *mockBucketConfig) newVersionId() *string {
+	config.nextVersion += 1
+	return aws.String(fmt.Sprintf("v%d", config.nextVersion))
 }
-func (ms *MockS3) GetBucketCors(*s3.GetBucketCorsInput) (*s3.GetBucketCorsOutput, error) {
-	return &s3.GetBucketCorsOutput{}, nil
-}
-func (ms *MockS3) GetBucketLifecycleRequest(*s3.GetBucketLifecycleInput) (*request.Request, *s3.GetBucketLifecycleOutput) {
-	return nil, &s3.GetBucketLifecycleOutput{}
-}
-func (ms *MockS3) GetBucketLifecycle(*s3.GetBucketLifecycleInput) (*s3.GetBucketLifecycleOutput, error) {
-	return &s3.GetBucketLifecycleOutput{}, nil
-}
-func (ms *MockS3) GetBucketLifecycleConfigurationRequest(*s3.GetBucketLifecycleConfigurationInput) (*request.Request, *s3.GetBucketLifecycleConfigurationOutput) {
-	return nil, &s3.GetBucketLifecycleConfigurationOutput{}
-}
-func (ms *MockS3) GetBucketLifecycleConfiguration(*s3.GetBucketLifecycleConfigurationInput) (*s3.GetBucketLifecycleConfigurationOutput, error) {
-	return &s3.GetBucketLifecycleConfigurationOutput{}, nil
-}
-func (ms *MockS3) GetBucketLocationRequest(*s3.GetBucketLocationInput) (*request.Request, *s3.GetBucketLocationOutput) {
-	return nil, &s3.GetBucketLocationOutput{}
-}
-func (ms *MockS3) GetBucketLocation(*s3.GetBucketLocationInput) (*s3.GetBucketLocationOutput, error) {
-	return &s3.GetBucketLocationOutput{}, nil
-}
-func (ms *MockS3) GetBucketLoggingRequest(*s3.GetBucketLoggingInput) (*request.Request, *s3.GetBucketLoggingOutput) {
-	return nil, &s3.GetBucketLoggingOutput{}
-}
-func (ms *MockS3) GetBucketLogging(*s3.GetBucketLoggingInput) (*s3.GetBucketLoggingOutput, error) {
-	return &s3.GetBucketLoggingOutput{}, nil
-}
-func (ms *MockS3) GetBucketNotificationRequest(*s3.GetBucketNotificationConfigurationRequest) (*request.Request, *s3.NotificationConfigurationDeprecated) {
-	return nil, &s3.NotificationConfigurationDeprecated{}
-}
-func (ms *MockS3) GetBucketNotification(*s3.GetBucketNotificationConfigurationRequest) (*s3.NotificationConfigurationDeprecated, error) {
-	return &s3.NotificationConfigurationDeprecated{}, nil
-}
-func (ms *MockS3) GetBucketNotificationConfigurationRequest(*s3.GetBucketNotificationConfigurationRequest) (*request.Request, *s3.NotificationConfiguration) {
-	return nil, &s3.NotificationConfiguration{}
-}
-func (ms *MockS3) GetBucketNotificationConfiguration(*s3.GetBucketNotificationConfigurationRequest) (*s3.NotificationConfiguration, error) {
-	return &s3.NotificationConfiguration{}, nil
-}
-func (ms *MockS3) GetBucketPolicyRequest(*s3.GetBucketPolicyInput) (*request.Request, *s3.GetBucketPolicyOutput) {
-	return nil, &s3.GetBucketPolicyOutput{}
-}
-func (ms *MockS3) GetBucketPolicy(*s3.GetBucketPolicyInput) (*s3.GetBucketPolicyOutput, error) {
-	return &s3.GetBucketPolicyOutput{}, nil
-}
-func (ms *MockS3) GetBucketReplicationRequest(*s3.GetBucketReplicationInput) (*request.Request, *s3.GetBucketReplicationOutput) {
-	return nil, &s3.GetBucketReplicationOutput{}
-}
-func (ms *MockS3) GetBucketReplication(*s3.GetBucketReplicationInput) (*s3.GetBucketReplicationOutput, error) {
-	return &s3.GetBucketReplicationOutput{}, nil
-}
-func (ms *MockS3) GetBucketRequestPaymentRequest(*s3.GetBucketRequestPaymentInput) (*request.Request, *s3.GetBucketRequestPaymentOutput) {
-	return nil, &s3.GetBucketRequestPaymentOutput{}
-}
-func (ms *MockS3) GetBucketRequestPayment(*s3.GetBucketRequestPaymentInput) (*s3.GetBucketRequestPaymentOutput, error) {
-	return &s3.GetBucketRequestPaymentOutput{}, nil
-}
-func (ms *MockS3) GetBucketTaggingRequest(*s3.GetBucketTaggingInput) (*request.Request, *s3.GetBucketTaggingOutput) {
-	return nil, &s3.GetBucketTaggingOutput{}
-}
-func (ms *MockS3) GetBucketTagging(*s3.GetBucketTaggingInput) (*s3.GetBucketTaggingOutput, error) {
-	return &s3.GetBucketTaggingOutput{}, nil
-}
-func (ms *MockS3) GetBucketVersioningRequest(*s3.GetBucketVersioningInput) (*request.Request, *s3.GetBucketVersioningOutput) {
-	return nil, &s3.GetBucketVersioningOutput{}
-}
-func (ms *MockS3) GetBucketVersioning(*s3.GetBucketVersioningInput) (*s3.GetBucketVersioningOutput, error) {
-	return &s3.GetBucketVersioningOutput{}, nil
-}
-func (ms *MockS3) GetBucketWebsiteRequest(*s3.GetBucketWebsiteInput) (*request.Request, *s3.GetBucketWebsiteOutput) {
-	return nil, &s3.GetBucketWebsiteOutput{}
-}
-func (ms *MockS3) GetBucketWebsite(*s3.GetBucketWebsiteInput) (*s3.GetBucketWebsiteOutput, error) {
-	return &s3.GetBucketWebsiteOutput{}, nil
-}
-func (ms *MockS3) GetObjectRequest(*s3.GetObjectInput) (*request.Request, *s3.GetObjectOutput) {
-	return nil, &s3.GetObjectOutput{}
-}
-func (ms *MockS3) GetObjectAclRequest(*s3.GetObjectAclInput) (*request.Request, *s3.GetObjectAclOutput) {
-	return nil, &s3.GetObjectAclOutput{}
-}
-func (ms *MockS3) GetObjectAcl(*s3.GetObjectAclInput) (*s3.GetObjectAclOutput, error) {
-	return &s3.GetObjectAclOutput{}, nil
-}
-func (ms *MockS3) GetObjectTorrentRequest(*s3.GetObjectTorrentInput) (*request.Request, *s3.GetObjectTorrentOutput) {
-	return nil, &s3.GetObjectTorrentOutput{}
-}
-func (ms *MockS3) GetObjectTorrent(*s3.GetObjectTorrentInput) (*s3.GetObjectTorrentOutput, error) {
-	return &s3.GetObjectTorrentOutput{}, nil
-}
-func (ms *MockS3) HeadBucketRequest(*s3.HeadBucketInput) (*request.Request, *s3.HeadBucketOutput) {
-	return nil, &s3.HeadBucketOutput{}
-}
-func (ms *MockS3) HeadBucket(*s3.HeadBucketInput) (*s3.HeadBucketOutput, error) {
-	return &s3.HeadBucketOutput{}, nil
-}
-func (ms *MockS3) HeadObjectRequest(*s3.HeadObjectInput) (*request.Request, *s3.HeadObjectOutput) {
-	return nil, &s3.HeadObjectOutput{}
-}
-func (ms *MockS3) HeadObject(*s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
-	return &s3.HeadObjectOutput{}, nil
-}
-func (ms *MockS3) ListBucketsRequest(*s3.ListBucketsInput) (*request.Request, *s3.ListBucketsOutput) {
-	return nil, &s3.ListBucketsOutput{}
-}
-func (ms *MockS3) ListMultipartUploadsRequest(*s3.ListMultipartUploadsInput) (*request.Request, *s3.ListMultipartUploadsOutput) {
-	return nil, &s3.ListMultipartUploadsOutput{}
-}
-func (ms *MockS3) ListMultipartUploads(*s3.ListMultipartUploadsInput) (*s3.ListMultipartUploadsOutput, error) {
-	return &s3.ListMultipartUploadsOutput{}, nil
-}
-func (ms *MockS3) ListMultipartUploadsPages(*s3.ListMultipartUploadsInput, func(*s3.ListMultipartUploadsOutput, bool) bool) error {
-	return nil
-}
-func (ms *MockS3) ListObjectVersionsRequest(*s3.ListObjectVersionsInput) (*request.Request, *s3.ListObjectVersionsOutput) {
-	return nil, &s3.ListObjectVersionsOutput{}
-}
-func (ms *MockS3) ListObjectVersions(*s3.ListObjectVersionsInput) (*s3.ListObjectVersionsOutput, error) {
-	return &s3.ListObjectVersionsOutput{}, nil
-}
-func (ms *MockS3) ListObjectVersionsPages(*s3.ListObjectVersionsInput, func(*s3.ListObjectVersionsOutput, bool) bool) error {
-	return nil
-}
-func (ms *MockS3) ListObjectsRequest(*s3.ListObjectsInput) (*request.Request, *s3.ListObjectsOutput) {
-	return nil, &s3.ListObjectsOutput{}
-}
-func (ms *MockS3) ListObjectsPages(*s3.ListObjectsInput, func(*s3.ListObjectsOutput, bool) bool) error {
-	return nil
-}
-func (ms *MockS3) ListObjectsV2Pages(*s3.ListObjectsV2Input, func(*s3.ListObjectsV2Output, bool) bool) error {
-	return nil
-}
-func (ms *MockS3) ListObjectsV2(*s3.ListObjectsV2Input) (*s3.ListObjectsV2Output, error) {
-	return nil, nil
-}
-func (ms *MockS3) ListObjectsV2Request(*s3.ListObjectsV2Input) (*request.Request, *s3.ListObjectsV2Output) {
-	return nil, nil
-}
-func (ms *MockS3) ListPartsRequest(*s3.ListPartsInput) (*request.Request, *s3.ListPartsOutput) {
-	return nil, &s3.ListPartsOutput{}
-}
-func (ms *MockS3) ListParts(*s3.ListPartsInput) (*s3.ListPartsOutput, error) {
-	return &s3.ListPartsOutput{}, nil
-}
-func (ms *MockS3) ListPartsPages(*s3.ListPartsInput, func(*s3.ListPartsOutput, bool) bool) error {
-	return nil
-}
-func (ms *MockS3) PutBucketAclRequest(*s3.PutBucketAclInput) (*request.Request, *s3.PutBucketAclOutput) {
-	return nil, &s3.PutBucketAclOutput{}
-}
-func (ms *MockS3) PutBucketAccelerateConfiguration(*s3.PutBucketAccelerateConfigurationInput) (*s3.PutBucketAccelerateConfigurationOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) PutBucketAccelerateConfigurationRequest(*s3.PutBucketAccelerateConfigurationInput) (*request.Request, *s3.PutBucketAccelerateConfigurationOutput) {
-	return nil, &s3.PutBucketAccelerateConfigurationOutput{}
-}
-func (ms *MockS3) PutBucketAcl(*s3.PutBucketAclInput) (*s3.PutBucketAclOutput, error) {
-	return &s3.PutBucketAclOutput{}, nil
-}
-func (ms *MockS3) PutBucketCorsRequest(*s3.PutBucketCorsInput) (*request.Request, *s3.PutBucketCorsOutput) {
-	return nil, &s3.PutBucketCorsOutput{}
-}
-func (ms *MockS3) PutBucketCors(*s3.PutBucketCorsInput) (*s3.PutBucketCorsOutput, error) {
-	return &s3.PutBucketCorsOutput{}, nil
-}
-func (ms *MockS3) PutBucketLifecycleRequest(*s3.PutBucketLifecycleInput) (*request.Request, *s3.PutBucketLifecycleOutput) {
-	return nil, &s3.PutBucketLifecycleOutput{}
-}
-func (ms *MockS3) PutBucketLifecycle(*s3.PutBucketLifecycleInput) (*s3.PutBucketLifecycleOutput, error) {
-	return &s3.PutBucketLifecycleOutput{}, nil
-}
-func (ms *MockS3) PutBucketLifecycleConfigurationRequest(*s3.PutBucketLifecycleConfigurationInput) (*request.Request, *s3.PutBucketLifecycleConfigurationOutput) {
-	return nil, &s3.PutBucketLifecycleConfigurationOutput{}
-}
-func (ms *MockS3) PutBucketLifecycleConfiguration(*s3.PutBucketLifecycleConfigurationInput) (*s3.PutBucketLifecycleConfigurationOutput, error) {
-	return &s3.PutBucketLifecycleConfigurationOutput{}, nil
-}
-func (ms *MockS3) PutBucketLoggingRequest(*s3.PutBucketLoggingInput) (*request.Request, *s3.PutBucketLoggingOutput) {
-	return nil, &s3.PutBucketLoggingOutput{}
-}
-func (ms *MockS3) PutBucketLogging(*s3.PutBucketLoggingInput) (*s3.PutBucketLoggingOutput, error) {
-	return &s3.PutBucketLoggingOutput{}, nil
-}
-func (ms *MockS3) PutBucketNotificationRequest(*s3.PutBucketNotificationInput) (*request.Request, *s3.PutBucketNotificationOutput) {
-	return nil, &s3.PutBucketNotificationOutput{}
-}
-func (ms *MockS3) PutBucketNotification(*s3.PutBucketNotificationInput) (*s3.PutBucketNotificationOutput, error) {
-	return &s3.PutBucketNotificationOutput{}, nil
-}
-func (ms *MockS3) PutBucketNotificationConfigurationRequest(*s3.PutBucketNotificationConfigurationInput) (*request.Request, *s3.PutBucketNotificationConfigurationOutput) {
-	return nil, &s3.PutBucketNotificationConfigurationOutput{}
-}
-func (ms *MockS3) PutBucketNotificationConfiguration(*s3.PutBucketNotificationConfigurationInput) (*s3.PutBucketNotificationConfigurationOutput, error) {
-	return &s3.PutBucketNotificationConfigurationOutput{}, nil
-}
-func (ms *MockS3) PutBucketPolicyRequest(*s3.PutBucketPolicyInput) (*request.Request, *s3.PutBucketPolicyOutput) {
-	return nil, &s3.PutBucketPolicyOutput{}
-}
-func (ms *MockS3) PutBucketPolicy(*s3.PutBucketPolicyInput) (*s3.PutBucketPolicyOutput, error) {
-	return &s3.PutBucketPolicyOutput{}, nil
-}
-func (ms *MockS3) PutBucketReplicationRequest(*s3.PutBucketReplicationInput) (*request.Request, *s3.PutBucketReplicationOutput) {
-	return nil, &s3.PutBucketReplicationOutput{}
-}
-func (ms *MockS3) PutBucketReplication(*s3.PutBucketReplicationInput) (*s3.PutBucketReplicationOutput, error) {
-	return &s3.PutBucketReplicationOutput{}, nil
-}
-func (ms *MockS3) PutBucketRequestPaymentRequest(*s3.PutBucketRequestPaymentInput) (*request.Request, *s3.PutBucketRequestPaymentOutput) {
-	return nil, &s3.PutBucketRequestPaymentOutput{}
-}
-func (ms *MockS3) PutBucketRequestPayment(*s3.PutBucketRequestPaymentInput) (*s3.PutBucketRequestPaymentOutput, error) {
-	return &s3.PutBucketRequestPaymentOutput{}, nil
-}
-func (ms *MockS3) PutBucketTaggingRequest(*s3.PutBucketTaggingInput) (*request.Request, *s3.PutBucketTaggingOutput) {
-	return nil, &s3.PutBucketTaggingOutput{}
-}
-func (ms *MockS3) PutBucketTagging(*s3.PutBucketTaggingInput) (*s3.PutBucketTaggingOutput, error) {
-	return &s3.PutBucketTaggingOutput{}, nil
-}
-func (ms *MockS3) PutBucketVersioningRequest(*s3.PutBucketVersioningInput) (*request.Request, *s3.PutBucketVersioningOutput) {
-	return nil, &s3.PutBucketVersioningOutput{}
-}
-func (ms *MockS3) PutBucketVersioning(*s3.PutBucketVersioningInput) (*s3.PutBucketVersioningOutput, error) {
-	return &s3.PutBucketVersioningOutput{}, nil
-}
-func (ms *MockS3) PutBucketWebsiteRequest(*s3.PutBucketWebsiteInput) (*request.Request, *s3.PutBucketWebsiteOutput) {
-	return nil, &s3.PutBucketWebsiteOutput{}
-}
-func (ms *MockS3) PutBucketWebsite(*s3.PutBucketWebsiteInput) (*s3.PutBucketWebsiteOutput, error) {
-	return &s3.PutBucketWebsiteOutput{}, nil
-}
-func (ms *MockS3) PutObjectAclRequest(*s3.PutObjectAclInput) (*request.Request, *s3.PutObjectAclOutput) {
-	return nil, &s3.PutObjectAclOutput{}
-}
-func (ms *MockS3) PutObjectAcl(*s3.PutObjectAclInput) (*s3.PutObjectAclOutput, error) {
-	return &s3.PutObjectAclOutput{}, nil
-}
-func (ms *MockS3) RestoreObjectRequest(*s3.RestoreObjectInput) (*request.Request, *s3.RestoreObjectOutput) {
-	return nil, &s3.RestoreObjectOutput{}
-}
-func (ms *MockS3) RestoreObject(*s3.RestoreObjectInput) (*s3.RestoreObjectOutput, error) {
-	return &s3.RestoreObjectOutput{}, nil
-}
-func (ms *MockS3) UploadPartRequest(*s3.UploadPartInput) (*request.Request, *s3.UploadPartOutput) {
-	return nil, &s3.UploadPartOutput{}
-}
-func (ms *MockS3) UploadPart(*s3.UploadPartInput) (*s3.UploadPartOutput, error) {
-	return &s3.UploadPartOutput{}, nil
-}
-func (ms *MockS3) UploadPartCopyRequest(*s3.UploadPartCopyInput) (*request.Request, *s3.UploadPartCopyOutput) {
-	return nil, &s3.UploadPartCopyOutput{}
-}
-func (ms *MockS3) UploadPartCopy(*s3.UploadPartCopyInput) (*s3.UploadPartCopyOutput, error) {
-	return &s3.UploadPartCopyOutput{}, nil
-}
-
-func (ms *MockS3) AbortMultipartUploadWithContext(aws.Context, *s3.AbortMultipartUploadInput, ...request.Option) (*s3.AbortMultipartUploadOutput, error) {
-	return &s3.AbortMultipartUploadOutput{}, nil
-}
-
-func (ms *MockS3) CompleteMultipartUploadWithContext(aws.Context, *s3.CompleteMultipartUploadInput, ...request.Option) (*s3.CompleteMultipartUploadOutput, error) {
-	return &s3.CompleteMultipartUploadOutput{}, nil
-}
-
-func (ms *MockS3) CopyObjectWithContext(aws.Context, *s3.CopyObjectInput, ...request.Option) (*s3.CopyObjectOutput, error) {
-	return &s3.CopyObjectOutput{}, nil
-}
-
-func (ms *MockS3) CreateBucketWithContext(aws.Context, *s3.CreateBucketInput, ...request.Option) (*s3.CreateBucketOutput, error) {
-	return &s3.CreateBucketOutput{}, nil
-}
-
-func (ms *MockS3) CreateMultipartUploadWithContext(aws.Context, *s3.CreateMultipartUploadInput, ...request.Option) (*s3.CreateMultipartUploadOutput, error) {
-	return nil, nil
-}
-
-func (ms *MockS3) DeleteBucketWithContext(aws.Context, *s3.DeleteBucketInput, ...request.Option) (*s3.DeleteBucketOutput, error) {
-	return nil, nil
-}
-
-func (ms *MockS3) DeleteBucketAnalyticsConfiguration(*s3.DeleteBucketAnalyticsConfigurationInput) (*s3.DeleteBucketAnalyticsConfigurationOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) DeleteBucketAnalyticsConfigurationWithContext(aws.Context, *s3.DeleteBucketAnalyticsConfigurationInput, ...request.Option) (*s3.DeleteBucketAnalyticsConfigurationOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) DeleteBucketAnalyticsConfigurationRequest(*s3.DeleteBucketAnalyticsConfigurationInput) (*request.Request, *s3.DeleteBucketAnalyticsConfigurationOutput) {
-	return nil, nil
-}
-
-func (ms *MockS3) DeleteBucketCorsWithContext(aws.Context, *s3.DeleteBucketCorsInput, ...request.Option) (*s3.DeleteBucketCorsOutput, error) {
-	return nil, nil
-}
-
-func (ms *MockS3) DeleteBucketEncryption(*s3.DeleteBucketEncryptionInput) (*s3.DeleteBucketEncryptionOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) DeleteBucketEncryptionWithContext(aws.Context, *s3.DeleteBucketEncryptionInput, ...request.Option) (*s3.DeleteBucketEncryptionOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) DeleteBucketEncryptionRequest(*s3.DeleteBucketEncryptionInput) (*request.Request, *s3.DeleteBucketEncryptionOutput) {
-	return nil, nil
-}
-
-func (ms *MockS3) DeleteBucketIntelligentTieringConfiguration(*s3.DeleteBucketIntelligentTieringConfigurationInput) (*s3.DeleteBucketIntelligentTieringConfigurationOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) DeleteBucketIntelligentTieringConfigurationWithContext(aws.Context, *s3.DeleteBucketIntelligentTieringConfigurationInput, ...request.Option) (*s3.DeleteBucketIntelligentTieringConfigurationOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) DeleteBucketIntelligentTieringConfigurationRequest(*s3.DeleteBucketIntelligentTieringConfigurationInput) (*request.Request, *s3.DeleteBucketIntelligentTieringConfigurationOutput) {
-	return nil, nil
-}
-
-func (ms *MockS3) DeleteBucketInventoryConfiguration(*s3.DeleteBucketInventoryConfigurationInput) (*s3.DeleteBucketInventoryConfigurationOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) DeleteBucketInventoryConfigurationWithContext(aws.Context, *s3.DeleteBucketInventoryConfigurationInput, ...request.Option) (*s3.DeleteBucketInventoryConfigurationOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) DeleteBucketInventoryConfigurationRequest(*s3.DeleteBucketInventoryConfigurationInput) (*request.Request, *s3.DeleteBucketInventoryConfigurationOutput) {
-	return nil, nil
-}
-
-func (ms *MockS3) DeleteBucketLifecycleWithContext(aws.Context, *s3.DeleteBucketLifecycleInput, ...request.Option) (*s3.DeleteBucketLifecycleOutput, error) {
-	return nil, nil
-}
-
-func (ms *MockS3) DeleteBucketMetricsConfiguration(*s3.DeleteBucketMetricsConfigurationInput) (*s3.DeleteBucketMetricsConfigurationOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) DeleteBucketMetricsConfigurationWithContext(aws.Context, *s3.DeleteBucketMetricsConfigurationInput, ...request.Option) (*s3.DeleteBucketMetricsConfigurationOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) DeleteBucketMetricsConfigurationRequest(*s3.DeleteBucketMetricsConfigurationInput) (*request.Request, *s3.DeleteBucketMetricsConfigurationOutput) {
-	return nil, nil
-}
-
-func (ms *MockS3) DeleteBucketOwnershipControls(*s3.DeleteBucketOwnershipControlsInput) (*s3.DeleteBucketOwnershipControlsOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) DeleteBucketOwnershipControlsWithContext(aws.Context, *s3.DeleteBucketOwnershipControlsInput, ...request.Option) (*s3.DeleteBucketOwnershipControlsOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) DeleteBucketOwnershipControlsRequest(*s3.DeleteBucketOwnershipControlsInput) (*request.Request, *s3.DeleteBucketOwnershipControlsOutput) {
-	return nil, nil
-}
-
-func (ms *MockS3) DeleteBucketPolicyWithContext(aws.Context, *s3.DeleteBucketPolicyInput, ...request.Option) (*s3.DeleteBucketPolicyOutput, error) {
-	return nil, nil
-}
-
-func (ms *MockS3) DeleteBucketReplicationWithContext(aws.Context, *s3.DeleteBucketReplicationInput, ...request.Option) (*s3.DeleteBucketReplicationOutput, error) {
-	return nil, nil
-}
-
-func (ms *MockS3) DeleteBucketTaggingWithContext(aws.Context, *s3.DeleteBucketTaggingInput, ...request.Option) (*s3.DeleteBucketTaggingOutput, error) {
-	return nil, nil
-}
-
-func (ms *MockS3) DeleteBucketWebsiteWithContext(aws.Context, *s3.DeleteBucketWebsiteInput, ...request.Option) (*s3.DeleteBucketWebsiteOutput, error) {
-	return nil, nil
-}
-
-func (ms *MockS3) DeleteObjectWithContext(aws.Context, *s3.DeleteObjectInput, ...request.Option) (*s3.DeleteObjectOutput, error) {
-	return nil, nil
-}
-
-func (ms *MockS3) DeleteObjectTagging(*s3.DeleteObjectTaggingInput) (*s3.DeleteObjectTaggingOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) DeleteObjectTaggingWithContext(aws.Context, *s3.DeleteObjectTaggingInput, ...request.Option) (*s3.DeleteObjectTaggingOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) DeleteObjectTaggingRequest(*s3.DeleteObjectTaggingInput) (*request.Request, *s3.DeleteObjectTaggingOutput) {
-	return nil, nil
-}
-
-func (ms *MockS3) DeleteObjectsWithContext(aws.Context, *s3.DeleteObjectsInput, ...request.Option) (*s3.DeleteObjectsOutput, error) {
-	return nil, nil
-}
-
-func (ms *MockS3) DeletePublicAccessBlock(*s3.DeletePublicAccessBlockInput) (*s3.DeletePublicAccessBlockOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) DeletePublicAccessBlockWithContext(aws.Context, *s3.DeletePublicAccessBlockInput, ...request.Option) (*s3.DeletePublicAccessBlockOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) DeletePublicAccessBlockRequest(*s3.DeletePublicAccessBlockInput) (*request.Request, *s3.DeletePublicAccessBlockOutput) {
-	return nil, nil
-}
-
-func (ms *MockS3) GetBucketAccelerateConfigurationWithContext(aws.Context, *s3.GetBucketAccelerateConfigurationInput, ...request.Option) (*s3.GetBucketAccelerateConfigurationOutput, error) {
-	return nil, nil
-}
-
-func (ms *MockS3) GetBucketAclWithContext(aws.Context, *s3.GetBucketAclInput, ...request.Option) (*s3.GetBucketAclOutput, error) {
-	return nil, nil
-}
-
-func (ms *MockS3) GetBucketAnalyticsConfiguration(*s3.GetBucketAnalyticsConfigurationInput) (*s3.GetBucketAnalyticsConfigurationOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) GetBucketAnalyticsConfigurationWithContext(aws.Context, *s3.GetBucketAnalyticsConfigurationInput, ...request.Option) (*s3.GetBucketAnalyticsConfigurationOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) GetBucketAnalyticsConfigurationRequest(*s3.GetBucketAnalyticsConfigurationInput) (*request.Request, *s3.GetBucketAnalyticsConfigurationOutput) {
-	return nil, nil
-}
-
-func (ms *MockS3) GetBucketCorsWithContext(aws.Context, *s3.GetBucketCorsInput, ...request.Option) (*s3.GetBucketCorsOutput, error) {
-	return nil, nil
-}
-
-func (ms *MockS3) GetBucketEncryption(*s3.GetBucketEncryptionInput) (*s3.GetBucketEncryptionOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) GetBucketEncryptionWithContext(aws.Context, *s3.GetBucketEncryptionInput, ...request.Option) (*s3.GetBucketEncryptionOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) GetBucketEncryptionRequest(*s3.GetBucketEncryptionInput) (*request.Request, *s3.GetBucketEncryptionOutput) {
-	return nil, nil
-}
-
-func (ms *MockS3) GetBucketIntelligentTieringConfiguration(*s3.GetBucketIntelligentTieringConfigurationInput) (*s3.GetBucketIntelligentTieringConfigurationOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) GetBucketIntelligentTieringConfigurationWithContext(aws.Context, *s3.GetBucketIntelligentTieringConfigurationInput, ...request.Option) (*s3.GetBucketIntelligentTieringConfigurationOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) GetBucketIntelligentTieringConfigurationRequest(*s3.GetBucketIntelligentTieringConfigurationInput) (*request.Request, *s3.GetBucketIntelligentTieringConfigurationOutput) {
-	return nil, nil
-}
-
-func (ms *MockS3) GetBucketInventoryConfiguration(*s3.GetBucketInventoryConfigurationInput) (*s3.GetBucketInventoryConfigurationOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) GetBucketInventoryConfigurationWithContext(aws.Context, *s3.GetBucketInventoryConfigurationInput, ...request.Option) (*s3.GetBucketInventoryConfigurationOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) GetBucketInventoryConfigurationRequest(*s3.GetBucketInventoryConfigurationInput) (*request.Request, *s3.GetBucketInventoryConfigurationOutput) {
-	return nil, nil
-}
-
-func (ms *MockS3) GetBucketLifecycleWithContext(aws.Context, *s3.GetBucketLifecycleInput, ...request.Option) (*s3.GetBucketLifecycleOutput, error) {
-	return nil, nil
-}
-
-func (ms *MockS3) GetBucketLifecycleConfigurationWithContext(aws.Context, *s3.GetBucketLifecycleConfigurationInput, ...request.Option) (*s3.GetBucketLifecycleConfigurationOutput, error) {
-	return nil, nil
-}
-
-func (ms *MockS3) GetBucketLocationWithContext(aws.Context, *s3.GetBucketLocationInput, ...request.Option) (*s3.GetBucketLocationOutput, error) {
-	return nil, nil
+
+func (ms *MockS3) GetBucketVersioning(ctx context.Context, input *s3.GetBucketVersioningInput, _ ...func(*s3.Options)) (*s3.GetBucketVersioningOutput, error) {
+	if err := mockCanceled(ctx); err != nil {
+		return nil, err
+	}
+	ms.RLock()
+	defer ms.RUnlock()
+	if _, ok := ms.data[*input.Bucket]; !ok {
+		return nil, ErrNoSuchBucket
+	}
+	output := s3.GetBucketVersioningOutput{}
+	if config, ok := ms.config[*input.Bucket]; ok && config.versioning {
+		output.Status = types.BucketVersioningStatusEnabled
+	}
+	return &output, nil
 }
 
-func (ms *MockS3) GetBucketLoggingWithContext(aws.Context, *s3.GetBucketLoggingInput, ...request.Option) (*s3.GetBucketLoggingOutput, error) {
-	return nil, nil
-}
-
-func (ms *MockS3) GetBucketMetricsConfiguration(*s3.GetBucketMetricsConfigurationInput) (*s3.GetBucketMetricsConfigurationOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) GetBucketMetricsConfigurationWithContext(aws.Context, *s3.GetBucketMetricsConfigurationInput, ...request.Option) (*s3.GetBucketMetricsConfigurationOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) GetBucketMetricsConfigurationRequest(*s3.GetBucketMetricsConfigurationInput) (*request.Request, *s3.GetBucketMetricsConfigurationOutput) {
-	return nil, nil
-}
-
-func (ms *MockS3) GetBucketNotificationWithContext(aws.Context, *s3.GetBucketNotificationConfigurationRequest, ...request.Option) (*s3.NotificationConfigurationDeprecated, error) {
-	return nil, nil
-}
-
-func (ms *MockS3) GetBucketNotificationConfigurationWithContext(aws.Context, *s3.GetBucketNotificationConfigurationRequest, ...request.Option) (*s3.NotificationConfiguration, error) {
-	return nil, nil
-}
-
-func (ms *MockS3) GetBucketOwnershipControls(*s3.GetBucketOwnershipControlsInput) (*s3.GetBucketOwnershipControlsOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) GetBucketOwnershipControlsWithContext(aws.Context, *s3.GetBucketOwnershipControlsInput, ...request.Option) (*s3.GetBucketOwnershipControlsOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) GetBucketOwnershipControlsRequest(*s3.GetBucketOwnershipControlsInput) (*request.Request, *s3.GetBucketOwnershipControlsOutput) {
-	return nil, nil
-}
-
-func (ms *MockS3) GetBucketPolicyWithContext(aws.Context, *s3.GetBucketPolicyInput, ...request.Option) (*s3.GetBucketPolicyOutput, error) {
-	return nil, nil
-}
-
-func (ms *MockS3) GetBucketPolicyStatus(*s3.GetBucketPolicyStatusInput) (*s3.GetBucketPolicyStatusOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) GetBucketPolicyStatusWithContext(aws.Context, *s3.GetBucketPolicyStatusInput, ...request.Option) (*s3.GetBucketPolicyStatusOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) GetBucketPolicyStatusRequest(*s3.GetBucketPolicyStatusInput) (*request.Request, *s3.GetBucketPolicyStatusOutput) {
-	return nil, nil
-}
-
-func (ms *MockS3) GetBucketReplicationWithContext(aws.Context, *s3.GetBucketReplicationInput, ...request.Option) (*s3.GetBucketReplicationOutput, error) {
-	return nil, nil
-}
-
-func (ms *MockS3) GetBucketRequestPaymentWithContext(aws.Context, *s3.GetBucketRequestPaymentInput, ...request.Option) (*s3.GetBucketRequestPaymentOutput, error) {
-	return nil, nil
-}
-
-func (ms *MockS3) GetBucketTaggingWithContext(aws.Context, *s3.GetBucketTaggingInput, ...request.Option) (*s3.GetBucketTaggingOutput, error) {
-	return nil, nil
-}
-
-func (ms *MockS3) GetBucketVersioningWithContext(aws.Context, *s3.GetBucketVersioningInput, ...request.Option) (*s3.GetBucketVersioningOutput, error) {
-	return nil, nil
-}
-
-func (ms *MockS3) GetBucketWebsiteWithContext(aws.Context, *s3.GetBucketWebsiteInput, ...request.Option) (*s3.GetBucketWebsiteOutput, error) {
-	return nil, nil
-}
-
-func (ms *MockS3) GetObjectWithContext(aws.Context, *s3.GetObjectInput, ...request.Option) (*s3.GetObjectOutput, error) {
-	return nil, nil
-}
-
-func (ms *MockS3) GetObjectAclWithContext(aws.Context, *s3.GetObjectAclInput, ...request.Option) (*s3.GetObjectAclOutput, error) {
-	return nil, nil
-}
-
-func (ms *MockS3) GetObjectLegalHold(*s3.GetObjectLegalHoldInput) (*s3.GetObjectLegalHoldOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) GetObjectLegalHoldWithContext(aws.Context, *s3.GetObjectLegalHoldInput, ...request.Option) (*s3.GetObjectLegalHoldOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) GetObjectLegalHoldRequest(*s3.GetObjectLegalHoldInput) (*request.Request, *s3.GetObjectLegalHoldOutput) {
-	return nil, nil
-}
-
-func (ms *MockS3) GetObjectLockConfiguration(*s3.GetObjectLockConfigurationInput) (*s3.GetObjectLockConfigurationOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) GetObjectLockConfigurationWithContext(aws.Context, *s3.GetObjectLockConfigurationInput, ...request.Option) (*s3.GetObjectLockConfigurationOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) GetObjectLockConfigurationRequest(*s3.GetObjectLockConfigurationInput) (*request.Request, *s3.GetObjectLockConfigurationOutput) {
-	return nil, nil
-}
-
-func (ms *MockS3) GetObjectRetention(*s3.GetObjectRetentionInput) (*s3.GetObjectRetentionOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) GetObjectRetentionWithContext(aws.Context, *s3.GetObjectRetentionInput, ...request.Option) (*s3.GetObjectRetentionOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) GetObjectRetentionRequest(*s3.GetObjectRetentionInput) (*request.Request, *s3.GetObjectRetentionOutput) {
-	return nil, nil
-}
-
-func (ms *MockS3) GetObjectTagging(*s3.GetObjectTaggingInput) (*s3.GetObjectTaggingOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) GetObjectTaggingWithContext(aws.Context, *s3.GetObjectTaggingInput, ...request.Option) (*s3.GetObjectTaggingOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) GetObjectTaggingRequest(*s3.GetObjectTaggingInput) (*request.Request, *s3.GetObjectTaggingOutput) {
-	return nil, nil
-}
-
-func (ms *MockS3) GetObjectTorrentWithContext(aws.Context, *s3.GetObjectTorrentInput, ...request.Option) (*s3.GetObjectTorrentOutput, error) {
-	return nil, nil
-}
-
-func (ms *MockS3) GetPublicAccessBlock(*s3.GetPublicAccessBlockInput) (*s3.GetPublicAccessBlockOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) GetPublicAccessBlockWithContext(aws.Context, *s3.GetPublicAccessBlockInput, ...request.Option) (*s3.GetPublicAccessBlockOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) GetPublicAccessBlockRequest(*s3.GetPublicAccessBlockInput) (*request.Request, *s3.GetPublicAccessBlockOutput) {
-	return nil, nil
-}
-
-func (ms *MockS3) HeadBucketWithContext(aws.Context, *s3.HeadBucketInput, ...request.Option) (*s3.HeadBucketOutput, error) {
-	return nil, nil
-}
-
-func (ms *MockS3) HeadObjectWithContext(aws.Context, *s3.HeadObjectInput, ...request.Option) (*s3.HeadObjectOutput, error) {
-	return nil, nil
-}
-
-func (ms *MockS3) ListBucketAnalyticsConfigurations(*s3.ListBucketAnalyticsConfigurationsInput) (*s3.ListBucketAnalyticsConfigurationsOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) ListBucketAnalyticsConfigurationsWithContext(aws.Context, *s3.ListBucketAnalyticsConfigurationsInput, ...request.Option) (*s3.ListBucketAnalyticsConfigurationsOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) ListBucketAnalyticsConfigurationsRequest(*s3.ListBucketAnalyticsConfigurationsInput) (*request.Request, *s3.ListBucketAnalyticsConfigurationsOutput) {
-	return nil, nil
-}
-
-func (ms *MockS3) ListBucketIntelligentTieringConfigurations(*s3.ListBucketIntelligentTieringConfigurationsInput) (*s3.ListBucketIntelligentTieringConfigurationsOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) ListBucketIntelligentTieringConfigurationsWithContext(aws.Context, *s3.ListBucketIntelligentTieringConfigurationsInput, ...request.Option) (*s3.ListBucketIntelligentTieringConfigurationsOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) ListBucketIntelligentTieringConfigurationsRequest(*s3.ListBucketIntelligentTieringConfigurationsInput) (*request.Request, *s3.ListBucketIntelligentTieringConfigurationsOutput) {
-	return nil, nil
-}
-
-func (ms *MockS3) ListBucketInventoryConfigurations(*s3.ListBucketInventoryConfigurationsInput) (*s3.ListBucketInventoryConfigurationsOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) ListBucketInventoryConfigurationsWithContext(aws.Context, *s3.ListBucketInventoryConfigurationsInput, ...request.Option) (*s3.ListBucketInventoryConfigurationsOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) ListBucketInventoryConfigurationsRequest(*s3.ListBucketInventoryConfigurationsInput) (*request.Request, *s3.ListBucketInventoryConfigurationsOutput) {
-	return nil, nil
-}
-
-func (ms *MockS3) ListBucketMetricsConfigurations(*s3.ListBucketMetricsConfigurationsInput) (*s3.ListBucketMetricsConfigurationsOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) ListBucketMetricsConfigurationsWithContext(aws.Context, *s3.ListBucketMetricsConfigurationsInput, ...request.Option) (*s3.ListBucketMetricsConfigurationsOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) ListBucketMetricsConfigurationsRequest(*s3.ListBucketMetricsConfigurationsInput) (*request.Request, *s3.ListBucketMetricsConfigurationsOutput) {
-	return nil, nil
-}
-
-func (ms *MockS3) ListBucketsWithContext(aws.Context, *s3.ListBucketsInput, ...request.Option) (*s3.ListBucketsOutput, error) {
-	return nil, nil
-}
-
-func (ms *MockS3) ListMultipartUploadsWithContext(aws.Context, *s3.ListMultipartUploadsInput, ...request.Option) (*s3.ListMultipartUploadsOutput, error) {
-	return nil, nil
-}
-
-func (ms *MockS3) ListMultipartUploadsPagesWithContext(aws.Context, *s3.ListMultipartUploadsInput, func(*s3.ListMultipartUploadsOutput, bool) bool, ...request.Option) error {
-	return nil
-}
-
-func (ms *MockS3) ListObjectVersionsWithContext(aws.Context, *s3.ListObjectVersionsInput, ...request.Option) (*s3.ListObjectVersionsOutput, error) {
-	return nil, nil
-}
-
-func (ms *MockS3) ListObjectVersionsPagesWithContext(aws.Context, *s3.ListObjectVersionsInput, func(*s3.ListObjectVersionsOutput, bool) bool, ...request.Option) error {
-	return nil
-}
-
-func (ms *MockS3) ListObjectsWithContext(aws.Context, *s3.ListObjectsInput, ...request.Option) (*s3.ListObjectsOutput, error) {
-	return nil, nil
-}
-
-func (ms *MockS3) ListObjectsPagesWithContext(aws.Context, *s3.ListObjectsInput, func(*s3.ListObjectsOutput, bool) bool, ...request.Option) error {
-	return nil
-}
-
-func (ms *MockS3) ListObjectsV2WithContext(aws.Context, *s3.ListObjectsV2Input, ...request.Option) (*s3.ListObjectsV2Output, error) {
-	return nil, nil
-}
-
-func (ms *MockS3) ListObjectsV2PagesWithContext(aws.Context, *s3.ListObjectsV2Input, func(*s3.ListObjectsV2Output, bool) bool, ...request.Option) error {
-	return nil
-}
-
-func (ms *MockS3) ListPartsWithContext(aws.Context, *s3.ListPartsInput, ...request.Option) (*s3.ListPartsOutput, error) {
-	return nil, nil
-}
-
-func (ms *MockS3) ListPartsPagesWithContext(aws.Context, *s3.ListPartsInput, func(*s3.ListPartsOutput, bool) bool, ...request.Option) error {
-	return nil
-}
-
-func (ms *MockS3) PutBucketAccelerateConfigurationWithContext(aws.Context, *s3.PutBucketAccelerateConfigurationInput, ...request.Option) (*s3.PutBucketAccelerateConfigurationOutput, error) {
-	return nil, nil
-}
-
-func (ms *MockS3) PutBucketAclWithContext(aws.Context, *s3.PutBucketAclInput, ...request.Option) (*s3.PutBucketAclOutput, error) {
-	return nil, nil
-}
-
-func (ms *MockS3) PutBucketAnalyticsConfiguration(*s3.PutBucketAnalyticsConfigurationInput) (*s3.PutBucketAnalyticsConfigurationOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) PutBucketAnalyticsConfigurationWithContext(aws.Context, *s3.PutBucketAnalyticsConfigurationInput, ...request.Option) (*s3.PutBucketAnalyticsConfigurationOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) PutBucketAnalyticsConfigurationRequest(*s3.PutBucketAnalyticsConfigurationInput) (*request.Request, *s3.PutBucketAnalyticsConfigurationOutput) {
-	return nil, nil
-}
-
-func (ms *MockS3) PutBucketCorsWithContext(aws.Context, *s3.PutBucketCorsInput, ...request.Option) (*s3.PutBucketCorsOutput, error) {
-	return nil, nil
-}
-
-func (ms *MockS3) PutBucketEncryption(*s3.PutBucketEncryptionInput) (*s3.PutBucketEncryptionOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) PutBucketEncryptionWithContext(aws.Context, *s3.PutBucketEncryptionInput, ...request.Option) (*s3.PutBucketEncryptionOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) PutBucketEncryptionRequest(*s3.PutBucketEncryptionInput) (*request.Request, *s3.PutBucketEncryptionOutput) {
-	return nil, nil
-}
-
-func (ms *MockS3) PutBucketIntelligentTieringConfiguration(*s3.PutBucketIntelligentTieringConfigurationInput) (*s3.PutBucketIntelligentTieringConfigurationOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) PutBucketIntelligentTieringConfigurationWithContext(aws.Context, *s3.PutBucketIntelligentTieringConfigurationInput, ...request.Option) (*s3.PutBucketIntelligentTieringConfigurationOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) PutBucketIntelligentTieringConfigurationRequest(*s3.PutBucketIntelligentTieringConfigurationInput) (*request.Request, *s3.PutBucketIntelligentTieringConfigurationOutput) {
-	return nil, nil
+func (ms *MockS3) GetBucketAccelerateConfiguration(ctx context.Context, input *s3.GetBucketAccelerateConfigurationInput, _ ...func(*s3.Options)) (*s3.GetBucketAccelerateConfigurationOutput, error) {
+	if err := mockCanceled(ctx); err != nil {
+		return nil, err
+	}
+	ms.RLock()
+	defer ms.RUnlock()
+	if _, ok := ms.data[*input.Bucket]; !ok {
+		return nil, ErrNoSuchBucket
+	}
+	output := s3.GetBucketAccelerateConfigurationOutput{}
+	if config, ok := ms.config[*input.Bucket]; ok {
+		output.Status = config.accelerate
+	}
+	return &output, nil
 }
 
-func (ms *MockS3) PutBucketInventoryConfiguration(*s3.PutBucketInventoryConfigurationInput) (*s3.PutBucketInventoryConfigurationOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) PutBucketInventoryConfigurationWithContext(aws.Context, *s3.PutBucketInventoryConfigurationInput, ...request.Option) (*s3.PutBucketInventoryConfigurationOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) PutBucketInventoryConfigurationRequest(*s3.PutBucketInventoryConfigurationInput) (*request.Request, *s3.PutBucketInventoryConfigurationOutput) {
-	return nil, nil
+func (ms *MockS3) PutBucketAccelerateConfiguration(ctx context.Context, input *s3.PutBucketAccelerateConfigurationInput, _ ...func(*s3.Options)) (*s3.PutBucketAccelerateConfigurationOutput, error) {
+	if err := mockCanceled(ctx); err != nil {
+		return nil, err
+	}
+	ms.Lock()
+	defer ms.Unlock()
+	config, err := ms.bucketConfig(*input.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	config.accelerate = input.AccelerateConfiguration.Status
+	return &s3.PutBucketAccelerateConfigurationOutput{}, nil
 }
 
-func (ms *MockS3) PutBucketLifecycleWithContext(aws.Context, *s3.PutBucketLifecycleInput, ...request.Option) (*s3.PutBucketLifecycleOutput, error) {
-	return nil, nil
+// PutBucketVersioning enables versioning, but can't suspend it.
+func (ms *MockS3) PutBucketVersioning(ctx context.Context, input *s3.PutBucketVersioningInput, _ ...func(*s3.Options)) (*s3.PutBucketVersioningOutput, error) {
+	if err := mockCanceled(ctx); err != nil {
+		return nil, err
+	}
+	ms.Lock()
+	defer ms.Unlock()
+	config, err := ms.bucketConfig(*input.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if input.VersioningConfiguration.Status == types.BucketVersioningStatusEnabled && !config.versioning {
+		config.versioning = true
+		config.versions = map[string][]*MockObject{}
+	}
+	return &s3.PutBucketVersioningOutput{}, nil
 }
 
-func (ms *MockS3) PutBucketLifecycleConfigurationWithContext(aws.Context, *s3.PutBucketLifecycleConfigurationInput, ...request.Option) (*s3.PutBucketLifecycleConfigurationOutput, error) {
-	return nil, nil
+// ListObjectVersions lists every version of the keys under the prefix,
+// newest first, in a single page.
+func (ms *MockS3) ListObjectVersions(ctx context.Context, input *s3.ListObjectVersionsInput, _ ...func(*s3.Options)) (*s3.ListObjectVersionsOutput, error) {
+	if err := mockCanceled(ctx); err != nil {
+		return nil, err
+	}
+	ms.RLock()
+	defer ms.RUnlock()
+	if _, ok := ms.data[*input.Bucket]; !ok {
+		return nil, ErrNoSuchBucket
+	}
+	output := s3.ListObjectVersionsOutput{IsTruncated: aws.Bool(false)}
+	config, ok := ms.config[*input.Bucket]
+	if !ok {
+		return &output, nil
+	}
+	var keys []string
+	for key := range config.versions {
+		if strings.HasPrefix(key, aws.ToString(input.Prefix)) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		versions := config.versions[key]
+		for i := len(versions) - 1; i >= 0; i-- {
+			version := versions[i]
+			latest := aws.Bool(i == len(versions)-1)
+			if version.deleteMarker {
+				output.DeleteMarkers = append(output.DeleteMarkers, types.DeleteMarkerEntry{Key: aws.String(key), VersionId: version.VersionId, IsLatest: latest, LastModified: aws.Time(version.Modified)})
+				continue
+			}
+			output.Versions = append(output.Versions, types.ObjectVersion{Key: aws.String(key), VersionId: version.VersionId, IsLatest: latest, LastModified: aws.Time(version.Modified), ETag: version.etag(), Size: aws.Int64(int64(len(version.Content)))})
+		}
+	}
+	return &output, nil
 }
 
-func (ms *MockS3) PutBucketLoggingWithContext(aws.Context, *s3.PutBucketLoggingInput, ...request.Option) (*s3.PutBucketLoggingOutput, error) {
-	return nil, nil
+func (ms *MockS3) CopyObject(ctx context.Context, input *s3.CopyObjectInput, _ ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	if err := mockCanceled(ctx); err != nil {
+		return nil, err
+	}
+	ms.Lock()
+	defer ms.Unlock()
+	source, err := url.PathUnescape(*input.CopySource)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.SplitN(strings.TrimPrefix(source, "/"), "/", 2)
+	srcBucket, ok := ms.data[parts[0]]
+	if !ok || len(parts) < 2 {
+		return nil, ErrNoSuchBucket
+	}
+	object, ok := srcBucket[parts[1]]
+	if !ok {
+		return nil, errors.New("missing key")
+	}
+	if err := object.checkCustomerKey(input.CopySourceSSECustomerKey); err != nil {
+		return nil, err
+	}
+	if _, ok := ms.data[*input.Bucket]; !ok {
+		return nil, ErrNoSuchBucket
+	}
+	copied := *object
+	copied.Modified = time.Now()
+	copied.StorageClass = input.StorageClass
+	copied.ServerSideEncryption = input.ServerSideEncryption
+	copied.SSEKMSKeyId = input.SSEKMSKeyId
+	copied.SSECustomerKeyMD5 = customerKeyMD5(input.SSECustomerKey)
+	if input.MetadataDirective == types.MetadataDirectiveReplace {
+		copied.Metadata = input.Metadata
+		copied.ContentType = input.ContentType
+		copied.ContentEncoding = input.ContentEncoding
+		copied.CacheControl = input.CacheControl
+		copied.ContentDisposition = input.ContentDisposition
+	}
+	ms.put(*input.Bucket, *input.Key, &copied)
+	return &s3.CopyObjectOutput{}, nil
 }
 
-func (ms *MockS3) PutBucketMetricsConfiguration(*s3.PutBucketMetricsConfigurationInput) (*s3.PutBucketMetricsConfigurationOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) PutBucketMetricsConfigurationWithContext(aws.Context, *s3.PutBucketMetricsConfigurationInput, ...request.Option) (*s3.PutBucketMetricsConfigurationOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) PutBucketMetricsConfigurationRequest(*s3.PutBucketMetricsConfigurationInput) (*request.Request, *s3.PutBucketMetricsConfigurationOutput) {
-	return nil, nil
+func (ms *MockS3) DeleteBucketTagging(ctx context.Context, input *s3.DeleteBucketTaggingInput, _ ...func(*s3.Options)) (*s3.DeleteBucketTaggingOutput, error) {
+	if err := mockCanceled(ctx); err != nil {
+		return nil, err
+	}
+	ms.Lock()
+	defer ms.Unlock()
+	config, err := ms.bucketConfig(*input.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	config.tags = nil
+	return &s3.DeleteBucketTaggingOutput{}, nil
 }
 
-func (ms *MockS3) PutBucketNotificationWithContext(aws.Context, *s3.PutBucketNotificationInput, ...request.Option) (*s3.PutBucketNotificationOutput, error) {
-	return nil, nil
+func (ms *MockS3) GetBucketLocation(ctx context.Context, input *s3.GetBucketLocationInput, _ ...func(*s3.Options)) (*s3.GetBucketLocationOutput, error) {
+	if err := mockCanceled(ctx); err != nil {
+		return nil, err
+	}
+	ms.RLock()
+	defer ms.RUnlock()
+	if _, ok := ms.data[*input.Bucket]; !ok {
+		return nil, ErrNoSuchBucket
+	}
+	output := s3.GetBucketLocationOutput{}
+	if config, ok := ms.config[*input.Bucket]; ok {
+		output.LocationConstraint = types.BucketLocationConstraint(config.location)
+	}
+	return &output, nil
 }
 
-func (ms *MockS3) PutBucketNotificationConfigurationWithContext(aws.Context, *s3.PutBucketNotificationConfigurationInput, ...request.Option) (*s3.PutBucketNotificationConfigurationOutput, error) {
-	return nil, nil
+func (ms *MockS3) GetBucketTagging(ctx context.Context, input *s3.GetBucketTaggingInput, _ ...func(*s3.Options)) (*s3.GetBucketTaggingOutput, error) {
+	if err := mockCanceled(ctx); err != nil {
+		return nil, err
+	}
+	ms.Lock()
+	defer ms.Unlock()
+	config, err := ms.bucketConfig(*input.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if config.tags == nil {
+		return nil, &smithy.GenericAPIError{Code: "NoSuchTagSet", Message: "The TagSet does not exist"}
+	}
+	return &s3.GetBucketTaggingOutput{TagSet: config.tags}, nil
 }
 
-func (ms *MockS3) PutBucketOwnershipControls(*s3.PutBucketOwnershipControlsInput) (*s3.PutBucketOwnershipControlsOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) PutBucketOwnershipControlsWithContext(aws.Context, *s3.PutBucketOwnershipControlsInput, ...request.Option) (*s3.PutBucketOwnershipControlsOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) PutBucketOwnershipControlsRequest(*s3.PutBucketOwnershipControlsInput) (*request.Request, *s3.PutBucketOwnershipControlsOutput) {
-	return nil, nil
+func (ms *MockS3) PutBucketTagging(ctx context.Context, input *s3.PutBucketTaggingInput, _ ...func(*s3.Options)) (*s3.PutBucketTaggingOutput, error) {
+	if err := mockCanceled(ctx); err != nil {
+		return nil, err
+	}
+	ms.Lock()
+	defer ms.Unlock()
+	config, err := ms.bucketConfig(*input.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	config.tags = input.Tagging.TagSet
+	return &s3.PutBucketTaggingOutput{}, nil
 }
 
-func (ms *MockS3) PutBucketPolicyWithContext(aws.Context, *s3.PutBucketPolicyInput, ...request.Option) (*s3.PutBucketPolicyOutput, error) {
-	return nil, nil
+func (ms *MockS3) HeadObject(ctx context.Context, input *s3.HeadObjectInput, _ ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	if err := mockCanceled(ctx); err != nil {
+		return nil, err
+	}
+	ms.Lock()
+	defer ms.Unlock()
+	bucket := ms.data[*input.Bucket]
+	if object, ok := bucket[*input.Key]; ok {
+		if object.hidden > 0 {
+			object.hidden--
+			return nil, errors.New("missing key")
+		}
+		if err := object.checkCustomerKey(input.SSECustomerKey); err != nil {
+			return nil, err
+		}
+		output := s3.HeadObjectOutput{
+			ContentLength:   aws.Int64(int64(len(object.Content))),
+			ContentType:     object.ContentType,
+			ContentEncoding: object.ContentEncoding,
+			ETag:            object.etag(),
+			LastModified:    aws.Time(object.Modified),
+			Metadata:        object.Metadata,
+			StorageClass:    object.StorageClass,
+
+			CacheControl:         object.CacheControl,
+			ContentDisposition:   object.ContentDisposition,
+			ServerSideEncryption: object.ServerSideEncryption,
+			SSEKMSKeyId:          object.SSEKMSKeyId,
+			SSECustomerAlgorithm: input.SSECustomerAlgorithm,
+			SSECustomerKeyMD5:    object.SSECustomerKeyMD5,
+
+			ObjectLockMode:            object.ObjectLockMode,
+			ObjectLockRetainUntilDate: object.ObjectLockRetainUntilDate,
+			ObjectLockLegalHoldStatus: object.ObjectLockLegalHoldStatus,
+		}
+		return &output, nil
+	} else {
+		return nil, errors.New("missing key")
+	}
 }
 
-func (ms *MockS3) PutBucketReplicationWithContext(aws.Context, *s3.PutBucketReplicationInput, ...request.Option) (*s3.PutBucketReplicationOutput, error) {
-	return nil, nil
+func (ms *MockS3) DeleteBucketEncryption(ctx context.Context, input *s3.DeleteBucketEncryptionInput, _ ...func(*s3.Options)) (*s3.DeleteBucketEncryptionOutput, error) {
+	if err := mockCanceled(ctx); err != nil {
+		return nil, err
+	}
+	ms.Lock()
+	defer ms.Unlock()
+	config, err := ms.bucketConfig(*input.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	config.encryption = nil
+	return &s3.DeleteBucketEncryptionOutput{}, nil
 }
 
-func (ms *MockS3) PutBucketRequestPaymentWithContext(aws.Context, *s3.PutBucketRequestPaymentInput, ...request.Option) (*s3.PutBucketRequestPaymentOutput, error) {
-	return nil, nil
+func (ms *MockS3) GetBucketEncryption(ctx context.Context, input *s3.GetBucketEncryptionInput, _ ...func(*s3.Options)) (*s3.GetBucketEncryptionOutput, error) {
+	if err := mockCanceled(ctx); err != nil {
+		return nil, err
+	}
+	ms.Lock()
+	defer ms.Unlock()
+	config, err := ms.bucketConfig(*input.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if config.encryption == nil {
+		return nil, &smithy.GenericAPIError{Code: "ServerSideEncryptionConfigurationNotFoundError", Message: "The server side encryption configuration was not found"}
+	}
+	return &s3.GetBucketEncryptionOutput{ServerSideEncryptionConfiguration: config.encryption}, nil
 }
 
-func (ms *MockS3) PutBucketTaggingWithContext(aws.Context, *s3.PutBucketTaggingInput, ...request.Option) (*s3.PutBucketTaggingOutput, error) {
-	return nil, nil
+func (ms *MockS3) PutBucketEncryption(ctx context.Context, input *s3.PutBucketEncryptionInput, _ ...func(*s3.Options)) (*s3.PutBucketEncryptionOutput, error) {
+	if err := mockCanceled(ctx); err != nil {
+		return nil, err
+	}
+	ms.Lock()
+	defer ms.Unlock()
+	config, err := ms.bucketConfig(*input.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	config.encryption = input.ServerSideEncryptionConfiguration
+	return &s3.PutBucketEncryptionOutput{}, nil
 }
 
-func (ms *MockS3) PutBucketVersioningWithContext(aws.Context, *s3.PutBucketVersioningInput, ...request.Option) (*s3.PutBucketVersioningOutput, error) {
-	return nil, nil
+func (ms *MockS3) DeleteBucketOwnershipControls(ctx context.Context, input *s3.DeleteBucketOwnershipControlsInput, _ ...func(*s3.Options)) (*s3.DeleteBucketOwnershipControlsOutput, error) {
+	if err := mockCanceled(ctx); err != nil {
+		return nil, err
+	}
+	ms.Lock()
+	defer ms.Unlock()
+	config, err := ms.bucketConfig(*input.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	config.ownership = nil
+	return &s3.DeleteBucketOwnershipControlsOutput{}, nil
 }
 
-func (ms *MockS3) PutBucketWebsiteWithContext(aws.Context, *s3.PutBucketWebsiteInput, ...request.Option) (*s3.PutBucketWebsiteOutput, error) {
-	return nil, nil
+func (ms *MockS3) GetBucketOwnershipControls(ctx context.Context, input *s3.GetBucketOwnershipControlsInput, _ ...func(*s3.Options)) (*s3.GetBucketOwnershipControlsOutput, error) {
+	if err := mockCanceled(ctx); err != nil {
+		return nil, err
+	}
+	ms.Lock()
+	defer ms.Unlock()
+	config, err := ms.bucketConfig(*input.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if config.ownership == nil {
+		return nil, &smithy.GenericAPIError{Code: "OwnershipControlsNotFoundError", Message: "The bucket ownership controls were not found"}
+	}
+	return &s3.GetBucketOwnershipControlsOutput{OwnershipControls: config.ownership}, nil
 }
 
-func (ms *MockS3) PutObjectWithContext(aws.Context, *s3.PutObjectInput, ...request.Option) (*s3.PutObjectOutput, error) {
-	return nil, nil
+func (ms *MockS3) PutBucketOwnershipControls(ctx context.Context, input *s3.PutBucketOwnershipControlsInput, _ ...func(*s3.Options)) (*s3.PutBucketOwnershipControlsOutput, error) {
+	if err := mockCanceled(ctx); err != nil {
+		return nil, err
+	}
+	ms.Lock()
+	defer ms.Unlock()
+	config, err := ms.bucketConfig(*input.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	config.ownership = input.OwnershipControls
+	return &s3.PutBucketOwnershipControlsOutput{}, nil
 }
 
-func (ms *MockS3) PutObjectAclWithContext(aws.Context, *s3.PutObjectAclInput, ...request.Option) (*s3.PutObjectAclOutput, error) {
-	return nil, nil
+func (ms *MockS3) DeletePublicAccessBlock(ctx context.Context, input *s3.DeletePublicAccessBlockInput, _ ...func(*s3.Options)) (*s3.DeletePublicAccessBlockOutput, error) {
+	if err := mockCanceled(ctx); err != nil {
+		return nil, err
+	}
+	ms.Lock()
+	defer ms.Unlock()
+	config, err := ms.bucketConfig(*input.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	config.publicAccessBlock = nil
+	return &s3.DeletePublicAccessBlockOutput{}, nil
 }
 
-func (ms *MockS3) PutObjectLegalHold(*s3.PutObjectLegalHoldInput) (*s3.PutObjectLegalHoldOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) PutObjectLegalHoldWithContext(aws.Context, *s3.PutObjectLegalHoldInput, ...request.Option) (*s3.PutObjectLegalHoldOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) PutObjectLegalHoldRequest(*s3.PutObjectLegalHoldInput) (*request.Request, *s3.PutObjectLegalHoldOutput) {
-	return nil, nil
+func (ms *MockS3) GetPublicAccessBlock(ctx context.Context, input *s3.GetPublicAccessBlockInput, _ ...func(*s3.Options)) (*s3.GetPublicAccessBlockOutput, error) {
+	if err := mockCanceled(ctx); err != nil {
+		return nil, err
+	}
+	ms.Lock()
+	defer ms.Unlock()
+	config, err := ms.bucketConfig(*input.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if config.publicAccessBlock == nil {
+		return nil, &smithy.GenericAPIError{Code: "NoSuchPublicAccessBlockConfiguration", Message: "The public access block configuration was not found"}
+	}
+	return &s3.GetPublicAccessBlockOutput{PublicAccessBlockConfiguration: config.publicAccessBlock}, nil
 }
 
-func (ms *MockS3) PutObjectLockConfiguration(*s3.PutObjectLockConfigurationInput) (*s3.PutObjectLockConfigurationOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) PutObjectLockConfigurationWithContext(aws.Context, *s3.PutObjectLockConfigurationInput, ...request.Option) (*s3.PutObjectLockConfigurationOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) PutObjectLockConfigurationRequest(*s3.PutObjectLockConfigurationInput) (*request.Request, *s3.PutObjectLockConfigurationOutput) {
-	return nil, nil
+func (ms *MockS3) PutPublicAccessBlock(ctx context.Context, input *s3.PutPublicAccessBlockInput, _ ...func(*s3.Options)) (*s3.PutPublicAccessBlockOutput, error) {
+	if err := mockCanceled(ctx); err != nil {
+		return nil, err
+	}
+	ms.Lock()
+	defer ms.Unlock()
+	config, err := ms.bucketConfig(*input.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	config.publicAccessBlock = input.PublicAccessBlockConfiguration
+	return &s3.PutPublicAccessBlockOutput{}, nil
 }
 
-func (ms *MockS3) PutObjectRetention(*s3.PutObjectRetentionInput) (*s3.PutObjectRetentionOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) PutObjectRetentionWithContext(aws.Context, *s3.PutObjectRetentionInput, ...request.Option) (*s3.PutObjectRetentionOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) PutObjectRetentionRequest(*s3.PutObjectRetentionInput) (*request.Request, *s3.PutObjectRetentionOutput) {
-	return nil, nil
+func (ms *MockS3) GetObjectLockConfiguration(ctx context.Context, input *s3.GetObjectLockConfigurationInput, _ ...func(*s3.Options)) (*s3.GetObjectLockConfigurationOutput, error) {
+	if err := mockCanceled(ctx); err != nil {
+		return nil, err
+	}
+	ms.RLock()
+	defer ms.RUnlock()
+	config, ok := ms.config[*input.Bucket]
+	if !ok || !config.objectLock {
+		return nil, &smithy.GenericAPIError{Code: "ObjectLockConfigurationNotFoundError", Message: "Object Lock configuration does not exist for this bucket"}
+	}
+	return &s3.GetObjectLockConfigurationOutput{
+		ObjectLockConfiguration: &types.ObjectLockConfiguration{ObjectLockEnabled: types.ObjectLockEnabledEnabled},
+	}, nil
 }
 
-func (ms *MockS3) PutObjectTagging(*s3.PutObjectTaggingInput) (*s3.PutObjectTaggingOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) PutObjectTaggingWithContext(aws.Context, *s3.PutObjectTaggingInput, ...request.Option) (*s3.PutObjectTaggingOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) PutObjectTaggingRequest(*s3.PutObjectTaggingInput) (*request.Request, *s3.PutObjectTaggingOutput) {
-	return nil, nil
+func (ms *MockS3) GetObjectTagging(ctx context.Context, input *s3.GetObjectTaggingInput, _ ...func(*s3.Options)) (*s3.GetObjectTaggingOutput, error) {
+	if err := mockCanceled(ctx); err != nil {
+		return nil, err
+	}
+	ms.RLock()
+	defer ms.RUnlock()
+	bucket, ok := ms.data[*input.Bucket]
+	if !ok {
+		return nil, ErrNoSuchBucket
+	}
+	object, ok := bucket[*input.Key]
+	if !ok {
+		return nil, ErrNoSuchKey
+	}
+	return &s3.GetObjectTaggingOutput{TagSet: object.Tags}, nil
 }
 
-func (ms *MockS3) PutPublicAccessBlock(*s3.PutPublicAccessBlockInput) (*s3.PutPublicAccessBlockOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) PutPublicAccessBlockWithContext(aws.Context, *s3.PutPublicAccessBlockInput, ...request.Option) (*s3.PutPublicAccessBlockOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) PutPublicAccessBlockRequest(*s3.PutPublicAccessBlockInput) (*request.Request, *s3.PutPublicAccessBlockOutput) {
-	return nil, nil
-}
+// reMockSelect matches the only S3 Select queries the mock runs, those of
+// grep --select.
+var reMockSelect = regexp.MustCompile(`^SELECT s\._1 FROM S3Object s WHERE s\._1 (NOT )?LIKE '%((?:[^']|'')*)%' ESCAPE '\\'$`)
 
-func (ms *MockS3) RestoreObjectWithContext(aws.Context, *s3.RestoreObjectInput, ...request.Option) (*s3.RestoreObjectOutput, error) {
-	return nil, nil
+// SelectObjectContent runs the line matching queries of grep --select over
+// the lines of an object, read as a single column csv. The records are
+// streamed as the sdk reads them from S3, by a client of the fake server
+// answering from the mock, as only the sdk can make the stream of events.
+func (ms *MockS3) SelectObjectContent(ctx context.Context, input *s3.SelectObjectContentInput, _ ...func(*s3.Options)) (*s3.SelectObjectContentOutput, error) {
+	if err := mockCanceled(ctx); err != nil {
+		return nil, err
+	}
+	// failing here with the mock's own errors, rather than as the client
+	// reads them from the fake server
+	_, err := ms.selectRecords(input)
+	if err != nil {
+		return nil, err
+	}
+	client := s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String("http://mock"),
+		UsePathStyle: true,
+		Credentials:  aws.AnonymousCredentials{},
+		HTTPClient:   mockHTTPClient{NewFakeServer(ms, "")},
+		Retryer:      aws.NopRetryer{},
+	})
+	return client.SelectObjectContent(ctx, input)
+}
+
+// selectRecords returns the lines of the object input selects, each ending
+// in a newline.
+func (ms *MockS3) selectRecords(input *s3.SelectObjectContentInput) ([]byte, error) {
+	ms.RLock()
+	defer ms.RUnlock()
+	object, ok := ms.data[*input.Bucket][*input.Key]
+	if !ok {
+		return nil, ErrNoSuchKey
+	}
+	if err := object.checkCustomerKey(input.SSECustomerKey); err != nil {
+		return nil, err
+	}
+	m := reMockSelect.FindStringSubmatch(aws.ToString(input.Expression))
+	if m == nil {
+		return nil, &smithy.GenericAPIError{Code: "UnsupportedSyntax", Message: "The mock doesn't run this query"}
+	}
+	invert := m[1] != ""
+	needle := strings.NewReplacer(`''`, `'`, `\\`, `\`, `\%`, `%`, `\_`, `_`).Replace(m[2])
+	content := object.Content
+	if input.InputSerialization != nil && input.InputSerialization.CompressionType == types.CompressionTypeGzip {
+		gz, err := gzip.NewReader(bytes.NewReader(content))
+		if err != nil {
+			return nil, &smithy.GenericAPIError{Code: "InvalidCompressionFormat", Message: err.Error()}
+		}
+		content, err = ioutil.ReadAll(gz)
+		if err != nil {
+			return nil, &smithy.GenericAPIError{Code: "InvalidCompressionFormat", Message: err.Error()}
+		}
+	}
+	var records bytes.Buffer
+	for _, line := range strings.Split(string(content), "\n") {
+		if line != "" && strings.Contains(line, needle) != invert {
+			records.WriteString(line + "\n")
+		}
+	}
+	return records.Bytes(), nil
 }
 
-func (ms *MockS3) SelectObjectContent(*s3.SelectObjectContentInput) (*s3.SelectObjectContentOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) SelectObjectContentWithContext(aws.Context, *s3.SelectObjectContentInput, ...request.Option) (*s3.SelectObjectContentOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) SelectObjectContentRequest(*s3.SelectObjectContentInput) (*request.Request, *s3.SelectObjectContentOutput) {
-	return nil, nil
+// mockHTTPClient sends requests to a handler in memory.
+type mockHTTPClient struct {
+	handler http.Handler
 }
 
-func (ms *MockS3) UploadPartWithContext(aws.Context, *s3.UploadPartInput, ...request.Option) (*s3.UploadPartOutput, error) {
-	return nil, nil
+func (c mockHTTPClient) Do(r *http.Request) (*http.Response, error) {
+	w := httptest.NewRecorder()
+	c.handler.ServeHTTP(w, r)
+	return w.Result(), nil
 }
 
-func (ms *MockS3) UploadPartCopyWithContext(aws.Context, *s3.UploadPartCopyInput, ...request.Option) (*s3.UploadPartCopyOutput, error) {
-	return nil, nil
-}
+// MockSSOSecond is the unit of the intervals of MockSSOOIDC.
+const MockSSOSecond = 10 * time.Millisecond
 
-func (ms *MockS3) WriteGetObjectResponse(*s3.WriteGetObjectResponseInput) (*s3.WriteGetObjectResponseOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) WriteGetObjectResponseWithContext(aws.Context, *s3.WriteGetObjectResponseInput, ...request.Option) (*s3.WriteGetObjectResponseOutput, error) {
-	return nil, nil
-}
-func (ms *MockS3) WriteGetObjectResponseRequest(*s3.WriteGetObjectResponseInput) (*request.Request, *s3.WriteGetObjectResponseOutput) {
-	return nil, nil
-}
+// MockSSOOIDC is an AWS SSO OIDC service for logins, confirming each device
+// login once it has answered Pending polls for the token as pending, and
+// then SlowDowns more asking to slow down. Its intervals are in units of
+// MockSSOSecond, so logins polling it are quick.
+type MockSSOOIDC struct {
+	Pending   int // polls answered AuthorizationPending
+	SlowDowns int // polls then answered SlowDown
 
-func (ms *MockS3) WaitUntilBucketExists(*s3.HeadBucketInput) error {
-	return nil
-}
-func (ms *MockS3) WaitUntilBucketExistsWithContext(aws.Context, *s3.HeadBucketInput, ...request.WaiterOption) error {
-	return nil
+	mu     sync.Mutex
+	logins int
+	polls  []time.Time
 }
 
-func (ms *MockS3) WaitUntilBucketNotExists(*s3.HeadBucketInput) error {
-	return nil
-}
-func (ms *MockS3) WaitUntilBucketNotExistsWithContext(aws.Context, *s3.HeadBucketInput, ...request.WaiterOption) error {
-	return nil
+func (m *MockSSOOIDC) RegisterClient(ctx context.Context, input *ssooidc.RegisterClientInput, _ ...func(*ssooidc.Options)) (*ssooidc.RegisterClientOutput, error) {
+	return &ssooidc.RegisterClientOutput{
+		ClientId:     aws.String("mock-client"),
+		ClientSecret: aws.String("mock-secret"),
+	}, nil
 }
 
-func (ms *MockS3) WaitUntilObjectExists(*s3.HeadObjectInput) error {
-	return nil
-}
-func (ms *MockS3) WaitUntilObjectExistsWithContext(aws.Context, *s3.HeadObjectInput, ...request.WaiterOption) error {
-	return nil
+func (m *MockSSOOIDC) StartDeviceAuthorization(ctx context.Context, input *ssooidc.StartDeviceAuthorizationInput, _ ...func(*ssooidc.Options)) (*ssooidc.StartDeviceAuthorizationOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.logins++
+	return &ssooidc.StartDeviceAuthorizationOutput{
+		DeviceCode:              aws.String("mock-device"),
+		UserCode:                aws.String("MOCK-CODE"),
+		VerificationUriComplete: aws.String(aws.ToString(input.StartUrl) + "/device?user_code=MOCK-CODE"),
+		Interval:                1,
+		ExpiresIn:               600,
+	}, nil
 }
 
-func (ms *MockS3) WaitUntilObjectNotExists(*s3.HeadObjectInput) error {
-	return nil
-}
-func (ms *MockS3) WaitUntilObjectNotExistsWithContext(aws.Context, *s3.HeadObjectInput, ...request.WaiterOption) error {
-	return nil
+func (m *MockSSOOIDC) CreateToken(ctx context.Context, input *ssooidc.CreateTokenInput, _ ...func(*ssooidc.Options)) (*ssooidc.CreateTokenOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.polls = append(m.polls, time.Now())
+	if m.Pending > 0 {
+		m.Pending--
+		return nil, &ssooidctypes.AuthorizationPendingException{}
+	}
+	if m.SlowDowns > 0 {
+		m.SlowDowns--
+		return nil, &ssooidctypes.SlowDownException{}
+	}
+	return &ssooidc.CreateTokenOutput{
+		AccessToken: aws.String("mock-token"),
+		ExpiresIn:   3600,
+	}, nil
+}
+
+// Logins returns the number of device logins started.
+func (m *MockSSOOIDC) Logins() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.logins
+}
+
+// PollIntervals returns the time between each poll for the token and the
+// one before.
+func (m *MockSSOOIDC) PollIntervals() []time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var intervals []time.Duration
+	for i := 1; i < len(m.polls); i++ {
+		intervals = append(intervals, m.polls[i].Sub(m.polls[i-1]))
+	}
+	return intervals
 }
 
-var _ s3iface.S3API = (*MockS3)(nil)
+var _ S3API = (*MockS3)(nil)
+var _ SSOOIDCAPI = (*MockSSOOIDC)(nil)
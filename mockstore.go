@@ -0,0 +1,228 @@
+package s3
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// A MockS3 saved to a directory has a directory per bucket, holding an
+// index.json of its keys and their attributes, and the content of each key
+// in objects/, named by its md5 so unchanged content isn't rewritten.
+const (
+	mockIndexFile  = "index.json"
+	mockObjectsDir = "objects"
+)
+
+// mockBucketRecord is a bucket as saved to disk.
+type mockBucketRecord struct {
+	Objects           map[string]*mockObjectRecord
+	Tags              []types.Tag                              `json:",omitempty"`
+	Encryption        *types.ServerSideEncryptionConfiguration `json:",omitempty"`
+	PublicAccessBlock *types.PublicAccessBlockConfiguration    `json:",omitempty"`
+	Ownership         *types.OwnershipControls                 `json:",omitempty"`
+}
+
+// mockObjectRecord is a key as saved to disk, its content held separately.
+type mockObjectRecord struct {
+	Content         string             // md5 hex of the content
+	Metadata        map[string]string  `json:",omitempty"`
+	ContentType     *string            `json:",omitempty"`
+	ContentEncoding *string            `json:",omitempty"`
+	StorageClass    types.StorageClass `json:",omitempty"`
+	ETag            *string            `json:",omitempty"`
+	Modified        time.Time
+
+	CacheControl         *string                    `json:",omitempty"`
+	ContentDisposition   *string                    `json:",omitempty"`
+	Tags                 []types.Tag                `json:",omitempty"`
+	ServerSideEncryption types.ServerSideEncryption `json:",omitempty"`
+	SSEKMSKeyId          *string                    `json:",omitempty"`
+
+	ObjectLockMode            types.ObjectLockMode            `json:",omitempty"`
+	ObjectLockRetainUntilDate *time.Time                      `json:",omitempty"`
+	ObjectLockLegalHoldStatus types.ObjectLockLegalHoldStatus `json:",omitempty"`
+}
+
+// LoadMockS3 returns a MockS3 holding the buckets saved in dir, which is
+// created if missing.
+func LoadMockS3(dir string) (*MockS3, error) {
+	ms := NewMockS3()
+	err := os.MkdirAll(dir, 0777)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		data, err := ioutil.ReadFile(filepath.Join(dir, name, mockIndexFile))
+		if os.IsNotExist(err) {
+			// not a bucket
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var record mockBucketRecord
+		err = json.Unmarshal(data, &record)
+		if err != nil {
+			return nil, err
+		}
+		bucket := MockBucket{}
+		for key, object := range record.Objects {
+			content, err := ioutil.ReadFile(filepath.Join(dir, name, mockObjectsDir, object.Content))
+			if err != nil {
+				return nil, err
+			}
+			bucket[key] = &MockObject{
+				Content:         content,
+				Metadata:        object.Metadata,
+				ContentType:     object.ContentType,
+				ContentEncoding: object.ContentEncoding,
+				StorageClass:    object.StorageClass,
+				ETag:            object.ETag,
+				Modified:        object.Modified,
+
+				CacheControl:         object.CacheControl,
+				ContentDisposition:   object.ContentDisposition,
+				Tags:                 object.Tags,
+				ServerSideEncryption: object.ServerSideEncryption,
+				SSEKMSKeyId:          object.SSEKMSKeyId,
+
+				ObjectLockMode:            object.ObjectLockMode,
+				ObjectLockRetainUntilDate: object.ObjectLockRetainUntilDate,
+				ObjectLockLegalHoldStatus: object.ObjectLockLegalHoldStatus,
+			}
+		}
+		ms.data[name] = bucket
+		ms.config[name] = &mockBucketConfig{
+			tags:              record.Tags,
+			encryption:        record.Encryption,
+			publicAccessBlock: record.PublicAccessBlock,
+			ownership:         record.Ownership,
+		}
+	}
+	return ms, nil
+}
+
+// Save writes the buckets to dir, to be loaded by LoadMockS3, removing any
+// buckets and content since deleted.
+func (ms *MockS3) Save(dir string) error {
+	ms.RLock()
+	defer ms.RUnlock()
+	for name, bucket := range ms.data {
+		err := ms.saveBucket(filepath.Join(dir, name), name, bucket)
+		if err != nil {
+			return err
+		}
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if _, ok := ms.data[name]; ok || !entry.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, name, mockIndexFile)); err == nil {
+			err = os.RemoveAll(filepath.Join(dir, name))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// saveBucket writes a bucket's index and any new content to bdir. The
+// caller must hold the lock.
+func (ms *MockS3) saveBucket(bdir, name string, bucket MockBucket) error {
+	objects := filepath.Join(bdir, mockObjectsDir)
+	err := os.MkdirAll(objects, 0777)
+	if err != nil {
+		return err
+	}
+	record := mockBucketRecord{Objects: map[string]*mockObjectRecord{}}
+	if config, ok := ms.config[name]; ok {
+		record.Tags = config.tags
+		record.Encryption = config.encryption
+		record.PublicAccessBlock = config.publicAccessBlock
+		record.Ownership = config.ownership
+	}
+	used := map[string]bool{}
+	for key, object := range bucket {
+		sum := md5.Sum(object.Content)
+		content := hex.EncodeToString(sum[:])
+		if !used[content] {
+			used[content] = true
+			fpath := filepath.Join(objects, content)
+			if _, err := os.Stat(fpath); os.IsNotExist(err) {
+				err = writeFileAtomic(fpath, object.Content)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		record.Objects[key] = &mockObjectRecord{
+			Content:         content,
+			Metadata:        object.Metadata,
+			ContentType:     object.ContentType,
+			ContentEncoding: object.ContentEncoding,
+			StorageClass:    object.StorageClass,
+			ETag:            object.ETag,
+			Modified:        object.Modified,
+
+			CacheControl:         object.CacheControl,
+			ContentDisposition:   object.ContentDisposition,
+			Tags:                 object.Tags,
+			ServerSideEncryption: object.ServerSideEncryption,
+			SSEKMSKeyId:          object.SSEKMSKeyId,
+
+			ObjectLockMode:            object.ObjectLockMode,
+			ObjectLockRetainUntilDate: object.ObjectLockRetainUntilDate,
+			ObjectLockLegalHoldStatus: object.ObjectLockLegalHoldStatus,
+		}
+	}
+	data, err := json.MarshalIndent(record, "", "\t")
+	if err != nil {
+		return err
+	}
+	err = writeFileAtomic(filepath.Join(bdir, mockIndexFile), data)
+	if err != nil {
+		return err
+	}
+	entries, err := ioutil.ReadDir(objects)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !used[entry.Name()] {
+			os.Remove(filepath.Join(objects, entry.Name()))
+		}
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to fpath via a temporary file, so a reader
+// never sees it part written.
+func writeFileAtomic(fpath string, data []byte) error {
+	tmp := fpath + ".tmp"
+	err := ioutil.WriteFile(tmp, data, 0666)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, fpath)
+}
@@ -0,0 +1,186 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// MultipartOptions configure RunListMultipartUploads and
+// RunAbortMultipartUploads.
+type MultipartOptions struct {
+	CommonOptions
+	OlderThan time.Duration // only uploads initiated at least this long ago
+}
+
+// staleUpload is an incomplete multipart upload, whose parts are billed
+// until it's completed or aborted.
+type staleUpload struct {
+	bucket string
+	upload types.MultipartUpload
+}
+
+func (su staleUpload) String() string {
+	return fmt.Sprintf("s3://%s/%s", su.bucket, aws.ToString(su.upload.Key))
+}
+
+// RunListMultipartUploads prints the incomplete multipart uploads in each
+// bucket, or under the prefix of each s3 url, with the size of the parts
+// sent to each.
+func RunListMultipartUploads(ctx context.Context, conn S3API, urls []string, opts MultipartOptions) error {
+	uploads, err := staleUploads(ctx, conn, urls, opts.OlderThan)
+	if err != nil {
+		return err
+	}
+	var totalSize int64
+	for _, su := range uploads {
+		size, err := uploadSize(ctx, conn, su)
+		if err != nil {
+			return err
+		}
+		totalSize += size
+		initiated := aws.ToTime(su.upload.Initiated).UTC().Format(time.RFC3339)
+		fmt.Fprintf(outOf(ctx), "%s\t%s\t%s\t%db\n", su, aws.ToString(su.upload.UploadId), initiated, size)
+	}
+	fmt.Fprintf(outOf(ctx), "\n%d uploads, %d bytes\n", len(uploads), totalSize)
+	return nil
+}
+
+// RunAbortMultipartUploads aborts the incomplete multipart uploads in each
+// bucket, or under the prefix of each s3 url, such as those left by failed
+// put-part runs. Aborted uploads are printed as D s3://bucket/key.
+func RunAbortMultipartUploads(ctx context.Context, conn S3API, urls []string, opts MultipartOptions) error {
+	uploads, err := staleUploads(ctx, conn, urls, opts.OlderThan)
+	if err != nil {
+		return err
+	}
+	aborted := 0
+	for _, su := range uploads {
+		if done(ctx) {
+			return ctx.Err()
+		}
+		if !opts.Quiet {
+			fmt.Fprintf(outOf(ctx), "D %s\t%s\n", su, aws.ToString(su.upload.UploadId))
+		}
+		if opts.DryRun {
+			aborted += 1
+			continue
+		}
+		_, err := conn.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(su.bucket),
+			Key:      su.upload.Key,
+			UploadId: su.upload.UploadId,
+		})
+		if err != nil && !isAWSErrorCode(err, "NoSuchUpload") {
+			if opts.IgnoreErrors {
+				fmt.Fprintf(errOutOf(ctx), "E %s: %s\n", su, err)
+				continue
+			}
+			return err
+		}
+		aborted += 1
+	}
+	if !opts.Quiet {
+		fmt.Fprintf(outOf(ctx), "\n%d aborted\n", aborted)
+	}
+	return nil
+}
+
+// listUploads lists the incomplete multipart uploads under each url after
+// the keys, for ls --uploads, returning how many there are.
+func listUploads(ctx context.Context, conn S3API, urls []string, opts ListOptions) (int, error) {
+	for _, url := range urls {
+		if !isS3Url(url) {
+			return 0, errors.New("s3:// url required for --uploads")
+		}
+	}
+	uploads, err := staleUploads(ctx, conn, urls, 0)
+	if err != nil {
+		return 0, err
+	}
+	for _, su := range uploads {
+		id := aws.ToString(su.upload.UploadId)
+		initiated := aws.ToTime(su.upload.Initiated).UTC().Format(time.RFC3339)
+		switch {
+		case opts.Records != nil:
+			err = opts.Records.Write(Record{Type: "upload", URL: su.String(), UploadID: id, Initiated: initiated})
+			if err != nil {
+				return 0, err
+			}
+		case opts.Quiet:
+			fmt.Fprintf(outOf(ctx), "%s\t%s\n", su, id)
+		default:
+			fmt.Fprintf(outOf(ctx), "%s\tUPLOAD\t%s\t%s\n", su, id, initiated)
+		}
+	}
+	return len(uploads), nil
+}
+
+// staleUploads lists the incomplete multipart uploads under each url,
+// initiated at least olderThan ago.
+func staleUploads(ctx context.Context, conn S3API, urls []string, olderThan time.Duration) ([]staleUpload, error) {
+	cutoff := time.Now().Add(-olderThan)
+	var uploads []staleUpload
+	for _, u := range urls {
+		bucket, prefix := bucketName(u), ""
+		if isS3Url(u) {
+			bucket, prefix = extractBucketPath(u)
+		}
+		input := s3.ListMultipartUploadsInput{
+			Bucket: aws.String(bucket),
+			Prefix: aws.String(prefix),
+		}
+		for {
+			if done(ctx) {
+				return nil, ctx.Err()
+			}
+			output, err := conn.ListMultipartUploads(ctx, &input)
+			if err != nil {
+				return nil, err
+			}
+			for _, upload := range output.Uploads {
+				if !aws.ToTime(upload.Initiated).After(cutoff) {
+					uploads = append(uploads, staleUpload{bucket, upload})
+				}
+			}
+			if !aws.ToBool(output.IsTruncated) {
+				break
+			}
+			input.KeyMarker = output.NextKeyMarker
+			input.UploadIdMarker = output.NextUploadIdMarker
+		}
+	}
+	return uploads, nil
+}
+
+// uploadSize returns the total size of the parts sent to an upload.
+func uploadSize(ctx context.Context, conn S3API, su staleUpload) (int64, error) {
+	var size int64
+	input := s3.ListPartsInput{
+		Bucket:   aws.String(su.bucket),
+		Key:      su.upload.Key,
+		UploadId: su.upload.UploadId,
+	}
+	for {
+		output, err := conn.ListParts(ctx, &input)
+		if isAWSErrorCode(err, "NoSuchUpload") {
+			// completed or aborted since listed
+			return size, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		for _, part := range output.Parts {
+			size += aws.ToInt64(part.Size)
+		}
+		if !aws.ToBool(output.IsTruncated) {
+			return size, nil
+		}
+		input.PartNumberMarker = output.NextPartNumberMarker
+	}
+}
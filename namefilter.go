@@ -0,0 +1,43 @@
+package s3
+
+import "path/filepath"
+
+// NameFilter selects the keys and files grep searches by their path beneath
+// the url listed, as grep -r's --include and --exclude do. Patterns are as in
+// .s3ignore: without a slash they match the name at any depth, and a pattern
+// matching a directory matches everything beneath it.
+type NameFilter struct {
+	include *ignoreRules // one of which must match, if any
+	exclude *ignoreRules // none of which may match
+}
+
+// ParseNameFilter parses the --include and --exclude patterns. It returns nil
+// if there are none.
+func ParseNameFilter(include, exclude []string) (*NameFilter, error) {
+	if len(include) == 0 && len(exclude) == 0 {
+		return nil, nil
+	}
+	filter := &NameFilter{}
+	var err error
+	if filter.include, err = (*ignoreRules)(nil).filter("", include, nil); err != nil {
+		return nil, err
+	}
+	if filter.exclude, err = (*ignoreRules)(nil).filter("", exclude, nil); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// selects reports whether file passes the filter. A nil filter selects every
+// file.
+func (f *NameFilter) selects(file File) bool {
+	if f == nil {
+		return true
+	}
+	// protected matches a path or any directory above it
+	name := filepath.ToSlash(file.Relative())
+	if f.exclude != nil && f.exclude.protected(name) {
+		return false
+	}
+	return f.include == nil || f.include.protected(name)
+}
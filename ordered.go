@@ -0,0 +1,160 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/barnybug/s3/pkg/mys3"
+)
+
+// orderedBufferSize is how much of a key's output is held while the keys
+// before it are written, before its fetch waits.
+const orderedBufferSize = 1 << 20
+
+// errOutputAbandoned stops fetching a key whose output will never be written.
+var errOutputAbandoned = errors.New("output abandoned")
+
+// orderedOutput is the output of one of several keys fetched at once and
+// written in order. Until the keys before it are written it's buffered, up to
+// orderedBufferSize, then it streams straight to the output.
+type orderedOutput struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	buf  bytes.Buffer
+	w    io.Writer // once live, the output, or nil if abandoned
+	live bool
+	done chan struct{} // closed once the key is fetched
+	err  error         // of fetching the key, once done
+}
+
+func newOrderedOutput() *orderedOutput {
+	oo := &orderedOutput{done: make(chan struct{})}
+	oo.cond = sync.NewCond(&oo.mu)
+	return oo
+}
+
+func (oo *orderedOutput) Write(p []byte) (int, error) {
+	oo.mu.Lock()
+	defer oo.mu.Unlock()
+	for !oo.live && oo.buf.Len() > 0 && oo.buf.Len()+len(p) > orderedBufferSize {
+		oo.cond.Wait()
+	}
+	if !oo.live {
+		return oo.buf.Write(p)
+	}
+	if oo.w == nil {
+		return 0, errOutputAbandoned
+	}
+	return oo.w.Write(p)
+}
+
+// waitLive waits until it's the key's turn to be written.
+func (oo *orderedOutput) waitLive() {
+	oo.mu.Lock()
+	defer oo.mu.Unlock()
+	for !oo.live {
+		oo.cond.Wait()
+	}
+}
+
+// finish records the outcome of fetching the key.
+func (oo *orderedOutput) finish(err error) {
+	oo.err = err
+	close(oo.done)
+}
+
+// writeTo writes the output to w, once it's the key's turn, streaming the
+// rest as it's fetched, and returns the error fetching it, if any. A nil w
+// abandons the output.
+func (oo *orderedOutput) writeTo(w io.Writer) error {
+	oo.mu.Lock()
+	var err error
+	if w != nil {
+		_, err = w.Write(oo.buf.Bytes())
+	}
+	oo.buf.Reset()
+	oo.w = w
+	if err != nil {
+		oo.w = nil
+	}
+	oo.live = true
+	oo.cond.Broadcast()
+	oo.mu.Unlock()
+	<-oo.done
+	if err != nil {
+		return err
+	}
+	return oo.err
+}
+
+// iterateKeysOrdered calls callback for the keys under each url in parallel,
+// each given a writer of its output, and writes their output one after another
+// in the order they're listed.
+func iterateKeysOrdered(ctx context.Context, conn S3API, urls []string, parallel int, opts FilesystemOptions, callback func(w io.Writer, file File) error, mys3Conn mys3.Mys3) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if parallel < 1 {
+		parallel = 1
+	}
+	type job struct {
+		file   File
+		output *orderedOutput
+	}
+	// keys are fetched by the pool, and written in order from pending, which
+	// bounds how far ahead of the key being written they're fetched
+	jobs := make(chan job)
+	pending := make(chan job, parallel)
+	wg := sync.WaitGroup{}
+	for i := 0; i < parallel; i += 1 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				if err := ctx.Err(); err != nil {
+					j.output.finish(err)
+					continue
+				}
+				j.output.finish(callback(j.output, j.file))
+			}
+		}()
+	}
+
+	var listErr error
+	go func() {
+		defer close(jobs)
+		defer close(pending)
+		listErr = iterateKeys(ctx, conn, urls, opts, func(file File) error {
+			j := job{file, newOrderedOutput()}
+			select {
+			case pending <- j:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			// the keys before this one are taken by the pool, so this send
+			// can't block for good
+			jobs <- j
+			return nil
+		}, mys3Conn)
+	}()
+
+	var err error
+	for j := range pending {
+		if err != nil {
+			// abandon the keys after a failure
+			j.output.writeTo(nil)
+			continue
+		}
+		if e := j.output.writeTo(outOf(ctx)); e != nil {
+			err = e
+			cancel()
+		}
+	}
+	wg.Wait()
+	if err != nil {
+		return err
+	}
+	return listErr
+}
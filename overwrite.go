@@ -0,0 +1,63 @@
+package s3
+
+import (
+	"errors"
+	"os"
+)
+
+// OverwritePolicy governs downloading onto local files that already exist.
+type OverwritePolicy int
+
+const (
+	OverwriteAlways OverwritePolicy = iota // replace existing files
+	OverwriteNever                         // leave existing files be
+	OverwriteNewer                         // replace files older than the key
+)
+
+// ParseOverwritePolicy returns the policy selected by the --overwrite,
+// --skip-existing and --newer-only flags, at most one of which may be set.
+func ParseOverwritePolicy(overwrite, skipExisting, newerOnly bool) (OverwritePolicy, error) {
+	n := 0
+	for _, set := range []bool{overwrite, skipExisting, newerOnly} {
+		if set {
+			n += 1
+		}
+	}
+	switch {
+	case n > 1:
+		return OverwriteAlways, errors.New("--overwrite, --skip-existing and --newer-only are mutually exclusive")
+	case skipExisting:
+		return OverwriteNever, nil
+	case newerOnly:
+		return OverwriteNewer, nil
+	}
+	return OverwriteAlways, nil
+}
+
+// replaces reports whether src may be written over the existing local file.
+// Only S3 keys, with a last modified time, are newer than a file.
+func (policy OverwritePolicy) replaces(src File, existing os.FileInfo) bool {
+	switch policy {
+	case OverwriteNever:
+		return false
+	case OverwriteNewer:
+		s3f, ok := src.(*S3File)
+		if !ok || s3f.object.LastModified == nil {
+			return false
+		}
+		return s3f.object.LastModified.After(existing.ModTime())
+	}
+	return true
+}
+
+// replacesPath is replaces for the file at fpath, which needn't exist.
+func (policy OverwritePolicy) replacesPath(src File, fpath string) bool {
+	if policy == OverwriteAlways {
+		return true
+	}
+	info, err := os.Lstat(fpath)
+	if err != nil {
+		return true
+	}
+	return policy.replaces(src, info)
+}
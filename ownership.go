@@ -0,0 +1,47 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// aclsDisabled reports whether bucket enforces bucket owner object
+// ownership, which rejects uploads carrying acls. Where the ownership
+// controls can't be read, acls are assumed to be supported.
+func aclsDisabled(ctx context.Context, conn S3API, bucket string) bool {
+	output, err := conn.GetBucketOwnershipControls(ctx, &s3.GetBucketOwnershipControlsInput{
+		Bucket: aws.String(bucket),
+	})
+	if err != nil || output.OwnershipControls == nil {
+		return false
+	}
+	for _, rule := range output.OwnershipControls.Rules {
+		if rule.ObjectOwnership == types.ObjectOwnershipBucketOwnerEnforced {
+			return true
+		}
+	}
+	return false
+}
+
+// checkBucketACL makes the acl in opts compatible with the destination url.
+// Buckets with acls disabled only accept bucket-owner-full-control, so any
+// other acl is dropped with a warning, or is an error with StrictACL.
+func checkBucketACL(ctx context.Context, conn S3API, url string, opts *FilesystemOptions) error {
+	if !isS3Url(url) || opts.ACL == "" || opts.ACL == string(types.ObjectCannedACLBucketOwnerFullControl) {
+		return nil
+	}
+	bucket, _ := extractBucketPath(url)
+	if !aclsDisabled(ctx, conn, bucket) {
+		return nil
+	}
+	if opts.StrictACL {
+		return fmt.Errorf("bucket %s has acls disabled (object ownership BucketOwnerEnforced), so --acl %s can't be applied: grant access with a bucket policy instead", bucket, opts.ACL)
+	}
+	logWarning(ctx, "bucket %s has acls disabled (object ownership BucketOwnerEnforced), ignoring --acl %s", bucket, opts.ACL)
+	opts.ACL = ""
+	return nil
+}
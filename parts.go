@@ -0,0 +1,210 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/barnybug/s3/pkg/mys3"
+)
+
+const (
+	partSizeKey = "part_size"
+	partMD5sKey = "part_md5s"
+	// user metadata is limited to 2KB, so the part checksums of very large
+	// uploads are not recorded
+	maxPartMD5sLength = 1536
+)
+
+// minPartSize and maxPartSize bound the size of the parts S3 accepts, all
+// but the last of which must be at least the minimum.
+const (
+	minPartSize = 5 * mib
+	maxPartSize = 5 * 1024 * mib
+)
+
+// ParsePartOptions checks the --part-size and --part-concurrency flags, 0
+// for the defaults.
+func ParsePartOptions(size int64, concurrency int) (mys3.PartOptions, error) {
+	if size != 0 && (size < minPartSize || size > maxPartSize) {
+		return mys3.PartOptions{}, fmt.Errorf("--part-size must be from %d (5MiB) to %d (5GiB) bytes", int64(minPartSize), int64(maxPartSize))
+	}
+	if concurrency < 0 {
+		return mys3.PartOptions{}, errors.New("--part-concurrency must be at least 1")
+	}
+	return mys3.PartOptions{Size: size, Concurrency: concurrency}, nil
+}
+
+// partChecksummer computes the md5 of each partSize part of the content
+// written to it, for uploads to record before the parts are sent.
+type partChecksummer struct {
+	partSize int64
+	part     hash.Hash // of the current part
+	written  int64     // to the current part
+	sums     []string
+}
+
+func newPartChecksummer(partSize int64) *partChecksummer {
+	return &partChecksummer{partSize: partSize, part: md5.New()}
+}
+
+func (pc *partChecksummer) Write(b []byte) (int, error) {
+	n := len(b)
+	for len(b) > 0 {
+		chunk := pc.partSize - pc.written
+		if chunk > int64(len(b)) {
+			chunk = int64(len(b))
+		}
+		pc.part.Write(b[:chunk])
+		pc.written += chunk
+		b = b[chunk:]
+		if pc.written == pc.partSize {
+			pc.endPart()
+		}
+	}
+	return n, nil
+}
+
+func (pc *partChecksummer) endPart() {
+	pc.sums = append(pc.sums, hex.EncodeToString(pc.part.Sum(nil)))
+	pc.part.Reset()
+	pc.written = 0
+}
+
+// metadata returns metadata recording the md5 of each part written, or nil
+// if there are too many parts to record.
+func (pc *partChecksummer) metadata() map[string]string {
+	if pc.written > 0 {
+		pc.endPart()
+	}
+	value := strings.Join(pc.sums, ",")
+	if len(pc.sums) == 0 || len(value) > maxPartMD5sLength {
+		return nil
+	}
+	return map[string]string{
+		partSizeKey: strconv.FormatInt(pc.partSize, 10),
+		partMD5sKey: value,
+	}
+}
+
+// partMetadata returns metadata recording the md5 of each partSize part of
+// file, and its checksum in algorithm if given, read in one pass. The hex
+// md5s of the parts are also returned, whether or not they fit in metadata.
+func partMetadata(ctx context.Context, file File, partSize int64, algorithm string) (map[string]string, []string, error) {
+	reader, err := file.Reader(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer reader.Close()
+	parts := newPartChecksummer(partSize)
+	var sum hash.Hash
+	w := io.Writer(parts)
+	if algorithm != "" {
+		sum = newChecksumHash(algorithm)
+		w = io.MultiWriter(parts, sum)
+	}
+	_, err = io.Copy(w, reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	metadata := parts.metadata()
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	if sum != nil {
+		metadata[checksumMetadataKey(algorithm)] = base64.StdEncoding.EncodeToString(sum.Sum(nil))
+	}
+	return metadata, parts.sums, nil
+}
+
+// partChecksums returns the part size and per-part md5s recorded in
+// metadata, if any.
+func partChecksums(metadata map[string]string) (int64, [][]byte, bool) {
+	partSize, err := strconv.ParseInt(metadataValue(metadata, partSizeKey), 10, 64)
+	if err != nil || partSize <= 0 {
+		return 0, nil, false
+	}
+	value := metadataValue(metadata, partMD5sKey)
+	if value == "" {
+		return 0, nil, false
+	}
+	var sums [][]byte
+	for _, s := range strings.Split(value, ",") {
+		sum, err := hex.DecodeString(s)
+		if err != nil || len(sum) != md5.Size {
+			return 0, nil, false
+		}
+		sums = append(sums, sum)
+	}
+	return partSize, sums, true
+}
+
+// getRange fetches bytes start to end (inclusive) of the object, failing
+// with PreconditionFailed if it's no longer the version listed, as the ranges
+// of two versions mustn't be mixed.
+func (s3f *S3File) getRange(ctx context.Context, start, end int64) ([]byte, error) {
+	input := s3.GetObjectInput{
+		Bucket:  aws.String(s3f.bucket),
+		Key:     s3f.object.Key,
+		Range:   aws.String(fmt.Sprintf("bytes=%d-%d", start, end)),
+		IfMatch: s3f.object.ETag,
+
+		SSECustomerAlgorithm: s3f.encryption.customerAlgorithm(),
+		SSECustomerKey:       s3f.encryption.customerKey(),
+		SSECustomerKeyMD5:    s3f.encryption.customerKeyMD5(),
+	}
+	output, err := s3f.mys3.GetObject(ctx, &input)
+	if isAWSErrorCode(err, "PreconditionFailed") {
+		return nil, fmt.Errorf("%s: changed during the download: %w", s3f, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer output.Body.Close()
+	return ioutil.ReadAll(output.Body)
+}
+
+// copyVerified writes the object to w a part at a time, fetching up to
+// concurrency parts at once and checking each against its recorded md5 as
+// it arrives. A corrupt part is fetched again, as often as the retry policy
+// allows, before giving up.
+func (s3f *S3File) copyVerified(ctx context.Context, w io.Writer, partSize int64, sums [][]byte, concurrency int) error {
+	size := s3f.Size()
+	if int64(len(sums)) != (size+partSize-1)/partSize {
+		return fmt.Errorf("%s: recorded %d part checksums for %d bytes in parts of %d", s3f, len(sums), size, partSize)
+	}
+	return fetchOrdered(w, len(sums), concurrency, func(i int) ([]byte, error) {
+		start := int64(i) * partSize
+		end := start + partSize - 1
+		if end >= size {
+			end = size - 1
+		}
+		for try := 0; ; try++ {
+			data, err := s3f.getRange(ctx, start, end)
+			if err != nil {
+				return nil, err
+			}
+			actual := md5.Sum(data)
+			if bytes.Equal(actual[:], sums[i]) {
+				return data, nil
+			}
+			if try == s3f.retry.MaxRetries() {
+				return nil, fmt.Errorf("%s: part %d (bytes %d-%d) failed checksum verification", s3f, i+1, start, end)
+			}
+			if err := s3f.retry.wait(ctx, try); err != nil {
+				return nil, err
+			}
+		}
+	})
+}
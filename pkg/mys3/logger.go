@@ -0,0 +1,25 @@
+package mys3
+
+import (
+	"log/slog"
+)
+
+// Logger receives the diagnostics of a Mys3, such as uploads it fails or
+// aborts, as a message and alternating keys and values. *slog.Logger is one.
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// Discard is a Logger that drops everything, to silence a Mys3.
+var Discard Logger = slog.New(slog.DiscardHandler)
+
+// logger returns the Logger of opts, slog's default if unset.
+func (opts Options) logger() Logger {
+	if opts.Logger != nil {
+		return opts.Logger
+	}
+	return slog.Default()
+}
@@ -1,118 +1,266 @@
 package mys3
 
 import (
-	"log"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/logging"
+	"github.com/aws/smithy-go/middleware"
 )
 
-func New(endpoint, region string, https bool) Mys3 {
-	able := false
-	if https {
-		able = true
-	}
-
-	sess := session.Must(session.NewSession(&aws.Config{
-		Region:           aws.String(region),
-		Endpoint:         aws.String(endpoint),
-		DisableSSL:       aws.Bool(able),
-		S3ForcePathStyle: aws.Bool(true),
-	}))
-	return &s3Service{sess: sess, svc: s3.New(sess)}
+// New returns a Mys3 for the endpoint. Any apiOptions are added to the
+// middleware of the client's requests, such as to install endpoint failover.
+func New(endpoint, region string, https bool, apiOptions ...func(*middleware.Stack) error) (Mys3, error) {
+	return NewWithOptions(endpoint, region, https, Options{}, apiOptions...)
 }
 
-type Mys3 interface {
-	UploadPart(input *s3.UploadPartInput) (*s3.UploadPartOutput, error)
-	GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error)
-	ListObject(input *s3.ListObjectsInput) (*s3.ListObjectsOutput, error)
-	Upload(input *s3manager.UploadInput) (*s3manager.UploadOutput, error)
-	MultipartUploads(input *s3.CreateMultipartUploadInput) (*s3.CreateMultipartUploadOutput, error)
-	CompleteMultipartUpload(input *s3.CompleteMultipartUploadInput) (*s3.CompleteMultipartUploadOutput, error)
-	AbortMultipartUpload(input *s3.AbortMultipartUploadInput) (*s3.AbortMultipartUploadOutput, error)
-	CreateMultipartUpload(input *s3.CreateMultipartUploadInput) (*s3.CreateMultipartUploadOutput, error)
-}
-
-type s3Service struct {
-	sess *session.Session
-	svc  *s3.S3
+// Options configure the client of NewClient and NewWithOptions.
+type Options struct {
+	Credentials aws.CredentialsProvider // or nil for the default credentials
+	HTTPClient  *http.Client            // or nil for the default client
+	Retryer     aws.Retryer             // or nil for the sdk's
+	// address buckets by host name, rather than by path
+	VirtualHostStyle bool
+	// transfer through the buckets' accelerate endpoints
+	Accelerate bool
+	// the headers of requests and responses are written to, if set, with
+	// the values of those carrying secrets redacted
+	WireLogger logging.Logger
+	// diagnostics are written to, or slog's default logger if nil
+	Logger Logger
 }
 
-func (s *s3Service) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
-	out, err := s.svc.GetObject(input)
+// NewWithOptions returns a Mys3 for the endpoint as New does, making
+// requests as opts configure. An endpoint without a scheme of its own is
+// reached over https if https is set, else over http.
+func NewWithOptions(endpoint, region string, https bool, opts Options, apiOptions ...func(*middleware.Stack) error) (Mys3, error) {
+	scheme := "http"
+	if https {
+		scheme = "https"
+	}
+	if endpoint != "" {
+		u, err := parseEndpoint(endpoint, scheme)
+		if err != nil {
+			return nil, err
+		}
+		endpoint = u.String()
+	}
+	svc, err := NewClient(endpoint, region, opts, apiOptions...)
 	if err != nil {
-		log.Println("getObject:", err)
 		return nil, err
 	}
-	return out, err
+	return NewFromAPIWithOptions(svc, opts), nil
 }
 
-func (s *s3Service) Upload(input *s3manager.UploadInput) (*s3manager.UploadOutput, error) {
-	uploader := s3manager.NewUploader(s.sess)
-	up, err := uploader.Upload(input, func(u *s3manager.Uploader) {
-		u.PartSize = 10 * 1024 * 1024
-		u.Concurrency = 2
-	})
+// NewClient returns the client of the endpoint, over https unless it has a
+// scheme of its own, or of the sdk's endpoint for the region if empty. Its
+// credentials, http client, retries and bucket addressing are as opts
+// configure, and any apiOptions are added to the middleware of its requests.
+// It's the one place clients are made, both for Mys3 and for the requests
+// made with the client itself.
+func NewClient(endpoint, region string, opts Options, apiOptions ...func(*middleware.Stack) error) (*s3.Client, error) {
+	var base *string
+	if endpoint != "" {
+		u, err := ParseEndpoint(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		base = aws.String(u.String())
+	}
+	cfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(region))
 	if err != nil {
-		log.Println("upload:", err)
 		return nil, err
 	}
-	return up, nil
+	if opts.Credentials != nil {
+		cfg.Credentials = opts.Credentials
+	}
+	if opts.HTTPClient != nil {
+		// once the config is loaded, as the sdk would otherwise add the
+		// CAs of AWS_CA_BUNDLE to its own client
+		cfg.HTTPClient = opts.HTTPClient
+	}
+	if opts.Retryer != nil {
+		cfg.Retryer = func() aws.Retryer { return opts.Retryer }
+	}
+	if opts.WireLogger != nil {
+		cfg.Logger = redactingLogger{opts.WireLogger}
+		// not the bodies, which are dumped whole into memory and would
+		// log the content of every object
+		cfg.ClientLogMode = aws.LogRequest | aws.LogResponse
+	}
+	cfg.APIOptions = append(cfg.APIOptions, apiOptions...)
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		o.BaseEndpoint = base
+		o.UsePathStyle = !opts.VirtualHostStyle
+		o.UseAccelerate = opts.Accelerate
+		// checksums are sent as the request's options ask, not by default
+		o.RequestChecksumCalculation = aws.RequestChecksumCalculationWhenRequired
+		o.ResponseChecksumValidation = aws.ResponseChecksumValidationWhenRequired
+	}), nil
 }
 
-func (s *s3Service) ListObject(input *s3.ListObjectsInput) (*s3.ListObjectsOutput, error) {
-	out, err := s.svc.ListObjects(input)
-	if err != nil {
-		log.Println("list :", err)
-		return nil, err
-	}
-	return out, nil
+// secretHeaders matches the lines of dumped requests and responses with
+// headers carrying secrets: the sse-c keys and session tokens.
+var secretHeaders = regexp.MustCompile(`(?im)^((?:X-Amz-Server-Side-Encryption-Customer-Key|X-Amz-Copy-Source-Server-Side-Encryption-Customer-Key|X-Amz-Security-Token):).*?(\r?)$`)
+
+// redactingLogger is a logging.Logger redacting the values of secretHeaders
+// from the messages it writes.
+type redactingLogger struct {
+	logging.Logger
 }
 
-func (s *s3Service) MultipartUploads(input *s3.CreateMultipartUploadInput) (*s3.CreateMultipartUploadOutput, error) {
-	out, err := s.svc.CreateMultipartUpload(input)
-	if err != nil {
-		log.Println("multipart upload:", err)
-		return nil, err
-	}
-	return out, nil
+func (l redactingLogger) Logf(classification logging.Classification, format string, v ...interface{}) {
+	msg := secretHeaders.ReplaceAllString(fmt.Sprintf(format, v...), "$1 REDACTED$2")
+	l.Logger.Logf(classification, "%s", msg)
+}
+
+// ParseEndpoint returns the url of an endpoint: a host name or IP address,
+// with any port, reached over https, or the url of one with an http or https
+// scheme, and perhaps a path. It fails with an error saying what's wrong
+// with any other.
+func ParseEndpoint(endpoint string) (*url.URL, error) {
+	return parseEndpoint(endpoint, "https")
 }
 
-func (s *s3Service) AbortMultipartUpload(input *s3.AbortMultipartUploadInput) (*s3.AbortMultipartUploadOutput, error) {
-	out, err := s.svc.AbortMultipartUpload(input)
+// parseEndpoint returns the url of endpoint as ParseEndpoint does, reached
+// over scheme if it has none of its own.
+func parseEndpoint(endpoint, scheme string) (*url.URL, error) {
+	given, lower := endpoint, strings.ToLower(endpoint)
+	switch {
+	case strings.Contains(endpoint, "://"):
+		if s := lower[:strings.Index(lower, "://")]; s != "http" && s != "https" {
+			return nil, fmt.Errorf("endpoint %q: scheme must be http or https, not %q", given, s)
+		}
+	case strings.HasPrefix(lower, "http:") || strings.HasPrefix(lower, "https:"):
+		return nil, fmt.Errorf("endpoint %q: malformed scheme, expected %s://", given, endpoint[:strings.IndexByte(endpoint, ':')])
+	default:
+		endpoint = scheme + "://" + endpoint
+	}
+	u, err := url.Parse(endpoint)
 	if err != nil {
-		log.Println("abort multipart upload:", err)
-		return nil, err
+		return nil, fmt.Errorf("endpoint %q: %s", given, errors.Unwrap(err))
+	}
+	switch {
+	case u.Hostname() == "":
+		return nil, fmt.Errorf("endpoint %q has no host", given)
+	case u.User != nil || u.RawQuery != "" || u.Fragment != "":
+		return nil, fmt.Errorf("endpoint %q can't have a user, query or fragment", given)
+	}
+	if port := u.Port(); port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return nil, fmt.Errorf("endpoint %q: port must be 1 to 65535, not %s", given, port)
+		}
 	}
-	return out, nil
+	return u, nil
 }
 
-func (s *s3Service) CompleteMultipartUpload(input *s3.CompleteMultipartUploadInput) (*s3.CompleteMultipartUploadOutput, error) {
-	out, err := s.svc.CompleteMultipartUpload(input)
-	if err != nil {
-		log.Println("complete multipart upload:", err)
-		return nil, err
+// NewFromAPI returns a Mys3 backed by an existing client, such as a mock.
+func NewFromAPI(svc API) Mys3 {
+	return NewFromAPIWithOptions(svc, Options{})
+}
+
+// NewFromAPIWithOptions returns a Mys3 backed by an existing client as
+// NewFromAPI does, writing diagnostics to the Logger of opts. The options
+// configuring a client are left to the client.
+func NewFromAPIWithOptions(svc API, opts Options) Mys3 {
+	return &s3Service{API: svc, logger: opts.logger()}
+}
+
+// UploadPartSize is the default part size of Upload, which sends smaller
+// bodies in a single request.
+const UploadPartSize = 10 * 1024 * 1024
+
+// UploadConcurrency is the default number of parts Upload sends at once.
+const UploadConcurrency = 2
+
+// PartOptions configure the parts of uploads sent in several requests.
+type PartOptions struct {
+	Size        int64 // bytes per part, or 0 for the default
+	Concurrency int   // parts sent at once, or 0 for the default
+}
+
+// UploadSize returns the part size of Upload.
+func (o PartOptions) UploadSize() int64 {
+	if o.Size > 0 {
+		return o.Size
 	}
-	return out, nil
+	return UploadPartSize
 }
 
-func (s *s3Service) CreateMultipartUpload(input *s3.CreateMultipartUploadInput) (*s3.CreateMultipartUploadOutput, error) {
-	out, err := s.svc.CreateMultipartUpload(input)
-	if err != nil {
-		log.Println("Create multipart upload:", err)
-		return nil, err
+// UploadConcurrency returns the parts Upload sends at once.
+func (o PartOptions) UploadConcurrency() int {
+	if o.Concurrency > 0 {
+		return o.Concurrency
 	}
-	return out, nil
+	return UploadConcurrency
+}
+
+// API is the operations of the client a Mys3 is backed by, as *s3.Client
+// makes them.
+type API interface {
+	GetObject(ctx context.Context, input *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	PutObject(ctx context.Context, input *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	ListObjectsV2(ctx context.Context, input *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	UploadPart(ctx context.Context, input *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error)
+	CreateMultipartUpload(ctx context.Context, input *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error)
+	CompleteMultipartUpload(ctx context.Context, input *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error)
+	AbortMultipartUpload(ctx context.Context, input *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error)
+	ListMultipartUploads(ctx context.Context, input *s3.ListMultipartUploadsInput, optFns ...func(*s3.Options)) (*s3.ListMultipartUploadsOutput, error)
+	ListParts(ctx context.Context, input *s3.ListPartsInput, optFns ...func(*s3.Options)) (*s3.ListPartsOutput, error)
+}
 
+// Mys3 makes the requests of API, and uploads with the sdk's upload manager.
+// Its listings are paged with the sdk's paginators, such as
+// s3.NewListObjectsV2Paginator.
+type Mys3 interface {
+	API
+	Upload(ctx context.Context, input *s3.PutObjectInput, parts PartOptions, optFns ...func(*s3.Options)) (*manager.UploadOutput, error)
+}
+
+type s3Service struct {
+	API
+	logger Logger
 }
 
-func (s *s3Service) UploadPart(input *s3.UploadPartInput) (*s3.UploadPartOutput, error) {
-	out, err := s.svc.UploadPart(input)
+// Upload uploads input, in parts if larger than a part, applying any optFns
+// to each request made.
+func (s *s3Service) Upload(ctx context.Context, input *s3.PutObjectInput, parts PartOptions, optFns ...func(*s3.Options)) (*manager.UploadOutput, error) {
+	uploader := manager.NewUploader(s.API, func(u *manager.Uploader) {
+		u.PartSize = parts.UploadSize()
+		u.Concurrency = parts.UploadConcurrency()
+		u.ClientOptions = append(u.ClientOptions, optFns...)
+		u.RequestChecksumCalculation = aws.RequestChecksumCalculationWhenRequired
+	})
+	up, err := uploader.Upload(ctx, input)
 	if err != nil {
-		log.Println(" upload part:", err)
+		bucket, key := aws.ToString(input.Bucket), aws.ToString(input.Key)
+		s.logger.Debug("upload failed", "bucket", bucket, "key", key, "error", err)
+		if failure, ok := err.(manager.MultiUploadFailure); ok && ctx.Err() != nil {
+			// the uploader's own abort is made with ctx, so fails once
+			// it's done, leaving the upload behind
+			_, abortErr := s.API.AbortMultipartUpload(context.Background(), &s3.AbortMultipartUploadInput{
+				Bucket:   input.Bucket,
+				Key:      input.Key,
+				UploadId: aws.String(failure.UploadID()),
+			})
+			if abortErr != nil {
+				s.logger.Warn("couldn't abort canceled upload", "bucket", bucket, "key", key, "upload_id", failure.UploadID(), "error", abortErr)
+			} else {
+				s.logger.Info("aborted canceled upload", "bucket", bucket, "key", key, "upload_id", failure.UploadID())
+			}
+		}
 		return nil, err
 	}
-	return out, nil
+	s.logger.Debug("uploaded", "bucket", aws.ToString(input.Bucket), "key", aws.ToString(input.Key), "location", up.Location)
+	return up, nil
 }
@@ -0,0 +1,73 @@
+package s3
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// user metadata keys recording local file attributes
+const (
+	mtimeKey = "mtime"
+	modeKey  = "mode"
+	uidKey   = "uid"
+	gidKey   = "gid"
+)
+
+// posixMetadata records the modification time, permissions and ownership of
+// a local file as user metadata.
+func posixMetadata(info os.FileInfo) map[string]string {
+	metadata := map[string]string{
+		mtimeKey: info.ModTime().UTC().Format(time.RFC3339Nano),
+		modeKey:  strconv.FormatUint(uint64(info.Mode().Perm()), 8),
+	}
+	if uid, gid, ok := fileOwner(info); ok {
+		metadata[uidKey] = strconv.Itoa(uid)
+		metadata[gidKey] = strconv.Itoa(gid)
+	}
+	return metadata
+}
+
+// restorePosixMetadata applies the attributes recorded by posixMetadata to
+// the file at path. Attributes missing from metadata are left alone, as is
+// ownership when we lack permission to change it.
+func restorePosixMetadata(path string, metadata map[string]string) error {
+	if v := metadataValue(metadata, modeKey); v != "" {
+		mode, err := strconv.ParseUint(v, 8, 32)
+		if err != nil {
+			return err
+		}
+		err = os.Chmod(path, os.FileMode(mode).Perm())
+		if err != nil {
+			return err
+		}
+	}
+	uid, uerr := strconv.Atoi(metadataValue(metadata, uidKey))
+	gid, gerr := strconv.Atoi(metadataValue(metadata, gidKey))
+	if uerr == nil && gerr == nil {
+		err := os.Chown(path, uid, gid)
+		if err != nil && !os.IsPermission(err) {
+			return err
+		}
+	}
+	if v := metadataValue(metadata, mtimeKey); v != "" {
+		mtime, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return err
+		}
+		return os.Chtimes(path, mtime, mtime)
+	}
+	return nil
+}
+
+// restoreModTime sets the mtime of a file downloaded from an object to the
+// object's last modified time, so tools comparing timestamps see when the
+// content last changed rather than when it was fetched.
+func restoreModTime(path string, file File) error {
+	s3f, ok := file.(*S3File)
+	if !ok || s3f.object.LastModified == nil {
+		return nil
+	}
+	mtime := *s3f.object.LastModified
+	return os.Chtimes(path, mtime, mtime)
+}
@@ -0,0 +1,8 @@
+package s3
+
+import "os"
+
+// windows has no numeric uid/gid to record
+func fileOwner(info os.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,146 @@
+package s3
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// progressChunkSize is the number of bytes transferred between chunk events.
+const progressChunkSize = 1 << 20
+
+// ProgressEvent is one line of the --progress-json stream.
+type ProgressEvent struct {
+	Event  string `json:"event"` // start, chunk, visible, done or error
+	Key    string `json:"key"`
+	Bytes  int64  `json:"bytes,omitempty"`     // transferred so far
+	Total  int64  `json:"total,omitempty"`     // size of the file
+	Waited int64  `json:"waited_ms,omitempty"` // wait for an upload to become visible
+	Error  string `json:"error,omitempty"`
+}
+
+// ProgressReporter writes transfer progress as newline-delimited JSON
+// events, or feeds them to a dashboard. A nil reporter discards them.
+type ProgressReporter struct {
+	mu        sync.Mutex
+	enc       *json.Encoder
+	dashboard *Dashboard
+}
+
+// NewProgressReporter returns a reporter writing events to w.
+func NewProgressReporter(w io.Writer) *ProgressReporter {
+	return &ProgressReporter{enc: json.NewEncoder(w)}
+}
+
+// NewDashboardReporter returns a reporter feeding events to d.
+func NewDashboardReporter(d *Dashboard) *ProgressReporter {
+	return &ProgressReporter{dashboard: d}
+}
+
+func (p *ProgressReporter) emit(event ProgressEvent) {
+	if p == nil {
+		return
+	}
+	if p.dashboard != nil {
+		p.dashboard.handle(event)
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.enc.Encode(event)
+}
+
+// Queued reports that file is scheduled for transfer, ahead of its start.
+// Only the dashboard uses this, for its ETA.
+func (p *ProgressReporter) Queued(file File) {
+	if p != nil && p.dashboard != nil {
+		p.dashboard.queue(file.Relative(), file.Size())
+	}
+}
+
+// Start reports that the transfer of file has begun.
+func (p *ProgressReporter) Start(file File) {
+	p.emit(ProgressEvent{Event: "start", Key: file.Relative(), Total: file.Size()})
+}
+
+// Done reports that file was transferred.
+func (p *ProgressReporter) Done(file File) {
+	p.emit(ProgressEvent{Event: "done", Key: file.Relative(), Bytes: file.Size(), Total: file.Size()})
+}
+
+// Visible reports that an upload of file only became visible after waiting.
+func (p *ProgressReporter) Visible(file File, waited time.Duration) {
+	p.emit(ProgressEvent{Event: "visible", Key: file.Relative(), Total: file.Size(), Waited: waited.Milliseconds()})
+}
+
+// Error reports that the transfer of file failed.
+func (p *ProgressReporter) Error(file File, err error) {
+	p.emit(ProgressEvent{Event: "error", Key: file.Relative(), Total: file.Size(), Error: err.Error()})
+}
+
+// track reports the outcome of a transfer that returned err.
+func (p *ProgressReporter) track(file File, err error) {
+	if err != nil {
+		p.Error(file, err)
+	} else {
+		p.Done(file)
+	}
+}
+
+// wrap returns r, emitting chunk events as the contents of file are read
+// from it.
+func (p *ProgressReporter) wrap(file File, r io.Reader) io.Reader {
+	if p == nil {
+		return r
+	}
+	return &progressReader{reader: r, counter: progressCounter{progress: p, key: file.Relative(), total: file.Size()}}
+}
+
+// progressCounter emits a chunk event every progressChunkSize bytes.
+type progressCounter struct {
+	progress *ProgressReporter
+	key      string
+	total    int64
+	count    int64
+	reported int64
+}
+
+func (pc *progressCounter) add(n int, final bool) {
+	pc.count += int64(n)
+	if pc.count-pc.reported >= progressChunkSize || (final && pc.count > pc.reported) {
+		pc.reported = pc.count
+		pc.progress.emit(ProgressEvent{Event: "chunk", Key: pc.key, Bytes: pc.count, Total: pc.total})
+	}
+}
+
+type progressReader struct {
+	reader  io.Reader
+	counter progressCounter
+}
+
+func (pr *progressReader) Read(b []byte) (int, error) {
+	n, err := pr.reader.Read(b)
+	pr.counter.add(n, err == io.EOF)
+	return n, err
+}
+
+type progressWriter struct {
+	writer  io.Writer
+	counter progressCounter
+}
+
+func (pw *progressWriter) Write(b []byte) (int, error) {
+	n, err := pw.writer.Write(b)
+	pw.counter.add(n, pw.counter.count+int64(n) >= pw.counter.total)
+	return n, err
+}
+
+// wrapWriter returns w, emitting chunk events as the contents of file are
+// written to it.
+func (p *ProgressReporter) wrapWriter(file File, w io.Writer) io.Writer {
+	if p == nil {
+		return w
+	}
+	return &progressWriter{writer: w, counter: progressCounter{progress: p, key: file.Relative(), total: file.Size()}}
+}
@@ -0,0 +1,61 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// TransferLimits cap the files and bytes a run transfers, such as for
+// metered links. Zero means no limit.
+type TransferLimits struct {
+	MaxBytes int64 // total bytes of the files transferred
+	MaxFiles int   // number of files transferred
+}
+
+// transferQuota admits transfers until one would exceed the limits, after
+// which nothing more is scheduled and what remains is counted instead.
+type transferQuota struct {
+	mu        sync.Mutex
+	limits    TransferLimits
+	bytes     int64
+	files     int
+	exhausted bool
+
+	remainingFiles int
+	remainingBytes int64
+}
+
+func newTransferQuota(limits TransferLimits) *transferQuota {
+	return &transferQuota{limits: limits}
+}
+
+// allow reports whether file may be transferred, counting it against the
+// quota if so.
+func (q *transferQuota) allow(file File) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	size := file.Size()
+	if !q.exhausted {
+		overBytes := q.limits.MaxBytes > 0 && q.bytes+size > q.limits.MaxBytes
+		overFiles := q.limits.MaxFiles > 0 && q.files+1 > q.limits.MaxFiles
+		q.exhausted = overBytes || overFiles
+	}
+	if q.exhausted {
+		q.remainingFiles++
+		q.remainingBytes += size
+		return false
+	}
+	q.files++
+	q.bytes += size
+	return true
+}
+
+// report prints what was left untransferred once the quota was reached.
+func (q *transferQuota) report(ctx context.Context) {
+	if q.remainingFiles == 0 {
+		return
+	}
+	fmt.Fprintf(outOf(ctx), "quota reached after %d files (%d bytes): %d files (%d bytes) not transferred\n",
+		q.files, q.bytes, q.remainingFiles, q.remainingBytes)
+}
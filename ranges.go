@@ -0,0 +1,94 @@
+package s3
+
+import (
+	"context"
+	"io"
+)
+
+// RangeOptions configure concurrent ranged downloads of large objects.
+type RangeOptions struct {
+	Threshold   int64 // objects at least this size are fetched in ranges
+	Size        int64 // bytes per range
+	Concurrency int   // ranges fetched at once; below 2 disables ranged downloads
+}
+
+// DefaultRangeOptions fetch objects of 32MiB or more in 8MiB ranges, four at
+// a time.
+var DefaultRangeOptions = RangeOptions{
+	Threshold:   32 * mib,
+	Size:        8 * mib,
+	Concurrency: 4,
+}
+
+// applies reports whether size bytes should be fetched in ranges.
+func (ro RangeOptions) applies(size int64) bool {
+	return ro.Concurrency > 1 && ro.Size > 0 && size >= ro.Threshold
+}
+
+// fetchOrdered runs fetch for chunks 0 to n-1, up to concurrency at once,
+// writing the results to w in order. As chunks are written strictly in
+// order, w only ever holds a complete prefix of the data, so an interrupted
+// download can be resumed. At most concurrency chunks are held in memory.
+func fetchOrdered(w io.Writer, n, concurrency int, fetch func(i int) ([]byte, error)) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	type result struct {
+		data []byte
+		err  error
+	}
+	results := make([]chan result, n)
+	for i := range results {
+		results[i] = make(chan result, 1)
+	}
+	slots := make(chan struct{}, concurrency)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for i := 0; i < n; i++ {
+			select {
+			case slots <- struct{}{}:
+			case <-done:
+				return
+			}
+			go func(i int) {
+				data, err := fetch(i)
+				results[i] <- result{data, err}
+			}(i)
+		}
+	}()
+	for i := 0; i < n; i++ {
+		r := <-results[i]
+		if r.err != nil {
+			return r.err
+		}
+		_, err := w.Write(r.data)
+		if err != nil {
+			return err
+		}
+		<-slots
+	}
+	return nil
+}
+
+// downloadFrom writes the object from offset onwards to w, fetching large
+// remainders in concurrent ranges.
+func (s3f *S3File) downloadFrom(ctx context.Context, offset int64, w io.Writer, ranges RangeOptions) (int64, error) {
+	size := s3f.Size()
+	if !ranges.applies(size - offset) {
+		return s3f.streamFrom(ctx, offset, w)
+	}
+	n := int((size - offset + ranges.Size - 1) / ranges.Size)
+	err := fetchOrdered(w, n, ranges.Concurrency, func(i int) ([]byte, error) {
+		start := offset + int64(i)*ranges.Size
+		end := start + ranges.Size - 1
+		if end >= size {
+			end = size - 1
+		}
+		return s3f.getRange(ctx, start, end)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return size - offset, nil
+}
@@ -0,0 +1,86 @@
+package s3
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// rateLimiter spaces out requests evenly, at most rps a second.
+type rateLimiter struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time // when the next request may be sent
+}
+
+// newRateLimiter returns a limiter of rps requests a second, or nil, for no
+// limit, if 0.
+func newRateLimiter(rps float64) *rateLimiter {
+	if rps <= 0 {
+		return nil
+	}
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / rps)}
+}
+
+// reserve returns how long to wait before sending a request, and reserves
+// its slot.
+func (l *rateLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	wait := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	return wait
+}
+
+// requestRates limits the requests of a run with --rps and --list-rps, list
+// requests apart from those of data, so a listing doesn't hold up transfers
+// or the other way about. Limiters are shared by all the clients of the run.
+type requestRates struct {
+	data *rateLimiter
+	list *rateLimiter
+}
+
+// newRequestRates returns the limits of rps data and listRPS list requests a
+// second, 0 being unlimited, or nil without any.
+func newRequestRates(rps, listRPS float64) *requestRates {
+	if rps <= 0 && listRPS <= 0 {
+		return nil
+	}
+	return &requestRates{data: newRateLimiter(rps), list: newRateLimiter(listRPS)}
+}
+
+// install adds the middleware holding back each attempt of a request,
+// retries included, until its limit allows it to be sent.
+func (rates *requestRates) install(stack *middleware.Stack) error {
+	if rates == nil {
+		return nil
+	}
+	limit := middleware.FinalizeMiddlewareFunc("s3.RequestRate", func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+		limiter := rates.data
+		if strings.HasPrefix(middleware.GetOperationName(ctx), "List") {
+			limiter = rates.list
+		}
+		if limiter != nil {
+			if wait := limiter.reserve(); wait > 0 {
+				timer := time.NewTimer(wait)
+				defer timer.Stop()
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					return middleware.FinalizeOutput{}, middleware.Metadata{}, &aws.RequestCanceledError{Err: ctx.Err()}
+				}
+			}
+		}
+		return next.HandleFinalize(ctx, in)
+	})
+	return stack.Finalize.Insert(limit, "Signing", middleware.Before)
+}
@@ -0,0 +1,86 @@
+package s3
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Record is one line of --json output, describing a bucket, key, directory,
+// incomplete upload, grep match or count, or the totals of a listing.
+type Record struct {
+	Type         string `json:"type"` // bucket, key, dir, upload, match, context, count or summary
+	URL          string `json:"url,omitempty"`
+	Count        *int64 `json:"count,omitempty"` // keys listed, for a summary, or lines selected
+	Size         *int64 `json:"size,omitempty"`  // bytes of a key, or of all those listed
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	StorageClass string `json:"storage_class,omitempty"`
+	UploadID     string `json:"upload_id,omitempty"`
+	Initiated    string `json:"initiated,omitempty"` // when the upload began
+	Line         string `json:"line,omitempty"`      // the matching line
+	LineNumber   int64  `json:"line_number,omitempty"`
+	Offset       *int64 `json:"offset,omitempty"` // of the line's first byte
+}
+
+// RecordWriter writes records as newline-delimited JSON, for scripting in
+// place of the text output. Commands given a nil writer print text.
+type RecordWriter struct {
+	mu        sync.Mutex
+	enc       *json.Encoder
+	collected []Record // written, without an encoder
+}
+
+// NewRecordWriter returns a writer of records to w.
+func NewRecordWriter(w io.Writer) *RecordWriter {
+	enc := json.NewEncoder(w)
+	// keys and lines are shown as they are
+	enc.SetEscapeHTML(false)
+	return &RecordWriter{enc: enc}
+}
+
+// newRecordCollector returns a writer collecting the records written, for a
+// Client.
+func newRecordCollector() *RecordWriter {
+	return &RecordWriter{}
+}
+
+// Write writes record on a line of its own. It's safe to call from parallel
+// operations.
+func (rw *RecordWriter) Write(record Record) error {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if rw.enc == nil {
+		rw.collected = append(rw.collected, record)
+		return nil
+	}
+	return rw.enc.Encode(record)
+}
+
+// fileRecord returns the record of a key or local file.
+func fileRecord(file File) Record {
+	if s3f, ok := file.(*S3File); ok {
+		return objectRecord(s3f.bucket, s3f.object)
+	}
+	return Record{Type: "key", URL: file.String(), Size: aws.Int64(file.Size())}
+}
+
+// objectRecord returns the record of a key as listed.
+func objectRecord(bucket string, object *types.Object) Record {
+	record := Record{
+		Type:         "key",
+		URL:          fmt.Sprintf("s3://%s/%s", bucket, aws.ToString(object.Key)),
+		Size:         aws.Int64(aws.ToInt64(object.Size)),
+		ETag:         aws.ToString(object.ETag),
+		StorageClass: string(object.StorageClass),
+	}
+	if object.LastModified != nil {
+		record.LastModified = object.LastModified.UTC().Format(time.RFC3339)
+	}
+	return record
+}
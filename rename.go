@@ -0,0 +1,249 @@
+package s3
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/barnybug/s3/pkg/mys3"
+)
+
+// Transform is a sed-style substitution rule applied to keys, written
+// s/pattern/replacement/ with an optional g flag to replace every match.
+// The pattern is a Go regexp and the replacement may refer to groups as $1.
+type Transform struct {
+	re          *regexp.Regexp
+	replacement string
+	global      bool
+}
+
+// ParseTransform parses a substitution rule. Any character may follow the s
+// as the delimiter, e.g. s|logs/|archive/logs/|.
+func ParseTransform(expr string) (*Transform, error) {
+	if len(expr) < 2 || expr[0] != 's' {
+		return nil, fmt.Errorf("invalid transform %q: expected s/pattern/replacement/", expr)
+	}
+	delim := expr[1:2]
+	parts := strings.Split(expr[2:], delim)
+	if len(parts) != 3 || (parts[2] != "" && parts[2] != "g") {
+		return nil, fmt.Errorf("invalid transform %q: expected s/pattern/replacement/", expr)
+	}
+	re, err := regexp.Compile(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid transform %q: %s", expr, err)
+	}
+	return &Transform{re: re, replacement: parts[1], global: parts[2] == "g"}, nil
+}
+
+// Apply returns key with the substitution made.
+func (t *Transform) Apply(key string) string {
+	if t.global {
+		return t.re.ReplaceAllString(key, t.replacement)
+	}
+	match := t.re.FindStringSubmatchIndex(key)
+	if match == nil {
+		return key
+	}
+	dst := t.re.ExpandString(nil, t.replacement, key, match)
+	return key[:match[0]] + string(dst) + key[match[1]:]
+}
+
+// RenameEntry maps a source url to its destination, as read by cp --manifest.
+type RenameEntry struct {
+	Source string `json:"source"`
+	Dest   string `json:"dest"`
+}
+
+// ReadRenameManifest loads the entries written by plan-rename --manifest.
+func ReadRenameManifest(filename string) ([]RenameEntry, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var entries []RenameEntry
+	err = json.Unmarshal(data, &entries)
+	return entries, err
+}
+
+// PlanRenameOptions configure RunPlanRename.
+type PlanRenameOptions struct {
+	CommonOptions
+	FilesystemOptions
+	Transforms []string // substitution rules, applied in order
+	Manifest   string   // write the mapping here for cp --manifest
+}
+
+// RunPlanRename prints the old -> new key mapping the transforms produce for
+// the keys under each url, without changing anything.
+func RunPlanRename(ctx context.Context, conn S3API, mys3Conn mys3.Mys3, urls []string, opts PlanRenameOptions) error {
+	for _, u := range urls {
+		if !isS3Url(u) {
+			return errors.New("s3:// url required")
+		}
+	}
+	if len(opts.Transforms) == 0 {
+		return errors.New("at least one --transform is required")
+	}
+	var transforms []*Transform
+	for _, expr := range opts.Transforms {
+		t, err := ParseTransform(expr)
+		if err != nil {
+			return err
+		}
+		transforms = append(transforms, t)
+	}
+
+	entries := []RenameEntry{}
+	sources := map[string]string{}
+	var renamed, unchanged, conflicts int
+	err := iterateKeys(ctx, conn, urls, opts.FilesystemOptions, func(file File) error {
+		s3f, ok := file.(*S3File)
+		if !ok {
+			return nil
+		}
+		key := *s3f.object.Key
+		newKey := key
+		for _, t := range transforms {
+			newKey = t.Apply(newKey)
+		}
+		if newKey == key {
+			unchanged += 1
+			return nil
+		}
+		source := fmt.Sprintf("s3://%s/%s", s3f.bucket, key)
+		dest := fmt.Sprintf("s3://%s/%s", s3f.bucket, newKey)
+		if other, exists := sources[dest]; exists {
+			fmt.Fprintf(outOf(ctx), "! %s -> %s conflicts with %s\n", source, dest, other)
+			conflicts += 1
+			return nil
+		}
+		sources[dest] = source
+		if !opts.Quiet {
+			fmt.Fprintf(outOf(ctx), "%s -> %s\n", source, dest)
+		}
+		entries = append(entries, RenameEntry{Source: source, Dest: dest})
+		renamed += 1
+		return nil
+	}, mys3Conn)
+	if err != nil && err != ErrNotFound {
+		return err
+	}
+	if opts.Manifest != "" {
+		data, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(opts.Manifest, append(data, '\n'), 0666)
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(outOf(ctx), "\n%d renamed %d unchanged %d conflicts\n", renamed, unchanged, conflicts)
+	if conflicts > 0 {
+		return fmt.Errorf("%d keys would be overwritten by another rename", conflicts)
+	}
+	return nil
+}
+
+// CopyOptions configure RunCopy.
+type CopyOptions struct {
+	CommonOptions
+	Manifest   string     // copy each source -> dest listed in this file
+	Encryption Encryption // server-side encryption of the copies
+	// COPY to keep the source's metadata and headers, or REPLACE to set
+	// Headers, keeping the rest of the source's
+	MetadataDirective string
+	Headers           Headers
+}
+
+// RunCopy copies keys server-side, either src to dest or every entry of a
+// manifest written by plan-rename.
+func RunCopy(ctx context.Context, conn S3API, src, dest string, opts CopyOptions) error {
+	var entries []RenameEntry
+	if opts.Manifest != "" {
+		var err error
+		entries, err = ReadRenameManifest(opts.Manifest)
+		if err != nil {
+			return err
+		}
+	} else {
+		entries = []RenameEntry{{Source: src, Dest: dest}}
+	}
+	for _, entry := range entries {
+		if !isS3Url(entry.Source) || !isS3Url(entry.Dest) {
+			return errors.New("s3:// url required")
+		}
+	}
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !opts.Quiet {
+			fmt.Fprintf(outOf(ctx), "C %s -> %s\n", entry.Source, entry.Dest)
+		}
+		if opts.DryRun {
+			continue
+		}
+		err := copyObject(ctx, conn, entry.Source, entry.Dest, opts)
+		if err != nil {
+			if opts.IgnoreErrors {
+				fmt.Fprintf(errOutOf(ctx), "E %s: %s\n", entry.Source, err)
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func copyObject(ctx context.Context, conn S3API, src, dest string, opts CopyOptions) error {
+	srcBucket, srcKey := extractBucketPath(src)
+	destBucket, destKey := extractBucketPath(dest)
+	if srcKey == "" || destKey == "" {
+		return errors.New("cp needs a key, not just a bucket")
+	}
+	input := s3.CopyObjectInput{
+		Bucket:     aws.String(destBucket),
+		Key:        aws.String(destKey),
+		CopySource: aws.String(escapeCopySource(srcBucket, srcKey)),
+		// otherwise the copy takes the bucket's default encryption
+		ServerSideEncryption: opts.Encryption.algorithm(),
+		SSEKMSKeyId:          opts.Encryption.keyID(),
+	}
+	if opts.MetadataDirective == string(types.MetadataDirectiveReplace) {
+		// S3 replaces everything, so carry across what isn't being set
+		head, err := conn.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(srcBucket),
+			Key:    aws.String(srcKey),
+		})
+		if err != nil {
+			return err
+		}
+		input.MetadataDirective = types.MetadataDirectiveReplace
+		input.Metadata = head.Metadata
+		input.ContentType = head.ContentType
+		input.CacheControl = head.CacheControl
+		input.ContentEncoding = head.ContentEncoding
+		input.ContentDisposition = head.ContentDisposition
+		opts.Headers.apply(&input.CacheControl, &input.ContentEncoding, &input.ContentDisposition)
+	}
+	_, err := conn.CopyObject(ctx, &input)
+	return err
+}
+
+// escapeCopySource url-encodes bucket/key, leaving the separators intact.
+func escapeCopySource(bucket, key string) string {
+	segments := strings.Split(bucket+"/"+key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,104 @@
+package s3
+
+import (
+	"context"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// resumableUpload finds the most recent incomplete multipart upload of key
+// whose parts so far are those of content with the part md5s given, so it
+// can be continued from the next part. It returns the upload and its parts
+// by number, or nil if there's none to resume. Uploads of other content are
+// left alone.
+func (s3fs *S3Filesystem) resumableUpload(ctx context.Context, key string, partSums []string) (*s3.CreateMultipartUploadOutput, map[int64]*types.CompletedPart, error) {
+	uploads, err := s3fs.incompleteUploads(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	// most recent first
+	sort.SliceStable(uploads, func(i, j int) bool {
+		return aws.ToTime(uploads[i].Initiated).After(aws.ToTime(uploads[j].Initiated))
+	})
+	for _, upload := range uploads {
+		parts, err := s3fs.uploadedParts(ctx, key, upload.UploadId)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !partsMatch(parts, partSums) {
+			continue
+		}
+		completed := map[int64]*types.CompletedPart{}
+		for _, part := range parts {
+			completed[int64(*part.PartNumber)] = &types.CompletedPart{ETag: part.ETag, PartNumber: part.PartNumber}
+		}
+		return &s3.CreateMultipartUploadOutput{
+			Bucket:   aws.String(s3fs.bucket),
+			Key:      aws.String(key),
+			UploadId: upload.UploadId,
+		}, completed, nil
+	}
+	return nil, nil, nil
+}
+
+// incompleteUploads lists the incomplete multipart uploads of key.
+func (s3fs *S3Filesystem) incompleteUploads(ctx context.Context, key string) ([]types.MultipartUpload, error) {
+	var uploads []types.MultipartUpload
+	input := s3.ListMultipartUploadsInput{
+		Bucket: aws.String(s3fs.bucket),
+		Prefix: aws.String(key),
+	}
+	for {
+		output, err := s3fs.mys3.ListMultipartUploads(ctx, &input)
+		if err != nil {
+			return nil, err
+		}
+		for _, upload := range output.Uploads {
+			// the prefix also matches longer keys
+			if aws.ToString(upload.Key) == key {
+				uploads = append(uploads, upload)
+			}
+		}
+		if !aws.ToBool(output.IsTruncated) {
+			return uploads, nil
+		}
+		input.KeyMarker = output.NextKeyMarker
+		input.UploadIdMarker = output.NextUploadIdMarker
+	}
+}
+
+// uploadedParts lists the parts sent to an incomplete upload of key.
+func (s3fs *S3Filesystem) uploadedParts(ctx context.Context, key string, uploadID *string) ([]types.Part, error) {
+	var parts []types.Part
+	input := s3.ListPartsInput{
+		Bucket:   aws.String(s3fs.bucket),
+		Key:      aws.String(key),
+		UploadId: uploadID,
+	}
+	for {
+		output, err := s3fs.mys3.ListParts(ctx, &input)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, output.Parts...)
+		if !aws.ToBool(output.IsTruncated) {
+			return parts, nil
+		}
+		input.PartNumberMarker = output.NextPartNumberMarker
+	}
+}
+
+// partsMatch reports whether each uploaded part has the etag of the part of
+// the content with that number, its quoted md5.
+func partsMatch(parts []types.Part, partSums []string) bool {
+	for _, part := range parts {
+		n := int64(aws.ToInt32(part.PartNumber))
+		if n < 1 || n > int64(len(partSums)) || aws.ToString(part.ETag) != `"`+partSums[n-1]+`"` {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,175 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// RetryMode is how requests back off before being retried.
+type RetryMode string
+
+const (
+	// RetryStandard backs off each request on its own.
+	RetryStandard RetryMode = "standard"
+	// RetryAdaptive also holds back every other request while one backs
+	// off from throttling, so parallel transfers slow down together.
+	RetryAdaptive RetryMode = "adaptive"
+)
+
+// DefaultMaxRetries is how many times a failed request is retried without
+// --max-retries, as the sdk does for s3.
+const DefaultMaxRetries = 3
+
+const (
+	retryBaseDelay    = 100 * time.Millisecond // of the first retry
+	throttleBaseDelay = 500 * time.Millisecond // of the first retry of a throttled request
+	retryMaxDelay     = 20 * time.Second
+)
+
+// RetryPolicy is how failed requests, and transfers corrupted on the way, are
+// retried: up to Retries times, waiting a random time up to a delay doubled
+// with each retry. It's the sdk's retryer of the clients of a run. A nil
+// policy is the default.
+type RetryPolicy struct {
+	Retries int       // times a failure is retried
+	Mode    RetryMode // standard or adaptive
+
+	mu          sync.Mutex
+	pausedUntil time.Time // adaptive: when requests may be sent again
+}
+
+// ParseRetryPolicy checks the --max-retries and --retry-mode flags.
+func ParseRetryPolicy(maxRetries int, mode string) (*RetryPolicy, error) {
+	if maxRetries < 0 {
+		return nil, errors.New("--max-retries can't be negative")
+	}
+	switch RetryMode(mode) {
+	case RetryStandard, RetryAdaptive:
+	default:
+		return nil, fmt.Errorf("--retry-mode must be standard or adaptive, not %q", mode)
+	}
+	return &RetryPolicy{Retries: maxRetries, Mode: RetryMode(mode)}, nil
+}
+
+// MaxRetries returns how many times a failure is retried.
+func (p *RetryPolicy) MaxRetries() int {
+	if p == nil {
+		return DefaultMaxRetries
+	}
+	return p.Retries
+}
+
+// IsErrorRetryable reports whether a failed request is retried, as the
+// sdk's retryer does: on throttling, RequestTimeout, server errors and
+// connections refused or reset, or as another middleware, such as endpoint
+// failover, decides. It's the same for every operation.
+func (p *RetryPolicy) IsErrorRetryable(err error) bool {
+	return retry.IsErrorRetryables(retry.DefaultRetryables).IsErrorRetryable(err) == aws.TrueTernary || isErrorThrottle(err)
+}
+
+// MaxAttempts returns how many times a request is tried, retries included.
+func (p *RetryPolicy) MaxAttempts() int {
+	return p.MaxRetries() + 1
+}
+
+// RetryDelay returns how long a request that failed on attempt, from 1,
+// waits before it's retried, starting longer when throttled. In adaptive mode
+// every other request waits for as long.
+func (p *RetryPolicy) RetryDelay(attempt int, err error) (time.Duration, error) {
+	if !isErrorThrottle(err) {
+		return backoff(attempt-1, retryBaseDelay), nil
+	}
+	delay := backoff(attempt-1, throttleBaseDelay)
+	if p != nil && p.Mode == RetryAdaptive {
+		p.mu.Lock()
+		if until := time.Now().Add(delay); until.After(p.pausedUntil) {
+			p.pausedUntil = until
+		}
+		p.mu.Unlock()
+	}
+	return delay, nil
+}
+
+// GetRetryToken allows every retry, the retries of a request being limited
+// by MaxAttempts alone.
+func (p *RetryPolicy) GetRetryToken(ctx context.Context, err error) (func(error) error, error) {
+	return releaseRetryToken, nil
+}
+
+// GetInitialToken allows every first attempt.
+func (p *RetryPolicy) GetInitialToken() func(error) error {
+	return releaseRetryToken
+}
+
+func releaseRetryToken(error) error {
+	return nil
+}
+
+// isErrorThrottle reports whether err is S3 asking for fewer requests: an
+// error the sdk's retryer sees as throttling, such as SlowDown, or any 503.
+// Both the retries and sync --adaptive back off on it.
+func isErrorThrottle(err error) bool {
+	var respErr *smithyhttp.ResponseError
+	if errors.As(err, &respErr) && respErr.HTTPStatusCode() == http.StatusServiceUnavailable {
+		return true
+	}
+	return retry.IsErrorThrottles(retry.DefaultThrottles).IsErrorThrottle(err) == aws.TrueTernary
+}
+
+// wait sleeps before retry n, from 0, of a transfer that arrived corrupted,
+// returning ctx's error if it's done first.
+func (p *RetryPolicy) wait(ctx context.Context, n int) error {
+	timer := time.NewTimer(backoff(n, retryBaseDelay))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// install adds the middleware holding back requests in adaptive mode while
+// another backs off from throttling. It's run before each attempt is signed.
+func (p *RetryPolicy) install(stack *middleware.Stack) error {
+	if p == nil || p.Mode != RetryAdaptive {
+		return nil
+	}
+	pause := middleware.FinalizeMiddlewareFunc("s3.RetryPause", func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+		p.mu.Lock()
+		pause := time.Until(p.pausedUntil)
+		p.mu.Unlock()
+		if pause > 0 {
+			timer := time.NewTimer(pause)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				return middleware.FinalizeOutput{}, middleware.Metadata{}, &aws.RequestCanceledError{Err: ctx.Err()}
+			}
+		}
+		return next.HandleFinalize(ctx, in)
+	})
+	return stack.Finalize.Insert(pause, "Signing", middleware.Before)
+}
+
+// backoff returns the delay before retry n, from 0: a random time up to base
+// doubled n times, at most retryMaxDelay. The jitter spreads out the retries
+// of requests that failed together.
+func backoff(n int, base time.Duration) time.Duration {
+	limit := retryMaxDelay
+	if n < 30 && base<<uint(n) < limit {
+		limit = base << uint(n)
+	}
+	return time.Duration(rand.Int63n(int64(limit))) + 1
+}
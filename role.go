@@ -0,0 +1,67 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// AssumeRole is a role requests are made as, such as to reach buckets of
+// another account, assumed with the default credentials.
+type AssumeRole struct {
+	ARN         string // of the role, or empty to use the default credentials
+	ExternalID  string // required by the role's trust policy, if any
+	SessionName string // identifying the session, generated if empty
+	MFA         *MFA   // device the role requires codes from, if any
+}
+
+// ParseAssumeRole checks the --role-arn, --external-id and
+// --role-session-name flags.
+func ParseAssumeRole(roleARN, externalID, sessionName string) (AssumeRole, error) {
+	role := AssumeRole{ARN: roleARN, ExternalID: externalID, SessionName: sessionName}
+	if roleARN == "" {
+		if externalID != "" || sessionName != "" {
+			return role, errors.New("--external-id and --role-session-name need a --role-arn")
+		}
+		return role, nil
+	}
+	if !arn.IsARN(roleARN) {
+		return role, fmt.Errorf("--role-arn %q is not an arn", roleARN)
+	}
+	return role, nil
+}
+
+// credentials returns credentials of the role, assumed through STS in
+// region with base, or the default credentials if nil, and renewed as they
+// expire. STS is called with client, or the default client if nil. It returns
+// nil without a role.
+func (role AssumeRole) credentials(ctx context.Context, region string, base aws.CredentialsProvider, client *http.Client) (aws.CredentialsProvider, error) {
+	if role.ARN == "" {
+		return nil, nil
+	}
+	cfg, err := loadConfig(ctx, client, config.WithRegion(region))
+	if err != nil {
+		return nil, err
+	}
+	if base != nil {
+		cfg.Credentials = base
+	}
+	provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), role.ARN, func(o *stscreds.AssumeRoleOptions) {
+		if role.ExternalID != "" {
+			o.ExternalID = aws.String(role.ExternalID)
+		}
+		o.RoleSessionName = role.SessionName
+		if role.MFA != nil {
+			o.SerialNumber = aws.String(role.MFA.Serial)
+			o.TokenProvider = role.MFA.roleTokenCode
+		}
+	})
+	return aws.NewCredentialsCache(provider), nil
+}
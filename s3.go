@@ -1,45 +1,61 @@
 package s3
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"crypto/md5"
+	"encoding/base64"
 	"encoding/hex"
-	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"mime"
+	"net/http"
+	"path"
 	"path/filepath"
 	"strings"
-	"time"
+	"sync"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/aws/aws-sdk-go/service/s3/s3iface"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/barnybug/s3/pkg/mys3"
 )
 
 const (
 	PART_SIZE = 6_000_000 // Has to be 5_000_000 minimim
-	RETRIES   = 2
 )
 
 type S3Filesystem struct {
 	err    error
-	conn   s3iface.S3API
+	conn   S3API
 	bucket string
 	path   string
 	mys3   mys3.Mys3
+	opts   FilesystemOptions
+	// glob pattern the keys listed must match, if any
+	pattern string
+
+	versionsMu sync.Mutex
+	versions   map[string]string
+
+	partsOnce sync.Once
+	parts     chan struct{} // slots for the parts of multipart uploads being sent
 }
 
 type S3File struct {
-	conn   s3iface.S3API
+	conn   S3API
 	bucket string
-	object *s3.Object
+	object *types.Object
 	path   string
 	md5    []byte
 	mys3   mys3.Mys3
+	// SSE-C key, if any, needed to read the object
+	encryption Encryption
+	retry      *RetryPolicy // of parts fetched corrupted
+
+	metadata map[string]string
+	encoding *string // Content-Encoding, once fetched
 }
 
 func strMd5(str string) (retMd5 string) {
@@ -48,12 +64,23 @@ func strMd5(str string) (retMd5 string) {
 	return hex.EncodeToString(h.Sum(nil))
 }
 
-func (s3f *S3File) CheckSum() (string, error) {
-	data, err := ioutil.ReadFile(s3f.path)
-	if err != nil {
-		return "", err
+func (s3f *S3File) CheckSum(ctx context.Context) (string, error) {
+	sum := s3f.MD5(ctx)
+	if sum == nil {
+		// multipart upload without a recorded checksum
+		reader, err := s3f.Reader(ctx)
+		if err != nil {
+			return "", err
+		}
+		defer reader.Close()
+		h := md5.New()
+		_, err = io.Copy(h, reader)
+		if err != nil {
+			return "", err
+		}
+		sum = h.Sum(nil)
 	}
-	return strMd5(string(data)), nil
+	return hex.EncodeToString(sum), nil
 }
 
 func (s3f *S3File) Relative() string {
@@ -68,42 +95,136 @@ func (s3f *S3File) IsDirectory() bool {
 	return strings.HasSuffix(s3f.path, "/") && *s3f.object.Size == 0
 }
 
-func (s3f *S3File) MD5() []byte {
+// MD5 returns the md5 of the object's contents. This is the ETag, except for
+// multipart uploads where the md5 recorded in metadata at upload is used, if
+// present. Returns nil if the md5 is unknown.
+func (s3f *S3File) MD5(ctx context.Context) []byte {
 	if s3f.md5 == nil {
 		etag := *s3f.object.ETag
-		v := etag[1 : len(etag)-1]
-		s3f.md5, _ = hex.DecodeString(v)
+		if multipartParts(etag) > 0 {
+			metadata, err := s3f.Metadata(ctx)
+			if err != nil {
+				return nil
+			}
+			if v := metadataValue(metadata, "md5_checksum"); v != "" {
+				s3f.md5, _ = hex.DecodeString(v)
+			}
+		} else {
+			v := etag[1 : len(etag)-1]
+			s3f.md5, _ = hex.DecodeString(v)
+		}
 	}
 	return s3f.md5
 }
 
-func (s3f *S3File) Reader() (io.ReadCloser, error) {
-	input := s3.GetObjectInput{
-		Bucket: aws.String(s3f.bucket),
-		Key:    s3f.object.Key,
+// Metadata returns the user metadata of the object, fetching it on first use
+// as listings don't include it.
+func (s3f *S3File) Metadata(ctx context.Context) (map[string]string, error) {
+	if s3f.metadata == nil {
+		input := s3.HeadObjectInput{
+			Bucket:               aws.String(s3f.bucket),
+			Key:                  s3f.object.Key,
+			SSECustomerAlgorithm: s3f.encryption.customerAlgorithm(),
+			SSECustomerKey:       s3f.encryption.customerKey(),
+			SSECustomerKeyMD5:    s3f.encryption.customerKeyMD5(),
+		}
+		output, err := s3f.conn.HeadObject(ctx, &input)
+		if err != nil {
+			return nil, err
+		}
+		s3f.metadata = output.Metadata
+		s3f.encoding = aws.String(aws.ToString(output.ContentEncoding))
+		if s3f.metadata == nil {
+			s3f.metadata = map[string]string{}
+		}
 	}
-	output, err := s3f.mys3.GetObject(&input)
+	return s3f.metadata, nil
+}
 
+// reload replaces what was listed of the object with the version there now.
+func (s3f *S3File) reload(ctx context.Context) error {
+	input := s3.HeadObjectInput{
+		Bucket:               aws.String(s3f.bucket),
+		Key:                  s3f.object.Key,
+		SSECustomerAlgorithm: s3f.encryption.customerAlgorithm(),
+		SSECustomerKey:       s3f.encryption.customerKey(),
+		SSECustomerKeyMD5:    s3f.encryption.customerKeyMD5(),
+	}
+	output, err := s3f.conn.HeadObject(ctx, &input)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	s3f.object.ETag = output.ETag
+	s3f.object.Size = aws.Int64(aws.ToInt64(output.ContentLength))
+	s3f.object.LastModified = output.LastModified
+	s3f.md5 = nil
+	s3f.metadata = output.Metadata
+	s3f.encoding = aws.String(aws.ToString(output.ContentEncoding))
+	if s3f.metadata == nil {
+		s3f.metadata = map[string]string{}
 	}
-	if onlyShow {
+	return nil
+}
 
-		out, err := json.MarshalIndent(output, "", "\t")
-		if err != nil {
-			return nil, err
+// SymlinkTarget returns the link target of an object stored as a preserved
+// symlink, or "" if it is a regular object.
+func (s3f *S3File) SymlinkTarget(ctx context.Context) string {
+	if *s3f.object.Size != 0 {
+		return ""
+	}
+	metadata, err := s3f.Metadata(ctx)
+	if err != nil {
+		return ""
+	}
+	return metadataValue(metadata, symlinkTargetKey)
+}
+
+// metadataValue looks up a user metadata key, ignoring the case changes
+// introduced by http header canonicalisation.
+func metadataValue(metadata map[string]string, key string) string {
+	for k, v := range metadata {
+		if strings.EqualFold(k, key) {
+			return v
 		}
-		fmt.Println(string(out))
 	}
+	return ""
+}
+
+func (s3f *S3File) getObject(ctx context.Context) (*s3.GetObjectOutput, error) {
+	input := s3.GetObjectInput{
+		Bucket:               aws.String(s3f.bucket),
+		Key:                  s3f.object.Key,
+		SSECustomerAlgorithm: s3f.encryption.customerAlgorithm(),
+		SSECustomerKey:       s3f.encryption.customerKey(),
+		SSECustomerKeyMD5:    s3f.encryption.customerKeyMD5(),
+	}
+	return s3f.mys3.GetObject(ctx, &input)
+}
+
+func (s3f *S3File) Reader(ctx context.Context) (io.ReadCloser, error) {
+	output, err := s3f.getObject(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s3f.encoding = aws.String(aws.ToString(output.ContentEncoding))
 	return output.Body, err
 }
 
-func (s3f *S3File) Delete() error {
+// ContentEncoding returns the Content-Encoding the object was stored with,
+// fetching it unless the object has been read.
+func (s3f *S3File) ContentEncoding(ctx context.Context) string {
+	if s3f.encoding == nil {
+		s3f.Metadata(ctx)
+	}
+	return aws.ToString(s3f.encoding)
+}
+
+func (s3f *S3File) Delete(ctx context.Context) error {
 	input := s3.DeleteObjectInput{
 		Bucket: aws.String(s3f.bucket),
 		Key:    s3f.object.Key,
 	}
-	_, err := s3f.conn.DeleteObject(&input)
+	_, err := s3f.conn.DeleteObject(ctx, &input)
 	return err
 }
 
@@ -115,7 +236,7 @@ func (s3fs *S3Filesystem) Error() error {
 	return s3fs.err
 }
 
-func (s3fs *S3Filesystem) Files() <-chan File {
+func (s3fs *S3Filesystem) Files(ctx context.Context) <-chan File {
 	ch := make(chan File, 1000)
 	stripLen := strings.LastIndex(s3fs.path, "/") + 1
 	if stripLen == -1 {
@@ -123,229 +244,475 @@ func (s3fs *S3Filesystem) Files() <-chan File {
 	}
 	go func() {
 		defer close(ch)
-		truncated := true
-		marker := ""
-		for truncated {
-			input := s3.ListObjectsInput{
-				Bucket: aws.String(s3fs.bucket),
-				Prefix: aws.String(s3fs.path),
-				Marker: aws.String(marker),
+		input := s3.ListObjectsV2Input{
+			Bucket: aws.String(s3fs.bucket),
+			Prefix: aws.String(s3fs.path),
+		}
+		pages := s3.NewListObjectsV2Paginator(s3fs.mys3, &input)
+		for pages.HasMorePages() {
+			if done(ctx) {
+				s3fs.err = ctx.Err()
+				return
 			}
-			output, err := s3fs.mys3.ListObject(&input)
+			output, err := pages.NextPage(ctx)
 			if err != nil {
 				s3fs.err = err
 				return
 			}
 			for _, c := range output.Contents {
 				key := c
+				if s3fs.pattern != "" {
+					if matched, _ := path.Match(s3fs.pattern, *key.Key); !matched {
+						continue
+					}
+				}
 				relpath := (*key.Key)[stripLen:]
-				ch <- &S3File{s3fs.conn, s3fs.bucket, key, relpath, nil, s3fs.mys3}
-				marker = *c.Key
+				err = send(ctx, ch, &S3File{conn: s3fs.conn, bucket: s3fs.bucket, object: &key, path: relpath, mys3: s3fs.mys3, encryption: s3fs.opts.Encryption, retry: s3fs.opts.Retry})
+				if err != nil {
+					s3fs.err = err
+					return
+				}
 			}
-			truncated = *output.IsTruncated
 		}
 	}()
 	return ch
 }
 
-func guessMimeType(filename string) string {
+// contentMD5 returns a hex md5 as a Content-MD5 header value.
+func contentMD5(checkSum string) *string {
+	sum, err := hex.DecodeString(checkSum)
+	if err != nil {
+		return nil
+	}
+	return aws.String(base64.StdEncoding.EncodeToString(sum))
+}
+
+// sniffLen is how much content http.DetectContentType considers.
+const sniffLen = 512
+
+// guessMimeType returns the MIME type of filename from its extension, or
+// failing that from the start of its content.
+func guessMimeType(filename string, head []byte) string {
 	ext := mime.TypeByExtension(filepath.Ext(filename))
 	if ext == "" {
-		ext = "application/binary"
+		ext = http.DetectContentType(head)
 	}
 	return ext
 }
 
-func (s3fs *S3Filesystem) Create(src File) error {
-	var fullpath string
-	if s3fs.path == "" || strings.HasSuffix(s3fs.path, "/") {
-		fullpath = filepath.Join(s3fs.path, src.Relative())
-	} else {
-		fullpath = s3fs.path
-	}
-	checkSum, err := src.CheckSum()
-	if err != nil {
-		return err
+// sniffMimeType is guessMimeType reading the content from r, returning a
+// reader of the whole content.
+func sniffMimeType(filename string, r io.Reader) (string, io.Reader) {
+	if ext := mime.TypeByExtension(filepath.Ext(filename)); ext != "" {
+		return ext, r
 	}
-	input := s3manager.UploadInput{
-		ACL:      aws.String(acl),
+	br := bufio.NewReaderSize(r, sniffLen)
+	// a short read is the whole content, and errors recur on the upload
+	head, _ := br.Peek(sniffLen)
+	return http.DetectContentType(head), br
+}
+
+// putInput returns the input putting src at fullpath with metadata: its
+// content, and the headers and metadata of src and the options. closeBody
+// closes the content once it's sent.
+func (s3fs *S3Filesystem) putInput(ctx context.Context, src File, fullpath string, metadata map[string]string) (input *s3.PutObjectInput, closeBody func(), err error) {
+	input = &s3.PutObjectInput{
 		Bucket:   aws.String(s3fs.bucket),
 		Key:      aws.String(fullpath),
-		Metadata: map[string]*string{"md5_checksum": &checkSum},
+		Metadata: metadata,
+	}
+	if s3fs.opts.ACL != "" {
+		input.ACL = types.ObjectCannedACL(s3fs.opts.ACL)
+	}
+	if lf, ok := src.(*LocalFile); ok {
+		if lf.target != "" {
+			input.Metadata[symlinkTargetKey] = lf.target
+		} else if s3fs.opts.Preserve {
+			for k, v := range posixMetadata(lf.info) {
+				input.Metadata[k] = v
+			}
+		}
 	}
 	switch t := src.(type) {
 	case *S3File:
 		// special case for S3File to preserve header information
 		getObjectInput := s3.GetObjectInput{
-			Bucket: aws.String(t.bucket),
-			Key:    t.object.Key,
+			Bucket:               aws.String(t.bucket),
+			Key:                  t.object.Key,
+			SSECustomerAlgorithm: t.encryption.customerAlgorithm(),
+			SSECustomerKey:       t.encryption.customerKey(),
+			SSECustomerKeyMD5:    t.encryption.customerKeyMD5(),
 		}
-		output, err := s3fs.mys3.GetObject(&getObjectInput)
+		output, err := s3fs.mys3.GetObject(ctx, &getObjectInput)
 		//output, err := s3fs.conn.GetObject(&getObjectInput)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
-		defer output.Body.Close()
+		closeBody = func() { output.Body.Close() }
 		input.Body = output.Body
 		// transfer existing headers across
 		input.ContentType = output.ContentType
+		input.CacheControl = output.CacheControl
+		input.ContentEncoding = output.ContentEncoding
+		input.ContentDisposition = output.ContentDisposition
 		// input.LastModified = output.LastModified
 		input.StorageClass = output.StorageClass
+		if s3fs.opts.Preserve {
+			for k, v := range output.Metadata {
+				if _, ok := input.Metadata[k]; !ok {
+					input.Metadata[k] = v
+				}
+			}
+		}
 	default:
-		reader, err := src.Reader()
+		reader, err := src.Reader(ctx)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
-		input.Body = reader
-		defer reader.Close()
-		input.ContentType = aws.String(guessMimeType(src.Relative()))
+		closeBody = func() { reader.Close() }
+		var contentType string
+		contentType, input.Body = sniffMimeType(src.Relative(), reader)
+		input.ContentType = aws.String(contentType)
 	}
-	_, err = s3fs.mys3.Upload(&input)
-	return err
+	if s3fs.opts.ContentType != "" {
+		input.ContentType = aws.String(s3fs.opts.ContentType)
+	}
+	if s3fs.opts.Tagging != "" {
+		input.Tagging = aws.String(s3fs.opts.Tagging)
+	}
+	if s3fs.opts.StorageClass != "" {
+		input.StorageClass = types.StorageClass(s3fs.opts.StorageClass)
+	}
+	s3fs.opts.Headers.apply(&input.CacheControl, &input.ContentEncoding, &input.ContentDisposition)
+	s3fs.opts.ObjectLock.apply(&input.ObjectLockMode, &input.ObjectLockRetainUntilDate, &input.ObjectLockLegalHoldStatus)
+	input.ServerSideEncryption = s3fs.opts.Encryption.algorithm()
+	input.SSEKMSKeyId = s3fs.opts.Encryption.keyID()
+	input.SSECustomerAlgorithm = s3fs.opts.Encryption.customerAlgorithm()
+	input.SSECustomerKey = s3fs.opts.Encryption.customerKey()
+	input.SSECustomerKeyMD5 = s3fs.opts.Encryption.customerKeyMD5()
+	return input, closeBody, nil
 }
 
-func (s3fs *S3Filesystem) CreateMultiPart(src File, buffer []byte) error {
+func (s3fs *S3Filesystem) Create(ctx context.Context, src File) error {
 	var fullpath string
 	if s3fs.path == "" || strings.HasSuffix(s3fs.path, "/") {
 		fullpath = filepath.Join(s3fs.path, src.Relative())
 	} else {
 		fullpath = s3fs.path
 	}
-	input := s3manager.UploadInput{
-		ACL:    aws.String(acl),
-		Bucket: aws.String(s3fs.bucket),
-		Key:    aws.String(fullpath),
+	checkSum, err := src.CheckSum(ctx)
+	if err != nil {
+		return err
 	}
-	checkSum, err := src.CheckSum()
+	input, closeBody, err := s3fs.putInput(ctx, src, fullpath, map[string]string{"md5_checksum": checkSum})
 	if err != nil {
 		return err
 	}
-	switch t := src.(type) {
-	case *S3File:
-		// special case for S3File to preserve header information
-		getObjectInput := s3.GetObjectInput{
-			Bucket: aws.String(t.bucket),
-			Key:    t.object.Key,
-		}
-		output, err := s3fs.mys3.GetObject(&getObjectInput)
-		//output, err := s3fs.conn.GetObject(&getObjectInput)
+	defer closeBody()
+	if _, ok := src.(*LocalFile); ok && src.Size() < s3fs.opts.Parts.UploadSize() {
+		// so S3 rejects the upload if it isn't what was checksummed; only
+		// single requests carry it, and an s3 source's etag may not be its md5
+		input.ContentMD5 = contentMD5(checkSum)
+	}
+	var options []func(*s3.Options)
+	if algorithm := s3fs.opts.ChecksumAlgorithm; algorithm != "" {
+		sum, err := fileChecksum(ctx, src, algorithm)
 		if err != nil {
 			return err
 		}
-		defer output.Body.Close()
-		input.Body = output.Body
-		// transfer existing headers across
-		input.ContentType = output.ContentType
-		// input.LastModified = output.LastModified
-		input.StorageClass = output.StorageClass
-	default:
-		reader, err := src.Reader()
+		input.Metadata[checksumMetadataKey(algorithm)] = sum
+		options = append(options, checksumHeader(algorithm, sum))
+	}
+	input.Body = readContext(ctx, s3fs.opts.Progress.wrap(src, input.Body))
+	output, err := s3fs.mys3.Upload(ctx, input, s3fs.opts.Parts, options...)
+	if err != nil {
+		return err
+	}
+	if s3fs.opts.Visibility > 0 {
+		err = s3fs.waitVisible(ctx, src, fullpath, src.Size(), checkSum)
 		if err != nil {
 			return err
 		}
-		input.Body = reader
-		defer reader.Close()
-		input.ContentType = aws.String(guessMimeType(src.Relative()))
 	}
+	if output.VersionID != nil {
+		s3fs.versionsMu.Lock()
+		defer s3fs.versionsMu.Unlock()
+		if s3fs.versions == nil {
+			s3fs.versions = map[string]string{}
+		}
+		s3fs.versions[src.Relative()] = *output.VersionID
+	}
+	return nil
+}
 
-	expiryDate := time.Now().AddDate(0, 0, 1)
-	createdResp, err := s3fs.mys3.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
-		Bucket:   aws.String(s3fs.bucket),
-		Key:      aws.String(fullpath),
-		Metadata: map[string]*string{"md5_checksum": &checkSum},
-		Expires:  &expiryDate,
+// VersionID returns the version id assigned to the file last created at path,
+// if the bucket is versioned.
+func (s3fs *S3Filesystem) VersionID(path string) string {
+	s3fs.versionsMu.Lock()
+	defer s3fs.versionsMu.Unlock()
+	return s3fs.versions[path]
+}
+
+// partSize returns the part size of CreateMultiPart.
+func (s3fs *S3Filesystem) partSize() int64 {
+	if s3fs.opts.Parts.Size > 0 {
+		return s3fs.opts.Parts.Size
+	}
+	return PART_SIZE
+}
+
+// partSlots returns the semaphore bounding the parts CreateMultiPart sends
+// at once, across all the files being uploaded: --part-concurrency if given,
+// otherwise as many as the operations run in parallel.
+func (s3fs *S3Filesystem) partSlots() chan struct{} {
+	s3fs.partsOnce.Do(func() {
+		n := s3fs.opts.Parts.Concurrency
+		if n <= 0 {
+			n = s3fs.opts.PartParallel
+		}
+		if n <= 0 {
+			n = 1
+		}
+		s3fs.parts = make(chan struct{}, n)
 	})
+	return s3fs.parts
+}
+
+// CreateMultiPart uploads src in explicit parts, which records the checksum
+// of each part for downloads to verify. The parts are read from src in turn
+// and sent concurrently, so only those being sent are held in memory however
+// large src is. The ETag S3 returns for each part is checked against its
+// md5, and that of the completed upload against the parts.
+func (s3fs *S3Filesystem) CreateMultiPart(ctx context.Context, src File) error {
+	var fullpath string
+	if s3fs.path == "" || strings.HasSuffix(s3fs.path, "/") {
+		fullpath = filepath.Join(s3fs.path, src.Relative())
+	} else {
+		fullpath = s3fs.path
+	}
+	checkSum, err := src.CheckSum(ctx)
 	if err != nil {
 		return err
 	}
-	var start, currentSize int
-	var remaining = int(src.Size())
+	// the part checksums are recorded as the upload is created, so are
+	// computed by a pass over src before it's read for the parts
+	partSize := s3fs.partSize()
+	metadata, partSums, err := partMetadata(ctx, src, partSize, s3fs.opts.ChecksumAlgorithm)
+	if err != nil {
+		return err
+	}
+	metadata["md5_checksum"] = checkSum
+	input, closeBody, err := s3fs.putInput(ctx, src, fullpath, metadata)
+	if err != nil {
+		return err
+	}
+	defer closeBody()
+	createInput := s3.CreateMultipartUploadInput{
+		Bucket:                    input.Bucket,
+		Key:                       input.Key,
+		Metadata:                  input.Metadata,
+		ACL:                       input.ACL,
+		ContentType:               input.ContentType,
+		CacheControl:              input.CacheControl,
+		ContentEncoding:           input.ContentEncoding,
+		ContentDisposition:        input.ContentDisposition,
+		StorageClass:              input.StorageClass,
+		Tagging:                   input.Tagging,
+		ObjectLockMode:            input.ObjectLockMode,
+		ObjectLockRetainUntilDate: input.ObjectLockRetainUntilDate,
+		ObjectLockLegalHoldStatus: input.ObjectLockLegalHoldStatus,
+		ServerSideEncryption:      input.ServerSideEncryption,
+		SSEKMSKeyId:               input.SSEKMSKeyId,
+		SSECustomerAlgorithm:      input.SSECustomerAlgorithm,
+		SSECustomerKey:            input.SSECustomerKey,
+		SSECustomerKeyMD5:         input.SSECustomerKeyMD5,
+	}
+	var createdResp *s3.CreateMultipartUploadOutput
+	var resumed map[int64]*types.CompletedPart
+	if s3fs.opts.Resume {
+		createdResp, resumed, err = s3fs.resumableUpload(ctx, fullpath, partSums)
+		if err != nil {
+			return err
+		}
+	}
+	if createdResp == nil {
+		createdResp, err = s3fs.mys3.CreateMultipartUpload(ctx, &createInput)
+		if err != nil {
+			return err
+		}
+	}
+	abort := func() {
+		if s3fs.opts.Resume {
+			// left for the parts sent to be resumed from
+			return
+		}
+		// even once ctx is done, so an interrupted upload isn't left behind
+		s3fs.mys3.AbortMultipartUpload(context.Background(), &s3.AbortMultipartUploadInput{
+			Bucket:   createdResp.Bucket,
+			Key:      createdResp.Key,
+			UploadId: createdResp.UploadId,
+		})
+	}
+	// parts are read in turn, and sent concurrently, holding a slot each
+	// while read and sent so only as many parts as slots are in memory
+	slots := s3fs.partSlots()
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var sendErr error
+	failed := func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		return sendErr
+	}
+	var currentSize int64
+	var remaining = src.Size()
 	var partNum = 1
-	var completedParts []*s3.CompletedPart
-	// Loop till remaining upload size is 0
-	for start = 0; remaining != 0; start += PART_SIZE {
-		if remaining < PART_SIZE {
+	var completedParts []*types.CompletedPart
+	// Loop till remaining upload size is 0, or a part fails
+	for remaining != 0 && failed() == nil {
+		if done(ctx) {
+			wg.Wait()
+			abort()
+			return ctx.Err()
+		}
+		if remaining < partSize {
 			currentSize = remaining
 		} else {
-			currentSize = PART_SIZE
+			currentSize = partSize
 		}
 
-		completed, err := Upload(s3fs.mys3, createdResp, buffer[start:start+currentSize], partNum)
-		// If upload function failed (meaning it retried acoording to RETRIES)
+		slots <- struct{}{}
+		part := make([]byte, currentSize)
+		_, err := io.ReadFull(input.Body, part)
 		if err != nil {
-			_, err = s3fs.mys3.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
-				Bucket:   createdResp.Bucket,
-				Key:      createdResp.Key,
-				UploadId: createdResp.UploadId,
-			})
-			if err != nil {
-				// god speed
-
-				return err
-			}
+			<-slots
+			wg.Wait()
+			abort()
+			return err
+		}
+		if completed, ok := resumed[int64(partNum)]; ok {
+			<-slots
+			completedParts = append(completedParts, completed)
+		} else {
+			// filled in once sent
+			completed := &types.CompletedPart{PartNumber: aws.Int32(int32(partNum))}
+			completedParts = append(completedParts, completed)
+			wg.Add(1)
+			go func(part []byte, partNum int) {
+				defer wg.Done()
+				defer func() { <-slots }()
+				sent, err := Upload(ctx, s3fs.mys3, createdResp, part, partNum, s3fs.opts.Encryption, s3fs.opts.Retry)
+				mu.Lock()
+				defer mu.Unlock()
+				// If upload function failed (meaning it retried acoording to the policy)
+				if err != nil {
+					if sendErr == nil {
+						sendErr = err
+					}
+					return
+				}
+				completed.ETag = sent.ETag
+			}(part, partNum)
 		}
 
 		// Detract the current part size from remaining
 		remaining -= currentSize
-		fmt.Printf("Part %v complete, %v btyes remaining\n", partNum, remaining)
-
-		// Add the completed part to our list
-		completedParts = append(completedParts, completed)
 		partNum++
-
 	}
-	_, err = s3fs.mys3.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+	wg.Wait()
+	if sendErr != nil {
+		abort()
+		return sendErr
+	}
+	completedResp, err := s3fs.mys3.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
 		Bucket:   createdResp.Bucket,
 		Key:      createdResp.Key,
 		UploadId: createdResp.UploadId,
-		MultipartUpload: &s3.CompletedMultipartUpload{
-			Parts: completedParts,
+		MultipartUpload: &types.CompletedMultipartUpload{
+			Parts: completedPartValues(completedParts),
 		},
 	})
 	if err != nil {
+		abort()
 		return err
 	}
+	if len(partSums) > 0 && s3fs.opts.Encryption.md5ETags() {
+		// the ETag of the whole is derived from those of the parts, so
+		// checks that the parts assembled are those sent
+		expected, err := compositeETag(partSums)
+		if err != nil {
+			return err
+		}
+		if etag := strings.Trim(aws.ToString(completedResp.ETag), `"`); etag != expected {
+			return fmt.Errorf("%s: ETag %s of the completed upload does not match %s computed from its parts", src.Relative(), etag, expected)
+		}
+	}
+	if s3fs.opts.Visibility > 0 {
+		return s3fs.waitVisible(ctx, src, fullpath, src.Size(), checkSum)
+	}
 	return nil
 }
 
-func (s3fs *S3Filesystem) Delete(path string) error {
-	fullpath := filepath.Join(s3fs.path, path)
+// completedPartValues returns the parts of an upload to complete it with.
+func completedPartValues(parts []*types.CompletedPart) []types.CompletedPart {
+	values := make([]types.CompletedPart, len(parts))
+	for i, part := range parts {
+		values[i] = *part
+	}
+	return values
+}
+
+// keyOf returns the key of path, relative to the filesystem.
+func (s3fs *S3Filesystem) keyOf(path string) string {
+	return filepath.Join(s3fs.path, path)
+}
+
+func (s3fs *S3Filesystem) Delete(ctx context.Context, path string) error {
 	input := s3.DeleteObjectInput{
 		Bucket: aws.String(s3fs.bucket),
-		Key:    aws.String(fullpath),
+		Key:    aws.String(s3fs.keyOf(path)),
 	}
-	_, err := s3fs.conn.DeleteObject(&input)
+	_, err := s3fs.conn.DeleteObject(ctx, &input)
 	return err
 }
 
-func Upload(mys3 mys3.Mys3, resp *s3.CreateMultipartUploadOutput, fileBytes []byte, partNum int) (completedPart *s3.CompletedPart, err error) {
-	var try int
-	for try <= RETRIES {
-		uploadResp, err := mys3.UploadPart(&s3.UploadPartInput{
+// Upload sends a part of a multipart upload. A part stored otherwise than
+// sent is sent again, as often as retry allows, failed requests being
+// retried by the client.
+func Upload(ctx context.Context, mys3 mys3.Mys3, resp *s3.CreateMultipartUploadOutput, fileBytes []byte, partNum int, encryption Encryption, retry *RetryPolicy) (completedPart *types.CompletedPart, err error) {
+	sum := md5.Sum(fileBytes)
+	for try := 0; ; try++ {
+		uploadResp, err := mys3.UploadPart(ctx, &s3.UploadPartInput{
 			Body:          bytes.NewReader(fileBytes),
 			Bucket:        resp.Bucket,
 			Key:           resp.Key,
-			PartNumber:    aws.Int64(int64(partNum)),
+			PartNumber:    aws.Int32(int32(partNum)),
 			UploadId:      resp.UploadId,
 			ContentLength: aws.Int64(int64(len(fileBytes))),
+			ContentMD5:    aws.String(base64.StdEncoding.EncodeToString(sum[:])),
+			// parts are encrypted with the key the upload was created with
+			SSECustomerAlgorithm: encryption.customerAlgorithm(),
+			SSECustomerKey:       encryption.customerKey(),
+			SSECustomerKeyMD5:    encryption.customerKeyMD5(),
 		})
-		// Upload failed
 		if err != nil {
-			// Max retries reached! Quitting
-			if try == RETRIES {
+			return nil, err
+		}
+		// the ETag of a part is its md5 as stored, so a mismatch means it
+		// was stored otherwise than sent and is sent again
+		if etag := strings.Trim(aws.ToString(uploadResp.ETag), `"`); encryption.md5ETags() && etag != hex.EncodeToString(sum[:]) {
+			err = fmt.Errorf("part %d: ETag %s does not match md5 %x", partNum, etag, sum)
+			if try == retry.MaxRetries() {
 				return nil, err
-			} else {
-				// Retrying
-				try++
 			}
-		} else {
-			// Upload is done!
-			return &s3.CompletedPart{
-				ETag:       uploadResp.ETag,
-				PartNumber: aws.Int64(int64(partNum)),
-			}, nil
+			if err := retry.wait(ctx, try); err != nil {
+				return nil, err
+			}
+			continue
 		}
+		return &types.CompletedPart{
+			ETag:       uploadResp.ETag,
+			PartNumber: aws.Int32(int32(partNum)),
+		}, nil
 	}
-
-	return nil, nil
 }
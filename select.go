@@ -0,0 +1,133 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// selectExts are the extensions of the keys grep --select searches with S3
+// Select, csv and json lines, before any .gz.
+var selectExts = map[string]bool{
+	".csv":    true,
+	".tsv":    true,
+	".json":   true,
+	".jsonl":  true,
+	".ndjson": true,
+}
+
+// Select reads each line of a key whole, as the only column of a csv with
+// control characters for its delimiter, quote and comments, so a pattern
+// matches the line as grep would and the lines selected are returned as
+// stored.
+const (
+	selectDelimiter = "\x1f"
+	selectQuote     = "\x1e"
+	selectComment   = "\x1d"
+)
+
+// selectable returns the key of file if it's searched with S3 Select by
+// grep --select.
+func selectable(file File) (*S3File, bool) {
+	s3f, ok := file.(*S3File)
+	if !ok {
+		return nil, false
+	}
+	name := strings.TrimSuffix(aws.ToString(s3f.object.Key), gzipExt)
+	return s3f, selectExts[strings.ToLower(path.Ext(name))]
+}
+
+// selectExpression returns the S3 Select SQL choosing the lines containing
+// needle, or not containing it if invert.
+func selectExpression(needle string, invert bool) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`, `'`, `''`).Replace(needle)
+	like := "LIKE"
+	if invert {
+		like = "NOT LIKE"
+	}
+	return "SELECT s._1 FROM S3Object s WHERE s._1 " + like + " '%" + escaped + "%' ESCAPE '\\'"
+}
+
+// selectLines returns a reader of the lines of s3f containing needle, or
+// not containing it if invert, filtered by S3 Select so only they're fetched.
+func selectLines(ctx context.Context, s3f *S3File, needle string, invert bool, mode DecompressMode) (io.ReadCloser, error) {
+	compression := types.CompressionTypeNone
+	if mode.applies(ctx, s3f) {
+		compression = types.CompressionTypeGzip
+	}
+	input := s3.SelectObjectContentInput{
+		Bucket:         aws.String(s3f.bucket),
+		Key:            s3f.object.Key,
+		Expression:     aws.String(selectExpression(needle, invert)),
+		ExpressionType: types.ExpressionTypeSql,
+		InputSerialization: &types.InputSerialization{
+			CompressionType: compression,
+			CSV: &types.CSVInput{
+				FileHeaderInfo:       types.FileHeaderInfoNone,
+				FieldDelimiter:       aws.String(selectDelimiter),
+				QuoteCharacter:       aws.String(selectQuote),
+				QuoteEscapeCharacter: aws.String(selectQuote),
+				Comments:             aws.String(selectComment),
+				RecordDelimiter:      aws.String("\n"),
+			},
+		},
+		OutputSerialization: &types.OutputSerialization{
+			CSV: &types.CSVOutput{
+				FieldDelimiter:  aws.String(selectDelimiter),
+				QuoteCharacter:  aws.String(selectQuote),
+				QuoteFields:     types.QuoteFieldsAsneeded,
+				RecordDelimiter: aws.String("\n"),
+			},
+		},
+
+		SSECustomerAlgorithm: s3f.encryption.customerAlgorithm(),
+		SSECustomerKey:       s3f.encryption.customerKey(),
+		SSECustomerKeyMD5:    s3f.encryption.customerKeyMD5(),
+	}
+	output, err := s3f.conn.SelectObjectContent(ctx, &input)
+	if err != nil {
+		return nil, err
+	}
+	return &selectReader{stream: output.GetStream()}, nil
+}
+
+// selectReader reads the records of an S3 Select response.
+type selectReader struct {
+	stream *s3.SelectObjectContentEventStream
+	buf    []byte // of the records event being read
+	ended  bool
+}
+
+func (sr *selectReader) Read(p []byte) (int, error) {
+	for len(sr.buf) == 0 {
+		event, ok := <-sr.stream.Events()
+		if !ok {
+			if err := sr.stream.Err(); err != nil {
+				return 0, err
+			}
+			if !sr.ended {
+				return 0, errors.New("S3 Select response ended early")
+			}
+			return 0, io.EOF
+		}
+		switch e := event.(type) {
+		case *types.SelectObjectContentEventStreamMemberRecords:
+			sr.buf = e.Value.Payload
+		case *types.SelectObjectContentEventStreamMemberEnd:
+			sr.ended = true
+		}
+	}
+	n := copy(p, sr.buf)
+	sr.buf = sr.buf[n:]
+	return n, nil
+}
+
+func (sr *selectReader) Close() error {
+	return sr.stream.Close()
+}
@@ -0,0 +1,107 @@
+package s3
+
+import (
+	"container/heap"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// ListSort orders the keys ls lists.
+type ListSort int
+
+const (
+	SortNone  ListSort = iota // as listed
+	SortName                  // by name, a to z
+	SortSize                  // biggest first
+	SortMtime                 // newest first
+)
+
+// ParseListSort parses a --sort value: name, size or mtime.
+func ParseListSort(value string) (ListSort, error) {
+	switch value {
+	case "":
+		return SortNone, nil
+	case "name":
+		return SortName, nil
+	case "size":
+		return SortSize, nil
+	case "mtime":
+		return SortMtime, nil
+	}
+	return SortNone, fmt.Errorf("invalid --sort %q: expected name, size or mtime", value)
+}
+
+// modTime returns when file was last modified.
+func modTime(file File) time.Time {
+	switch f := file.(type) {
+	case *S3File:
+		return aws.ToTime(f.object.LastModified)
+	case *LocalFile:
+		return f.info.ModTime()
+	}
+	return time.Time{}
+}
+
+// before returns whether a is listed before b, ties going by name.
+func (order ListSort) before(a, b File) bool {
+	switch order {
+	case SortSize:
+		if a.Size() != b.Size() {
+			return a.Size() > b.Size()
+		}
+	case SortMtime:
+		if ta, tb := modTime(a), modTime(b); !ta.Equal(tb) {
+			return ta.After(tb)
+		}
+	}
+	return a.String() < b.String()
+}
+
+// sortedFiles collects files in order. With a max, only the first max are
+// kept, ranked in a heap with the last of them on top, so the biggest or
+// newest of a huge listing take memory for just those.
+type sortedFiles struct {
+	before func(a, b File) bool
+	max    int
+	files  []File
+}
+
+func newSortedFiles(order ListSort, reverse bool, max int) *sortedFiles {
+	before := order.before
+	if reverse {
+		before = func(a, b File) bool { return order.before(b, a) }
+	}
+	return &sortedFiles{before: before, max: max}
+}
+
+func (sf *sortedFiles) Len() int           { return len(sf.files) }
+func (sf *sortedFiles) Less(i, j int) bool { return sf.before(sf.files[j], sf.files[i]) }
+func (sf *sortedFiles) Swap(i, j int)      { sf.files[i], sf.files[j] = sf.files[j], sf.files[i] }
+func (sf *sortedFiles) Push(x interface{}) { sf.files = append(sf.files, x.(File)) }
+func (sf *sortedFiles) Pop() interface{} {
+	last := sf.files[len(sf.files)-1]
+	sf.files = sf.files[:len(sf.files)-1]
+	return last
+}
+
+// add collects file, unless there are already max files before it.
+func (sf *sortedFiles) add(file File) {
+	switch {
+	case sf.max <= 0:
+		sf.files = append(sf.files, file)
+	case len(sf.files) < sf.max:
+		heap.Push(sf, file)
+	case sf.before(file, sf.files[0]):
+		sf.files[0] = file
+		heap.Fix(sf, 0)
+	}
+}
+
+// sorted returns the files collected, in order.
+func (sf *sortedFiles) sorted() []File {
+	sort.Slice(sf.files, func(i, j int) bool { return sf.before(sf.files[i], sf.files[j]) })
+	return sf.files
+}
@@ -0,0 +1,247 @@
+package s3
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ssooidc"
+	"github.com/aws/aws-sdk-go-v2/service/ssooidc/types"
+)
+
+// sharedFile returns the path of a shared aws file, ~/.aws/name unless set by
+// the environment variable env.
+func sharedFile(env, name string) string {
+	if path := os.Getenv(env); path != "" {
+		return path
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".aws", name)
+}
+
+// loadProfile returns the settings of a profile of the shared config and
+// credentials files, failing if it's in neither.
+func loadProfile(name string) (map[string]string, error) {
+	settings := map[string]string{}
+	found := false
+	for _, file := range []struct{ path, section string }{
+		{sharedFile("AWS_SHARED_CREDENTIALS_FILE", "credentials"), name},
+		{sharedFile("AWS_CONFIG_FILE", "config"), "profile " + name},
+	} {
+		section := file.section
+		if name == "default" {
+			section = name
+		}
+		ok, err := readProfileSection(file.path, section, settings)
+		if err != nil {
+			return nil, err
+		}
+		found = found || ok
+	}
+	if !found {
+		return nil, fmt.Errorf("profile %q not found", name)
+	}
+	return settings, nil
+}
+
+// readProfileSection adds the key = value settings of section of the ini
+// file at path to settings, reporting whether it has the section.
+func readProfileSection(path, section string, settings map[string]string) (bool, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	found, in := false, false
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			in = strings.Join(strings.Fields(line[1:len(line)-1]), " ") == section
+			found = found || in
+		case in:
+			if eq := strings.IndexByte(line, '='); eq != -1 {
+				settings[strings.TrimSpace(line[:eq])] = strings.TrimSpace(line[eq+1:])
+			}
+		}
+	}
+	return found, scanner.Err()
+}
+
+// profileCredentials returns the credentials of a profile of the shared
+// config and credentials files, or nil without one. A profile signing in to
+// AWS SSO (IAM Identity Center) is first logged in with ssoLogin if its
+// cached token has expired. Requests are made with client, or the default
+// client if nil.
+func profileCredentials(ctx context.Context, name, region string, client *http.Client) (aws.CredentialsProvider, error) {
+	if name == "" {
+		return nil, nil
+	}
+	settings, err := loadProfile(name)
+	if err != nil {
+		return nil, err
+	}
+	if startURL := settings["sso_start_url"]; startURL != "" {
+		cfg, err := loadConfig(ctx, client,
+			config.WithRegion(settings["sso_region"]),
+			config.WithCredentialsProvider(aws.AnonymousCredentials{}))
+		if err != nil {
+			return nil, err
+		}
+		err = ssoLogin(ctx, ssooidc.NewFromConfig(cfg), startURL, settings["sso_region"], errOutOf(ctx), time.Second)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// with client, for the credentials of the profile's role
+	cfg, err := loadConfig(ctx, client, config.WithRegion(region), config.WithSharedConfigProfile(name))
+	if err != nil {
+		return nil, err
+	}
+	return cfg.Credentials, nil
+}
+
+// SSOOIDCAPI is the operations of the AWS SSO OIDC client a login makes, as
+// *ssooidc.Client makes them.
+type SSOOIDCAPI interface {
+	RegisterClient(ctx context.Context, input *ssooidc.RegisterClientInput, optFns ...func(*ssooidc.Options)) (*ssooidc.RegisterClientOutput, error)
+	StartDeviceAuthorization(ctx context.Context, input *ssooidc.StartDeviceAuthorizationInput, optFns ...func(*ssooidc.Options)) (*ssooidc.StartDeviceAuthorizationOutput, error)
+	CreateToken(ctx context.Context, input *ssooidc.CreateTokenInput, optFns ...func(*ssooidc.Options)) (*ssooidc.CreateTokenOutput, error)
+}
+
+// ssoToken is an AWS SSO access token, cached as the aws cli and sdks do.
+type ssoToken struct {
+	StartURL    string `json:"startUrl"`
+	Region      string `json:"region"`
+	AccessToken string `json:"accessToken"`
+	ExpiresAt   string `json:"expiresAt"` // RFC3339
+}
+
+// ssoTokenPath returns where the token of the portal at startURL is cached.
+func ssoTokenPath(startURL string) string {
+	sum := sha1.Sum([]byte(startURL))
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".aws", "sso", "cache", hex.EncodeToString(sum[:])+".json")
+}
+
+// ssoLoginMargin is how long a cached token must have left to be used
+// rather than logging in again.
+const ssoLoginMargin = time.Minute
+
+// SSOLogin logs in the profile of the shared config file to AWS SSO with
+// client, as commands using the profile do, unless its cached token is still
+// valid. The user is shown where to confirm the login on prompt. The polling
+// intervals client gives are in units of second, time.Second but for a mock.
+func SSOLogin(ctx context.Context, profile string, client SSOOIDCAPI, prompt io.Writer, second time.Duration) error {
+	settings, err := loadProfile(profile)
+	if err != nil {
+		return err
+	}
+	startURL := settings["sso_start_url"]
+	if startURL == "" {
+		return fmt.Errorf("profile %q doesn't sign in with AWS SSO", profile)
+	}
+	return ssoLogin(ctx, client, startURL, settings["sso_region"], prompt, second)
+}
+
+// ssoLogin logs in to the AWS SSO portal at startURL with the device code
+// flow, as aws sso login does, unless a cached token is still valid. The
+// user is shown where to confirm the login on prompt, and the token is
+// cached where the sdk reads it. The service's intervals are in units of
+// second.
+func ssoLogin(ctx context.Context, client SSOOIDCAPI, startURL, region string, prompt io.Writer, second time.Duration) error {
+	path := ssoTokenPath(startURL)
+	if data, err := ioutil.ReadFile(path); err == nil {
+		var cached ssoToken
+		if json.Unmarshal(data, &cached) == nil {
+			expires, err := time.Parse(time.RFC3339, cached.ExpiresAt)
+			if err == nil && time.Until(expires) > ssoLoginMargin {
+				return nil
+			}
+		}
+	}
+
+	registration, err := client.RegisterClient(ctx, &ssooidc.RegisterClientInput{
+		ClientName: aws.String("s3"),
+		ClientType: aws.String("public"),
+	})
+	if err != nil {
+		return err
+	}
+	auth, err := client.StartDeviceAuthorization(ctx, &ssooidc.StartDeviceAuthorizationInput{
+		ClientId:     registration.ClientId,
+		ClientSecret: registration.ClientSecret,
+		StartUrl:     aws.String(startURL),
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(prompt, "Log in to AWS SSO at %s and confirm the code %s\n", aws.ToString(auth.VerificationUriComplete), aws.ToString(auth.UserCode))
+
+	interval := time.Duration(auth.Interval) * second
+	if interval <= 0 {
+		interval = 5 * second
+	}
+	deadline := time.Now().Add(time.Duration(auth.ExpiresIn) * second)
+	for {
+		timer := time.NewTimer(interval)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+		token, err := client.CreateToken(ctx, &ssooidc.CreateTokenInput{
+			ClientId:     registration.ClientId,
+			ClientSecret: registration.ClientSecret,
+			DeviceCode:   auth.DeviceCode,
+			GrantType:    aws.String("urn:ietf:params:oauth:grant-type:device_code"),
+		})
+		if time.Now().Before(deadline) {
+			var pending *types.AuthorizationPendingException
+			var slowDown *types.SlowDownException
+			switch {
+			case errors.As(err, &pending):
+				continue
+			case errors.As(err, &slowDown):
+				interval += 5 * second
+				continue
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("AWS SSO login failed: %s", err)
+		}
+		cached := ssoToken{
+			StartURL:    startURL,
+			Region:      region,
+			AccessToken: aws.ToString(token.AccessToken),
+			ExpiresAt:   time.Now().Add(time.Duration(token.ExpiresIn) * time.Second).UTC().Format(time.RFC3339),
+		}
+		data, err := json.Marshal(cached)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return err
+		}
+		return ioutil.WriteFile(path, data, 0600)
+	}
+}
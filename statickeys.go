@@ -0,0 +1,74 @@
+package s3
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+)
+
+// StaticKeys are credentials given outright, by --access-key, --secret-key
+// and --session-token or the files of their -file variants, such as for
+// self-hosted endpoints, in place of those of the shared aws files.
+type StaticKeys struct {
+	AccessKey    string
+	SecretKey    string
+	SessionToken string // of temporary credentials, if any
+}
+
+// ParseStaticKeys checks the --access-key, --secret-key and --session-token
+// flags, each given either by value or by the file of its -file variant. It
+// returns nil without keys.
+func ParseStaticKeys(accessKey, accessKeyFile, secretKey, secretKeyFile, sessionToken, sessionTokenFile string) (*StaticKeys, error) {
+	var keys StaticKeys
+	for _, key := range []struct {
+		flag        string
+		value, file string
+		dest        *string
+	}{
+		{"access-key", accessKey, accessKeyFile, &keys.AccessKey},
+		{"secret-key", secretKey, secretKeyFile, &keys.SecretKey},
+		{"session-token", sessionToken, sessionTokenFile, &keys.SessionToken},
+	} {
+		value, err := flagOrFile(key.flag, key.value, key.file)
+		if err != nil {
+			return nil, err
+		}
+		*key.dest = value
+	}
+	if keys == (StaticKeys{}) {
+		return nil, nil
+	}
+	if keys.AccessKey == "" || keys.SecretKey == "" {
+		return nil, errors.New("--access-key and --secret-key must be given together")
+	}
+	return &keys, nil
+}
+
+// flagOrFile returns the value of the flag name, or else the contents of the
+// file of its -file variant, trimmed of surrounding space.
+func flagOrFile(name, value, file string) (string, error) {
+	if file == "" {
+		return value, nil
+	}
+	if value != "" {
+		return "", fmt.Errorf("--%s and --%s-file can't be used together", name, name)
+	}
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("--%s-file: %s", name, err)
+	}
+	value = strings.TrimSpace(string(content))
+	if value == "" {
+		return "", fmt.Errorf("--%s-file %q is empty", name, file)
+	}
+	return value, nil
+}
+
+// provider returns the keys as credentials.
+func (keys *StaticKeys) provider() aws.CredentialsProvider {
+	return credentials.NewStaticCredentialsProvider(keys.AccessKey, keys.SecretKey, keys.SessionToken)
+}
@@ -0,0 +1,102 @@
+package s3
+
+import (
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/barnybug/s3/pkg/mys3"
+)
+
+// streamArg stands for standard input as a put source, or standard output
+// as a get destination.
+const streamArg = "-"
+
+// getStream writes the contents of the keys under each url to the output in
+// turn, without temporary files.
+func getStream(ctx context.Context, conn S3API, mys3Conn mys3.Mys3, urls []string, opts GetOptions) error {
+	return iterateKeysParallel(ctx, conn, urls, 1, opts.FilesystemOptions, func(file File) error {
+		if file.IsDirectory() {
+			return nil
+		}
+		if opts.Decompress.applies(ctx, file) {
+			reader, err := file.Reader(ctx)
+			if err != nil {
+				return err
+			}
+			defer reader.Close()
+			reader, err = decompressReader(ctx, reader, file, opts.Decompress)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(outOf(ctx), reader)
+			return err
+		}
+		hash := md5.New()
+		_, err := download(ctx, file, io.MultiWriter(outOf(ctx), hash), opts.Ranges)
+		if err == nil && !opts.NoVerify {
+			err = checkMD5(ctx, file, hash.Sum(nil))
+		}
+		return err
+	}, mys3Conn)
+}
+
+// putStream uploads r, of unknown length, to the destination key. The
+// uploader reads a part at a time, switching to a multipart upload for
+// streams longer than a part, so r is never held in memory whole.
+func putStream(ctx context.Context, mys3Conn mys3.Mys3, r io.Reader, destination string, opts PutOptions) error {
+	if !isS3Url(destination) {
+		return errors.New("s3:// url required for destination")
+	}
+	bucket, key := extractBucketPath(destination)
+	if key == "" || strings.HasSuffix(key, "/") {
+		return errors.New("a destination key is required to put from standard input")
+	}
+	if r == nil {
+		return errors.New("no standard input to put")
+	}
+	if opts.ChecksumAlgorithm != "" {
+		// the checksum is sent ahead of the content
+		return errors.New("--checksum-algorithm can't be used putting standard input")
+	}
+	if !opts.Quiet {
+		fmt.Fprintf(outOf(ctx), "A %s\n", streamArg)
+	}
+	contentType, body := sniffMimeType(key, r)
+	if opts.ContentType != "" {
+		contentType = opts.ContentType
+	}
+	input := s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		Body:        body,
+		ContentType: aws.String(contentType),
+	}
+	if opts.ACL != "" {
+		input.ACL = types.ObjectCannedACL(opts.ACL)
+	}
+	if opts.StorageClass != "" {
+		input.StorageClass = types.StorageClass(opts.StorageClass)
+	}
+	if opts.Tagging != "" {
+		input.Tagging = aws.String(opts.Tagging)
+	}
+	opts.Headers.apply(&input.CacheControl, &input.ContentEncoding, &input.ContentDisposition)
+	opts.ObjectLock.apply(&input.ObjectLockMode, &input.ObjectLockRetainUntilDate, &input.ObjectLockLegalHoldStatus)
+	input.ServerSideEncryption = opts.Encryption.algorithm()
+	input.SSEKMSKeyId = opts.Encryption.keyID()
+	input.SSECustomerAlgorithm = opts.Encryption.customerAlgorithm()
+	input.SSECustomerKey = opts.Encryption.customerKey()
+	input.SSECustomerKeyMD5 = opts.Encryption.customerKeyMD5()
+	if opts.DryRun {
+		return nil
+	}
+	_, err := mys3Conn.Upload(ctx, &input, opts.Parts)
+	return err
+}
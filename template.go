@@ -0,0 +1,77 @@
+package s3
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// OutputTemplate lays out downloaded keys locally, such as
+// {bucket}/{dirname}/{basename}. Placeholders are:
+//
+//	{bucket}    the bucket
+//	{key}       the full key
+//	{relative}  the key relative to the url given
+//	{dirname}   the key up to the last /
+//	{basename}  the key after the last /
+//	{stem}      the basename without its extension
+//	{ext}       the extension, including the .
+//	{yyyy} {mm} {dd}  the date the key was last modified (UTC)
+type OutputTemplate struct {
+	template string
+}
+
+var rePlaceholder = regexp.MustCompile(`\{([a-z]*)\}`)
+
+var templatePlaceholders = map[string]bool{
+	"bucket": true, "key": true, "relative": true, "dirname": true, "basename": true,
+	"stem": true, "ext": true, "yyyy": true, "mm": true, "dd": true,
+}
+
+// ParseOutputTemplate checks template only uses known placeholders.
+func ParseOutputTemplate(template string) (*OutputTemplate, error) {
+	for _, match := range rePlaceholder.FindAllStringSubmatch(template, -1) {
+		if !templatePlaceholders[match[1]] {
+			return nil, fmt.Errorf("invalid --output-template: unknown placeholder %s", match[0])
+		}
+	}
+	return &OutputTemplate{template: template}, nil
+}
+
+// Expand returns the local path for file. Keys with .. in them are refused,
+// so they can't lead outside the layout.
+func (t *OutputTemplate) Expand(file File) (string, error) {
+	s3f, ok := file.(*S3File)
+	if !ok {
+		return "", errors.New("s3:// url required")
+	}
+	key := aws.ToString(s3f.object.Key)
+	for _, segment := range strings.Split(key, "/") {
+		if segment == ".." {
+			return "", fmt.Errorf("%s: refusing to expand a key containing ..", file)
+		}
+	}
+	dirname, basename := path.Split(key)
+	ext := path.Ext(basename)
+	modified := aws.ToTime(s3f.object.LastModified).UTC()
+	values := map[string]string{
+		"bucket":   s3f.bucket,
+		"key":      key,
+		"relative": file.Relative(),
+		"dirname":  strings.TrimSuffix(dirname, "/"),
+		"basename": basename,
+		"stem":     strings.TrimSuffix(basename, ext),
+		"ext":      ext,
+		"yyyy":     modified.Format("2006"),
+		"mm":       modified.Format("01"),
+		"dd":       modified.Format("02"),
+	}
+	expanded := rePlaceholder.ReplaceAllStringFunc(t.template, func(placeholder string) string {
+		return values[strings.Trim(placeholder, "{}")]
+	})
+	return path.Clean(expanded), nil
+}
@@ -0,0 +1,132 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/barnybug/s3/pkg/mys3"
+)
+
+// maxCopySize is the largest object CopyObject copies in one request.
+const maxCopySize = 5 * 1024 * 1024 * 1024
+
+// ParseAge parses an age such as 90d, 12h or 1h30m. Days are in addition to
+// the units time.ParseDuration accepts.
+func ParseAge(value string) (time.Duration, error) {
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if err != nil || days < 0 {
+			return 0, fmt.Errorf("invalid age %q", value)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	age, err := time.ParseDuration(value)
+	if err != nil || age < 0 {
+		return 0, fmt.Errorf("invalid age %q", value)
+	}
+	return age, nil
+}
+
+// ParseStorageClass checks name is a storage class, ignoring case.
+func ParseStorageClass(name string) (string, error) {
+	class := strings.ToUpper(name)
+	for _, known := range types.StorageClass("").Values() {
+		if class == string(known) {
+			return class, nil
+		}
+	}
+	return "", fmt.Errorf("unknown storage class %q", name)
+}
+
+// TierOptions configure RunTier.
+type TierOptions struct {
+	CommonOptions
+	FilesystemOptions
+	OlderThan    time.Duration // only keys last modified at least this long ago
+	StorageClass string        // storage class to transition to
+}
+
+// RunTier transitions the keys under each url older than OlderThan to
+// another storage class, by copying each in place, for buckets without
+// lifecycle rules. Transitioned keys are printed as T s3://bucket/key.
+func RunTier(ctx context.Context, conn S3API, mys3Conn mys3.Mys3, urls []string, opts TierOptions) error {
+	for _, u := range urls {
+		if !isS3Url(u) {
+			return errors.New("s3:// url required")
+		}
+	}
+	if opts.StorageClass == "" {
+		return errors.New("--to storage class is required")
+	}
+	storageClass, err := ParseStorageClass(opts.StorageClass)
+	if err != nil {
+		return err
+	}
+	cutoff := time.Now().Add(-opts.OlderThan)
+
+	var mu sync.Mutex
+	var transitioned, skipped int
+	err = iterateKeysParallel(ctx, conn, urls, opts.Parallel, opts.FilesystemOptions, func(file File) error {
+		s3f, ok := file.(*S3File)
+		if !ok || file.IsDirectory() {
+			return nil
+		}
+		object := s3f.object
+		current := string(object.StorageClass)
+		if current == "" {
+			current = string(types.StorageClassStandard)
+		}
+		mu.Lock()
+		if current == storageClass || aws.ToTime(object.LastModified).After(cutoff) {
+			skipped += 1
+			mu.Unlock()
+			return nil
+		}
+		url := fmt.Sprintf("s3://%s/%s", s3f.bucket, *object.Key)
+		if !opts.Quiet {
+			fmt.Fprintf(outOf(ctx), "T %s\n", url)
+		}
+		transitioned += 1
+		mu.Unlock()
+		if opts.DryRun {
+			return nil
+		}
+		err := transitionObject(ctx, conn, s3f.bucket, *object.Key, aws.ToInt64(object.Size), storageClass)
+		if err != nil && opts.IgnoreErrors {
+			fmt.Fprintf(errOutOf(ctx), "E %s: %s\n", url, err)
+			return nil
+		}
+		return err
+	}, mys3Conn)
+	if err != nil && err != ErrNotFound {
+		return err
+	}
+	if !opts.Quiet {
+		fmt.Fprintf(outOf(ctx), "\n%d transitioned %d skipped\n", transitioned, skipped)
+	}
+	return nil
+}
+
+// transitionObject copies a key onto itself with a new storage class,
+// keeping its metadata and headers.
+func transitionObject(ctx context.Context, conn S3API, bucket, key string, size int64, storageClass string) error {
+	if size > maxCopySize {
+		return fmt.Errorf("%d bytes is too large to copy in place", size)
+	}
+	_, err := conn.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:            aws.String(bucket),
+		Key:               aws.String(key),
+		CopySource:        aws.String(escapeCopySource(bucket, key)),
+		MetadataDirective: types.MetadataDirectiveCopy,
+		StorageClass:      types.StorageClass(storageClass),
+	})
+	return err
+}
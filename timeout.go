@@ -0,0 +1,52 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// requestTimeout is how long a request may wait on the endpoint with
+// --timeout, so a request hung on a flaky endpoint fails, and is retried,
+// rather than stalling the command for good.
+type requestTimeout time.Duration
+
+// install adds the middleware failing requests whose response body stalls
+// for longer than the timeout. Connecting and awaiting the response are
+// limited by the client of newHTTPClient, leaving a body that keeps
+// arriving, such as a large download, as long as it takes.
+func (t requestTimeout) install(stack *middleware.Stack) error {
+	timeout := middleware.DeserializeMiddlewareFunc("s3.RequestTimeout", func(ctx context.Context, in middleware.DeserializeInput, next middleware.DeserializeHandler) (middleware.DeserializeOutput, middleware.Metadata, error) {
+		out, metadata, err := next.HandleDeserialize(ctx, in)
+		if resp, ok := out.RawResponse.(*smithyhttp.Response); ok && resp.Body != nil {
+			resp.Body = &readTimeoutBody{body: resp.Body, timeout: time.Duration(t)}
+		}
+		return out, metadata, err
+	})
+	// innermost, so the body is wrapped before it's deserialized
+	return stack.Deserialize.Add(timeout, middleware.After)
+}
+
+// readTimeoutBody is a response body failing a read that waits longer than
+// timeout, closing the body to give up on it.
+type readTimeoutBody struct {
+	body    io.ReadCloser
+	timeout time.Duration
+}
+
+func (b *readTimeoutBody) Read(p []byte) (int, error) {
+	timer := time.AfterFunc(b.timeout, func() { b.body.Close() })
+	n, err := b.body.Read(p)
+	if !timer.Stop() {
+		return n, fmt.Errorf("read of response body timed out after %s", b.timeout)
+	}
+	return n, err
+}
+
+func (b *readTimeoutBody) Close() error {
+	return b.body.Close()
+}
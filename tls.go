@@ -0,0 +1,64 @@
+package s3
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+// newHTTPClient returns the client of the --ca-bundle,
+// --insecure-skip-verify and --timeout flags, its connections tuned by
+// tuning. The CAs of the bundle are trusted as well as the system's, for
+// https endpoints such as self-hosted MinIO or Ceph with certificates signed
+// by a private CA. With a timeout, connecting and awaiting a response each
+// give up after it, failing the attempt for the sdk to retry. It returns nil,
+// for the default client, without any of the flags.
+func newHTTPClient(caBundle string, insecureSkipVerify bool, timeout time.Duration, tuning TransportOptions) (*http.Client, error) {
+	if caBundle == "" && !insecureSkipVerify && timeout == 0 && tuning == (TransportOptions{}) {
+		return nil, nil
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if caBundle != "" || insecureSkipVerify {
+		config := &tls.Config{InsecureSkipVerify: insecureSkipVerify}
+		if caBundle != "" {
+			pem, err := ioutil.ReadFile(caBundle)
+			if err != nil {
+				return nil, err
+			}
+			pool, err := x509.SystemCertPool()
+			if err != nil {
+				pool = x509.NewCertPool()
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("--ca-bundle %q has no pem certificates", caBundle)
+			}
+			config.RootCAs = pool
+		}
+		transport.TLSClientConfig = config
+	}
+	if timeout > 0 {
+		transport.TLSHandshakeTimeout = timeout
+		transport.ResponseHeaderTimeout = timeout
+	}
+	tuning.apply(transport, timeout)
+	return &http.Client{Transport: transport}, nil
+}
+
+// loadConfig returns the sdk's config loaded as optFns ask, whose clients
+// make requests with client, or the default client if nil. The client is set
+// once the config is loaded, as the sdk would otherwise replace its CAs with
+// those of AWS_CA_BUNDLE.
+func loadConfig(ctx context.Context, client *http.Client, optFns ...func(*config.LoadOptions) error) (aws.Config, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, optFns...)
+	if err == nil && client != nil {
+		cfg.HTTPClient = client
+	}
+	return cfg, err
+}
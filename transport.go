@@ -0,0 +1,63 @@
+package s3
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+// defaultKeepAlive is the interval of TCP keep-alive probes without
+// --keep-alive, as go's default transport has it.
+const defaultKeepAlive = 30 * time.Second
+
+// TransportOptions tune the connections of the http client, of the
+// --max-idle-conns, --max-conns-per-host, --idle-conn-timeout, --keep-alive
+// and --connect-timeout flags. Go keeps only 2 idle connections to a host,
+// so a highly parallel sync against a single endpoint, such as MinIO, keeps
+// connecting again unless MaxIdleConns is raised. The zero value leaves go's
+// defaults.
+type TransportOptions struct {
+	MaxIdleConns    int           // idle connections kept for reuse, to each endpoint as well as in all
+	MaxConnsPerHost int           // connections to an endpoint at once, 0 for no limit
+	IdleConnTimeout time.Duration // how long an idle connection is kept
+	KeepAlive       time.Duration // between TCP keep-alive probes, negative for none
+	ConnectTimeout  time.Duration // of connecting, TLS handshake included, rather than --timeout
+}
+
+// check returns an error if a count or a timeout is negative.
+func (t TransportOptions) check() error {
+	if t.MaxIdleConns < 0 || t.MaxConnsPerHost < 0 {
+		return errors.New("--max-idle-conns and --max-conns-per-host can't be negative")
+	}
+	if t.IdleConnTimeout < 0 || t.ConnectTimeout < 0 {
+		return errors.New("--idle-conn-timeout and --connect-timeout can't be negative")
+	}
+	return nil
+}
+
+// apply sets the options on transport, connecting with a dialer giving up
+// after timeout, if any, unless ConnectTimeout is set.
+func (t TransportOptions) apply(transport *http.Transport, timeout time.Duration) {
+	if t.ConnectTimeout > 0 {
+		timeout = t.ConnectTimeout
+		transport.TLSHandshakeTimeout = t.ConnectTimeout
+	}
+	if timeout > 0 || t.KeepAlive != 0 {
+		dialer := &net.Dialer{Timeout: timeout, KeepAlive: defaultKeepAlive}
+		if t.KeepAlive != 0 {
+			dialer.KeepAlive = t.KeepAlive
+		}
+		transport.DialContext = dialer.DialContext
+	}
+	if t.MaxIdleConns > 0 {
+		transport.MaxIdleConns = t.MaxIdleConns
+		transport.MaxIdleConnsPerHost = t.MaxIdleConns
+	}
+	if t.MaxConnsPerHost > 0 {
+		transport.MaxConnsPerHost = t.MaxConnsPerHost
+	}
+	if t.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = t.IdleConnTimeout
+	}
+}
@@ -0,0 +1,143 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// Features lists the optional capabilities built into this version, for bug
+// reports.
+var Features = []string{
+	"symlinks",
+	"preserve",
+	"manifest",
+	"multipart-etag",
+	"adaptive",
+}
+
+// VersionOptions configure RunVersion.
+type VersionOptions struct {
+	Verbose bool // include build details and probe the endpoint
+}
+
+// RunVersion reports the version, and with Verbose, build details and the
+// capabilities of the endpoint serving url (if given).
+func RunVersion(ctx context.Context, conn S3API, url string, opts VersionOptions) error {
+	fmt.Fprintf(outOf(ctx), "s3 version %s\n", version)
+	if !opts.Verbose {
+		return nil
+	}
+	fmt.Fprintf(outOf(ctx), "go: %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	if info, ok := debug.ReadBuildInfo(); ok {
+		fmt.Fprintf(outOf(ctx), "module: %s %s\n", info.Main.Path, info.Main.Version)
+	}
+	fmt.Fprintf(outOf(ctx), "aws-sdk-go-v2: %s\n", aws.SDKVersion)
+	fmt.Fprintf(outOf(ctx), "features: %s\n", strings.Join(Features, ", "))
+	if url == "" {
+		return nil
+	}
+	if !isS3Url(url) {
+		return fmt.Errorf("s3:// url required")
+	}
+	bucket, _ := extractBucketPath(url)
+	fmt.Fprintf(outOf(ctx), "endpoint capabilities (s3://%s/):\n", bucket)
+	for _, probe := range capabilityProbes {
+		fmt.Fprintf(outOf(ctx), "  %s: %s\n", probe.name, probe.probe(ctx, conn, bucket))
+	}
+	return nil
+}
+
+var capabilityProbes = []struct {
+	name  string
+	probe func(ctx context.Context, conn S3API, bucket string) string
+}{
+	{"list-objects-v2", probeListV2},
+	{"tagging", probeTagging},
+	{"object-lock", probeObjectLock},
+	{"checksums", probeChecksums},
+}
+
+// probeResult interprets the error from a probe request. Errors with one of
+// the given codes mean the feature is supported but not configured.
+func probeResult(err error, unconfigured ...string) string {
+	if err == nil {
+		return "supported"
+	}
+	var respErr *smithyhttp.ResponseError
+	if errors.As(err, &respErr) && respErr.HTTPStatusCode() == 501 {
+		return "not supported"
+	}
+	var aerr smithy.APIError
+	if errors.As(err, &aerr) {
+		if aerr.ErrorCode() == "NotImplemented" {
+			return "not supported"
+		}
+		for _, code := range unconfigured {
+			if aerr.ErrorCode() == code {
+				return "supported (not configured)"
+			}
+		}
+	}
+	return fmt.Sprintf("unknown (%s)", err)
+}
+
+func probeListV2(ctx context.Context, conn S3API, bucket string) string {
+	_, err := conn.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+		Bucket:  aws.String(bucket),
+		MaxKeys: aws.Int32(1),
+	})
+	return probeResult(err)
+}
+
+func probeTagging(ctx context.Context, conn S3API, bucket string) string {
+	_, err := conn.GetBucketTagging(ctx, &s3.GetBucketTaggingInput{
+		Bucket: aws.String(bucket),
+	})
+	return probeResult(err, "NoSuchTagSet", "NoSuchTagSetError")
+}
+
+func probeObjectLock(ctx context.Context, conn S3API, bucket string) string {
+	_, err := conn.GetObjectLockConfiguration(ctx, &s3.GetObjectLockConfigurationInput{
+		Bucket: aws.String(bucket),
+	})
+	return probeResult(err, "ObjectLockConfigurationNotFoundError")
+}
+
+// probeChecksums asks for the additional checksums of an existing key and
+// looks for them in the response headers.
+func probeChecksums(ctx context.Context, conn S3API, bucket string) string {
+	output, err := conn.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+		Bucket:  aws.String(bucket),
+		MaxKeys: aws.Int32(1),
+	})
+	if err != nil {
+		return probeResult(err)
+	}
+	if output == nil || len(output.Contents) == 0 {
+		return "unknown (bucket is empty)"
+	}
+	head, err := conn.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:       aws.String(bucket),
+		Key:          output.Contents[0].Key,
+		ChecksumMode: types.ChecksumModeEnabled,
+	})
+	if err != nil {
+		return probeResult(err)
+	}
+	for _, checksum := range []*string{head.ChecksumCRC32, head.ChecksumCRC32C, head.ChecksumSHA1, head.ChecksumSHA256} {
+		if checksum != nil {
+			return "supported"
+		}
+	}
+	return "unknown (no checksum returned)"
+}
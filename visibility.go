@@ -0,0 +1,52 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// visibilityPollInterval is the delay between checks that an upload has
+// become visible
+const visibilityPollInterval = 100 * time.Millisecond
+
+// waitVisible polls for an uploaded key until it is listed with the size and
+// md5 uploaded, for stores that are only eventually consistent. Gives up with
+// an error after the Visibility timeout.
+func (s3fs *S3Filesystem) waitVisible(ctx context.Context, src File, key string, size int64, checksum string) error {
+	start := time.Now()
+	deadline := start.Add(s3fs.opts.Visibility)
+	var seen string
+	for {
+		output, err := s3fs.conn.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket:               aws.String(s3fs.bucket),
+			Key:                  aws.String(key),
+			SSECustomerAlgorithm: s3fs.opts.Encryption.customerAlgorithm(),
+			SSECustomerKey:       s3fs.opts.Encryption.customerKey(),
+			SSECustomerKeyMD5:    s3fs.opts.Encryption.customerKeyMD5(),
+		})
+		if err == nil {
+			md5 := metadataValue(output.Metadata, "md5_checksum")
+			if md5 == "" {
+				md5 = strings.Trim(aws.ToString(output.ETag), `"`)
+			}
+			if aws.ToInt64(output.ContentLength) == size && md5 == checksum {
+				if waited := time.Since(start); waited >= visibilityPollInterval {
+					s3fs.opts.Progress.Visible(src, waited)
+				}
+				return nil
+			}
+			seen = fmt.Sprintf("size %d md5 %s", aws.ToInt64(output.ContentLength), md5)
+		} else {
+			seen = err.Error()
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s not visible after %s (last saw %s)", key, s3fs.opts.Visibility, seen)
+		}
+		time.Sleep(visibilityPollInterval)
+	}
+}